@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"expvar"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"runtime/debug"
+	"time"
+
+	"github.com/nwah/fujisuite-server/nav"
+)
+
+func init() {
+	expvar.Publish("goroutines", expvar.Func(func() any { return runtime.NumGoroutine() }))
+}
+
+// gcStats is the /debug/gc response: heap use and recent garbage collections
+type gcStats struct {
+	Goroutines   int       `json:"goroutines"`
+	HeapAlloc    uint64    `json:"heapAlloc"`   // Bytes of live and not yet collected heap objects
+	HeapInuse    uint64    `json:"heapInuse"`   // Bytes in in-use heap spans
+	HeapObjects  uint64    `json:"heapObjects"` // Allocated heap objects
+	Sys          uint64    `json:"sys"`         // Bytes obtained from the OS
+	NumGC        int64     `json:"numGC"`
+	LastGC       time.Time `json:"lastGC"`
+	PauseTotal   string    `json:"pauseTotal"`
+	RecentPauses []string  `json:"recentPauses"` // Most recent first
+}
+
+// adminHandler serves runtime diagnostics: pprof profiles under /debug/pprof/,
+// expvar variables at /debug/vars, GC stats at /debug/gc, and request, upstream,
+// and cache stats at /admin/stats
+func adminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+	mux.HandleFunc("/debug/gc", handleGCStats)
+	mux.HandleFunc("/admin/stats", nav.HandleStats)
+	return mux
+}
+
+// handleGCStats reports memory use and the last few GC pauses
+func handleGCStats(w http.ResponseWriter, r *http.Request) {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	var gc debug.GCStats
+	debug.ReadGCStats(&gc)
+
+	stats := gcStats{
+		Goroutines:  runtime.NumGoroutine(),
+		HeapAlloc:   mem.HeapAlloc,
+		HeapInuse:   mem.HeapInuse,
+		HeapObjects: mem.HeapObjects,
+		Sys:         mem.Sys,
+		NumGC:       gc.NumGC,
+		LastGC:      gc.LastGC,
+		PauseTotal:  gc.PauseTotal.String(),
+	}
+	for i, pause := range gc.Pause {
+		if i == 10 {
+			break
+		}
+		stats.RecentPauses = append(stats.RecentPauses, pause.String())
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
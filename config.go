@@ -1,38 +1,287 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 
 	"github.com/BurntSushi/toml"
 	"github.com/nwah/fujisuite-server/nav"
+	"gopkg.in/yaml.v3"
 )
 
 // Config holds the application configuration
 type Config struct {
-	Port string        `toml:"port"`
-	Nav  nav.NavConfig `toml:"nav"`
+	Port            string        `toml:"port"`
+	Listen          []string      `toml:"listen"`           // More addresses to serve HTTP on as well as port, e.g. ["0.0.0.0:8080", "[::]:8080"]
+	ListenUnix      string        `toml:"listen_unix"`      // Optional unix socket path to serve plain HTTP on, as well as or instead of port
+	ListenUnixMode  string        `toml:"listen_unix_mode"` // Octal permissions for the socket, e.g. "0660"
+	LinePort        string        `toml:"line_port"`        // Optional address for the raw TCP line protocol, e.g. ":8023"
+	LineListen      []string      `toml:"line_listen"`      // More addresses for the line protocol as well as line_port
+	AdminPort       string        `toml:"admin_port"`       // Optional loopback address for pprof and runtime stats, e.g. "127.0.0.1:6060"
+	ReadTimeout     int           `toml:"read_timeout"`     // in seconds, to read a whole request including its body
+	WriteTimeout    int           `toml:"write_timeout"`    // in seconds, from the end of the request to the end of the response
+	IdleTimeout     int           `toml:"idle_timeout"`     // in seconds, to wait for the next request on a keep-alive connection
+	MaxHeaderBytes  int           `toml:"max_header_bytes"` // Largest request header accepted
+	MaxBodyBytes    int           `toml:"max_body_bytes"`   // Largest request body accepted, such as a POST or GPX upload
+	ShutdownTimeout int           `toml:"shutdown_timeout"` // in seconds, how long in-flight requests get to finish on shutdown
+	LogLevel        string        `toml:"log_level"`        // debug, info, warn, or error
+	TLSCert         string        `toml:"tls_cert"`         // Path to a PEM certificate chain, to serve HTTPS on port
+	TLSKey          string        `toml:"tls_key"`          // Path to the certificate's PEM private key
+	HTTPRedirect    string        `toml:"http_redirect"`    // Optional address to redirect plain HTTP to HTTPS from, e.g. ":80"
+	ACMEDomains     []string      `toml:"acme_domains"`     // Domains to get certificates for from Let's Encrypt, instead of tls_cert
+	ACMECacheDir    string        `toml:"acme_cache_dir"`   // Directory certificates from Let's Encrypt are kept in
+	ACMEEmail       string        `toml:"acme_email"`       // Optional contact for certificate expiry notices
+	LogFormat       string        `toml:"log_format"`       // text or json
+	Tracing         TracingConfig `toml:"tracing"`
+	Nav             nav.NavConfig `toml:"nav"`
 }
 
 var config Config
 
-// LoadConfig loads the configuration from a TOML file
+// LoadConfig loads the configuration from a TOML, YAML, or JSON file, chosen by
+// its extension, and applies command-line flag overrides
 func LoadConfig(filename string) error {
-	if _, err := toml.DecodeFile(filename, &config); err != nil {
-		return fmt.Errorf("error decoding config file: %v", err)
+	c, err := readConfig(filename)
+	if err != nil {
+		return err
+	}
+	if err := applyFlags(&c); err != nil {
+		return err
+	}
+	config = c
+	return nil
+}
+
+// applyFlags overrides config file settings with any given on the command line
+func applyFlags(c *Config) error {
+	if *portFlag != "" {
+		c.Port = *portFlag
+		if !strings.Contains(c.Port, ":") {
+			c.Port = ":" + c.Port
+		}
+	}
+	if *logLevelFlag != "" {
+		if _, err := parseLogLevel(*logLevelFlag); err != nil {
+			return err
+		}
+		c.LogLevel = *logLevelFlag
+	}
+	return nil
+}
+
+// configFiles are the config file names looked for at startup, in order
+var configFiles = []string{"config.toml", "config.yaml", "config.yml", "config.json"}
+
+// findConfigFile returns the first config file that exists, or config.toml
+// for the error when there are none
+func findConfigFile() string {
+	for _, filename := range configFiles {
+		if _, err := os.Stat(filename); err == nil {
+			return filename
+		}
+	}
+	return configFiles[0]
+}
+
+// readConfig decodes a TOML, YAML, or JSON config file by its extension,
+// validating it and filling in defaults
+func readConfig(filename string) (Config, error) {
+	var c Config
+	if err := decodeConfigFile(filename, &c); err != nil {
+		return Config{}, fmt.Errorf("error decoding config file: %v", err)
 	}
 
 	// Validate required fields
-	if config.Port == "" {
-		config.Port = ":8080" // Default port
+	if c.Port == "" && c.ListenUnix == "" && len(c.Listen) == 0 {
+		c.Port = ":8080" // Default port
+	}
+	if c.ListenUnixMode == "" {
+		c.ListenUnixMode = "0660"
+	}
+	if _, err := strconv.ParseUint(c.ListenUnixMode, 8, 32); err != nil {
+		return Config{}, fmt.Errorf("listen_unix_mode must be octal permissions like \"0660\"")
+	}
+	if c.ReadTimeout <= 0 {
+		c.ReadTimeout = 30
+	}
+	if c.WriteTimeout <= 0 {
+		c.WriteTimeout = 60
+	}
+	if c.IdleTimeout <= 0 {
+		c.IdleTimeout = 120
+	}
+	if c.MaxHeaderBytes <= 0 {
+		c.MaxHeaderBytes = 16 << 10
+	}
+	if c.MaxBodyBytes <= 0 {
+		c.MaxBodyBytes = 1 << 20
+	}
+	if (c.TLSCert == "") != (c.TLSKey == "") {
+		return Config{}, fmt.Errorf("tls_cert and tls_key must be set together")
+	}
+	if len(c.ACMEDomains) > 0 && c.TLSCert != "" {
+		return Config{}, fmt.Errorf("acme_domains and tls_cert can't both be set")
+	}
+	if c.ACMECacheDir == "" {
+		c.ACMECacheDir = "acme-cache"
+	}
+	if err := checkListenAddrs("listen", c.HTTPAddrs()); err != nil {
+		return Config{}, err
+	}
+	if err := checkListenAddrs("line_listen", c.LineAddrs()); err != nil {
+		return Config{}, err
+	}
+	if c.TLSEnabled() && len(c.HTTPAddrs()) == 0 {
+		return Config{}, fmt.Errorf("TLS requires port or listen; listen_unix serves plain HTTP")
+	}
+	if c.AdminPort != "" {
+		host, _, err := net.SplitHostPort(c.AdminPort)
+		if ip := net.ParseIP(host); err != nil || host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+			return Config{}, fmt.Errorf("admin_port must be a loopback address like \"127.0.0.1:6060\" so diagnostics aren't public")
+		}
+	}
+	if c.HTTPRedirect != "" && !c.TLSEnabled() {
+		return Config{}, fmt.Errorf("http_redirect requires tls_cert and tls_key or acme_domains")
+	}
+	if _, err := parseLogLevel(c.LogLevel); err != nil {
+		return Config{}, err
+	}
+	switch c.LogFormat {
+	case "", "text", "json":
+	default:
+		return Config{}, fmt.Errorf("log_format must be text or json")
+	}
+	if c.ShutdownTimeout <= 0 {
+		c.ShutdownTimeout = 30
+	}
+	if c.Tracing.Endpoint != "" {
+		if u, err := url.Parse(c.Tracing.Endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return Config{}, fmt.Errorf("tracing.endpoint must be an http or https URL like \"http://localhost:4318\"")
+		}
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		return Config{}, fmt.Errorf("tracing.sample_ratio must be between 0 and 1")
+	}
+	if c.Tracing.SampleRatio == 0 {
+		c.Tracing.SampleRatio = 1
+	}
+	if c.Tracing.ServiceName == "" {
+		c.Tracing.ServiceName = "fujisuite-server"
+	}
+	if c.Nav.Upstream.Record != "" && c.Nav.Upstream.Replay != "" {
+		return Config{}, fmt.Errorf("nav.upstream.record and nav.upstream.replay can't both be set")
+	}
+	for service, limit := range c.Nav.Upstream.Concurrency {
+		if limit < 0 {
+			return Config{}, fmt.Errorf("nav.upstream.concurrency: %s must be 0 for unlimited or more", service)
+		}
 	}
-	if config.Nav.NominatimURL == "" {
-		return fmt.Errorf("nav.nominatim_url is required in config file")
+	switch c.Nav.Providers {
+	case "", nav.ProvidersMock:
+	default:
+		return Config{}, fmt.Errorf("nav.providers must be empty or %q", nav.ProvidersMock)
 	}
-	if config.Nav.ValhallaURL == "" {
-		return fmt.Errorf("nav.valhalla_url is required in config file")
+	mock := c.Nav.Providers == nav.ProvidersMock
+	if c.Nav.NominatimURL == "" && c.Nav.ModuleEnabled(nav.ModuleGeocode) && !mock {
+		return Config{}, fmt.Errorf("nav.nominatim_url is required in config file unless nav.geocode_enabled is false or nav.providers is mock")
+	}
+	// The public Nominatim instance requires identification and at most 1 request per second
+	if u, err := url.Parse(c.Nav.NominatimURL); err == nil && u.Host == nav.PublicNominatimHost {
+		if c.Nav.UserAgent == "" {
+			return Config{}, fmt.Errorf("nav.user_agent is required when using %s", nav.PublicNominatimHost)
+		}
+		if c.Nav.NominatimMaxQPS <= 0 || c.Nav.NominatimMaxQPS > 1 {
+			c.Nav.NominatimMaxQPS = 1
+		}
+	}
+	if c.Nav.ValhallaURL == "" && c.Nav.ModuleEnabled(nav.ModuleRouting) && !mock {
+		return Config{}, fmt.Errorf("nav.valhalla_url is required in config file unless nav.routing_enabled is false or nav.providers is mock")
+	}
+	if err := c.Nav.CheckEndpoints(); err != nil {
+		return Config{}, err
 	}
 
-	return nil
+	if c.Nav.What3WordsAPIKey != "" && c.Nav.What3WordsURL == "" {
+		c.Nav.What3WordsURL = "https://api.what3words.com/v3" // Default what3words API
+	}
+
+	return c, nil
+}
+
+// decodeConfigFile decodes a config file into c. YAML and JSON files use the
+// same keys as TOML, so they're converted to TOML and decoded the same way.
+func decodeConfigFile(filename string, c *Config) error {
+	ext := strings.ToLower(filepath.Ext(filename))
+	switch ext {
+	case ".toml":
+		_, err := toml.DecodeFile(filename, c)
+		return err
+	case ".yaml", ".yml", ".json":
+	default:
+		return fmt.Errorf("unsupported config format %q: use .toml, .yaml, .yml, or .json", ext)
+	}
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	var values map[string]interface{}
+	if ext == ".json" {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		err = decoder.Decode(&values)
+	} else {
+		err = yaml.Unmarshal(data, &values)
+	}
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(tomlValue(values)); err != nil {
+		return err
+	}
+	_, err = toml.Decode(buf.String(), c)
+	return err
+}
+
+// tomlValue prepares a decoded YAML or JSON value for the TOML encoder,
+// turning JSON numbers into integers or floats and dropping nulls
+func tomlValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		table := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			if value != nil {
+				table[key] = tomlValue(value)
+			}
+		}
+		return table
+	case []interface{}:
+		array := make([]interface{}, 0, len(v))
+		for _, value := range v {
+			if value != nil {
+				array = append(array, tomlValue(value))
+			}
+		}
+		return array
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		f, _ := v.Float64()
+		return f
+	default:
+		return v
+	}
 }
 
 // GetConfig returns the current configuration
@@ -44,3 +293,72 @@ func GetConfig() Config {
 func GetNavConfig() nav.NavConfig {
 	return config.Nav
 }
+
+// parseLogLevel reads the log_level setting, defaulting to info
+func parseLogLevel(level string) (slog.Level, error) {
+	switch strings.ToLower(level) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "", "info":
+		return slog.LevelInfo, nil
+	case "warn":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	default:
+		return 0, fmt.Errorf("log_level must be debug, info, warn, or error")
+	}
+}
+
+// NewLogger builds the logger described by the log_level and log_format settings
+func NewLogger() *slog.Logger {
+	level, _ := parseLogLevel(config.LogLevel)
+	options := &slog.HandlerOptions{Level: level}
+	if config.LogFormat == "json" {
+		return slog.New(slog.NewJSONHandler(os.Stderr, options))
+	}
+	return slog.New(slog.NewTextHandler(os.Stderr, options))
+}
+
+// UnixSocketMode returns the permissions for the listen_unix socket
+func (c Config) UnixSocketMode() os.FileMode {
+	mode, _ := strconv.ParseUint(c.ListenUnixMode, 8, 32)
+	return os.FileMode(mode)
+}
+
+// HTTPAddrs returns the TCP addresses HTTP is served on: port, then listen
+func (c Config) HTTPAddrs() []string {
+	if c.Port == "" {
+		return c.Listen
+	}
+	return append([]string{c.Port}, c.Listen...)
+}
+
+// LineAddrs returns the addresses the line protocol is served on: line_port,
+// then line_listen
+func (c Config) LineAddrs() []string {
+	if c.LinePort == "" {
+		return c.LineListen
+	}
+	return append([]string{c.LinePort}, c.LineListen...)
+}
+
+// checkListenAddrs reports addresses that aren't host:port or are repeated
+func checkListenAddrs(key string, addrs []string) error {
+	seen := make(map[string]bool, len(addrs))
+	for _, addr := range addrs {
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			return fmt.Errorf("%s: %q must be an address like \":8080\" or \"[::1]:8080\"", key, addr)
+		}
+		if seen[addr] {
+			return fmt.Errorf("%s: %q is listed more than once", key, addr)
+		}
+		seen[addr] = true
+	}
+	return nil
+}
+
+// TLSEnabled reports whether the server serves HTTPS
+func (c Config) TLSEnabled() bool {
+	return c.TLSCert != "" || len(c.ACMEDomains) > 0
+}
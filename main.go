@@ -1,29 +1,386 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
+	"log/slog"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"reflect"
+	"syscall"
+	"time"
 
 	"github.com/nwah/fujisuite-server/nav"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// Build metadata, injected with e.g.
+// go build -ldflags "-X main.version=1.2.0 -X main.commit=$(git rev-parse HEAD) -X main.buildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+var (
+	version   string
+	commit    string
+	buildDate string
+)
+
+// Command-line flags, which take precedence over the config file
+var (
+	configFlag      = flag.String("config", "", "path to a .toml, .yaml, .yml, or .json config file (default: config.toml, config.yaml, config.yml, or config.json)")
+	portFlag        = flag.String("port", "", "address to listen on, e.g. :8080 or 8080, overriding port")
+	logLevelFlag    = flag.String("log-level", "", "debug, info, warn, or error, overriding log_level")
+	checkConfigFlag = flag.Bool("check-config", false, "check the config file and API key file, then exit")
 )
 
 func main() {
+	flag.Parse()
+	nav.SetBuildInfo(nav.BuildInfo{Version: version, Commit: commit, BuildDate: buildDate})
+
 	// Load configuration
-	if err := LoadConfig("config.toml"); err != nil {
+	configFile := *configFlag
+	if configFile == "" {
+		configFile = findConfigFile()
+	}
+	if err := LoadConfig(configFile); err != nil {
 		log.Fatalf("Failed to load configuration: %v", err)
 	}
+	if *checkConfigFlag {
+		if err := nav.CheckConfig(GetNavConfig()); err != nil {
+			log.Fatalf("Invalid configuration: %v", err)
+		}
+		fmt.Printf("%s is valid\n", configFile)
+		return
+	}
+
+	// Log through slog at the configured level and format, including the
+	// log package's output
+	logger := NewLogger()
+	slog.SetDefault(logger)
+	nav.SetLogger(logger)
+
+	shutdownTracing, err := setupTracing(config.Tracing)
+	if err != nil {
+		slog.Error("Failed to set up tracing", "error", err)
+		os.Exit(1)
+	}
 
 	// Set nav config for the nav package
 	nav.SetConfig(GetNavConfig())
+	if err := nav.LoadAPIKeys(); err != nil {
+		slog.Error("Failed to load API keys", "error", err)
+		os.Exit(1)
+	}
 
-	// Register handlers under /nav path
-	http.HandleFunc("/nav/geocode", nav.HandleGeocode)
-	http.HandleFunc("/nav/route", nav.HandleRoute)
+	// Register handlers under /nav path, on a mux of their own so the debug
+	// handlers pprof and expvar add to http.DefaultServeMux stay private
+	mux := http.NewServeMux()
+	mux.HandleFunc("/nav/geocode", nav.HandleGeocode)
+	mux.HandleFunc("/nav/route", nav.HandleRoute)
+	mux.HandleFunc("/nav/route/bitmap", nav.HandleRouteBitmap)
+	mux.HandleFunc("/nav/route/", nav.HandleRouteQR)
+	mux.HandleFunc("/nav/staticmap", nav.HandleStaticMap)
+	mux.HandleFunc("/nav/progress", nav.HandleRouteProgress)
+	mux.HandleFunc("/nav/nearby", nav.HandleNearby)
+	mux.HandleFunc("/nav/zip", nav.HandlePostalCode)
+	mux.HandleFunc("/nav/whereami", nav.HandleWhereAmI)
+	mux.HandleFunc("/nav/admin", nav.HandleAdminArea)
+	mux.HandleFunc("/nav/stops", nav.HandleStops)
+	mux.HandleFunc("/nav/departures", nav.HandleDepartures)
+	mux.HandleFunc("/nav/transit/route", nav.HandleTransitRoute)
+	mux.HandleFunc("/nav/transit/stop", nav.HandleTransitStop)
+	mux.HandleFunc("/nav/transit/agencies", nav.HandleTransitAgencies)
+	mux.HandleFunc("/nav/transit/vehicles", nav.HandleTransitVehicles)
+	mux.HandleFunc("/nav/transit/alerts", nav.HandleTransitAlerts)
+	mux.HandleFunc("/nav/transit/coverage", nav.HandleTransitCoverage)
+	mux.HandleFunc("/nav/usage", nav.HandleUsage)
+
+	// Health checks for load balancers and containers
+	mux.HandleFunc("/healthz", nav.HandleHealth)
+	mux.HandleFunc("/readyz", nav.HandleReady)
+	mux.HandleFunc("/version", nav.HandleVersion)
+
+	// API description for client developers
+	mux.HandleFunc("/openapi.json", nav.HandleOpenAPI)
+	mux.HandleFunc("/docs", nav.HandleAPIDocs)
 
 	// Start server
 	config := GetConfig()
-	log.Printf("Starting server on port %s", config.Port)
-	if err := http.ListenAndServe(config.Port, nil); err != nil {
-		log.Fatalf("Server failed to start: %v", err)
+	// Timeouts keep slow or hung clients, such as stalled serial bridges, from
+	// holding connections open indefinitely
+	handler := nav.WithStats(nav.WithConfig(nav.WithRequestID(nav.WithTracing(nav.WithCORS(nav.WithAPIKey(nav.WithEnabledModules(nav.WithTextEncoding(http.MaxBytesHandler(mux, int64(config.MaxBodyBytes))))))))))
+	server := &http.Server{
+		Handler:        handler,
+		ReadTimeout:    time.Duration(config.ReadTimeout) * time.Second,
+		WriteTimeout:   time.Duration(config.WriteTimeout) * time.Second,
+		IdleTimeout:    time.Duration(config.IdleTimeout) * time.Second,
+		MaxHeaderBytes: config.MaxHeaderBytes,
+	}
+	// With acme_domains, certificates come from Let's Encrypt instead of files
+	var certManager *autocert.Manager
+	if len(config.ACMEDomains) > 0 {
+		certManager = &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(config.ACMEDomains...),
+			Cache:      autocert.DirCache(config.ACMECacheDir),
+			Email:      config.ACMEEmail,
+		}
+		server.TLSConfig = certManager.TLSConfig()
 	}
+	// Under systemd socket activation, serve the sockets it passes instead of
+	// binding port and listen, or line_port and line_listen
+	listeners, lineListeners, err := systemdListeners()
+	if err != nil {
+		slog.Error("Server failed to start", "error", err)
+		os.Exit(1)
+	}
+	// Bind every address before serving any, so a taken port stops startup
+	// rather than leaving the server half up
+	if len(listeners) == 0 {
+		for _, addr := range config.HTTPAddrs() {
+			listener, err := listenTCP(addr)
+			if err != nil {
+				slog.Error("Server failed to start", "port", addr, "error", err)
+				os.Exit(1)
+			}
+			listeners = append(listeners, listener)
+		}
+	}
+	for _, listener := range listeners {
+		go func(listener net.Listener) {
+			addr := listener.Addr().String()
+			slog.Info("Starting server", "port", addr, "tls", config.TLSEnabled())
+			var err error
+			if certManager != nil {
+				err = server.ServeTLS(listener, "", "")
+			} else if config.TLSEnabled() {
+				err = server.ServeTLS(listener, config.TLSCert, config.TLSKey)
+			} else {
+				err = server.Serve(listener)
+			}
+			if err != nil && !errors.Is(err, http.ErrServerClosed) {
+				slog.Error("Server failed", "port", addr, "error", err)
+				os.Exit(1)
+			}
+		}(listener)
+	}
+
+	// Optionally serve plain HTTP on a unix socket too, for a local reverse
+	// proxy or FujiNet bridge
+	if config.ListenUnix != "" {
+		listener, err := listenUnix(config.ListenUnix, config.UnixSocketMode())
+		if err != nil {
+			slog.Error("Server failed to start", "socket", config.ListenUnix, "error", err)
+			os.Exit(1)
+		}
+		go func() {
+			slog.Info("Starting server", "socket", config.ListenUnix)
+			if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				slog.Error("Server failed to start", "socket", config.ListenUnix, "error", err)
+				os.Exit(1)
+			}
+		}()
+	}
+
+	// Optionally serve the plain-text protocols over raw TCP, for serial and
+	// modem bridges without an HTTP stack
+	var lineServer *nav.LineServer
+	if len(lineListeners) == 0 {
+		for _, addr := range config.LineAddrs() {
+			listener, err := listenTCP(addr)
+			if err != nil {
+				slog.Error("Line protocol server failed to start", "port", addr, "error", err)
+				os.Exit(1)
+			}
+			lineListeners = append(lineListeners, listener)
+		}
+	}
+	if len(lineListeners) > 0 {
+		lineServer = &nav.LineServer{
+			Handler:      handler,
+			ReadTimeout:  time.Duration(config.ReadTimeout) * time.Second,
+			WriteTimeout: time.Duration(config.WriteTimeout) * time.Second,
+			IdleTimeout:  time.Duration(config.IdleTimeout) * time.Second,
+		}
+		for _, listener := range lineListeners {
+			go func(listener net.Listener) {
+				slog.Info("Starting line protocol server", "port", listener.Addr().String())
+				if err := lineServer.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+					slog.Error("Line protocol server failed", "error", err)
+					os.Exit(1)
+				}
+			}(listener)
+		}
+	}
+
+	// Optionally serve runtime diagnostics on a loopback-only admin port
+	var admin *http.Server
+	if config.AdminPort != "" {
+		admin = &http.Server{
+			Addr:           config.AdminPort,
+			Handler:        adminHandler(),
+			ReadTimeout:    time.Duration(config.ReadTimeout) * time.Second,
+			IdleTimeout:    time.Duration(config.IdleTimeout) * time.Second,
+			MaxHeaderBytes: config.MaxHeaderBytes,
+		}
+		go func() {
+			slog.Info("Starting admin server", "port", config.AdminPort)
+			if err := admin.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				slog.Error("Admin server failed to start", "error", err)
+				os.Exit(1)
+			}
+		}()
+	}
+
+	// Optionally send plain HTTP clients to HTTPS
+	var redirect *http.Server
+	if config.HTTPRedirect != "" {
+		handler := httpsRedirect(config.HTTPAddrs()[0])
+		if certManager != nil {
+			// Also answer Let's Encrypt's HTTP challenges
+			handler = certManager.HTTPHandler(handler)
+		}
+		redirect = &http.Server{
+			Addr:           config.HTTPRedirect,
+			Handler:        handler,
+			ReadTimeout:    time.Duration(config.ReadTimeout) * time.Second,
+			WriteTimeout:   time.Duration(config.WriteTimeout) * time.Second,
+			IdleTimeout:    time.Duration(config.IdleTimeout) * time.Second,
+			MaxHeaderBytes: config.MaxHeaderBytes,
+		}
+		go func() {
+			slog.Info("Redirecting HTTP to HTTPS", "port", config.HTTPRedirect)
+			if err := redirect.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				slog.Error("Redirect server failed to start", "error", err)
+				os.Exit(1)
+			}
+		}()
+	}
+
+	// On SIGINT or SIGTERM, stop accepting connections and let in-flight
+	// requests finish, up to the drain timeout
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// On SIGHUP, reload the configuration without restarting
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+
+	// Load data while the server is up, so /healthz answers and /readyz
+	// reports when it's done
+	if err := nav.Warm(); err != nil {
+		slog.Error("Failed to load GTFS feeds", "error", err)
+		os.Exit(1)
+	}
+	slog.Info("Server ready")
+
+	for ctx.Err() == nil {
+		select {
+		case <-reload:
+			reloadConfig(configFile)
+		case <-ctx.Done():
+		}
+	}
+	stop()
+	signal.Stop(reload)
+
+	slog.Info("Shutting down, waiting for requests to finish", "timeout", time.Duration(config.ShutdownTimeout)*time.Second)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Duration(config.ShutdownTimeout)*time.Second)
+	defer cancel()
+	if redirect != nil {
+		redirect.Shutdown(shutdownCtx)
+	}
+	if lineServer != nil {
+		lineServer.Shutdown(shutdownCtx)
+	}
+	if admin != nil {
+		admin.Shutdown(shutdownCtx)
+	}
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		slog.Error("Shutdown did not finish cleanly", "error", err)
+	}
+	// Send the spans of the last requests before exiting
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		slog.Warn("Failed to flush traces", "error", err)
+	}
+}
+
+// reloadConfig re-reads the config file and applies its [nav] settings,
+// keeping the running configuration if the file is invalid. Server settings
+// such as the port, timeouts, TLS, and logging only change on restart.
+func reloadConfig(filename string) {
+	newConfig, err := readConfig(filename)
+	if err == nil {
+		err = applyFlags(&newConfig)
+	}
+	if err != nil {
+		slog.Error("Config reload failed, keeping current configuration", "error", err)
+		return
+	}
+	if err := nav.ReloadConfig(newConfig.Nav); err != nil {
+		slog.Error("Config reload failed, keeping current configuration", "error", err)
+		return
+	}
+
+	server := newConfig
+	server.Nav = config.Nav
+	if !reflect.DeepEqual(server, config) {
+		slog.Warn("Server settings changed in config file; restart to apply them")
+	}
+	config.Nav = newConfig.Nav
+	slog.Info("Configuration reloaded")
+}
+
+// listenUnix listens on a unix socket with the given permissions, replacing a
+// stale socket left by an earlier run but not one that's still in use
+func listenUnix(path string, mode os.FileMode) (net.Listener, error) {
+	if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("%s is in use by another process", path)
+		}
+		os.Remove(path)
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
+
+// listenTCP listens on a TCP address. IPv4 and IPv6 addresses are bound to
+// their own family, so "0.0.0.0:8080" and "[::]:8080" can be listed together
+// rather than the IPv6 wildcard also claiming IPv4.
+func listenTCP(addr string) (net.Listener, error) {
+	network := "tcp"
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		if ip := net.ParseIP(host); ip != nil && ip.To4() != nil {
+			network = "tcp4"
+		} else if ip != nil {
+			network = "tcp6"
+		}
+	}
+	return net.Listen(network, addr)
+}
+
+// httpsRedirect permanently redirects requests to the same host and path over
+// HTTPS on the given listen address's port
+func httpsRedirect(httpsAddr string) http.Handler {
+	_, port, _ := net.SplitHostPort(httpsAddr)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(r.Host); err == nil {
+			host = h
+		}
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+	})
 }
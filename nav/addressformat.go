@@ -0,0 +1,138 @@
+package nav
+
+import (
+	"fmt"
+	"strings"
+)
+
+// addressLayout describes how the locality line of an address is arranged
+type addressLayout int
+
+const (
+	// layoutUS formats localities as "City, ST 12345"
+	layoutUS addressLayout = iota
+	// layoutUK formats localities as "City, POSTCODE" with no state
+	layoutUK
+	// layoutEU formats localities as "12345 City" with no state
+	layoutEU
+	// layoutJP formats localities as "Prefecture City 123-4567"
+	layoutJP
+)
+
+// addressFormat holds the country-specific address conventions
+type addressFormat struct {
+	Layout           addressLayout
+	NumberAfterRoad  bool // e.g. "Hauptstraße 5" instead of "5 Hauptstraße"
+	AbbreviateStreet bool // Apply street type and direction abbreviations
+	AbbreviateState  bool // Apply state abbreviations
+}
+
+var (
+	usAddressFormat = addressFormat{Layout: layoutUS, AbbreviateStreet: true, AbbreviateState: true}
+
+	// Countries not listed here fall back to US-style ordering without abbreviations
+	defaultAddressFormat = addressFormat{Layout: layoutUS}
+
+	// Maps two-letter ISO country codes to their address conventions
+	addressFormats = map[string]addressFormat{
+		"us": usAddressFormat,
+		"ca": {Layout: layoutUS, AbbreviateStreet: true},
+		"au": {Layout: layoutUS, AbbreviateStreet: true},
+		"gb": {Layout: layoutUK, AbbreviateStreet: true},
+		"ie": {Layout: layoutUK, AbbreviateStreet: true},
+		"nz": {Layout: layoutUK, AbbreviateStreet: true},
+		"de": {Layout: layoutEU, NumberAfterRoad: true},
+		"at": {Layout: layoutEU, NumberAfterRoad: true},
+		"ch": {Layout: layoutEU, NumberAfterRoad: true},
+		"nl": {Layout: layoutEU, NumberAfterRoad: true},
+		"be": {Layout: layoutEU, NumberAfterRoad: true},
+		"dk": {Layout: layoutEU, NumberAfterRoad: true},
+		"no": {Layout: layoutEU, NumberAfterRoad: true},
+		"se": {Layout: layoutEU, NumberAfterRoad: true},
+		"fi": {Layout: layoutEU, NumberAfterRoad: true},
+		"pl": {Layout: layoutEU, NumberAfterRoad: true},
+		"cz": {Layout: layoutEU, NumberAfterRoad: true},
+		"it": {Layout: layoutEU, NumberAfterRoad: true},
+		"es": {Layout: layoutEU, NumberAfterRoad: true},
+		"pt": {Layout: layoutEU, NumberAfterRoad: true},
+		"fr": {Layout: layoutEU},
+		"lu": {Layout: layoutEU},
+		"jp": {Layout: layoutJP},
+	}
+)
+
+// lookupAddressFormat returns the address conventions for a country code.
+// Addresses with no country keep the original US formatting.
+func lookupAddressFormat(country string) addressFormat {
+	country = strings.ToLower(country)
+	if country == "" {
+		return usAddressFormat
+	}
+	format, ok := addressFormats[country]
+	if !ok {
+		format = defaultAddressFormat
+	}
+
+	// Deployments can turn on abbreviations for more countries alongside their own dictionaries
+	for _, c := range abbreviations.Load().countries {
+		if strings.ToLower(c) == country {
+			format.AbbreviateStreet, format.AbbreviateState = true, true
+		}
+	}
+	return format
+}
+
+// streetAddress builds the street line, e.g. "123 N Main St" or "Hauptstraße 5"
+func (f addressFormat) streetAddress(addr nominatimAddress) string {
+	road := addr.Road
+	if f.AbbreviateStreet && road != "" {
+		road = abbreviateStreetName(road)
+	}
+
+	var streetParts []string
+	if f.NumberAfterRoad {
+		streetParts = []string{road, addr.HouseNumber}
+	} else {
+		streetParts = []string{addr.HouseNumber, road}
+	}
+	return joinNonEmpty(streetParts, " ")
+}
+
+// locality builds the city, state, and postal code portion of the address
+func (f addressFormat) locality(addr nominatimAddress, city string) string {
+	state := addr.State
+	if f.AbbreviateState && state != "" {
+		state = abbreviateState(state)
+	}
+
+	switch f.Layout {
+	case layoutUK:
+		return joinNonEmpty([]string{city, addr.PostCode}, ", ")
+	case layoutEU:
+		return joinNonEmpty([]string{addr.PostCode, city}, " ")
+	case layoutJP:
+		return joinNonEmpty([]string{state, city, addr.PostCode}, " ")
+	}
+
+	// Add state and zip in standard US format
+	var stateZip string
+	if state != "" && addr.PostCode != "" {
+		stateZip = fmt.Sprintf("%s %s", state, addr.PostCode)
+	} else if state != "" {
+		stateZip = state
+	} else {
+		stateZip = addr.PostCode
+	}
+	return joinNonEmpty([]string{city, stateZip}, ", ")
+}
+
+// joinNonEmpty joins the non-empty parts with the separator
+func joinNonEmpty(parts []string, sep string) string {
+	var nonEmpty []string
+	for _, part := range parts {
+		if part != "" {
+			nonEmpty = append(nonEmpty, part)
+		}
+	}
+	return strings.Join(nonEmpty, sep)
+}
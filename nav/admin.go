@@ -0,0 +1,55 @@
+package nav
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// adminLookupZoom is the Nominatim reverse zoom level for city-sized areas
+const adminLookupZoom = 10
+
+// adminCacheTTL is how long administrative area lookups are cached; boundaries rarely change
+const adminCacheTTL = 24 * time.Hour
+
+// adminCache holds recent lookups keyed by coordinates rounded to about 1km
+var adminCache = newTTLCache[*AdminAreaResponse]("admin", adminCacheTTL, DefaultCacheMaxEntries)
+
+// lookupAdminArea returns the city, county, state, and country containing a point
+func lookupAdminArea(ctx context.Context, lat, lng float64) (*AdminAreaResponse, error) {
+	key := fmt.Sprintf("%.2f,%.2f", lat, lng)
+	if area, ok := adminCache.get(key); ok {
+		return area, nil
+	}
+
+	result, err := reverseNominatim(ctx, lat, lng, adminLookupZoom)
+	if err != nil {
+		return nil, err
+	}
+
+	addr := result.Address
+	area := &AdminAreaResponse{
+		City:        cityName(addr),
+		County:      addr.County,
+		State:       addr.State,
+		StateCode:   stateCode(addr),
+		Country:     strings.ToLower(addr.Country),
+		CountryName: addr.CountryName,
+	}
+	adminCache.set(key, area)
+
+	return area, nil
+}
+
+// stateCode returns the short code for the state, e.g. IL, from its ISO 3166-2 code
+// when available, falling back to US state abbreviations
+func stateCode(addr nominatimAddress) string {
+	if _, subdivision, ok := strings.Cut(addr.ISO3166Lvl4, "-"); ok {
+		return subdivision
+	}
+	if abbrev := abbreviateState(addr.State); abbrev != addr.State {
+		return abbrev
+	}
+	return ""
+}
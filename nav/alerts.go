@@ -0,0 +1,228 @@
+package nav
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/MobilityData/gtfs-realtime-bindings/golang/gtfs"
+)
+
+// gtfsAlert is a service alert with its feed-qualified informed entities
+type gtfsAlert struct {
+	Alert    TransitAlert
+	Feed     string // Prefix of the local feed the alert belongs to, e.g. "cta:"
+	Entities []alertEntity
+}
+
+// alertEntity is one GTFS-RT informed entity. Fields that are set must all match.
+type alertEntity struct {
+	RouteID string
+	TripID  string
+	StopID  string
+}
+
+// alertTime formats a Unix time for an alert, or returns "" when it's unset
+func alertTime(unix int64) string {
+	if unix <= 0 {
+		return ""
+	}
+	return time.Unix(unix, 0).Format(time.RFC3339)
+}
+
+// translatedText picks the untranslated or English text from a GTFS-RT string
+func translatedText(ts *gtfs.TranslatedString) string {
+	translations := ts.GetTranslation()
+	for _, t := range translations {
+		if lang := t.GetLanguage(); lang == "" || strings.HasPrefix(lang, "en") {
+			return t.GetText()
+		}
+	}
+	if len(translations) > 0 {
+		return translations[0].GetText()
+	}
+	return ""
+}
+
+// isActive checks if an alert applies at a given time. Alerts without active
+// periods are in effect for as long as they're in the feed.
+func isActive(alert *gtfs.Alert, now time.Time) bool {
+	periods := alert.GetActivePeriod()
+	if len(periods) == 0 {
+		return true
+	}
+	ts := uint64(now.Unix())
+	for _, p := range periods {
+		if (p.GetStart() == 0 || p.GetStart() <= ts) && (p.GetEnd() == 0 || ts <= p.GetEnd()) {
+			return true
+		}
+	}
+	return false
+}
+
+// serviceAlerts returns the active alerts from all configured GTFS-Realtime feeds
+func serviceAlerts(ctx context.Context) ([]gtfsAlert, error) {
+	now := time.Now()
+	var alerts []gtfsAlert
+	for _, rt := range configFor(ctx).GTFSRealtime {
+		if rt.AlertsURL == "" {
+			continue
+		}
+		msg, err := fetchRealtime(ctx, rt.AlertsURL)
+		if err != nil {
+			return nil, err
+		}
+
+		prefix := rt.Feed + ":"
+		for _, entity := range msg.GetEntity() {
+			a := entity.GetAlert()
+			if a == nil || entity.GetIsDeleted() || !isActive(a, now) {
+				continue
+			}
+
+			alert := gtfsAlert{
+				Alert: TransitAlert{
+					Header:      translatedText(a.GetHeaderText()),
+					Description: translatedText(a.GetDescriptionText()),
+					Effect:      strings.ToLower(a.GetEffect().String()),
+					Cause:       strings.ToLower(a.GetCause().String()),
+					URL:         translatedText(a.GetUrl()),
+					Routes:      []string{},
+					Stops:       []string{},
+				},
+				Feed: prefix,
+			}
+			if periods := a.GetActivePeriod(); len(periods) > 0 {
+				alert.Alert.Start = alertTime(int64(periods[0].GetStart()))
+				alert.Alert.End = alertTime(int64(periods[0].GetEnd()))
+			}
+
+			for _, ie := range a.GetInformedEntity() {
+				e := alertEntity{}
+				if id := ie.GetRouteId(); id != "" {
+					e.RouteID = prefix + id
+					alert.Alert.Routes = appendUnique(alert.Alert.Routes, e.RouteID)
+				}
+				if id := ie.GetTrip().GetTripId(); id != "" {
+					e.TripID = prefix + id
+				}
+				if id := ie.GetStopId(); id != "" {
+					e.StopID = prefix + id
+					alert.Alert.Stops = appendUnique(alert.Alert.Stops, e.StopID)
+				}
+				alert.Entities = append(alert.Entities, e)
+			}
+
+			alerts = append(alerts, alert)
+		}
+	}
+	return alerts, nil
+}
+
+// appendUnique appends a string to a slice if it isn't already present
+func appendUnique(values []string, v string) []string {
+	for _, existing := range values {
+		if existing == v {
+			return values
+		}
+	}
+	return append(values, v)
+}
+
+// affects checks if an alert applies to a route, trip, or any of a set of stops.
+// An empty route or trip matches only entities that don't name one.
+func (a *gtfsAlert) affects(routeID, tripID string, stopIDs []string) bool {
+	hasStop := func(id string) bool {
+		for _, s := range stopIDs {
+			if s == id {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, e := range a.Entities {
+		switch {
+		case e.TripID != "":
+			if e.TripID == tripID {
+				return true
+			}
+		case e.RouteID != "" && e.StopID != "":
+			if e.RouteID == routeID && hasStop(e.StopID) {
+				return true
+			}
+		case e.RouteID != "":
+			if e.RouteID == routeID {
+				return true
+			}
+		case e.StopID != "":
+			if hasStop(e.StopID) {
+				return true
+			}
+		default:
+			// Agency-wide alerts apply to everything in the feed
+			if strings.HasPrefix(routeID, a.Feed) || (len(stopIDs) > 0 && strings.HasPrefix(stopIDs[0], a.Feed)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// alertsFor returns the active alerts affecting a route, trip, or stops
+func alertsFor(ctx context.Context, routeID, tripID string, stopIDs []string) ([]TransitAlert, error) {
+	alerts, err := serviceAlerts(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var matched []TransitAlert
+	for i := range alerts {
+		if alerts[i].affects(routeID, tripID, stopIDs) {
+			matched = append(matched, alerts[i].Alert)
+		}
+	}
+	return matched, nil
+}
+
+// transitAlerts returns the active alerts for a route or stop. Routes may be given by
+// ID or short name. With neither, all active alerts are returned.
+func transitAlerts(ctx context.Context, routeID, stopID string) ([]TransitAlert, error) {
+	if len(configFor(ctx).GTFSRealtime) == 0 {
+		return nil, fmt.Errorf("gtfs realtime not configured")
+	}
+
+	if routeID == "" && stopID == "" {
+		alerts, err := serviceAlerts(ctx)
+		if err != nil {
+			return nil, err
+		}
+		result := make([]TransitAlert, 0, len(alerts))
+		for _, a := range alerts {
+			result = append(result, a.Alert)
+		}
+		return result, nil
+	}
+
+	if routeID != "" {
+		if feed := currentGTFS(); feed != nil {
+			if route := feed.findRoute(routeID); route != nil {
+				routeID = route.ID
+			}
+		}
+	}
+
+	var stopIDs []string
+	if stopID != "" {
+		stopIDs = []string{stopID}
+	}
+	alerts, err := alertsFor(ctx, routeID, "", stopIDs)
+	if err != nil {
+		return nil, err
+	}
+	if alerts == nil {
+		alerts = []TransitAlert{}
+	}
+	return alerts, nil
+}
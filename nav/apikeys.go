@@ -0,0 +1,256 @@
+package nav
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// APIKeyHeader carries the API key for clients that can set headers; others
+// send it as the apikey query parameter
+const APIKeyHeader = "X-API-Key"
+
+// apiKeyExemptPaths are served without a key, for load balancers and
+// orchestrators, and so developers can read the API docs before getting one
+var apiKeyExemptPaths = map[string]bool{
+	"/healthz":      true,
+	"/readyz":       true,
+	"/openapi.json": true,
+	"/docs":         true,
+}
+
+// apiKey is a configured key with its rate limit and usage counters
+type apiKey struct {
+	name      string
+	rateLimit float64 // Requests per minute, 0 for unlimited
+
+	mu       sync.Mutex
+	tokens   float64   // Requests left in the bucket
+	refilled time.Time // When tokens was last topped up
+	requests int64
+	limited  int64
+}
+
+var (
+	apiKeysMu sync.RWMutex
+	apiKeys   map[string]*apiKey // By key, nil when authentication is off
+)
+
+type apiKeyContextKey struct{}
+
+// LoadAPIKeys sets up the keys from the config and api_key_file. With no keys
+// configured, authentication is off.
+func LoadAPIKeys() error {
+	keys, err := buildAPIKeys(*currentConfig())
+	if err != nil {
+		return err
+	}
+	setAPIKeys(keys)
+	return nil
+}
+
+// buildAPIKeys reads the keys configured in cfg, or nil when there are none
+func buildAPIKeys(cfg NavConfig) (map[string]*apiKey, error) {
+	configs := cfg.APIKeys
+	if cfg.APIKeyFile != "" {
+		fileKeys, err := loadAPIKeyFile(cfg.APIKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		configs = append(append([]APIKeyConfig(nil), configs...), fileKeys...)
+	}
+
+	var keys map[string]*apiKey
+	for _, key := range configs {
+		if key.Key == "" {
+			continue
+		}
+		if keys == nil {
+			keys = make(map[string]*apiKey)
+		}
+		rateLimit := key.RateLimit
+		if rateLimit <= 0 {
+			rateLimit = cfg.APIKeyRateLimit
+		}
+		name := key.Name
+		if name == "" {
+			name = "unnamed"
+		}
+		keys[key.Key] = &apiKey{name: name, rateLimit: rateLimit, tokens: rateLimit, refilled: time.Now()}
+	}
+	return keys, nil
+}
+
+// setAPIKeys replaces the keys requests are checked against, carrying over the
+// usage and remaining requests of keys that are kept
+func setAPIKeys(keys map[string]*apiKey) {
+	apiKeysMu.Lock()
+	for key, k := range keys {
+		if old, ok := apiKeys[key]; ok {
+			old.mu.Lock()
+			k.requests, k.limited = old.requests, old.limited
+			k.tokens, k.refilled = math.Min(old.tokens, k.rateLimit), old.refilled
+			old.mu.Unlock()
+		}
+	}
+	apiKeys = keys
+	apiKeysMu.Unlock()
+
+	if len(keys) > 0 {
+		dataLog.Info("Loaded API keys", "keys", len(keys))
+	}
+}
+
+// loadAPIKeyFile reads a CSV of keys with key, name, and rate_limit columns;
+// only key is required
+func loadAPIKeyFile(filename string) ([]APIKeyConfig, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("error opening API key file: %v", err)
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	reader.Comment = '#'
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("error reading API key file header: %v", err)
+	}
+	columns := make(map[string]int)
+	for i, column := range header {
+		columns[strings.ToLower(strings.TrimSpace(column))] = i
+	}
+	if _, ok := columns["key"]; !ok {
+		return nil, fmt.Errorf("API key file missing \"key\" column")
+	}
+
+	field := func(row []string, column string) string {
+		i, ok := columns[column]
+		if !ok || i >= len(row) {
+			return ""
+		}
+		return strings.TrimSpace(row[i])
+	}
+
+	var keys []APIKeyConfig
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading API key file: %v", err)
+		}
+		cfg := APIKeyConfig{Key: field(row, "key"), Name: field(row, "name")}
+		if v := field(row, "rate_limit"); v != "" {
+			if cfg.RateLimit, err = strconv.ParseFloat(v, 64); err != nil {
+				return nil, fmt.Errorf("invalid rate_limit %q for API key %q", v, cfg.Name)
+			}
+		}
+		keys = append(keys, cfg)
+	}
+	return keys, nil
+}
+
+// lookupAPIKey finds a configured key, comparing in constant time
+func lookupAPIKey(key string) *apiKey {
+	apiKeysMu.RLock()
+	defer apiKeysMu.RUnlock()
+
+	var found *apiKey
+	for k, v := range apiKeys {
+		if subtle.ConstantTimeCompare([]byte(k), []byte(key)) == 1 {
+			found = v
+		}
+	}
+	return found
+}
+
+// authEnabled reports whether any API keys are configured
+func authEnabled() bool {
+	apiKeysMu.RLock()
+	defer apiKeysMu.RUnlock()
+	return apiKeys != nil
+}
+
+// allow takes a request from the key's bucket, which refills at its rate limit
+// and holds up to a minute of requests. It returns how long to wait when empty.
+func (k *apiKey) allow() (bool, time.Duration) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if k.rateLimit <= 0 {
+		k.requests++
+		return true, 0
+	}
+
+	now := time.Now()
+	perSecond := k.rateLimit / 60
+	k.tokens = math.Min(k.rateLimit, k.tokens+now.Sub(k.refilled).Seconds()*perSecond)
+	k.refilled = now
+	if k.tokens < 1 {
+		k.limited++
+		return false, time.Duration((1 - k.tokens) / perSecond * float64(time.Second))
+	}
+	k.tokens--
+	k.requests++
+	return true, 0
+}
+
+// usage returns the key's counters
+func (k *apiKey) usage() APIKeyUsageResponse {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return APIKeyUsageResponse{Name: k.name, Requests: k.requests, Limited: k.limited, RateLimit: k.rateLimit}
+}
+
+// WithAPIKey requires a configured API key on each request, sent in the
+// X-API-Key header or apikey query parameter since 8-bit clients can't do
+// OAuth, and applies the key's rate limit. With no keys configured, requests
+// pass through.
+func WithAPIKey(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !authEnabled() || apiKeyExemptPaths[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key := r.Header.Get(APIKeyHeader)
+		if key == "" {
+			key = r.URL.Query().Get("apikey")
+		}
+		if key == "" {
+			writeError(w, http.StatusUnauthorized, "API key required")
+			return
+		}
+		k := lookupAPIKey(key)
+		if k == nil {
+			writeError(w, http.StatusUnauthorized, "invalid API key")
+			return
+		}
+
+		if ok, wait := k.allow(); !ok {
+			httpLog.WarnContext(r.Context(), "API key rate limited", "key", k.name)
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			writeError(w, http.StatusTooManyRequests, "rate limit exceeded")
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiKeyContextKey{}, k)))
+	})
+}
+
+// requestAPIKey returns the API key a request was authenticated with, or nil
+func requestAPIKey(ctx context.Context) *apiKey {
+	k, _ := ctx.Value(apiKeyContextKey{}).(*apiKey)
+	return k
+}
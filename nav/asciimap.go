@@ -0,0 +1,106 @@
+package nav
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Default and allowed sizes for ASCII route maps, in characters
+const (
+	DefaultMapWidth  = 40
+	DefaultMapHeight = 24
+	MinMapSize       = 8
+	MaxMapSize       = 200
+)
+
+// renderASCIIMap rasterizes a path onto a width x height character grid,
+// drawing segments with - | / \ and marking the start with S and the end with E.
+// North is up, so grid rows run opposite to path y values.
+func renderASCIIMap(path Path, width, height int) []string {
+	points := path.Points
+	pathWidth, pathHeight := max(1, path.Width), max(1, path.Height)
+	grid := make([][]byte, height)
+	for i := range grid {
+		grid[i] = []byte(strings.Repeat(" ", width))
+	}
+
+	toCell := func(p PathPoint) (int, int) {
+		col := (p[0]*(width-1) + pathWidth/2) / pathWidth
+		row := (height - 1) - (p[1]*(height-1)+pathHeight/2)/pathHeight
+		return col, row
+	}
+
+	for i := 1; i < len(points); i++ {
+		x0, y0 := toCell(points[i-1])
+		x1, y1 := toCell(points[i])
+		ch := segmentChar(x1-x0, y1-y0)
+		bresenham(x0, y0, x1, y1, func(x, y int) {
+			grid[y][x] = ch
+		})
+	}
+
+	if len(points) > 0 {
+		x, y := toCell(points[0])
+		grid[y][x] = 'S'
+		x, y = toCell(points[len(points)-1])
+		grid[y][x] = 'E'
+	}
+
+	lines := make([]string, height)
+	for i, row := range grid {
+		lines[i] = strings.TrimRight(string(row), " ")
+	}
+	return lines
+}
+
+// segmentChar picks the character that best matches a segment's direction in
+// grid cells, where dy grows downward
+func segmentChar(dx, dy int) byte {
+	adx, ady := abs(dx), abs(dy)
+	switch {
+	case ady*2 < adx:
+		return '-'
+	case adx*2 < ady:
+		return '|'
+	case (dx > 0) == (dy < 0):
+		return '/'
+	default:
+		return '\\'
+	}
+}
+
+// bresenham calls plot for each cell on the line between two cells
+func bresenham(x0, y0, x1, y1 int, plot func(x, y int)) {
+	dx, dy := abs(x1-x0), -abs(y1-y0)
+	sx, sy := 1, 1
+	if x0 > x1 {
+		sx = -1
+	}
+	if y0 > y1 {
+		sy = -1
+	}
+	err := dx + dy
+	for {
+		plot(x0, y0)
+		if x0 == x1 && y0 == y1 {
+			return
+		}
+		e2 := 2 * err
+		if e2 >= dy {
+			err += dy
+			x0 += sx
+		}
+		if e2 <= dx {
+			err += dx
+			y0 += sy
+		}
+	}
+}
+
+// writeASCIIMap writes a route's path as an ASCII map, one grid row per line
+func writeASCIIMap(w io.Writer, result *RouteResponse, width, height int) {
+	for _, line := range renderASCIIMap(result.Path, width, height) {
+		fmt.Fprintf(w, "%s\n", line)
+	}
+}
@@ -0,0 +1,86 @@
+package nav
+
+import (
+	"encoding/binary"
+	"math"
+	"net/http"
+	"strconv"
+)
+
+// Binary route format, for clients where parsing text is expensive. All integers
+// are little-endian and strings are 7-bit ASCII with a one-byte length prefix.
+//
+//	Header, 16 bytes:
+//	  0  "FN" magic
+//	  2  format version
+//	  3  mode: 0 walking, 1 biking, 2 auto, 3 transit, 4 parkride
+//	  4  units: 0 km, 1 mi
+//	  5  page, or 0 when not paginated
+//	  6  page count, or 0 when not paginated
+//	  7  reserved, 0
+//	  8  duration in seconds, uint32
+//	  12 distance in hundredths of units, uint32
+//	Route ID string
+//	Step count, uvarint, then for each step:
+//	  icon string, description string, distance in hundredths of units as uint16
+//	Path point count, uvarint, then one x byte and one y byte per point
+const (
+	binaryRouteMagic   = "FN"
+	binaryRouteVersion = 1
+)
+
+// binaryModes lists transport modes by their code in the binary format
+var binaryModes = []TransportMode{ModeWalking, ModeBiking, ModeAuto, ModeTransit, ModeParkRide}
+
+// appendBinaryString appends a string as ASCII with a length byte, cutting it to 255 bytes
+func appendBinaryString(b []byte, s string) []byte {
+	s = transliterate(s)
+	if len(s) > math.MaxUint8 {
+		s = s[:math.MaxUint8]
+	}
+	b = append(b, byte(len(s)))
+	return append(b, s...)
+}
+
+// encodeBinaryRoute encodes a route in the binary route format
+func encodeBinaryRoute(result *RouteResponse) []byte {
+	b := []byte(binaryRouteMagic)
+	b = append(b, binaryRouteVersion)
+
+	var mode byte
+	for i, m := range binaryModes {
+		if m == result.Mode {
+			mode = byte(i)
+		}
+	}
+	var units byte
+	if result.Units == UnitMiles {
+		units = 1
+	}
+	b = append(b, mode, units, byte(min(result.Page, math.MaxUint8)), byte(min(result.Pages, math.MaxUint8)), 0)
+	b = binary.LittleEndian.AppendUint32(b, uint32(math.Max(0, math.Round(result.Duration))))
+	b = binary.LittleEndian.AppendUint32(b, uint32(math.Max(0, math.Round(result.Distance*100))))
+
+	b = appendBinaryString(b, result.ID)
+
+	b = binary.AppendUvarint(b, uint64(len(result.Steps)))
+	for _, step := range result.Steps {
+		b = appendBinaryString(b, step.Icon)
+		b = appendBinaryString(b, step.Description)
+		b = binary.LittleEndian.AppendUint16(b, uint16(math.Min(math.MaxUint16, math.Max(0, math.Round(step.Distance*100)))))
+	}
+
+	b = binary.AppendUvarint(b, uint64(len(result.Path.Points)))
+	for _, p := range result.Path.Points {
+		b = append(b, byte(p[0]), byte(p[1]))
+	}
+	return b
+}
+
+// writeBinaryRoute writes a route in the binary route format
+func writeBinaryRoute(w http.ResponseWriter, result *RouteResponse) {
+	body := encodeBinaryRoute(result)
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.Write(body)
+}
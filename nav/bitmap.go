@@ -0,0 +1,50 @@
+package nav
+
+import "math"
+
+// Default and allowed sizes for route bitmaps, in pixels
+const (
+	DefaultBitmapWidth  = 320
+	DefaultBitmapHeight = 192
+	MaxBitmapWidth      = 640
+	MaxBitmapHeight     = 480
+)
+
+// renderBitmap rasterizes [lat, lng] pairs into a packed 1-bit bitmap, with
+// rows top to bottom, each padded to a whole byte, and the leftmost pixel in
+// the most significant bit. North is up.
+func renderBitmap(rawPoints [][2]float64, width, height int) []byte {
+	rowBytes := (width + 7) / 8
+	bitmap := make([]byte, rowBytes*height)
+	if len(rawPoints) == 0 {
+		return bitmap
+	}
+
+	grid := newGridProjection(rawPoints)
+	toPixel := func(p [2]float64) (int, int) {
+		x := int(math.Round((p[1] - grid.minLng) / grid.lngRange * float64(width-1)))
+		y := int(math.Round((p[0] - grid.minLat) / grid.latRange * float64(height-1)))
+		return max(0, min(width-1, x)), (height - 1) - max(0, min(height-1, y))
+	}
+	plot := func(x, y int) {
+		bitmap[y*rowBytes+x/8] |= 0x80 >> (x % 8)
+	}
+
+	x0, y0 := toPixel(rawPoints[0])
+	plot(x0, y0)
+	for _, p := range rawPoints[1:] {
+		x1, y1 := toPixel(p)
+		bresenham(x0, y0, x1, y1, plot)
+		x0, y0 = x1, y1
+	}
+	return bitmap
+}
+
+// routeBitmap renders a stored route's full-resolution path as a 1-bit bitmap
+func routeBitmap(routeID string, width, height int) ([]byte, error) {
+	track, ok := routeStore.get(routeID)
+	if !ok {
+		return nil, &ErrNoResults{Query: routeID}
+	}
+	return renderBitmap(track.Points, width, height), nil
+}
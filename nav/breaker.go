@@ -0,0 +1,142 @@
+package nav
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Defaults for the circuit breakers in front of each upstream host
+const (
+	DefaultBreakerThreshold = 5
+	DefaultBreakerCooldown  = 30 * time.Second
+)
+
+// ErrUpstreamUnavailable is returned without calling an upstream service whose
+// circuit breaker is open after repeated failures, or whose concurrency limit
+// stays full for longer than the upstream timeout
+type ErrUpstreamUnavailable struct {
+	Service string
+}
+
+func (e *ErrUpstreamUnavailable) Error() string {
+	return fmt.Sprintf("%s temporarily unavailable", e.Service)
+}
+
+// circuitBreaker fails calls to a host fast once it has failed threshold times
+// in a row. After the cooldown a single trial call is let through, which closes
+// the breaker on success or opens it again on failure.
+type circuitBreaker struct {
+	mu        sync.Mutex
+	failures  int       // Consecutive failed calls
+	openUntil time.Time // When a trial call may be made, if open
+	trial     bool      // Whether a trial call is in flight
+}
+
+var (
+	breakersMu       sync.Mutex
+	breakers         = make(map[string]*circuitBreaker)
+	breakerThreshold = DefaultBreakerThreshold
+	breakerCooldown  = DefaultBreakerCooldown
+)
+
+// breakerForHost returns the shared circuit breaker for a host
+func breakerForHost(host string) *circuitBreaker {
+	breakersMu.Lock()
+	defer breakersMu.Unlock()
+
+	breaker, ok := breakers[host]
+	if !ok {
+		breaker = &circuitBreaker{}
+		breakers[host] = breaker
+	}
+	return breaker
+}
+
+// setBreakers sets the failure threshold and cooldown in seconds, or the
+// defaults for 0, and closes every breaker
+func setBreakers(threshold, cooldownSeconds int) {
+	breakersMu.Lock()
+	defer breakersMu.Unlock()
+
+	breakerThreshold = orDefault(threshold, DefaultBreakerThreshold)
+	breakerCooldown = orDefaultSeconds(cooldownSeconds, DefaultBreakerCooldown)
+	breakers = make(map[string]*circuitBreaker)
+}
+
+// allow reports whether a call may be made, claiming the trial call when the
+// breaker's cooldown has passed
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failures < breakerThreshold {
+		return true
+	}
+	if b.trial || time.Now().Before(b.openUntil) {
+		return false
+	}
+	b.trial = true
+	return true
+}
+
+// record notes whether an allowed call succeeded, opening the breaker when the
+// host has failed too many times in a row
+func (b *circuitBreaker) record(host string, ok bool) {
+	stats := upstreamStats(host)
+	stats.calls.Add(1)
+	if !ok {
+		stats.errors.Add(1)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.trial = false
+	if ok {
+		if b.failures >= breakerThreshold {
+			upstreamLog.Info("Circuit breaker closed", "host", host)
+		}
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.failures >= breakerThreshold {
+		b.openUntil = time.Now().Add(breakerCooldown)
+		upstreamLog.Warn("Circuit breaker open", "host", host, "cooldown", breakerCooldown, "failures", b.failures)
+	}
+}
+
+// closed reports whether calls are going through normally
+func (b *circuitBreaker) closed() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.failures < breakerThreshold
+}
+
+// release gives up a call's trial without counting it either way, for calls
+// canceled by their client
+func (b *circuitBreaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.trial = false
+}
+
+// upstreamService names the service at a host for errors, e.g. "routing" for Valhalla
+func upstreamService(ctx context.Context, host string) string {
+	for _, service := range []struct {
+		url, name string
+	}{
+		{configFor(ctx).ValhallaURL, "routing"},
+		{configFor(ctx).NominatimURL, "geocoding"},
+		{configFor(ctx).TransitlandURL, "transit"},
+		{configFor(ctx).What3WordsURL, "what3words"},
+	} {
+		if u, err := url.Parse(service.url); err == nil && service.url != "" && u.Host == host {
+			return service.name
+		}
+	}
+	return host
+}
@@ -0,0 +1,121 @@
+package nav
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// MinMaxBytes is the smallest size budget accepted for plain-text responses
+const MinMaxBytes = 32
+
+// truncatedLine ends plain-text responses that lost detail to fit a size budget
+const truncatedLine = "truncated\n"
+
+// budgetDescriptionWidths are the description lengths tried in turn when a
+// plain-text route is over its size budget, 0 being the full description
+var budgetDescriptionWidths = []int{0, 40, 24, 12}
+
+// parseMaxBytes reads a maxBytes parameter, returning 0 when it's empty
+func parseMaxBytes(v string) (int, error) {
+	if v == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < MinMaxBytes {
+		return 0, fmt.Errorf("maxBytes must be at least %d", MinMaxBytes)
+	}
+	return n, nil
+}
+
+// fits reports whether body fits in maxBytes as sent, after WithTextEncoding
+// adds its version and checksum lines and converts the character set
+func fits(ctx context.Context, body []byte, maxBytes int) bool {
+	return encodedSize(ctx, body) <= maxBytes
+}
+
+// withTruncated returns body followed by the truncated line
+func withTruncated(body []byte) []byte {
+	return append(body[:len(body):len(body)], truncatedLine...)
+}
+
+// fitResults renders as many of count results as fit in maxBytes, followed by the
+// truncated line when any are dropped. With no budget, all results are rendered.
+func fitResults(ctx context.Context, count, maxBytes int, render func(n int) []byte) []byte {
+	body := render(count)
+	if maxBytes == 0 || fits(ctx, body, maxBytes) {
+		return body
+	}
+	return dropResults(ctx, count-1, maxBytes, render)
+}
+
+// dropResults renders as many results as fit in maxBytes along with the
+// truncated line, up to count
+func dropResults(ctx context.Context, count, maxBytes int, render func(n int) []byte) []byte {
+	n := max(0, count)
+	body := withTruncated(render(n))
+	for n > 0 && !fits(ctx, body, maxBytes) {
+		n--
+		body = withTruncated(render(n))
+	}
+	return body
+}
+
+// fitRouteText renders a route as plain text within its size budget. ASCII maps
+// shrink toward the smallest map size; step lists first cut descriptions
+// shorter and then drop steps from the end. Anything that lost detail ends with
+// the truncated line.
+func fitRouteText(ctx context.Context, result *RouteResponse, output routeOutput) []byte {
+	if output.Format == "ascii" {
+		var buf bytes.Buffer
+		writeASCIIMap(&buf, result, output.Width, output.Height)
+		if fits(ctx, buf.Bytes(), output.MaxBytes) {
+			return buf.Bytes()
+		}
+		width, height := output.Width, output.Height
+		for {
+			width, height = max(MinMapSize, width*3/4), max(MinMapSize, height*3/4)
+			buf.Reset()
+			writeASCIIMap(&buf, result, width, height)
+			body := withTruncated(buf.Bytes())
+			if fits(ctx, body, output.MaxBytes) || (width == MinMapSize && height == MinMapSize) {
+				return body
+			}
+		}
+	}
+
+	// Dropped steps are cut from the end, so the last one written isn't the
+	// arrival unless all of them are
+	render := func(count, width int) []byte {
+		shortened := *result
+		shortened.Steps = make([]RouteStep, len(result.Steps))
+		for i, step := range result.Steps {
+			if width > 0 {
+				step.Description = strings.TrimRight(fmt.Sprintf("%.*s", width, step.Description), " ")
+				step.Summary = strings.TrimRight(fmt.Sprintf("%.*s", width, step.Summary), " ")
+			}
+			shortened.Steps[i] = step
+		}
+		var buf bytes.Buffer
+		writePlainTextRouteSteps(&buf, &shortened, output, count)
+		return buf.Bytes()
+	}
+
+	for i, width := range budgetDescriptionWidths {
+		body := render(len(result.Steps), width)
+		if i == 0 && fits(ctx, body, output.MaxBytes) {
+			return body
+		}
+		if body = withTruncated(body); fits(ctx, body, output.MaxBytes) {
+			return body
+		}
+	}
+
+	// Still over budget with the shortest descriptions, so drop steps
+	width := budgetDescriptionWidths[len(budgetDescriptionWidths)-1]
+	return dropResults(ctx, len(result.Steps)-1, output.MaxBytes, func(n int) []byte {
+		return render(n, width)
+	})
+}
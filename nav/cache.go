@@ -0,0 +1,115 @@
+package nav
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// DefaultCacheMaxEntries bounds each response cache when cache_max_entries isn't set
+const DefaultCacheMaxEntries = 10000
+
+// responseCache holds recent responses, in this process or shared through Redis
+type responseCache[V any] interface {
+	get(key string) (V, bool)
+	set(key string, value V)
+}
+
+// ttlCache is a simple in-process cache whose entries expire after a fixed TTL.
+// When it holds maxEntries, the least recently used entry makes way for a new one.
+type ttlCache[V any] struct {
+	mu         sync.Mutex
+	ttl        time.Duration
+	maxEntries int                      // 0 for unbounded
+	entries    map[string]*list.Element // Elements hold *cacheEntry[V]
+	recent     *list.List               // Most recently used at the front
+	stats      *cacheCounter
+}
+
+type cacheEntry[V any] struct {
+	key     string
+	value   V
+	expires time.Time
+}
+
+// newTTLCache returns an empty cache, counted in the stats under name
+func newTTLCache[V any](name string, ttl time.Duration, maxEntries int) *ttlCache[V] {
+	c := &ttlCache[V]{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		entries:    make(map[string]*list.Element),
+		recent:     list.New(),
+	}
+	c.stats = cacheStats(name, c.len)
+	return c
+}
+
+// len returns the number of entries, including expired ones not yet swept
+func (c *ttlCache[V]) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+// get returns the cached value for key if present and not expired
+func (c *ttlCache[V]) get(key string) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		c.stats.misses.Add(1)
+		var zero V
+		return zero, false
+	}
+	entry := elem.Value.(*cacheEntry[V])
+	if time.Now().After(entry.expires) {
+		c.remove(elem)
+		c.stats.misses.Add(1)
+		var zero V
+		return zero, false
+	}
+	c.stats.hits.Add(1)
+	c.recent.MoveToFront(elem)
+	return entry.value, true
+}
+
+// set stores value under key, evicting the least recently used entries when
+// full. Expired entries at the least recently used end are swept as it goes,
+// so a set never walks the whole cache; ones read since are dropped when next
+// looked up or when they reach the end.
+func (c *ttlCache[V]) set(key string, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for elem := c.recent.Back(); elem != nil && now.After(elem.Value.(*cacheEntry[V]).expires); elem = c.recent.Back() {
+		c.remove(elem)
+	}
+
+	if elem, ok := c.entries[key]; ok {
+		c.remove(elem)
+	}
+	for c.maxEntries > 0 && len(c.entries) >= c.maxEntries {
+		c.remove(c.recent.Back())
+	}
+	c.entries[key] = c.recent.PushFront(&cacheEntry[V]{key: key, value: value, expires: now.Add(c.ttl)})
+}
+
+// resize changes the TTL of entries stored from now on and the entry limit,
+// evicting the least recently used entries over it
+func (c *ttlCache[V]) resize(ttl time.Duration, maxEntries int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.ttl, c.maxEntries = ttl, maxEntries
+	for c.maxEntries > 0 && len(c.entries) > c.maxEntries {
+		c.remove(c.recent.Back())
+	}
+}
+
+// remove drops an entry; the caller holds the lock
+func (c *ttlCache[V]) remove(elem *list.Element) {
+	c.recent.Remove(elem)
+	delete(c.entries, elem.Value.(*cacheEntry[V]).key)
+}
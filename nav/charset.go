@@ -0,0 +1,307 @@
+package nav
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// asciiFolds spells out non-ASCII characters that commonly appear in place names
+// and descriptions. Accented letters are handled separately by stripping the accent.
+var asciiFolds = map[rune]string{
+	'ß': "ss", 'Æ': "AE", 'æ': "ae", 'Œ': "OE", 'œ': "oe", 'Þ': "Th", 'þ': "th",
+	'Ð': "D", 'ð': "d", 'Đ': "D", 'đ': "d", 'Ł': "L", 'ł': "l", 'Ø': "O", 'ø': "o",
+	'ı': "i", 'Ħ': "H", 'ħ': "h", 'Ĳ': "IJ", 'ĳ': "ij", '÷': "/",
+	'‘': "'", '’': "'", '‚': "'", '‛': "'", '“': "\"", '”': "\"", '„': "\"", '«': "\"", '»': "\"",
+	'‐': "-", '‑': "-", '‒': "-", '–': "-", '—': "-", '−': "-",
+	'…': "...", '•': "*", '·': ".", '×': "x", '°': " deg", '½': " 1/2", '¼': " 1/4", '¾': " 3/4",
+	'→': "->", '←': "<-", '↑': "^", '↓': "v",
+	'€': "EUR", '£': "GBP", '¥': "JPY", '¢': "c",
+	'\u00a0': " ", '\u2009': " ", '\u202f': " ", '\u3000': " ", // No-break, thin, and ideographic spaces
+	'、': ",", '。': ".", '・': " ", '「': "\"", '」': "\"",
+}
+
+// accentBases lists the unaccented letter for each accented Latin-1 and Latin
+// Extended-A letter, indexed from U+00C0. Zero entries have no single base letter.
+var accentBases = [...]byte{
+	// U+00C0
+	'A', 'A', 'A', 'A', 'A', 'A', 0, 'C', 'E', 'E', 'E', 'E', 'I', 'I', 'I', 'I',
+	0, 'N', 'O', 'O', 'O', 'O', 'O', 0, 0, 'U', 'U', 'U', 'U', 'Y', 0, 0,
+	'a', 'a', 'a', 'a', 'a', 'a', 0, 'c', 'e', 'e', 'e', 'e', 'i', 'i', 'i', 'i',
+	0, 'n', 'o', 'o', 'o', 'o', 'o', 0, 0, 'u', 'u', 'u', 'u', 'y', 0, 'y',
+	// U+0100
+	'A', 'a', 'A', 'a', 'A', 'a', 'C', 'c', 'C', 'c', 'C', 'c', 'C', 'c', 'D', 'd',
+	0, 0, 'E', 'e', 'E', 'e', 'E', 'e', 'E', 'e', 'E', 'e', 'G', 'g', 'G', 'g',
+	'G', 'g', 'G', 'g', 'H', 'h', 0, 0, 'I', 'i', 'I', 'i', 'I', 'i', 'I', 'i',
+	'I', 0, 0, 0, 'J', 'j', 'K', 'k', 'k', 'L', 'l', 'L', 'l', 'L', 'l', 'L',
+	'l', 0, 0, 'N', 'n', 'N', 'n', 'N', 'n', 'n', 'N', 'n', 'O', 'o', 'O', 'o',
+	'O', 'o', 0, 0, 'R', 'r', 'R', 'r', 'R', 'r', 'S', 's', 'S', 's', 'S', 's',
+	'S', 's', 'T', 't', 'T', 't', 'T', 't', 'U', 'u', 'U', 'u', 'U', 'u', 'U', 'u',
+	'U', 'u', 'U', 'u', 'W', 'w', 'Y', 'y', 'Y', 'Z', 'z', 'Z', 'z', 'Z', 'z', 's',
+}
+
+// transliterate folds text to printable 7-bit ASCII, stripping accents,
+// romanizing scripts that can be spelled letter by letter, and replacing
+// anything else without an equivalent with '?'
+func transliterate(s string) string {
+	var b strings.Builder
+	runes := []rune(s)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r < utf8.RuneSelf:
+			b.WriteRune(r)
+		case r >= 0xC0 && int(r-0xC0) < len(accentBases) && accentBases[r-0xC0] != 0:
+			b.WriteByte(accentBases[r-0xC0])
+		case asciiFolds[r] != "":
+			b.WriteString(asciiFolds[r])
+		case r >= 0x0300 && r <= 0x036F:
+			// Combining accents on decomposed text
+		case r >= 0xFF01 && r <= 0xFF5E:
+			// Fullwidth forms of ASCII, common in Japanese and Chinese addresses
+			b.WriteRune(r - 0xFEE0)
+		default:
+			roman, n := romanize(runes, i)
+			if n == 0 {
+				b.WriteByte('?')
+				continue
+			}
+			b.WriteString(roman)
+			i += n - 1
+		}
+	}
+	return b.String()
+}
+
+// encodeText converts UTF-8 text to a charset, including its line endings
+func encodeText(s string, charset Charset) []byte {
+	if charset == CharsetUTF8 {
+		return []byte(s)
+	}
+
+	text := []byte(transliterate(strings.ReplaceAll(s, "\r\n", "\n")))
+	for i, c := range text {
+		switch charset {
+		case CharsetATASCII:
+			text[i] = atasciiByte(c)
+		case CharsetPETSCII:
+			text[i] = petsciiByte(c)
+		}
+	}
+	return text
+}
+
+// atasciiByte converts an ASCII character to ATASCII, where most printable
+// characters match but a few codes are graphics or screen controls
+func atasciiByte(c byte) byte {
+	switch c {
+	case '\n':
+		return 0x9B // EOL
+	case '{':
+		return '('
+	case '}':
+		return ')'
+	case '`':
+		return '\''
+	case '~':
+		return '-'
+	}
+	return c
+}
+
+// petsciiByte converts an ASCII character to PETSCII for lowercase/uppercase
+// mode, where the letter cases are swapped relative to ASCII
+func petsciiByte(c byte) byte {
+	switch {
+	case c == '\n':
+		return 0x0D
+	case c >= 'a' && c <= 'z':
+		return c - 'a' + 0x41
+	case c >= 'A' && c <= 'Z':
+		return c - 'A' + 0xC1
+	}
+	switch c {
+	case '{':
+		return '('
+	case '}':
+		return ')'
+	case '`':
+		return '\''
+	case '~', '_':
+		return '-'
+	case '\\':
+		return '/' // 0x5C is the pound sign
+	case '|':
+		return 0xDD // Vertical line graphic
+	}
+	return c
+}
+
+// crc16 computes the CRC-16/XMODEM checksum of data, as used by XMODEM transfers
+func crc16(data []byte) uint16 {
+	var crc uint16
+	for _, b := range data {
+		crc ^= uint16(b) << 8
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// textWriter buffers plain-text and CSV responses so they can be converted to a
+// charset in one piece, without splitting multi-byte characters, and
+// checksummed. Other content types are passed through as they're written.
+type textWriter struct {
+	http.ResponseWriter
+	textEncoding
+	decided bool
+	text    bool
+	status  int
+	buf     bytes.Buffer
+}
+
+// isText decides on the first write whether the response is plain text
+func (tw *textWriter) isText() bool {
+	if !tw.decided {
+		tw.decided = true
+		contentType := tw.Header().Get("Content-Type")
+		tw.text = strings.HasPrefix(contentType, "text/plain") || strings.HasPrefix(contentType, "text/csv")
+	}
+	return tw.text
+}
+
+func (tw *textWriter) WriteHeader(code int) {
+	if tw.isText() {
+		tw.status = code
+		return
+	}
+	tw.ResponseWriter.WriteHeader(code)
+}
+
+func (tw *textWriter) Write(p []byte) (int, error) {
+	if tw.isText() {
+		return tw.buf.Write(p)
+	}
+	return tw.ResponseWriter.Write(p)
+}
+
+// textEncoding is how WithTextEncoding converts a request's plain-text responses
+type textEncoding struct {
+	charset  Charset // Empty for the default, ASCII for plain text and UTF-8 for CSV
+	checksum bool
+	proto    int
+}
+
+type textEncodingContextKey struct{}
+
+// charsetFor returns the character set a response is converted to.
+// Plain text is ASCII unless the client asked otherwise, since few small
+// clients can show UTF-8; CSV stays UTF-8 for spreadsheets.
+func (e textEncoding) charsetFor(plain bool) Charset {
+	if e.charset != "" {
+		return e.charset
+	}
+	if plain {
+		return CharsetASCII
+	}
+	return CharsetUTF8
+}
+
+// encode converts a response body, preceding plain text with the protocol
+// version line and following it with the checksum line when requested
+func (e textEncoding) encode(text string, plain bool) []byte {
+	charset := e.charsetFor(plain)
+	if e.proto >= ProtocolVersion2 && plain {
+		text = fmt.Sprintf("%d\n", e.proto) + text
+	}
+	body := encodeText(text, charset)
+	if e.checksum {
+		// The checksum covers every byte before its own line, as sent
+		body = append(body, encodeText(fmt.Sprintf("%04X\n", crc16(body)), charset)...)
+	}
+	return body
+}
+
+// encodedSize returns the bytes a plain-text body takes once WithTextEncoding
+// has converted it, so size budgets cover the response as sent
+func encodedSize(ctx context.Context, body []byte) int {
+	if e, ok := ctx.Value(textEncodingContextKey{}).(textEncoding); ok {
+		return len(e.encode(string(body), true))
+	}
+	return len(body)
+}
+
+// finish converts and writes a buffered plain-text response
+func (tw *textWriter) finish() {
+	if !tw.text {
+		return
+	}
+	if tw.status == 0 {
+		tw.status = http.StatusOK
+	}
+	plain := strings.HasPrefix(tw.Header().Get("Content-Type"), "text/plain")
+	body := tw.encode(tw.buf.String(), plain)
+	if tw.charsetFor(plain) != CharsetUTF8 {
+		// The body is no longer UTF-8, so drop any charset from the content type
+		mediaType, _, _ := strings.Cut(tw.Header().Get("Content-Type"), ";")
+		tw.Header().Set("Content-Type", mediaType)
+	}
+	tw.Header().Set("Content-Length", fmt.Sprintf("%d", len(body)))
+	tw.ResponseWriter.WriteHeader(tw.status)
+	tw.ResponseWriter.Write(body)
+}
+
+// protocolVersion returns the plain-text protocol version a request asks for,
+// defaulting to version 1 for clients written before versioning
+func protocolVersion(r *http.Request) (int, error) {
+	v := r.URL.Query().Get("proto")
+	if v == "" {
+		return ProtocolVersion1, nil
+	}
+	proto, err := strconv.Atoi(v)
+	if err != nil || proto < ProtocolVersion1 || proto > LatestProtocolVersion {
+		return 0, fmt.Errorf("proto must be between %d and %d", ProtocolVersion1, LatestProtocolVersion)
+	}
+	return proto, nil
+}
+
+// WithTextEncoding converts plain-text responses to the character set named by
+// the charset query parameter, ASCII by default, for clients that can't display
+// UTF-8, and with
+// checksum=1 adds a final CRC-16 line so clients on flaky links can detect
+// truncated or corrupted responses. The proto parameter selects the plain-text
+// protocol version.
+func WithTextEncoding(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		charset := Charset(strings.ToLower(r.URL.Query().Get("charset")))
+		checksum := r.URL.Query().Get("checksum") == "1"
+		proto, err := protocolVersion(r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if charset == CharsetUTF8 && !checksum && proto == ProtocolVersion1 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if charset != "" && !charset.IsValid() {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid charset. Must be one of: %s, %s, %s, %s",
+				CharsetUTF8, CharsetASCII, CharsetATASCII, CharsetPETSCII))
+			return
+		}
+
+		encoding := textEncoding{charset: charset, checksum: checksum, proto: proto}
+		tw := &textWriter{ResponseWriter: w, textEncoding: encoding}
+		next.ServeHTTP(tw, r.WithContext(context.WithValue(r.Context(), textEncodingContextKey{}, encoding)))
+		tw.finish()
+	})
+}
@@ -0,0 +1,111 @@
+package nav
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// concurrencyLimiter caps the calls in flight to one upstream service. Calls
+// over the limit wait their turn in arrival order, so a burst of clients is
+// served first come, first served rather than at random.
+type concurrencyLimiter struct {
+	mu          sync.Mutex
+	limit       int
+	waitTimeout time.Duration // Before a waiting call gives up
+	active      int
+	waiting     list.List // Of chan struct{}, closed when the waiter is given a slot
+}
+
+var (
+	concurrencyMu          sync.Mutex
+	concurrencyLimiters    = make(map[string]*concurrencyLimiter)
+	concurrencyLimits      map[string]int // By service name, e.g. "routing", or host
+	concurrencyWaitTimeout = DefaultUpstreamTimeout
+)
+
+// setConcurrencyLimits sets the limit for each service or host, and how long a
+// call waits for a slot before failing, replacing every limiter. Calls already
+// holding a slot release it to their old limiter.
+func setConcurrencyLimits(limits map[string]int, waitTimeout time.Duration) {
+	concurrencyMu.Lock()
+	defer concurrencyMu.Unlock()
+
+	concurrencyLimits = limits
+	concurrencyWaitTimeout = waitTimeout
+	concurrencyLimiters = make(map[string]*concurrencyLimiter)
+}
+
+// concurrencyLimiterFor returns the shared limiter for the service at a host,
+// or nil when its calls aren't limited
+func concurrencyLimiterFor(ctx context.Context, host string) *concurrencyLimiter {
+	service := upstreamService(ctx, host)
+
+	concurrencyMu.Lock()
+	defer concurrencyMu.Unlock()
+
+	limit, ok := concurrencyLimits[service]
+	if !ok {
+		limit, ok = concurrencyLimits[host]
+	}
+	if !ok || limit <= 0 {
+		return nil
+	}
+	limiter, ok := concurrencyLimiters[service]
+	if !ok {
+		limiter = &concurrencyLimiter{limit: limit, waitTimeout: concurrencyWaitTimeout}
+		concurrencyLimiters[service] = limiter
+	}
+	return limiter
+}
+
+// acquire waits for a slot, returning false if ctx is done or no slot frees
+// up within the wait timeout
+func (l *concurrencyLimiter) acquire(ctx context.Context) bool {
+	l.mu.Lock()
+	if l.active < l.limit && l.waiting.Len() == 0 {
+		l.active++
+		l.mu.Unlock()
+		return true
+	}
+	ready := make(chan struct{})
+	elem := l.waiting.PushBack(ready)
+	l.mu.Unlock()
+
+	timer := time.NewTimer(l.waitTimeout)
+	defer timer.Stop()
+	select {
+	case <-ready:
+		return true
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	select {
+	case <-ready:
+		// Given a slot while giving up, so pass it on
+		l.releaseLocked()
+	default:
+		l.waiting.Remove(elem)
+	}
+	return false
+}
+
+// release frees a slot, handing it to the longest waiting call if any
+func (l *concurrencyLimiter) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.releaseLocked()
+}
+
+func (l *concurrencyLimiter) releaseLocked() {
+	if front := l.waiting.Front(); front != nil {
+		l.waiting.Remove(front)
+		close(front.Value.(chan struct{}))
+		return
+	}
+	l.active--
+}
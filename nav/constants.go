@@ -4,10 +4,11 @@ package nav
 type TransportMode string
 
 const (
-	ModeWalking TransportMode = "walking"
-	ModeBiking  TransportMode = "biking"
-	ModeAuto    TransportMode = "auto"
-	ModeTransit TransportMode = "transit"
+	ModeWalking  TransportMode = "walking"
+	ModeBiking   TransportMode = "biking"
+	ModeAuto     TransportMode = "auto"
+	ModeTransit  TransportMode = "transit"
+	ModeParkRide TransportMode = "parkride" // Drive to a park-and-ride lot, then transit
 )
 
 // DefaultMode is the default transport mode if none is specified
@@ -24,22 +25,128 @@ const (
 // DefaultUnit is the default distance unit if none is specified
 const DefaultUnit = UnitKilometers
 
+// GeocodeLayer represents a category of geocoding result
+type GeocodeLayer string
+
+const (
+	LayerAddress  GeocodeLayer = "address"  // Streets and house-level addresses
+	LayerPOI      GeocodeLayer = "poi"      // Businesses, landmarks, and other points of interest
+	LayerLocality GeocodeLayer = "locality" // Cities, towns, villages, and neighborhoods
+	LayerAdmin    GeocodeLayer = "admin"    // Countries, states, counties, and other boundaries
+)
+
 // CountryCode represents a two-letter ISO country code
 type CountryCode string
 
+// Plain-text protocol versions, selected with the proto parameter. Version 1
+// is the original layout, which clients get when they don't ask for a version.
+// From version 2, responses start with a line holding the version number, and
+// layout changes are only made under a new version.
+const (
+	ProtocolVersion1 = 1
+	ProtocolVersion2 = 2 // Version line first, then the version 1 layout
+
+	LatestProtocolVersion = ProtocolVersion2
+)
+
+// Detail represents how much of each route step is included in responses
+type Detail string
+
+const (
+	DetailBrief  Detail = "brief"  // Descriptions only
+	DetailNormal Detail = "normal" // Descriptions, distances, and icons
+	DetailFull   Detail = "full"   // Also the stops passed on transit steps
+)
+
+// DefaultDetail is the default route detail level if none is specified
+const DefaultDetail = DetailNormal
+
+// Charset represents the character set of plain-text responses
+type Charset string
+
+const (
+	CharsetUTF8    Charset = "utf-8"
+	CharsetASCII   Charset = "ascii"   // 7-bit ASCII with \n line endings
+	CharsetATASCII Charset = "atascii" // Atari 8-bit, with EOL (0x9B) line endings
+	CharsetPETSCII Charset = "petscii" // Commodore lowercase/uppercase mode, with CR line endings
+)
+
+// Palette represents the colors of a dithered map framebuffer
+type Palette string
+
+const (
+	PaletteGray Palette = "gray" // Evenly spaced gray levels from black to white, at 2 or 4 bits
+	PaletteCGA  Palette = "cga"  // CGA 320x200 palette 1: black, cyan, magenta, white, at 2 bits
+	PaletteC64  Palette = "c64"  // The 16 Commodore 64 colors in VIC-II order, at 4 bits
+)
+
 // NormalizedGridSize is the size of the normalized grid for path points
 const NormalizedGridSize = 100
 
+// iconCodes gives each route step icon a stable code for icons=numeric, so clients
+// can index into a sprite table. Codes are never reused; steps without an icon are 0.
+var iconCodes = map[string]int{
+	"Straight": 1,  // Continue straight
+	"Right":    2,  // Turn right or sharp right
+	"Left":     3,  // Turn left or sharp left
+	"right":    4,  // Slight right
+	"left":     5,  // Slight left
+	"Merge":    6,  // Merge
+	"Exit":     7,  // Take an exit or ramp
+	"Ferry":    8,  // Ferry, as a maneuver or a transit leg
+	"building": 9,  // Enter or leave a building
+	"Walk":     10, // Walking leg
+	"Cycle":    11, // Cycling leg
+	"Drive":    12, // Driving leg
+	"Bus":      13, // Bus ride
+	"Train":    14, // Rail, subway, or tram ride
+	"Park":     15, // Park at a park-and-ride lot
+}
+
+// IconCode returns the numeric code for a step icon, or 0 for no or unknown icon
+func IconCode(icon string) int {
+	return iconCodes[icon]
+}
+
+// PathEncodingDelta marks paths whose points after the first are offsets from the previous point
+const PathEncodingDelta = "delta"
+
+// Allowed path grid sizes for pathWidth and pathHeight. Delta-encoded offsets
+// fit in a signed byte only on grids up to MaxDeltaPathSize.
+const (
+	MinPathSize      = 8
+	MaxPathSize      = 255
+	MaxDeltaPathSize = 127
+)
+
+// Values of the timeFormat option: one duration format and one clock format
+const (
+	DurationSeconds = "seconds" // Whole seconds, e.g. 3900
+	DurationText    = "text"    // Hours and minutes, e.g. 1hr 5min
+	DurationClock   = "clock"   // Hours and minutes like a clock, e.g. 1:05
+	Clock24Hour     = "24h"     // e.g. 15:04
+	Clock12Hour     = "12h"     // e.g. 3:04pm
+)
+
+// PathAspectPreserve keeps a path's real proportions on the normalized grid,
+// centering it instead of stretching it to fill both axes
+const PathAspectPreserve = "preserve"
+
 // IsValid checks if the transport mode is valid
 func (m TransportMode) IsValid() bool {
 	switch m {
-	case ModeWalking, ModeBiking, ModeAuto, ModeTransit:
+	case ModeWalking, ModeBiking, ModeAuto, ModeTransit, ModeParkRide:
 		return true
 	default:
 		return false
 	}
 }
 
+// usesTransit checks if routes in this mode include transit legs
+func (m TransportMode) usesTransit() bool {
+	return m == ModeTransit || m == ModeParkRide
+}
+
 // IsValid checks if the distance unit is valid
 func (u DistanceUnit) IsValid() bool {
 	switch u {
@@ -50,9 +157,49 @@ func (u DistanceUnit) IsValid() bool {
 	}
 }
 
+// IsValid checks if the geocode layer is valid
+func (l GeocodeLayer) IsValid() bool {
+	switch l {
+	case LayerAddress, LayerPOI, LayerLocality, LayerAdmin:
+		return true
+	default:
+		return false
+	}
+}
+
 // IsValid checks if the country code is valid
 func (c CountryCode) IsValid() bool {
 	// For now, just check if it's exactly 2 characters
 	// Could be enhanced to check against a list of valid ISO codes
 	return len(c) == 2
 }
+
+// IsValid checks if the charset is valid
+func (c Charset) IsValid() bool {
+	switch c {
+	case CharsetUTF8, CharsetASCII, CharsetATASCII, CharsetPETSCII:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsValid checks if the palette is valid
+func (p Palette) IsValid() bool {
+	switch p {
+	case PaletteGray, PaletteCGA, PaletteC64:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsValid checks if the detail level is valid
+func (d Detail) IsValid() bool {
+	switch d {
+	case DetailBrief, DetailNormal, DetailFull:
+		return true
+	default:
+		return false
+	}
+}
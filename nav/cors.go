@@ -0,0 +1,73 @@
+package nav
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Defaults for CORS settings left empty
+var (
+	defaultCORSMethods = []string{http.MethodGet, http.MethodPost, http.MethodOptions}
+	defaultCORSHeaders = []string{"Content-Type", APIKeyHeader, RequestIDHeader}
+)
+
+const defaultCORSMaxAge = 600
+
+// corsExposedHeaders are response headers browser scripts may read
+var corsExposedHeaders = strings.Join([]string{RequestIDHeader, "Retry-After"}, ", ")
+
+// corsOrigin returns the Access-Control-Allow-Origin value for a request's
+// origin, or "" when it isn't allowed
+func corsOrigin(ctx context.Context, origin string) string {
+	for _, allowed := range configFor(ctx).CORS.AllowedOrigins {
+		if allowed == "*" {
+			return "*"
+		}
+		if strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin) {
+			return origin
+		}
+	}
+	return ""
+}
+
+// WithCORS adds CORS headers for allowed origins so web map frontends can call
+// the API from the browser, and answers preflight requests itself so they
+// don't need an API key
+func WithCORS(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Add("Vary", "Origin")
+		allowed := corsOrigin(r.Context(), origin)
+		if allowed == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Access-Control-Allow-Origin", allowed)
+
+		if r.Method != http.MethodOptions || r.Header.Get("Access-Control-Request-Method") == "" {
+			w.Header().Set("Access-Control-Expose-Headers", corsExposedHeaders)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cfg := configFor(r.Context()).CORS
+		methods := cfg.AllowedMethods
+		if len(methods) == 0 {
+			methods = defaultCORSMethods
+		}
+		headers := cfg.AllowedHeaders
+		if len(headers) == 0 {
+			headers = defaultCORSHeaders
+		}
+		w.Header().Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+		w.Header().Set("Access-Control-Allow-Headers", strings.Join(headers, ", "))
+		w.Header().Set("Access-Control-Max-Age", strconv.Itoa(orDefault(cfg.MaxAge, defaultCORSMaxAge)))
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
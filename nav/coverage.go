@@ -0,0 +1,55 @@
+package nav
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// coverageRadius is how close local GTFS stops must be for an area to count as covered, in meters
+const coverageRadius = 2000
+
+// coverageCacheTTL is how long coverage checks are cached; feeds change rarely
+const coverageCacheTTL = time.Hour
+
+// coverageCache holds recent checks keyed by coordinates rounded to about 1km
+var coverageCache = newTTLCache[*TransitCoverageResponse]("coverage", coverageCacheTTL, 0)
+
+// Transit data providers reported by the coverage check
+const (
+	ProviderGTFS        = "gtfs"        // Local GTFS feeds
+	ProviderTransitland = "transitland" // Transitland API
+)
+
+// transitCoverage reports which providers have transit data around a point
+func transitCoverage(ctx context.Context, lat, lng float64) (*TransitCoverageResponse, error) {
+	key := fmt.Sprintf("%.2f,%.2f", lat, lng)
+	if coverage, ok := coverageCache.get(key); ok {
+		return coverage, nil
+	}
+
+	coverage := &TransitCoverageResponse{Providers: []string{}}
+	if feed := currentGTFS(); feed != nil && len(feed.nearbyStops(lat, lng, coverageRadius)) > 0 {
+		coverage.Providers = append(coverage.Providers, ProviderGTFS)
+	}
+
+	if configFor(ctx).TransitlandURL != "" && configFor(ctx).TransitlandAPIKey != "" {
+		_, err := nearbyAgencies(ctx, lat, lng)
+		switch err.(type) {
+		case nil:
+			coverage.Providers = append(coverage.Providers, ProviderTransitland)
+		case *ErrNoResults:
+		default:
+			// An outage doesn't mean there's no coverage, so don't cache the answer
+			if len(coverage.Providers) == 0 {
+				return nil, err
+			}
+			coverage.Available = true
+			return coverage, nil
+		}
+	}
+
+	coverage.Available = len(coverage.Providers) > 0
+	coverageCache.set(key, coverage)
+	return coverage, nil
+}
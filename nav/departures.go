@@ -0,0 +1,214 @@
+package nav
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultDeparturesLimit is the default number of departures returned
+const DefaultDeparturesLimit = 5
+
+// MaxDeparturesLimit is the largest number of departures returned
+const MaxDeparturesLimit = 20
+
+// departuresWindow is how far ahead to look for departures, in seconds
+const departuresWindow = 2 * 60 * 60
+
+type transitlandStopTime struct {
+	ServiceDate string `json:"service_date"` // YYYY-MM-DD
+	Departure   struct {
+		Scheduled    string `json:"scheduled"`     // HH:MM:SS, may exceed 24:00:00
+		Estimated    string `json:"estimated"`     // HH:MM:SS when real-time data is available
+		ScheduledUTC string `json:"scheduled_utc"` // RFC 3339
+		EstimatedUTC string `json:"estimated_utc"` // RFC 3339
+	} `json:"departure"`
+	Trip struct {
+		TripHeadsign         string           `json:"trip_headsign"`
+		WheelchairAccessible int              `json:"wheelchair_accessible"` // 0 unknown, 1 accessible, 2 not accessible
+		Route                transitlandRoute `json:"route"`
+	} `json:"trip"`
+}
+
+type transitlandDeparturesResponse struct {
+	Stops []struct {
+		transitlandStop
+		Departures []transitlandStopTime `json:"departures"`
+	} `json:"stops"`
+}
+
+// departureTime returns when a stop time departs, preferring real-time estimates.
+// Local clock times are read in the stop's timezone.
+func (st transitlandStopTime) departureTime(loc *time.Location) (time.Time, bool, error) {
+	if st.Departure.EstimatedUTC != "" {
+		t, err := time.Parse(time.RFC3339, st.Departure.EstimatedUTC)
+		return t, true, err
+	}
+	if st.Departure.ScheduledUTC != "" {
+		t, err := time.Parse(time.RFC3339, st.Departure.ScheduledUTC)
+		return t, false, err
+	}
+
+	// Fall back to the local clock time on the service date
+	clock, realtime := st.Departure.Scheduled, false
+	if st.Departure.Estimated != "" {
+		clock, realtime = st.Departure.Estimated, true
+	}
+	t, err := serviceTime(st.ServiceDate, clock, loc)
+	return t, realtime, err
+}
+
+// serviceTime converts a GTFS service date and HH:MM:SS time, which may run past
+// 24:00:00 for after-midnight trips, to an absolute time
+func serviceTime(serviceDate, clock string, loc *time.Location) (time.Time, error) {
+	date, err := time.ParseInLocation("2006-01-02", serviceDate, loc)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid service date %q", serviceDate)
+	}
+
+	parts := strings.Split(clock, ":")
+	if len(parts) != 3 {
+		return time.Time{}, fmt.Errorf("invalid time %q", clock)
+	}
+	var hms [3]int
+	for i, part := range parts {
+		if hms[i], err = strconv.Atoi(part); err != nil {
+			return time.Time{}, fmt.Errorf("invalid time %q", clock)
+		}
+	}
+
+	// GTFS times are measured from noon minus 12 hours, which matters on DST change days
+	noon := time.Date(date.Year(), date.Month(), date.Day(), 12, 0, 0, 0, loc)
+	return noon.Add(-12*time.Hour + time.Duration(hms[0])*time.Hour +
+		time.Duration(hms[1])*time.Minute + time.Duration(hms[2])*time.Second), nil
+}
+
+// departures returns the next departures from a transit stop, using the local
+// GTFS feeds for stops they contain and Transitland otherwise. With wheelchair
+// set, only trips known to be wheelchair accessible are included.
+func departures(ctx context.Context, stopID string, limit int, wheelchair bool) (*DeparturesResponse, error) {
+	if limit <= 0 {
+		limit = DefaultDeparturesLimit
+	}
+
+	if feed := currentGTFS(); feed != nil {
+		if _, ok := feed.Stops[stopID]; ok {
+			return gtfsDepartures(feed, stopID, limit, wheelchair)
+		}
+	}
+
+	// Fetch extra departures to filter from when only accessible trips are wanted
+	fetch := limit
+	if wheelchair {
+		fetch = limit * 4
+	}
+	params := url.Values{
+		"next":  {strconv.Itoa(departuresWindow)},
+		"limit": {strconv.Itoa(fetch)},
+	}
+
+	var tResp transitlandDeparturesResponse
+	if err := transitlandGet(ctx, "/rest/stops/"+url.PathEscape(stopID)+"/departures", params, &tResp); err != nil {
+		return nil, err
+	}
+
+	if len(tResp.Stops) == 0 {
+		return nil, &ErrNoResults{Query: stopID}
+	}
+
+	stop := tResp.Stops[0]
+	result := &DeparturesResponse{
+		StopID:     stop.OnestopID,
+		StopName:   stop.StopName,
+		Departures: []Departure{},
+	}
+
+	now := time.Now()
+	loc := timezoneAt(stop.Geometry.Coordinates[1], stop.Geometry.Coordinates[0])
+	for _, st := range stop.Departures {
+		if wheelchair && st.Trip.WheelchairAccessible != 1 {
+			continue
+		}
+
+		departs, realtime, err := st.departureTime(loc)
+		if err != nil {
+			continue
+		}
+
+		route := st.Trip.Route.RouteShortName
+		if route == "" {
+			route = st.Trip.Route.RouteLongName
+		}
+
+		result.Departures = append(result.Departures, Departure{
+			Route:    route,
+			Headsign: st.Trip.TripHeadsign,
+			Minutes:  max(0, int(departs.Sub(now).Minutes())),
+			Time:     departs.In(loc).Format(time.RFC3339),
+			Realtime: realtime,
+		})
+		if len(result.Departures) == limit {
+			break
+		}
+	}
+
+	return result, nil
+}
+
+// resolveStopID turns a rider-facing stop code into a stop ID using the local GTFS
+// feeds. Anything else is assumed to already be a stop ID.
+func resolveStopID(code string) string {
+	feed := currentGTFS()
+	if feed == nil {
+		return code
+	}
+	if _, ok := feed.Stops[code]; ok {
+		return code
+	}
+
+	var match *gtfsStop
+	for _, stop := range feed.Stops {
+		if stop.Code == code && (match == nil || stop.ID < match.ID) {
+			match = stop
+		}
+	}
+	if match != nil {
+		return match.ID
+	}
+	return code
+}
+
+// nearestStopID returns the ID of the closest stop to a point
+func nearestStopID(ctx context.Context, lat, lng float64) (string, error) {
+	stops, err := nearbyStops(ctx, lat, lng, MaxStopsRadius, DefaultUnit)
+	if err != nil {
+		return "", err
+	}
+	return stops[0].ID, nil
+}
+
+// departureBoardWidth keeps lines one short of 40 columns, since a full-width
+// line followed by a newline wraps to a blank line on many 8-bit screens
+const departureBoardWidth = 39
+
+// writeDepartureBoard writes departures as a fixed-width board for 40-column screens:
+// the stop name, the number of departures, then "ROUTE HEADSIGN MIN" per line.
+// Real-time departures are marked with an asterisk.
+func writeDepartureBoard(w io.Writer, board *DeparturesResponse) {
+	fmt.Fprintf(w, "%.*s\n", departureBoardWidth, board.StopName)
+	fmt.Fprintf(w, "%d\n", len(board.Departures))
+	for _, d := range board.Departures {
+		minutes := "now"
+		if d.Minutes > 0 {
+			minutes = fmt.Sprintf("%dm", d.Minutes)
+		}
+		if d.Realtime {
+			minutes += "*"
+		}
+		fmt.Fprintf(w, "%-5.5s %-27.27s %5s\n", d.Route, d.Headsign, minutes)
+	}
+}
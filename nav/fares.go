@@ -0,0 +1,133 @@
+package nav
+
+import (
+	"archive/zip"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// gtfsFare is a fare from fare_attributes.txt with the rules it applies under
+type gtfsFare struct {
+	ID            string
+	Price         float64
+	Currency      string // ISO 4217 code, e.g. USD
+	PaymentMethod int    // 0 paid on board, 1 paid before boarding
+	Rules         []gtfsFareRule
+}
+
+// gtfsFareRule is a row from fare_rules.txt. Empty fields match anything.
+type gtfsFareRule struct {
+	RouteID     string
+	Origin      string // Zone ID of the boarding stop
+	Destination string // Zone ID of the alighting stop
+}
+
+// loadFares reads the optional fare_attributes.txt and fare_rules.txt files
+func (feed *gtfsFeed) loadFares(archive *zip.ReadCloser, prefix string) error {
+	attributes, err := readGTFSTable(archive, "fare_attributes.txt")
+	if err != nil || attributes == nil {
+		return err
+	}
+
+	fares := make(map[string]*gtfsFare)
+	for _, row := range attributes.rows {
+		price, err := strconv.ParseFloat(attributes.get(row, "price"), 64)
+		if err != nil {
+			continue
+		}
+		payment, _ := strconv.Atoi(attributes.get(row, "payment_method"))
+		fare := &gtfsFare{
+			ID:            prefix + attributes.get(row, "fare_id"),
+			Price:         price,
+			Currency:      attributes.get(row, "currency_type"),
+			PaymentMethod: payment,
+		}
+		fares[fare.ID] = fare
+		feed.Fares = append(feed.Fares, fare)
+	}
+
+	rules, err := readGTFSTable(archive, "fare_rules.txt")
+	if err != nil || rules == nil {
+		return err
+	}
+	for _, row := range rules.rows {
+		fare, ok := fares[prefix+rules.get(row, "fare_id")]
+		if !ok {
+			continue
+		}
+		rule := gtfsFareRule{
+			Origin:      rules.get(row, "origin_id"),
+			Destination: rules.get(row, "destination_id"),
+		}
+		if id := rules.get(row, "route_id"); id != "" {
+			rule.RouteID = prefix + id
+		}
+		fare.Rules = append(fare.Rules, rule)
+	}
+	return nil
+}
+
+// fareFor returns the cheapest fare for riding a route between two stops. Fares
+// without rules apply to every trip in their feed.
+func (feed *gtfsFeed) fareFor(route *gtfsRoute, from, to *gtfsStop) *gtfsFare {
+	feedPrefix, _, _ := strings.Cut(route.ID, ":")
+	var best *gtfsFare
+	for _, fare := range feed.Fares {
+		if !strings.HasPrefix(fare.ID, feedPrefix+":") {
+			continue
+		}
+
+		applies := len(fare.Rules) == 0
+		for _, rule := range fare.Rules {
+			if (rule.RouteID == "" || rule.RouteID == route.ID) &&
+				(rule.Origin == "" || rule.Origin == from.Zone) &&
+				(rule.Destination == "" || rule.Destination == to.Zone) {
+				applies = true
+				break
+			}
+		}
+		if applies && (best == nil || fare.Price < best.Price) {
+			best = fare
+		}
+	}
+	return best
+}
+
+// formatFare formats a price for plain-text screens, using $ for dollar currencies
+// and the ISO code otherwise
+func formatFare(price float64, currency string) string {
+	switch strings.ToUpper(currency) {
+	case "", "USD", "CAD", "AUD", "NZD":
+		return fmt.Sprintf("$%.2f", price)
+	default:
+		return fmt.Sprintf("%.2f %s", price, strings.ToUpper(currency))
+	}
+}
+
+// fareDescription summarizes the zones and fare for a transit leg, e.g.
+// "zone 1 to 2, $2.50 paid on board". Unknown parts are left out.
+func fareDescription(fromZone, toZone, price string, payment string) string {
+	var parts []string
+	switch {
+	case fromZone != "" && toZone != "" && fromZone != toZone:
+		parts = append(parts, fmt.Sprintf("zone %s to %s", fromZone, toZone))
+	case fromZone != "":
+		parts = append(parts, fmt.Sprintf("zone %s", fromZone))
+	}
+	if price != "" {
+		if payment != "" {
+			price += " " + payment
+		}
+		parts = append(parts, price)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// paymentDescription describes a GTFS payment_method
+func paymentDescription(method int) string {
+	if method == 1 {
+		return "paid before boarding"
+	}
+	return "paid on board"
+}
@@ -0,0 +1,66 @@
+package nav
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// fieldTree is a set of selected JSON fields, with nested selections under each
+// name. An empty tree under a name keeps the whole value.
+type fieldTree map[string]fieldTree
+
+// parseFields builds a field tree from dotted paths like "steps.description"
+func parseFields(paths []string) fieldTree {
+	tree := fieldTree{}
+	for _, path := range paths {
+		node := tree
+		for _, name := range strings.Split(path, ".") {
+			if name == "" {
+				continue
+			}
+			if node[name] == nil {
+				node[name] = fieldTree{}
+			}
+			node = node[name]
+		}
+	}
+	return tree
+}
+
+// prune keeps only the selected fields of a decoded JSON value. Selections
+// apply to each element of arrays.
+func (t fieldTree) prune(v interface{}) interface{} {
+	if len(t) == 0 {
+		return v
+	}
+	switch v := v.(type) {
+	case map[string]interface{}:
+		pruned := make(map[string]interface{}, len(t))
+		for name, sub := range t {
+			if value, ok := v[name]; ok {
+				pruned[name] = sub.prune(value)
+			}
+		}
+		return pruned
+	case []interface{}:
+		for i := range v {
+			v[i] = t.prune(v[i])
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// selectFields returns a value reduced to the selected fields, using their JSON names
+func selectFields(v interface{}, paths []string) (interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var decoded interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return nil, err
+	}
+	return parseFields(paths).prune(decoded), nil
+}
@@ -0,0 +1,147 @@
+package nav
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+)
+
+// Default and allowed sizes for map framebuffers, in pixels. 160x192 at 2 bits
+// is an Atari ANTIC mode E screen; 320x200 is the CGA and C64 screen size.
+const (
+	DefaultFramebufferWidth  = 160
+	DefaultFramebufferHeight = 192
+	MaxFramebufferWidth      = 320
+	MaxFramebufferHeight     = 200
+	DefaultFramebufferBits   = 2
+	MaxPixelAspect           = 4
+)
+
+// framebufferMapStyle draws routes in black on white with a white start
+// marker, so they stay visible once dithered to a few gray levels
+var framebufferMapStyle = mapStyle{
+	background:   color.White,
+	padding:      8,
+	lineRadius:   1,
+	line:         color.Black,
+	markerRadius: 3,
+	outline:      color.Black,
+	start:        color.White,
+	end:          color.Black,
+}
+
+// Fixed palettes, in index order
+var (
+	cgaPalette = color.Palette{
+		color.RGBA{0x00, 0x00, 0x00, 0xFF}, // Black
+		color.RGBA{0x55, 0xFF, 0xFF, 0xFF}, // Light cyan
+		color.RGBA{0xFF, 0x55, 0xFF, 0xFF}, // Light magenta
+		color.RGBA{0xFF, 0xFF, 0xFF, 0xFF}, // White
+	}
+	c64Palette = color.Palette{
+		color.RGBA{0x00, 0x00, 0x00, 0xFF}, // Black
+		color.RGBA{0xFF, 0xFF, 0xFF, 0xFF}, // White
+		color.RGBA{0x68, 0x37, 0x2B, 0xFF}, // Red
+		color.RGBA{0x70, 0xA4, 0xB2, 0xFF}, // Cyan
+		color.RGBA{0x6F, 0x3D, 0x86, 0xFF}, // Purple
+		color.RGBA{0x58, 0x8D, 0x43, 0xFF}, // Green
+		color.RGBA{0x35, 0x28, 0x79, 0xFF}, // Blue
+		color.RGBA{0xB8, 0xC7, 0x6F, 0xFF}, // Yellow
+		color.RGBA{0x6F, 0x4F, 0x25, 0xFF}, // Orange
+		color.RGBA{0x43, 0x39, 0x00, 0xFF}, // Brown
+		color.RGBA{0x9A, 0x67, 0x59, 0xFF}, // Light red
+		color.RGBA{0x44, 0x44, 0x44, 0xFF}, // Dark grey
+		color.RGBA{0x6C, 0x6C, 0x6C, 0xFF}, // Grey
+		color.RGBA{0x9A, 0xD2, 0x84, 0xFF}, // Light green
+		color.RGBA{0x6C, 0x5E, 0xB5, 0xFF}, // Light blue
+		color.RGBA{0x95, 0x95, 0x95, 0xFF}, // Light grey
+	}
+)
+
+// framebufferPalette returns the colors for a palette at a pixel depth
+func framebufferPalette(palette Palette, bits int) (color.Palette, error) {
+	switch palette {
+	case PaletteGray:
+		levels := 1 << bits
+		grays := make(color.Palette, levels)
+		for i := range grays {
+			grays[i] = color.Gray{Y: uint8(i * 255 / (levels - 1))}
+		}
+		return grays, nil
+	case PaletteCGA:
+		if bits != 2 {
+			return nil, fmt.Errorf("the %s palette needs bits=2", palette)
+		}
+		return cgaPalette, nil
+	case PaletteC64:
+		if bits != 4 {
+			return nil, fmt.Errorf("the %s palette needs bits=4", palette)
+		}
+		return c64Palette, nil
+	default:
+		return nil, fmt.Errorf("invalid palette: %s", palette)
+	}
+}
+
+// squeezeWidth averages each run of aspect columns into one, for screens
+// whose pixels are wider than they are tall
+func squeezeWidth(img *image.RGBA, aspect int) *image.RGBA {
+	if aspect <= 1 {
+		return img
+	}
+	bounds := img.Bounds()
+	out := image.NewRGBA(image.Rect(0, 0, bounds.Dx()/aspect, bounds.Dy()))
+	for y := 0; y < out.Rect.Dy(); y++ {
+		for x := 0; x < out.Rect.Dx(); x++ {
+			var r, g, b int
+			for i := 0; i < aspect; i++ {
+				c := img.RGBAAt(x*aspect+i, y)
+				r, g, b = r+int(c.R), g+int(c.G), b+int(c.B)
+			}
+			out.SetRGBA(x, y, color.RGBA{uint8(r / aspect), uint8(g / aspect), uint8(b / aspect), 0xFF})
+		}
+	}
+	return out
+}
+
+// packFramebuffer packs palette indexes into rows of bits-deep pixels, each
+// row padded to a whole byte, with the leftmost pixel in the most significant bits
+func packFramebuffer(img *image.Paletted, bits int) []byte {
+	width, height := img.Rect.Dx(), img.Rect.Dy()
+	pixelsPerByte := 8 / bits
+	rowBytes := (width + pixelsPerByte - 1) / pixelsPerByte
+	framebuffer := make([]byte, rowBytes*height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			shift := 8 - bits*(x%pixelsPerByte+1)
+			framebuffer[y*rowBytes+x/pixelsPerByte] |= img.ColorIndexAt(x, y) << shift
+		}
+	}
+	return framebuffer
+}
+
+// renderFramebuffer draws [lat, lng] pairs as a map like renderStaticMap,
+// Floyd-Steinberg dithered to a palette and packed as a raw framebuffer
+func renderFramebuffer(ctx context.Context, points [][2]float64, width, height, bits, aspect int, palette Palette, tiles bool) ([]byte, error) {
+	colors, err := framebufferPalette(palette, bits)
+	if err != nil {
+		return nil, err
+	}
+
+	// Draw wide-pixel screens at their displayed proportions, then squeeze
+	img := squeezeWidth(renderStaticMap(ctx, points, width*aspect, height, tiles, framebufferMapStyle), aspect)
+	dithered := image.NewPaletted(img.Bounds(), colors)
+	draw.FloydSteinberg.Draw(dithered, dithered.Bounds(), img, image.Point{})
+	return packFramebuffer(dithered, bits), nil
+}
+
+// routeFramebuffer renders a stored route's full-resolution path as a dithered map framebuffer
+func routeFramebuffer(ctx context.Context, routeID string, width, height, bits, aspect int, palette Palette, tiles bool) ([]byte, error) {
+	track, ok := routeStore.get(routeID)
+	if !ok {
+		return nil, &ErrNoResults{Query: routeID}
+	}
+	return renderFramebuffer(ctx, track.Points, width, height, bits, aspect, palette, tiles)
+}
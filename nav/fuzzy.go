@@ -0,0 +1,130 @@
+package nav
+
+import (
+	"context"
+	"strings"
+	"unicode"
+)
+
+// maxFuzzyAttempts caps the number of alternate queries tried after a query finds nothing
+const maxFuzzyAttempts = 4
+
+// Common abbreviations expanded when retrying a query, in addition to the
+// street type and direction abbreviations used for formatting
+var fuzzyExpansions = map[string]string{
+	"mt":   "mount",
+	"ft":   "fort",
+	"pt":   "point",
+	"hwy":  "highway",
+	"rte":  "route",
+	"ctr":  "center",
+	"apt":  "apartment",
+	"univ": "university",
+	"intl": "international",
+	"natl": "national",
+}
+
+// expandAbbreviation returns the long form of an abbreviated word, or the word itself
+func expandAbbreviation(word string) string {
+	lower := strings.ToLower(word)
+	if expanded, ok := fuzzyExpansions[lower]; ok {
+		return expanded
+	}
+	abbrevs := abbreviations.Load()
+	for long, short := range abbrevs.streetTypes {
+		if strings.ToLower(short) == lower && long != lower && !strings.HasPrefix(long, "-") {
+			return long
+		}
+	}
+	for long, short := range abbrevs.directions {
+		if strings.ToLower(short) == lower {
+			return long
+		}
+	}
+	for long, short := range abbrevs.states {
+		if strings.ToLower(short) == lower {
+			return long
+		}
+	}
+	return word
+}
+
+// stripPunctuation replaces punctuation other than commas with spaces and collapses whitespace
+func stripPunctuation(query string) string {
+	cleaned := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == ',' {
+			return r
+		}
+		return ' '
+	}, query)
+	return strings.Join(strings.Fields(cleaned), " ")
+}
+
+// fuzzyQueryVariants returns alternate spellings of a query to try when it finds
+// nothing: stripped of punctuation, with abbreviations expanded, and reordered
+func fuzzyQueryVariants(query string) []string {
+	var variants []string
+	seen := map[string]bool{strings.ToLower(strings.TrimSpace(query)): true}
+	add := func(variant string) {
+		key := strings.ToLower(variant)
+		if variant != "" && !seen[key] {
+			seen[key] = true
+			variants = append(variants, variant)
+		}
+	}
+
+	// Without punctuation, e.g. "St. Louis" becomes "St Louis"
+	stripped := stripPunctuation(query)
+	add(stripped)
+
+	// With abbreviations expanded, e.g. "St Louis" becomes "saint Louis"
+	// and "Springfield IL" becomes "Springfield illinois"
+	words := strings.Fields(strings.ReplaceAll(stripped, ",", " , "))
+	for i, word := range words {
+		// "St" leading a name is Saint, anywhere else it's Street
+		if strings.EqualFold(word, "st") && (i == 0 || words[i-1] == ",") {
+			words[i] = "saint"
+			continue
+		}
+		words[i] = expandAbbreviation(word)
+	}
+	add(strings.ReplaceAll(strings.Join(words, " "), " , ", ", "))
+
+	// Reordered, moving the first comma-separated part to the end, e.g.
+	// "Springfield, 123 Main St" becomes "123 Main St, Springfield"
+	if parts := strings.Split(stripped, ","); len(parts) > 1 {
+		rotated := append(parts[1:], parts[0])
+		for i := range rotated {
+			rotated[i] = strings.TrimSpace(rotated[i])
+		}
+		add(strings.Join(rotated, ", "))
+	} else if fields := strings.Fields(stripped); len(fields) > 1 {
+		// Swap the first two words, e.g. "Central Cafe" becomes "Cafe Central"
+		fields[0], fields[1] = fields[1], fields[0]
+		add(strings.Join(fields, " "))
+	}
+
+	if len(variants) > maxFuzzyAttempts {
+		variants = variants[:maxFuzzyAttempts]
+	}
+	return variants
+}
+
+// geocodeFuzzy retries a query that found nothing using alternate spellings,
+// returning the results of the first variant that matches
+func geocodeFuzzy(ctx context.Context, req GeocodeRequest) ([]GeocodeResponse, error) {
+	for _, variant := range fuzzyQueryVariants(req.Query) {
+		geocodeLog.DebugContext(ctx, "Geocode retrying with variant", "query", req.Query, "variant", variant)
+
+		retry := req
+		retry.Query = variant
+		results, err := geocodeNominatim(ctx, retry)
+		if err == nil {
+			return results, nil
+		}
+		if _, ok := err.(*ErrNoResults); !ok {
+			return nil, err
+		}
+	}
+	return nil, &ErrNoResults{Query: req.Query}
+}
@@ -0,0 +1,225 @@
+package nav
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// gazetteerEntry is a single place loaded from a GeoNames extract
+type gazetteerEntry struct {
+	Name         string
+	Lat          float64
+	Lng          float64
+	FeatureClass string // GeoNames feature class, P for populated places, A for admin areas
+	Country      string // Two-letter ISO country code, lowercase
+	Admin1       string // First-level admin code, the state abbreviation in the US
+	Population   int
+}
+
+// gazetteer is an in-memory index of places keyed by normalized name
+type gazetteer struct {
+	byName map[string][]*gazetteerEntry
+}
+
+var (
+	gazetteerMu   sync.Mutex
+	gazetteerData *gazetteer
+	gazetteerPath string
+)
+
+// GeoNames dump column positions, see https://download.geonames.org/export/dump/readme.txt
+const (
+	geonamesName           = 1
+	geonamesASCIIName      = 2
+	geonamesAlternateNames = 3
+	geonamesLatitude       = 4
+	geonamesLongitude      = 5
+	geonamesFeatureClass   = 6
+	geonamesCountryCode    = 8
+	geonamesAdmin1         = 10
+	geonamesPopulation     = 14
+	geonamesMinColumns     = 15
+)
+
+// normalizeGazetteerName lowercases and collapses whitespace for lookups
+func normalizeGazetteerName(name string) string {
+	return strings.Join(strings.Fields(strings.ToLower(name)), " ")
+}
+
+// loadGazetteer reads a tab-separated GeoNames extract such as cities15000.txt
+func loadGazetteer(filename string) (*gazetteer, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("error opening gazetteer: %v", err)
+	}
+	defer file.Close()
+
+	g := &gazetteer{byName: make(map[string][]*gazetteerEntry)}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024) // alternate names can be long
+
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) < geonamesMinColumns {
+			continue
+		}
+
+		lat, err := strconv.ParseFloat(fields[geonamesLatitude], 64)
+		if err != nil {
+			continue
+		}
+		lng, err := strconv.ParseFloat(fields[geonamesLongitude], 64)
+		if err != nil {
+			continue
+		}
+		population, _ := strconv.Atoi(fields[geonamesPopulation])
+
+		entry := &gazetteerEntry{
+			Name:         fields[geonamesName],
+			Lat:          lat,
+			Lng:          lng,
+			FeatureClass: fields[geonamesFeatureClass],
+			Country:      strings.ToLower(fields[geonamesCountryCode]),
+			Admin1:       fields[geonamesAdmin1],
+			Population:   population,
+		}
+
+		// Index the entry under its name, ASCII name, and alternate names
+		names := []string{fields[geonamesName], fields[geonamesASCIIName]}
+		names = append(names, strings.Split(fields[geonamesAlternateNames], ",")...)
+		seen := make(map[string]bool)
+		for _, name := range names {
+			key := normalizeGazetteerName(name)
+			if key == "" || seen[key] {
+				continue
+			}
+			seen[key] = true
+			g.byName[key] = append(g.byName[key], entry)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading gazetteer: %v", err)
+	}
+
+	return g, nil
+}
+
+// openGazetteer returns the configured gazetteer, loading it on first use
+func openGazetteer() (*gazetteer, error) {
+	gazetteerMu.Lock()
+	defer gazetteerMu.Unlock()
+
+	if currentConfig().GazetteerFile == "" {
+		return nil, fmt.Errorf("gazetteer not configured")
+	}
+
+	// Reuse the loaded gazetteer unless the configured path has changed
+	if gazetteerData != nil && gazetteerPath == currentConfig().GazetteerFile {
+		return gazetteerData, nil
+	}
+
+	g, err := loadGazetteer(currentConfig().GazetteerFile)
+	if err != nil {
+		return nil, err
+	}
+	gazetteerData = g
+	gazetteerPath = currentConfig().GazetteerFile
+
+	dataLog.Info("Loaded gazetteer", "names", len(g.byName), "file", currentConfig().GazetteerFile)
+
+	return gazetteerData, nil
+}
+
+// search looks up places by name. A query like "Springfield, IL" or
+// "Paris, FR" narrows matches by first-level admin code or country.
+func (g *gazetteer) search(req GeocodeRequest) []GeocodeResponse {
+	parts := strings.Split(req.Query, ",")
+	name := normalizeGazetteerName(parts[0])
+	var qualifier string
+	if len(parts) > 1 {
+		qualifier = strings.ToLower(strings.TrimSpace(parts[len(parts)-1]))
+	}
+
+	var matches []*gazetteerEntry
+	for _, entry := range g.byName[name] {
+		if qualifier != "" && !entry.matchesQualifier(qualifier) {
+			continue
+		}
+		if len(req.CountryCodes) > 0 && !containsCountry(req.CountryCodes, entry.Country) {
+			continue
+		}
+		matches = append(matches, entry)
+	}
+
+	// Most populous places first
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].Population > matches[j].Population
+	})
+
+	var results []GeocodeResponse
+	for _, entry := range matches {
+		layer, placeType := LayerLocality, "city"
+		if entry.FeatureClass == "A" {
+			layer, placeType = LayerAdmin, "administrative"
+		}
+		if !hasLayer(req.Layers, layer) {
+			continue
+		}
+
+		addr := nominatimAddress{City: entry.Name, State: entry.Admin1, Country: entry.Country}
+		_, formatted, country := formatAddress(addr, nil, "", true)
+
+		results = append(results, GeocodeResponse{
+			Name:     entry.Name,
+			Address:  formatted,
+			Lat:      entry.Lat,
+			Lng:      entry.Lng,
+			Country:  country,
+			PlusCode: encodePlusCode(entry.Lat, entry.Lng),
+			Layer:    string(layer),
+			Category: "place",
+			Type:     placeType,
+		})
+		if len(results) == geocodeResultLimit {
+			break
+		}
+	}
+
+	return results
+}
+
+// matchesQualifier checks a lowercase qualifier against the entry's admin area and country,
+// accepting full US state names as well as their abbreviations
+func (e *gazetteerEntry) matchesQualifier(qualifier string) bool {
+	admin1 := strings.ToLower(e.Admin1)
+	return qualifier == admin1 || qualifier == e.Country || strings.ToLower(abbreviateState(qualifier)) == admin1
+}
+
+// containsCountry checks if the country is in the list of country codes
+func containsCountry(codes []CountryCode, country string) bool {
+	for _, c := range codes {
+		if string(c) == country {
+			return true
+		}
+	}
+	return false
+}
+
+// geocodeGazetteer searches the local gazetteer, used when Nominatim is unreachable
+func geocodeGazetteer(req GeocodeRequest) ([]GeocodeResponse, error) {
+	g, err := openGazetteer()
+	if err != nil {
+		return nil, err
+	}
+
+	results := g.search(req)
+	if len(results) == 0 {
+		return nil, &ErrNoResults{Query: req.Query}
+	}
+	return results, nil
+}
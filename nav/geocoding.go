@@ -1,16 +1,24 @@
 package nav
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/url"
+	"sort"
+	"strconv"
 	"strings"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel/attribute"
 )
 
-// Maps for address abbreviations
+// Built-in address abbreviations, keyed by lowercase long form. Street types
+// starting with "-" match the end of a word, for languages that attach them,
+// e.g. "-straße" abbreviates Hauptstraße to Hauptstr.
 var (
-	directionAbbrev = map[string]string{
+	defaultDirectionAbbrev = map[string]string{
 		"north":     "N",
 		"south":     "S",
 		"east":      "E",
@@ -21,7 +29,7 @@ var (
 		"southwest": "SW",
 	}
 
-	streetTypeAbbrev = map[string]string{
+	defaultStreetTypeAbbrev = map[string]string{
 		"avenue":     "Ave",
 		"boulevard":  "Blvd",
 		"circle":     "Cir",
@@ -44,7 +52,7 @@ var (
 		"way":        "Way",
 	}
 
-	stateAbbrev = map[string]string{
+	defaultStateAbbrev = map[string]string{
 		"alabama":        "AL",
 		"alaska":         "AK",
 		"arizona":        "AZ",
@@ -98,6 +106,49 @@ var (
 	}
 )
 
+// abbreviationSet is the address abbreviations in use: the built-in ones with
+// any configured changes, replaced as a whole on reload
+type abbreviationSet struct {
+	directions  map[string]string
+	streetTypes map[string]string
+	states      map[string]string
+	countries   []string // Codes of the countries whose addresses are also abbreviated
+}
+
+var abbreviations atomic.Pointer[abbreviationSet]
+
+func init() {
+	abbreviations.Store(&abbreviationSet{directions: defaultDirectionAbbrev, streetTypes: defaultStreetTypeAbbrev, states: defaultStateAbbrev})
+}
+
+// setAbbreviations applies configured abbreviations over the built-in ones
+func setAbbreviations(cfg AbbreviationConfig) {
+	abbreviations.Store(&abbreviationSet{
+		directions:  mergeAbbreviations(defaultDirectionAbbrev, cfg.Directions),
+		streetTypes: mergeAbbreviations(defaultStreetTypeAbbrev, cfg.StreetTypes),
+		states:      mergeAbbreviations(defaultStateAbbrev, cfg.States),
+		countries:   cfg.Countries,
+	})
+}
+
+// mergeAbbreviations returns the defaults with overrides added or replaced,
+// removing entries overridden with an empty abbreviation
+func mergeAbbreviations(defaults, overrides map[string]string) map[string]string {
+	merged := make(map[string]string, len(defaults)+len(overrides))
+	for long, short := range defaults {
+		merged[long] = short
+	}
+	for long, short := range overrides {
+		long = strings.ToLower(long)
+		if short == "" {
+			delete(merged, long)
+			continue
+		}
+		merged[long] = short
+	}
+	return merged
+}
+
 // ErrNoResults is returned when no geocoding results are found
 type ErrNoResults struct {
 	Query string
@@ -119,38 +170,136 @@ type nominatimAddress struct {
 	PostCode    string `json:"postcode"`
 	Name        string `json:"name"`
 	Country     string `json:"country_code"` // Two-letter ISO country code
+	CountryName string `json:"country"`
+	ISO3166Lvl4 string `json:"ISO3166-2-lvl4"` // State-level subdivision code, e.g. US-IL
 }
 
+// nominatimNameDetails holds all name tags of a place, e.g. name, official_name, name:de
+type nominatimNameDetails map[string]string
+
 type nominatimResponse struct {
-	DisplayName string `json:"display_name"`
-	NameDetails struct {
-		Name     string `json:"name"`
-		Official string `json:"official_name"`
-		Alt      string `json:"alt_name"`
-	} `json:"namedetails"`
-	Lat        string           `json:"lat"`
-	Lon        string           `json:"lon"`
-	Address    nominatimAddress `json:"address"`
-	Importance float64          `json:"importance"`
+	DisplayName string               `json:"display_name"`
+	NameDetails nominatimNameDetails `json:"namedetails"`
+	Lat         string               `json:"lat"`
+	Lon         string               `json:"lon"`
+	Address     nominatimAddress     `json:"address"`
+	Importance  float64              `json:"importance"`
+	Class       string               `json:"class"`
+	Type        string               `json:"type"`
+	PlaceRank   int                  `json:"place_rank"`
+	BoundingBox []string             `json:"boundingbox"` // [south, north, west, east]
+	GeoJSON     *nominatimGeometry   `json:"geojson"`     // Only present with polygon_geojson=1
+}
+
+// localityTypes are the place types treated as localities rather than addresses
+var localityTypes = map[string]bool{
+	"city":              true,
+	"town":              true,
+	"village":           true,
+	"hamlet":            true,
+	"suburb":            true,
+	"quarter":           true,
+	"neighbourhood":     true,
+	"borough":           true,
+	"municipality":      true,
+	"locality":          true,
+	"isolated_dwelling": true,
+}
+
+// resultLayer classifies a Nominatim result into one of our geocode layers
+func resultLayer(result nominatimResponse) GeocodeLayer {
+	switch {
+	case result.Class == "place" && localityTypes[result.Type]:
+		return LayerLocality
+	case result.Class == "boundary" && result.Type == "administrative":
+		// Boundaries for cities and towns are localities, larger areas are admin
+		if result.PlaceRank >= 13 {
+			return LayerLocality
+		}
+		return LayerAdmin
+	case result.Class == "place" && (result.Type == "country" || result.Type == "state" || result.Type == "county" ||
+		result.Type == "region" || result.Type == "province"):
+		return LayerAdmin
+	case result.Class == "highway" || result.Class == "building" ||
+		(result.Class == "place" && (result.Type == "house" || result.Type == "postcode")):
+		return LayerAddress
+	default:
+		return LayerPOI
+	}
+}
+
+// nominatimLayerParams maps our geocode layers onto Nominatim's layer and featureType filters
+func nominatimLayerParams(layers []GeocodeLayer, params url.Values) {
+	var nominatimLayers []string
+	seen := make(map[string]bool)
+	for _, layer := range layers {
+		name := "address"
+		if layer == LayerPOI {
+			name = "poi"
+		}
+		if !seen[name] {
+			seen[name] = true
+			nominatimLayers = append(nominatimLayers, name)
+		}
+	}
+	params.Set("layer", strings.Join(nominatimLayers, ","))
+
+	// Narrow to populated places when only localities are wanted
+	if len(layers) == 1 && layers[0] == LayerLocality {
+		params.Set("featureType", "settlement")
+	}
+}
+
+// hasLayer checks if the layer is among the requested layers, where no layers means all
+func hasLayer(layers []GeocodeLayer, layer GeocodeLayer) bool {
+	if len(layers) == 0 {
+		return true
+	}
+	for _, l := range layers {
+		if l == layer {
+			return true
+		}
+	}
+	return false
 }
 
 // Helper functions for address abbreviations
 func abbreviateDirection(word string) string {
-	if abbrev, ok := directionAbbrev[strings.ToLower(word)]; ok {
+	if abbrev, ok := abbreviations.Load().directions[strings.ToLower(word)]; ok {
 		return abbrev
 	}
 	return word
 }
 
 func abbreviateStreetType(word string) string {
-	if abbrev, ok := streetTypeAbbrev[strings.ToLower(word)]; ok {
+	lower := strings.ToLower(word)
+	if abbrev, ok := abbreviations.Load().streetTypes[lower]; ok {
 		return abbrev
 	}
-	return word
+	return abbreviateStreetSuffix(word)
+}
+
+// abbreviateStreetSuffix abbreviates a street type attached to the end of a
+// word, preferring the longest match
+func abbreviateStreetSuffix(word string) string {
+	lower := strings.ToLower(word)
+	if len(lower) != len(word) {
+		return word
+	}
+	var suffix, abbrev string
+	for long, short := range abbreviations.Load().streetTypes {
+		if s, ok := strings.CutPrefix(long, "-"); ok && len(s) > len(suffix) && len(s) < len(lower) && strings.HasSuffix(lower, s) {
+			suffix, abbrev = s, short
+		}
+	}
+	if suffix == "" {
+		return word
+	}
+	return word[:len(word)-len(suffix)] + abbrev
 }
 
 func abbreviateState(state string) string {
-	if abbrev, ok := stateAbbrev[strings.ToLower(state)]; ok {
+	if abbrev, ok := abbreviations.Load().states[strings.ToLower(state)]; ok {
 		return abbrev
 	}
 	return state
@@ -161,40 +310,42 @@ func abbreviateStreetName(street string) string {
 	if len(words) == 0 {
 		return street
 	}
+	if len(words) == 1 {
+		return abbreviateStreetSuffix(street)
+	}
 
 	// Check if the first word is a direction
 	if len(words) > 1 {
 		words[0] = abbreviateDirection(words[0])
 	}
 
-	// Check if the last word is a street type
+	// Check if the last word is a street type, or failing that the first, for
+	// languages that put it first, e.g. Calle Mayor
 	if len(words) > 1 {
-		words[len(words)-1] = abbreviateStreetType(words[len(words)-1])
+		last := words[len(words)-1]
+		if words[len(words)-1] = abbreviateStreetType(last); words[len(words)-1] == last {
+			words[0] = abbreviateStreetType(words[0])
+		}
 	}
 
 	return strings.Join(words, " ")
 }
 
-func formatAddress(addr nominatimAddress, nameDetails struct {
-	Name     string `json:"name"`
-	Official string `json:"official_name"`
-	Alt      string `json:"alt_name"`
-}) (name string, formattedAddr string, countryCode string) {
-	// Try to get the best name from namedetails
-	name = nameDetails.Official
-	if name == "" {
-		name = nameDetails.Name
-	}
-	if name == "" {
-		name = nameDetails.Alt
-	}
-
-	// If no name from namedetails, try address components
-	if name == "" {
-		name = addr.Name
+// primaryLanguage extracts the first language subtag from a language preference
+// such as "de-CH,de;q=0.9,en;q=0.8", returning "de"
+func primaryLanguage(lang string) string {
+	lang = strings.Split(lang, ",")[0]
+	lang = strings.Split(lang, ";")[0]
+	lang = strings.Split(lang, "-")[0]
+	lang = strings.ToLower(strings.TrimSpace(lang))
+	if lang == "*" {
+		return ""
 	}
+	return lang
+}
 
-	// Try to get the city name from various fields
+// cityName tries to get the city name from various address fields
+func cityName(addr nominatimAddress) string {
 	city := addr.City
 	if city == "" {
 		city = addr.Town
@@ -208,66 +359,318 @@ func formatAddress(addr nominatimAddress, nameDetails struct {
 	if city == "" && addr.County != "" {
 		city = addr.County
 	}
+	return city
+}
 
-	// Build the street address with abbreviations
-	var streetParts []string
-	if addr.HouseNumber != "" {
-		streetParts = append(streetParts, addr.HouseNumber)
+func formatAddress(addr nominatimAddress, nameDetails nominatimNameDetails, lang string, abbreviate bool) (name string, formattedAddr string, countryCode string) {
+	// Try to get the best name from namedetails, preferring the requested language
+	if lang = primaryLanguage(lang); lang != "" {
+		name = nameDetails["name:"+lang]
+	}
+	if name == "" {
+		name = nameDetails["official_name"]
 	}
-	if addr.Road != "" {
-		streetParts = append(streetParts, abbreviateStreetName(addr.Road))
+	if name == "" {
+		name = nameDetails["name"]
+	}
+	if name == "" {
+		name = nameDetails["alt_name"]
+	}
+
+	// If no name from namedetails, try address components
+	if name == "" {
+		name = addr.Name
+	}
+
+	// Pick address conventions based on the country
+	format := lookupAddressFormat(addr.Country)
+	if !abbreviate {
+		format.AbbreviateStreet, format.AbbreviateState = false, false
 	}
-	streetAddress := strings.Join(streetParts, " ")
+	streetAddress := format.streetAddress(addr)
 
 	// If still no name, use abbreviated street address
 	if name == "" {
 		name = streetAddress
 	}
 
-	// Build the formatted address in US format
-	var addrParts []string
-	if streetAddress != "" {
-		addrParts = append(addrParts, streetAddress)
+	// Build the formatted address
+	addrParts := []string{streetAddress, format.locality(addr, cityName(addr))}
+
+	return name, joinNonEmpty(addrParts, ", "), strings.ToLower(addr.Country)
+}
+
+// geocodeResultLimit is the maximum number of results returned by geocode
+const geocodeResultLimit = 5
+
+// geocodeFetchLimit is the number of results requested from Nominatim, leaving
+// room for duplicates and low-importance results to be filtered out
+const geocodeFetchLimit = 15
+
+// geocodeCacheKey builds a cache key from the normalized query and its filters
+func geocodeCacheKey(req GeocodeRequest) string {
+	codes := make([]string, len(req.CountryCodes))
+	for i, c := range req.CountryCodes {
+		codes[i] = string(c)
+	}
+	sort.Strings(codes)
+
+	layers := make([]string, len(req.Layers))
+	for i, l := range req.Layers {
+		layers[i] = string(l)
+	}
+	sort.Strings(layers)
+
+	query := strings.Join(strings.Fields(strings.ToLower(req.Query)), " ")
+	return query + "|" + strings.Join(codes, ",") + "|" + strings.ToLower(req.Language) + "|" + strings.Join(layers, ",") +
+		"|" + strconv.FormatBool(req.Unabbreviated)
+}
+
+// geocode performs geocoding, serving repeated queries from the cache when
+// enabled, or returns canned results when providers are mocked
+func geocode(ctx context.Context, req GeocodeRequest) (results []GeocodeResponse, err error) {
+	ctx, span := startSpan(ctx, "geocode")
+	defer func() {
+		spanError(span, err)
+		span.End()
+	}()
+	// Plus codes and three word addresses are resolved directly rather than searched for
+	if looksLikePlusCode(req.Query) {
+		return geocodePlusCode(ctx, req.Query)
+	}
+	if looksLikeWhat3Words(req.Query) {
+		return geocodeWhat3Words(ctx, req.Query)
+	}
+	if mockProviders(ctx) {
+		return mockGeocode(req), nil
+	}
+
+	geocodeCache := stateFor(ctx).geocodeCache
+	if geocodeCache == nil {
+		results, _, err := geocodeWithFallback(ctx, req)
+		return results, err
+	}
+
+	key := geocodeCacheKey(req)
+	if results, ok := geocodeCache.get(key); ok {
+		geocodeLog.DebugContext(ctx, "Geocode cache hit", "key", key)
+		span.SetAttributes(attribute.Bool("cache_hit", true))
+		return results, nil
+	}
+
+	results, fellBack, err := geocodeWithFallback(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	// Gazetteer results stand in while Nominatim is down, so they aren't
+	// kept once it's back
+	if !fellBack {
+		geocodeCache.set(key, results)
+	}
+
+	return results, nil
+}
+
+// geocodeWithFallback queries Nominatim, retrying with alternate spellings when
+// nothing is found and falling back to the local gazetteer when Nominatim is
+// unreachable or failing. It reports whether the results came from the
+// gazetteer.
+func geocodeWithFallback(ctx context.Context, req GeocodeRequest) ([]GeocodeResponse, bool, error) {
+	results, err := geocodeNominatim(ctx, req)
+	if _, ok := err.(*ErrNoResults); ok {
+		// Typos are common on retro keyboards, so try some alternate spellings
+		results, err = geocodeFuzzy(ctx, req)
+		return results, false, err
+	}
+	if err == nil || configFor(ctx).GazetteerFile == "" {
+		return results, false, err
+	}
+
+	geocodeLog.WarnContext(ctx, "Nominatim failed, falling back to gazetteer", "error", err)
+	fallback, fallbackErr := geocodeGazetteer(req)
+	if fallbackErr != nil {
+		if _, ok := fallbackErr.(*ErrNoResults); ok {
+			return nil, true, fallbackErr
+		}
+		// Report the original upstream failure rather than the fallback's
+		return nil, true, err
+	}
+	return fallback, true, nil
+}
+
+// geocodePlusCode resolves a plus code and describes the location using a reverse lookup
+func geocodePlusCode(ctx context.Context, query string) ([]GeocodeResponse, error) {
+	lat, lng, err := resolvePlusCode(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := reverseGeocode(ctx, lat, lng)
+	if err != nil {
+		// Still return the decoded location if it can't be described
+		if _, ok := err.(*ErrNoResults); !ok {
+			return nil, err
+		}
+		result = &GeocodeResponse{Lat: lat, Lng: lng}
+	}
+
+	// Report the decoded point and code rather than the matched feature
+	result.Lat = lat
+	result.Lng = lng
+	result.PlusCode = encodePlusCode(lat, lng)
+	if result.Name == "" {
+		result.Name = result.PlusCode
+	}
+
+	return []GeocodeResponse{*result}, nil
+}
+
+// reverseGeocode finds the address closest to a point using Nominatim
+func reverseGeocode(ctx context.Context, lat, lng float64) (*GeocodeResponse, error) {
+	if mockProviders(ctx) {
+		place := mockPlace("123 Main St", lat, lng, true)
+		return &place, nil
+	}
+	result, err := reverseNominatim(ctx, lat, lng, 0)
+	if err != nil {
+		return nil, err
+	}
+	return geocodeResponse(*result, "", true)
+}
+
+// reverseNominatim looks up the feature at a point using Nominatim. A zoom of 0
+// uses Nominatim's default of building level, lower zooms return larger areas.
+func reverseNominatim(ctx context.Context, lat, lng float64, zoom int) (*nominatimResponse, error) {
+	// Build query parameters
+	params := url.Values{
+		"lat":            {fmt.Sprintf("%.6f", lat)},
+		"lon":            {fmt.Sprintf("%.6f", lng)},
+		"format":         {"json"},
+		"addressdetails": {"1"},
+		"namedetails":    {"1"},
+	}
+	if zoom > 0 {
+		params.Set("zoom", strconv.Itoa(zoom))
+	}
+
+	// Create request URL with query parameters
+	apiURL := fmt.Sprintf("%s/reverse?%s", configFor(ctx).NominatimURL, params.Encode())
+
+	// Make GET request
+	resp, err := nominatimGet(ctx, apiURL)
+	if err != nil {
+		return nil, fmt.Errorf("error making request to Nominatim: %v", err)
+	}
+	defer resp.Body.Close()
+
+	// Check response status
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("nominatim API returned status: %d", resp.StatusCode)
 	}
 
-	// Add city
-	var cityStateParts []string
-	if city != "" {
-		cityStateParts = append(cityStateParts, city)
+	// Decode response
+	var result nominatimResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("error decoding response: %v", err)
 	}
 
-	// Add abbreviated state and zip in standard US format
-	if addr.State != "" && addr.PostCode != "" {
-		cityStateParts = append(cityStateParts, fmt.Sprintf("%s %s", abbreviateState(addr.State), addr.PostCode))
-	} else if addr.State != "" {
-		cityStateParts = append(cityStateParts, abbreviateState(addr.State))
-	} else if addr.PostCode != "" {
-		cityStateParts = append(cityStateParts, addr.PostCode)
+	// Nominatim reports points with nothing nearby as an object without coordinates
+	if result.Lat == "" || result.Lon == "" {
+		return nil, &ErrNoResults{Query: fmt.Sprintf("%.6f,%.6f", lat, lng)}
 	}
 
-	if len(cityStateParts) > 0 {
-		addrParts = append(addrParts, strings.Join(cityStateParts, ", "))
+	return &result, nil
+}
+
+// geocodeResponse converts a Nominatim result to our geocoding format
+func geocodeResponse(result nominatimResponse, lang string, abbreviate bool) (*GeocodeResponse, error) {
+	// Parse lat/lon strings to float64
+	lat, err := parseFloat(result.Lat)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing latitude: %v", err)
+	}
+	lng, err := parseFloat(result.Lon)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing longitude: %v", err)
+	}
+
+	// Format the address components
+	name, addr, country := formatAddress(result.Address, result.NameDetails, lang, abbreviate)
+
+	return &GeocodeResponse{
+		Name:       name,
+		Address:    addr,
+		Lat:        lat,
+		Lng:        lng,
+		Importance: result.Importance,
+		Country:    country,
+		PlusCode:   encodePlusCode(lat, lng),
+		Layer:      string(resultLayer(result)),
+		Category:   result.Class,
+		Type:       result.Type,
+		BBox:       parseBoundingBox(result.BoundingBox),
+	}, nil
+}
+
+// parseBoundingBox converts Nominatim's string bounding box, returning nil if it's missing or malformed
+func parseBoundingBox(bbox []string) *BoundingBox {
+	if len(bbox) != 4 {
+		return nil
 	}
 
-	return name, strings.Join(addrParts, ", "), strings.ToLower(addr.Country)
+	var values [4]float64
+	for i, s := range bbox {
+		v, err := parseFloat(s)
+		if err != nil {
+			return nil
+		}
+		values[i] = v
+	}
+
+	return &BoundingBox{South: values[0], North: values[1], West: values[2], East: values[3]}
 }
 
-// geocode performs geocoding using Nominatim
-func geocode(query string) ([]GeocodeResponse, error) {
+// geocodeNominatim performs geocoding using Nominatim
+func geocodeNominatim(ctx context.Context, req GeocodeRequest) ([]GeocodeResponse, error) {
 	// Build query parameters
 	params := url.Values{
-		"q":              {query},
+		"q":              {req.Query},
 		"format":         {"json"},
-		"limit":          {"5"},
+		"limit":          {strconv.Itoa(geocodeFetchLimit)},
 		"addressdetails": {"1"},
 		"namedetails":    {"1"},
 	}
 
+	// Restrict results to the requested countries
+	if len(req.CountryCodes) > 0 {
+		codes := make([]string, len(req.CountryCodes))
+		for i, c := range req.CountryCodes {
+			codes[i] = string(c)
+		}
+		params.Set("countrycodes", strings.Join(codes, ","))
+	}
+
+	// Restrict results to the requested layers
+	if len(req.Layers) > 0 {
+		nominatimLayerParams(req.Layers, params)
+	}
+
+	// Ask Nominatim for localized names and address components
+	if req.Language != "" {
+		params.Set("accept-language", req.Language)
+	}
+
+	// Fetch road geometry so a missing house number can be interpolated
+	houseNumber := queryHouseNumber(req.Query)
+	if houseNumber != "" {
+		params.Set("polygon_geojson", "1")
+	}
+
 	// Create request URL with query parameters
-	apiURL := fmt.Sprintf("%s/search?%s", navConfig.NominatimURL, params.Encode())
+	apiURL := fmt.Sprintf("%s/search?%s", configFor(ctx).NominatimURL, params.Encode())
 
 	// Make GET request
-	resp, err := http.Get(apiURL)
+	resp, err := nominatimGet(ctx, apiURL)
 	if err != nil {
 		return nil, fmt.Errorf("error making request to Nominatim: %v", err)
 	}
@@ -285,38 +688,75 @@ func geocode(query string) ([]GeocodeResponse, error) {
 	}
 
 	if len(nominatimResults) == 0 {
-		return nil, &ErrNoResults{Query: query}
+		return nil, &ErrNoResults{Query: req.Query}
 	}
 
 	// Convert nominatim results to our format
-	results := make([]GeocodeResponse, len(nominatimResults))
-	for i, result := range nominatimResults {
-		// Parse lat/lon strings to float64
-		lat, err := parseFloat(result.Lat)
-		if err != nil {
-			return nil, fmt.Errorf("error parsing latitude: %v", err)
+	results := make([]GeocodeResponse, 0, len(nominatimResults))
+	triedInterpolation := false
+	for _, result := range nominatimResults {
+		// Skip results below the configured relevance threshold
+		if result.Importance < configFor(ctx).MinImportance {
+			continue
 		}
-		lng, err := parseFloat(result.Lon)
-		if err != nil {
-			return nil, fmt.Errorf("error parsing longitude: %v", err)
+
+		// Nominatim's layers are coarser than ours, so filter again here
+		if !hasLayer(req.Layers, resultLayer(result)) {
+			continue
 		}
 
-		// Format the address components
-		name, addr, country := formatAddress(result.Address, result.NameDetails)
+		// Estimate the house position along the road rather than using its
+		// centroid, but only once since each attempt costs extra lookups
+		var interpolated bool
+		var lat, lng float64
+		if houseNumber != "" && !triedInterpolation && needsInterpolation(result) {
+			triedInterpolation = true
+			lat, lng, interpolated = interpolateHouseNumber(ctx, result, houseNumber)
+			if interpolated {
+				result.Address.HouseNumber = houseNumber
+			}
+		}
 
-		results[i] = GeocodeResponse{
-			Name:       name,
-			Address:    addr,
-			Lat:        lat,
-			Lng:        lng,
-			Importance: result.Importance,
-			Country:    country,
+		geocoded, err := geocodeResponse(result, req.Language, !req.Unabbreviated)
+		if err != nil {
+			return nil, err
+		}
+		if interpolated {
+			geocoded.Lat, geocoded.Lng = lat, lng
+			geocoded.PlusCode = encodePlusCode(lat, lng)
+			geocoded.Interpolated = true
 		}
+		results = append(results, *geocoded)
+	}
+
+	results = dedupeGeocodeResults(results)
+	if len(results) == 0 {
+		return nil, &ErrNoResults{Query: req.Query}
+	}
+	if len(results) > geocodeResultLimit {
+		results = results[:geocodeResultLimit]
 	}
 
 	return results, nil
 }
 
+// dedupeGeocodeResults drops results with the same name at roughly the same
+// coordinates, keeping the first (most important) occurrence
+func dedupeGeocodeResults(results []GeocodeResponse) []GeocodeResponse {
+	seen := make(map[string]bool)
+	deduped := results[:0]
+	for _, result := range results {
+		// Round to 3 decimal places, roughly 100m
+		key := fmt.Sprintf("%s|%.3f,%.3f", strings.ToLower(result.Name), result.Lat, result.Lng)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		deduped = append(deduped, result)
+	}
+	return deduped
+}
+
 func parseFloat(s string) (float64, error) {
 	var f float64
 	_, err := fmt.Sscanf(s, "%f", &f)
@@ -0,0 +1,697 @@
+package nav
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// gtfsStop is a stop loaded from stops.txt
+type gtfsStop struct {
+	ID         string // Feed-qualified ID, e.g. "city:1234"
+	Code       string
+	Name       string
+	Lat        float64
+	Lng        float64
+	Zone       string // Fare zone ID, if any
+	Wheelchair int    // 0 unknown, 1 accessible, 2 not accessible
+}
+
+// gtfsRoute is a route loaded from routes.txt
+type gtfsRoute struct {
+	ID        string
+	ShortName string
+	LongName  string
+	Type      int // GTFS route_type, e.g. 3 for bus
+	AgencyID  string
+	Agency    string
+	Location  *time.Location // Agency timezone, which all of the route's times are in
+}
+
+// gtfsTrip is a trip loaded from trips.txt with its stop times
+type gtfsTrip struct {
+	ID         string
+	Route      *gtfsRoute
+	ServiceID  string
+	ShapeID    string
+	Headsign   string
+	Wheelchair int // 0 unknown, 1 accessible, 2 not accessible
+	StopTimes  []gtfsStopTime
+}
+
+// gtfsStopTime is a single stop on a trip, with times in seconds since noon minus 12 hours
+type gtfsStopTime struct {
+	Stop      *gtfsStop
+	Arrival   int
+	Departure int
+}
+
+// gtfsDeparture indexes a trip's departure from a stop
+type gtfsDeparture struct {
+	Trip  *gtfsTrip
+	Index int // Position of the stop within Trip.StopTimes
+}
+
+// gtfsService is a service calendar from calendar.txt and calendar_dates.txt
+type gtfsService struct {
+	Days       [7]bool // Indexed by time.Weekday
+	Start, End string  // YYYYMMDD, inclusive
+	Exceptions map[string]bool
+}
+
+// gtfsFeed holds everything loaded from one or more GTFS feeds
+type gtfsFeed struct {
+	Stops      map[string]*gtfsStop
+	Routes     map[string]*gtfsRoute
+	Trips      map[string]*gtfsTrip
+	Shapes     map[string][][2]float64 // [lat, lng] pairs by shape ID
+	Fares      []*gtfsFare
+	Services   map[string]*gtfsService
+	Departures map[string][]gtfsDeparture // By stop ID, sorted by departure time
+}
+
+var (
+	gtfsMu   sync.RWMutex
+	gtfsData *gtfsFeed
+)
+
+// LoadGTFSFeeds loads the configured GTFS zip feeds, replacing any previously loaded data
+func LoadGTFSFeeds() error {
+	feed, err := loadGTFSFeeds(currentConfig().GTFSFeeds)
+	if err != nil {
+		return err
+	}
+
+	gtfsMu.Lock()
+	gtfsData = feed
+	gtfsMu.Unlock()
+
+	return nil
+}
+
+// loadGTFSFeeds parses GTFS zip feeds into one set of data, or nil for none
+func loadGTFSFeeds(paths []string) (*gtfsFeed, error) {
+	if len(paths) == 0 {
+		return nil, nil
+	}
+
+	feed := &gtfsFeed{
+		Stops:      make(map[string]*gtfsStop),
+		Routes:     make(map[string]*gtfsRoute),
+		Trips:      make(map[string]*gtfsTrip),
+		Shapes:     make(map[string][][2]float64),
+		Services:   make(map[string]*gtfsService),
+		Departures: make(map[string][]gtfsDeparture),
+	}
+	for _, path := range paths {
+		if err := feed.load(path); err != nil {
+			return nil, fmt.Errorf("error loading GTFS feed %s: %v", path, err)
+		}
+	}
+
+	for stopID := range feed.Departures {
+		deps := feed.Departures[stopID]
+		sort.Slice(deps, func(i, j int) bool {
+			return deps[i].Trip.StopTimes[deps[i].Index].Departure < deps[j].Trip.StopTimes[deps[j].Index].Departure
+		})
+	}
+
+	dataLog.Info("Loaded GTFS feeds", "stops", len(feed.Stops), "trips", len(feed.Trips), "feeds", len(paths))
+
+	return feed, nil
+}
+
+// currentGTFS returns the loaded GTFS data, or nil if no feeds are configured
+func currentGTFS() *gtfsFeed {
+	gtfsMu.RLock()
+	defer gtfsMu.RUnlock()
+	return gtfsData
+}
+
+// gtfsTable is a parsed GTFS CSV file with columns looked up by name
+type gtfsTable struct {
+	columns map[string]int
+	rows    [][]string
+}
+
+func (t *gtfsTable) get(row []string, column string) string {
+	i, ok := t.columns[column]
+	if !ok || i >= len(row) {
+		return ""
+	}
+	return strings.TrimSpace(row[i])
+}
+
+// readGTFSTable reads a CSV file from the feed, returning nil if it's absent
+func readGTFSTable(archive *zip.ReadCloser, name string) (*gtfsTable, error) {
+	for _, f := range archive.File {
+		if filepath.Base(f.Name) != name {
+			continue
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+
+		reader := csv.NewReader(rc)
+		reader.FieldsPerRecord = -1
+		reader.LazyQuotes = true
+
+		header, err := reader.Read()
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s header: %v", name, err)
+		}
+		table := &gtfsTable{columns: make(map[string]int)}
+		for i, column := range header {
+			table.columns[strings.TrimPrefix(strings.TrimSpace(column), "\ufeff")] = i
+		}
+
+		for {
+			row, err := reader.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, fmt.Errorf("error reading %s: %v", name, err)
+			}
+			table.rows = append(table.rows, row)
+		}
+		return table, nil
+	}
+	return nil, nil
+}
+
+// parseGTFSTime converts an HH:MM:SS time, which may exceed 24:00:00, to seconds
+func parseGTFSTime(s string) (int, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 3 {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	var seconds int
+	for _, part := range parts {
+		v, err := strconv.Atoi(part)
+		if err != nil {
+			return 0, fmt.Errorf("invalid time %q", s)
+		}
+		seconds = seconds*60 + v
+	}
+	return seconds, nil
+}
+
+// load reads a single GTFS zip, prefixing its IDs with the file name to avoid collisions
+func (feed *gtfsFeed) load(path string) error {
+	archive, err := zip.OpenReader(path)
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
+
+	prefix := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)) + ":"
+
+	// Agency timezone applies to all times in the feed, and must be the same for
+	// every agency in it
+	agencies, err := readGTFSTable(archive, "agency.txt")
+	if err != nil {
+		return err
+	}
+	var loc *time.Location
+	agencyNames := make(map[string]string)
+	if agencies != nil {
+		for _, row := range agencies.rows {
+			agencyNames[agencies.get(row, "agency_id")] = agencies.get(row, "agency_name")
+			if tz := agencies.get(row, "agency_timezone"); tz != "" && loc == nil {
+				if loc, err = time.LoadLocation(tz); err != nil {
+					return fmt.Errorf("invalid agency_timezone %q: %v", tz, err)
+				}
+			}
+		}
+	}
+
+	stops, err := readGTFSTable(archive, "stops.txt")
+	if err != nil || stops == nil {
+		return fmt.Errorf("missing stops.txt: %v", err)
+	}
+	for _, row := range stops.rows {
+		lat, _ := strconv.ParseFloat(stops.get(row, "stop_lat"), 64)
+		lng, _ := strconv.ParseFloat(stops.get(row, "stop_lon"), 64)
+		wheelchair, _ := strconv.Atoi(stops.get(row, "wheelchair_boarding"))
+		stop := &gtfsStop{
+			ID:         prefix + stops.get(row, "stop_id"),
+			Code:       stops.get(row, "stop_code"),
+			Zone:       stops.get(row, "zone_id"),
+			Name:       stops.get(row, "stop_name"),
+			Lat:        lat,
+			Lng:        lng,
+			Wheelchair: wheelchair,
+		}
+		feed.Stops[stop.ID] = stop
+	}
+
+	// Feeds missing a timezone get the one at their first stop
+	if loc == nil {
+		for _, row := range stops.rows {
+			lat, _ := strconv.ParseFloat(stops.get(row, "stop_lat"), 64)
+			lng, _ := strconv.ParseFloat(stops.get(row, "stop_lon"), 64)
+			loc = timezoneAt(lat, lng)
+			break
+		}
+	}
+
+	routesTable, err := readGTFSTable(archive, "routes.txt")
+	if err != nil || routesTable == nil {
+		return fmt.Errorf("missing routes.txt: %v", err)
+	}
+	for _, row := range routesTable.rows {
+		routeType, _ := strconv.Atoi(routesTable.get(row, "route_type"))
+		route := &gtfsRoute{
+			ID:        prefix + routesTable.get(row, "route_id"),
+			ShortName: routesTable.get(row, "route_short_name"),
+			LongName:  routesTable.get(row, "route_long_name"),
+			Type:      routeType,
+			AgencyID:  prefix + routesTable.get(row, "agency_id"),
+			Agency:    agencyNames[routesTable.get(row, "agency_id")],
+			Location:  loc,
+		}
+		feed.Routes[route.ID] = route
+	}
+
+	trips, err := readGTFSTable(archive, "trips.txt")
+	if err != nil || trips == nil {
+		return fmt.Errorf("missing trips.txt: %v", err)
+	}
+	for _, row := range trips.rows {
+		route, ok := feed.Routes[prefix+trips.get(row, "route_id")]
+		if !ok {
+			continue
+		}
+		wheelchair, _ := strconv.Atoi(trips.get(row, "wheelchair_accessible"))
+		trip := &gtfsTrip{
+			ID:         prefix + trips.get(row, "trip_id"),
+			Route:      route,
+			ServiceID:  prefix + trips.get(row, "service_id"),
+			ShapeID:    prefix + trips.get(row, "shape_id"),
+			Headsign:   trips.get(row, "trip_headsign"),
+			Wheelchair: wheelchair,
+		}
+		feed.Trips[trip.ID] = trip
+	}
+
+	stopTimes, err := readGTFSTable(archive, "stop_times.txt")
+	if err != nil || stopTimes == nil {
+		return fmt.Errorf("missing stop_times.txt: %v", err)
+	}
+	sequences := make(map[*gtfsTrip][]int)
+	for _, row := range stopTimes.rows {
+		trip, ok := feed.Trips[prefix+stopTimes.get(row, "trip_id")]
+		if !ok {
+			continue
+		}
+		stop, ok := feed.Stops[prefix+stopTimes.get(row, "stop_id")]
+		if !ok {
+			continue
+		}
+		arrival, errA := parseGTFSTime(stopTimes.get(row, "arrival_time"))
+		departure, errD := parseGTFSTime(stopTimes.get(row, "departure_time"))
+		if errA != nil && errD != nil {
+			continue // Untimed stops aren't useful without interpolation
+		}
+		if errA != nil {
+			arrival = departure
+		}
+		if errD != nil {
+			departure = arrival
+		}
+		sequence, _ := strconv.Atoi(stopTimes.get(row, "stop_sequence"))
+		trip.StopTimes = append(trip.StopTimes, gtfsStopTime{Stop: stop, Arrival: arrival, Departure: departure})
+		sequences[trip] = append(sequences[trip], sequence)
+	}
+
+	// Order each trip's stops by sequence and index departures by stop
+	for trip, seqs := range sequences {
+		sort.Sort(stopTimesBySequence{trip.StopTimes, seqs})
+		for i, st := range trip.StopTimes {
+			feed.Departures[st.Stop.ID] = append(feed.Departures[st.Stop.ID], gtfsDeparture{Trip: trip, Index: i})
+		}
+	}
+
+	// Shapes are optional, and only used to draw routes
+	shapes, err := readGTFSTable(archive, "shapes.txt")
+	if err != nil {
+		return err
+	}
+	if shapes != nil {
+		shapeSequences := make(map[string][]int)
+		for _, row := range shapes.rows {
+			lat, errLat := strconv.ParseFloat(shapes.get(row, "shape_pt_lat"), 64)
+			lng, errLng := strconv.ParseFloat(shapes.get(row, "shape_pt_lon"), 64)
+			if errLat != nil || errLng != nil {
+				continue
+			}
+			id := prefix + shapes.get(row, "shape_id")
+			sequence, _ := strconv.Atoi(shapes.get(row, "shape_pt_sequence"))
+			feed.Shapes[id] = append(feed.Shapes[id], [2]float64{lat, lng})
+			shapeSequences[id] = append(shapeSequences[id], sequence)
+		}
+		for id, seqs := range shapeSequences {
+			sort.Sort(pointsBySequence{feed.Shapes[id], seqs})
+		}
+	}
+
+	if err := feed.loadFares(archive, prefix); err != nil {
+		return err
+	}
+
+	calendar, err := readGTFSTable(archive, "calendar.txt")
+	if err != nil {
+		return err
+	}
+	if calendar != nil {
+		dayColumns := [7]string{"sunday", "monday", "tuesday", "wednesday", "thursday", "friday", "saturday"}
+		for _, row := range calendar.rows {
+			service := feed.service(prefix + calendar.get(row, "service_id"))
+			for day, column := range dayColumns {
+				service.Days[day] = calendar.get(row, column) == "1"
+			}
+			service.Start = calendar.get(row, "start_date")
+			service.End = calendar.get(row, "end_date")
+		}
+	}
+
+	calendarDates, err := readGTFSTable(archive, "calendar_dates.txt")
+	if err != nil {
+		return err
+	}
+	if calendarDates != nil {
+		for _, row := range calendarDates.rows {
+			service := feed.service(prefix + calendarDates.get(row, "service_id"))
+			// exception_type 1 adds service on the date, 2 removes it
+			service.Exceptions[calendarDates.get(row, "date")] = calendarDates.get(row, "exception_type") == "1"
+		}
+	}
+
+	return nil
+}
+
+// stopTimesBySequence sorts stop times by their stop_sequence values
+type stopTimesBySequence struct {
+	times     []gtfsStopTime
+	sequences []int
+}
+
+func (s stopTimesBySequence) Len() int           { return len(s.times) }
+func (s stopTimesBySequence) Less(i, j int) bool { return s.sequences[i] < s.sequences[j] }
+func (s stopTimesBySequence) Swap(i, j int) {
+	s.times[i], s.times[j] = s.times[j], s.times[i]
+	s.sequences[i], s.sequences[j] = s.sequences[j], s.sequences[i]
+}
+
+// pointsBySequence sorts shape points by their shape_pt_sequence values
+type pointsBySequence struct {
+	points    [][2]float64
+	sequences []int
+}
+
+func (s pointsBySequence) Len() int           { return len(s.points) }
+func (s pointsBySequence) Less(i, j int) bool { return s.sequences[i] < s.sequences[j] }
+func (s pointsBySequence) Swap(i, j int) {
+	s.points[i], s.points[j] = s.points[j], s.points[i]
+	s.sequences[i], s.sequences[j] = s.sequences[j], s.sequences[i]
+}
+
+// service returns the calendar for a service ID, creating it if needed
+func (feed *gtfsFeed) service(id string) *gtfsService {
+	service, ok := feed.Services[id]
+	if !ok {
+		service = &gtfsService{Exceptions: make(map[string]bool)}
+		feed.Services[id] = service
+	}
+	return service
+}
+
+// runsOn checks if a service operates on a service date
+func (feed *gtfsFeed) runsOn(serviceID string, date time.Time) bool {
+	service, ok := feed.Services[serviceID]
+	if !ok {
+		return false
+	}
+	day := date.Format("20060102")
+	if active, ok := service.Exceptions[day]; ok {
+		return active
+	}
+	return service.Days[date.Weekday()] && day >= service.Start && day <= service.End
+}
+
+// gtfsTime converts seconds on a service date to an absolute time. GTFS times are
+// measured from noon minus 12 hours, which matters on DST change days.
+func gtfsTime(date time.Time, seconds int) time.Time {
+	noon := time.Date(date.Year(), date.Month(), date.Day(), 12, 0, 0, 0, date.Location())
+	return noon.Add(time.Duration(seconds-12*60*60) * time.Second)
+}
+
+// gtfsUpcoming is a trip departing a stop at a specific time
+type gtfsUpcoming struct {
+	Trip    *gtfsTrip
+	Index   int
+	Departs time.Time
+	Date    time.Time // Service date of the trip
+}
+
+// serviceDates returns the local service dates whose trips may run between from
+// and until. The day before is included for trips running past midnight, which
+// GTFS writes as times like 25:30:00.
+func serviceDates(from, until time.Time, loc *time.Location) []time.Time {
+	from, until = from.In(loc), until.In(loc)
+	date := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, loc).AddDate(0, 0, -1)
+	last := time.Date(until.Year(), until.Month(), until.Day(), 0, 0, 0, 0, loc)
+
+	var dates []time.Time
+	for !date.After(last) {
+		dates = append(dates, date)
+		date = date.AddDate(0, 0, 1)
+	}
+	return dates
+}
+
+// upcoming returns departures from a stop between from and until, soonest first
+func (feed *gtfsFeed) upcoming(stopID string, from, until time.Time) []gtfsUpcoming {
+	datesByZone := make(map[*time.Location][]time.Time)
+
+	var results []gtfsUpcoming
+	for _, dep := range feed.Departures[stopID] {
+		loc := dep.Trip.Route.Location
+		dates, ok := datesByZone[loc]
+		if !ok {
+			dates = serviceDates(from, until, loc)
+			datesByZone[loc] = dates
+		}
+
+		for _, date := range dates {
+			departs := gtfsTime(date, dep.Trip.StopTimes[dep.Index].Departure)
+			if departs.Before(from) || departs.After(until) {
+				continue
+			}
+			// The last stop of a trip isn't a departure
+			if dep.Index == len(dep.Trip.StopTimes)-1 {
+				continue
+			}
+			if !feed.runsOn(dep.Trip.ServiceID, date) {
+				continue
+			}
+			results = append(results, gtfsUpcoming{Trip: dep.Trip, Index: dep.Index, Departs: departs, Date: date})
+		}
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Departs.Before(results[j].Departs)
+	})
+	return results
+}
+
+// nearbyStops returns stops within radius meters of a point, closest first
+func (feed *gtfsFeed) nearbyStops(lat, lng, radius float64) []*gtfsStop {
+	var stops []*gtfsStop
+	for _, stop := range feed.Stops {
+		if haversineDistance(lat, lng, stop.Lat, stop.Lng) <= radius {
+			stops = append(stops, stop)
+		}
+	}
+	sort.Slice(stops, func(i, j int) bool {
+		return haversineDistance(lat, lng, stops[i].Lat, stops[i].Lng) < haversineDistance(lat, lng, stops[j].Lat, stops[j].Lng)
+	})
+	return stops
+}
+
+// routeNames returns the distinct short names of routes departing a stop
+func (feed *gtfsFeed) routeNames(stopID string) []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, dep := range feed.Departures[stopID] {
+		name := dep.Trip.Route.displayName()
+		if name != "" && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// routeShape returns the geometry of a route as [lat, lng] pairs, using the shape
+// shared by the most trips. Feeds without shapes.txt fall back to the stops of the
+// longest trip.
+func (feed *gtfsFeed) routeShape(routeID string) [][2]float64 {
+	counts := make(map[string]int)
+	var longest *gtfsTrip
+	for _, trip := range feed.Trips {
+		if trip.Route.ID != routeID {
+			continue
+		}
+		if _, ok := feed.Shapes[trip.ShapeID]; ok {
+			counts[trip.ShapeID]++
+		}
+		if longest == nil || len(trip.StopTimes) > len(longest.StopTimes) {
+			longest = trip
+		}
+	}
+
+	var bestShape string
+	for id, count := range counts {
+		if bestShape == "" || count > counts[bestShape] || (count == counts[bestShape] && id < bestShape) {
+			bestShape = id
+		}
+	}
+	if bestShape != "" {
+		return feed.Shapes[bestShape]
+	}
+
+	var points [][2]float64
+	if longest != nil {
+		for _, st := range longest.StopTimes {
+			points = append(points, [2]float64{st.Stop.Lat, st.Stop.Lng})
+		}
+	}
+	return points
+}
+
+// accessibility combines the wheelchair values of a trip and the stops it's boarded
+// and left at: accessible only if all are, inaccessible if any is
+func accessibility(values ...int) int {
+	result := 1
+	for _, v := range values {
+		switch v {
+		case 2:
+			return 2
+		case 1:
+		default:
+			result = 0
+		}
+	}
+	return result
+}
+
+// matchesRoute checks if a route is named in a list of route IDs or short names.
+// IDs may be given with or without the feed prefix.
+func (r *gtfsRoute) matchesRoute(names []string) bool {
+	_, localID, _ := strings.Cut(r.ID, ":")
+	for _, name := range names {
+		if name == r.ID || name == localID || (r.ShortName != "" && strings.EqualFold(name, r.ShortName)) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesAgency checks if a route's agency is named in a list of agency IDs or names
+func (r *gtfsRoute) matchesAgency(names []string) bool {
+	_, localID, _ := strings.Cut(r.AgencyID, ":")
+	for _, name := range names {
+		if name == r.AgencyID || (localID != "" && name == localID) || (r.Agency != "" && strings.EqualFold(name, r.Agency)) {
+			return true
+		}
+	}
+	return false
+}
+
+// displayName returns the short name of a route, falling back to its long name
+func (r *gtfsRoute) displayName() string {
+	if r.ShortName != "" {
+		return r.ShortName
+	}
+	return r.LongName
+}
+
+// modeName maps a GTFS route_type to the mode names used by OpenTripPlanner
+func (r *gtfsRoute) modeName() string {
+	switch r.Type {
+	case 0, 5, 12:
+		return "TRAM"
+	case 1:
+		return "SUBWAY"
+	case 2:
+		return "RAIL"
+	case 4:
+		return "FERRY"
+	default:
+		return "BUS"
+	}
+}
+
+// gtfsNearbyStops finds stops near a point in the local GTFS feeds
+func gtfsNearbyStops(feed *gtfsFeed, lat, lng, radius float64, units DistanceUnit) ([]TransitStop, error) {
+	var stops []TransitStop
+	for _, stop := range feed.nearbyStops(lat, lng, radius) {
+		stops = append(stops, TransitStop{
+			ID:       stop.ID,
+			Name:     stop.Name,
+			Code:     stop.Code,
+			Lat:      stop.Lat,
+			Lng:      stop.Lng,
+			Routes:   feed.routeNames(stop.ID),
+			Distance: convertDistance(haversineDistance(lat, lng, stop.Lat, stop.Lng), units),
+		})
+	}
+	if len(stops) == 0 {
+		return nil, &ErrNoResults{Query: fmt.Sprintf("%.6f,%.6f", lat, lng)}
+	}
+	return stops, nil
+}
+
+// gtfsDepartures returns the next departures from a stop in the local GTFS feeds
+func gtfsDepartures(feed *gtfsFeed, stopID string, limit int, wheelchair bool) (*DeparturesResponse, error) {
+	stop, ok := feed.Stops[stopID]
+	if !ok {
+		return nil, &ErrNoResults{Query: stopID}
+	}
+
+	now := time.Now()
+	result := &DeparturesResponse{
+		StopID:     stop.ID,
+		StopName:   stop.Name,
+		Departures: []Departure{},
+	}
+	for _, up := range feed.upcoming(stopID, now, now.Add(departuresWindow*time.Second)) {
+		if wheelchair && up.Trip.Wheelchair != 1 {
+			continue
+		}
+		result.Departures = append(result.Departures, Departure{
+			Route:    up.Trip.Route.displayName(),
+			Headsign: up.Trip.Headsign,
+			Minutes:  max(0, int(up.Departs.Sub(now).Minutes())),
+			Time:     up.Departs.Format(time.RFC3339),
+		})
+		if len(result.Departures) == limit {
+			break
+		}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,243 @@
+package nav
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+const (
+	// gtfsMaxWalk is how far riders will walk to or from a stop by default, in meters
+	gtfsMaxWalk = 800
+	// gtfsWalkSpeed is average walking speed in meters per second
+	gtfsWalkSpeed = 1.3
+	// gtfsSearchWindow is how far ahead to look for a trip, in seconds
+	gtfsSearchWindow = 2 * 60 * 60
+	// gtfsNotPreferredPenalty is added to trips on routes or agencies that weren't
+	// preferred when preferences are given, matching OTP's default
+	gtfsNotPreferredPenalty = 5 * time.Minute
+)
+
+// gtfsItinerary is a single-seat ride between walking legs
+type gtfsItinerary struct {
+	Board    gtfsUpcoming
+	Alight   int       // Index of the alighting stop within Board.Trip.StopTimes
+	Arrives  time.Time // Arrival at the destination, including the final walk
+	WalkFrom float64   // Meters from the origin to the boarding stop
+	WalkTo   float64   // Meters from the alighting stop to the destination
+}
+
+// planGTFS finds the earliest-arriving direct trip for a route request. Only
+// itineraries without transfers are considered, which keeps the search cheap
+// enough to run over every departure in the window.
+func (feed *gtfsFeed) planGTFS(req RouteRequest, now time.Time) (*gtfsItinerary, error) {
+	maxWalk := req.MaxWalk
+	if maxWalk <= 0 {
+		maxWalk = gtfsMaxWalk
+	}
+	wheelchair := req.Wheelchair
+	hasPreferences := len(req.PreferredRoutes) > 0 || len(req.PreferredAgencies) > 0
+
+	destStops := make(map[*gtfsStop]float64)
+	for _, stop := range feed.nearbyStops(req.ToLat, req.ToLng, maxWalk) {
+		destStops[stop] = haversineDistance(stop.Lat, stop.Lng, req.ToLat, req.ToLng)
+	}
+	if len(destStops) == 0 {
+		return nil, fmt.Errorf("no transit stops near destination")
+	}
+
+	var best *gtfsItinerary
+	var bestScore time.Time
+	for _, origin := range feed.nearbyStops(req.FromLat, req.FromLng, maxWalk) {
+		if wheelchair && origin.Wheelchair != 1 {
+			continue
+		}
+		walkFrom := haversineDistance(req.FromLat, req.FromLng, origin.Lat, origin.Lng)
+		ready := now.Add(time.Duration(walkFrom/gtfsWalkSpeed) * time.Second)
+
+		for _, up := range feed.upcoming(origin.ID, ready, now.Add(gtfsSearchWindow*time.Second)) {
+			if wheelchair && up.Trip.Wheelchair != 1 {
+				continue
+			}
+			route := up.Trip.Route
+			if route.matchesRoute(req.BannedRoutes) || route.matchesAgency(req.BannedAgencies) {
+				continue
+			}
+			var penalty time.Duration
+			if hasPreferences && !route.matchesRoute(req.PreferredRoutes) && !route.matchesAgency(req.PreferredAgencies) {
+				penalty = gtfsNotPreferredPenalty
+			}
+
+			for i := up.Index + 1; i < len(up.Trip.StopTimes); i++ {
+				st := up.Trip.StopTimes[i]
+				walkTo, ok := destStops[st.Stop]
+				if !ok || (wheelchair && st.Stop.Wheelchair != 1) {
+					continue
+				}
+				arrives := gtfsTime(up.Date, st.Arrival).Add(time.Duration(walkTo/gtfsWalkSpeed) * time.Second)
+				if score := arrives.Add(penalty); best == nil || score.Before(bestScore) {
+					best = &gtfsItinerary{Board: up, Alight: i, Arrives: arrives, WalkFrom: walkFrom, WalkTo: walkTo}
+					bestScore = score
+				}
+			}
+		}
+	}
+
+	if best == nil {
+		return nil, fmt.Errorf("no route found")
+	}
+	return best, nil
+}
+
+// walkDescription describes a walking leg in the units riders expect
+func walkDescription(meters float64, to string, country CountryCode) string {
+	var description string
+	if country == "us" {
+		description = fmt.Sprintf("Walk %s", formatUSDistance(meters))
+	} else {
+		description = fmt.Sprintf("Walk %.0f meters", meters)
+	}
+	if to != "" {
+		description += fmt.Sprintf(" to %s", to)
+	}
+	return description
+}
+
+// routeTransitGTFS plans a transit route using the local GTFS feeds
+func routeTransitGTFS(ctx context.Context, feed *gtfsFeed, req RouteRequest, depart time.Time) (*RouteResponse, error) {
+	if req.Units == "" {
+		req.Units = DefaultUnit
+	} else if !req.Units.IsValid() {
+		return nil, fmt.Errorf("invalid units: must be one of: %s, %s", UnitKilometers, UnitMiles)
+	}
+
+	itinerary, err := feed.planGTFS(req, depart)
+	if err != nil {
+		return nil, err
+	}
+
+	trip := itinerary.Board.Trip
+	board := trip.StopTimes[itinerary.Board.Index]
+	alight := trip.StopTimes[itinerary.Alight]
+
+	// The ride follows straight lines between stops
+	var ridePoints [][2]float64
+	var rideDistance float64
+	for i := itinerary.Board.Index; i <= itinerary.Alight; i++ {
+		stop := trip.StopTimes[i].Stop
+		if len(ridePoints) > 0 {
+			prev := ridePoints[len(ridePoints)-1]
+			rideDistance += haversineDistance(prev[0], prev[1], stop.Lat, stop.Lng)
+		}
+		ridePoints = append(ridePoints, [2]float64{stop.Lat, stop.Lng})
+	}
+
+	ride := "Take"
+	if name := trip.Route.displayName(); name != "" {
+		ride += fmt.Sprintf(" the %s", name)
+	}
+	if trip.Headsign != "" {
+		ride += fmt.Sprintf(" toward %s", trip.Headsign)
+	}
+	alights := gtfsTime(itinerary.Board.Date, alight.Arrival)
+	ride += fmt.Sprintf(" at %s from %s to %s", clockTime(itinerary.Board.Departs, req.TwelveHourClock), board.Stop.Name, alight.Stop.Name)
+	if req.StepTimes {
+		ride += ", arriving " + clockTime(alights, req.TwelveHourClock)
+	}
+	if stops := itinerary.Alight - itinerary.Board.Index - 1; stops > 0 {
+		ride += fmt.Sprintf(" (%d stops)", stops)
+	}
+	var price, payment string
+	if fare := feed.fareFor(trip.Route, board.Stop, alight.Stop); fare != nil {
+		price, payment = formatFare(fare.Price, fare.Currency), paymentDescription(fare.PaymentMethod)
+	}
+	if fares := fareDescription(board.Stop.Zone, alight.Stop.Zone, price, payment); fares != "" {
+		ride += "; " + fares
+	}
+
+	// Leave just in time to walk to the stop
+	leave := itinerary.Board.Departs.Add(-time.Duration(itinerary.WalkFrom/gtfsWalkSpeed) * time.Second)
+	if leave.Before(depart) {
+		leave = depart
+	}
+
+	result := &RouteResponse{
+		Duration: itinerary.Arrives.Sub(leave).Seconds(),
+		Distance: convertDistance(itinerary.WalkFrom+itinerary.WalkTo, req.Units), // Walking distance, matching routeTransitUS
+		Units:    req.Units,
+		Mode:     req.Mode,
+		Provider: "gtfs",
+		From: Location{
+			Desc: req.FromDesc,
+			Lat:  req.FromLat,
+			Lng:  req.FromLng,
+		},
+		To: Location{
+			Desc: req.ToDesc,
+			Lat:  req.ToLat,
+			Lng:  req.ToLng,
+		},
+		Steps: []RouteStep{
+			{
+				Number:      1,
+				Description: walkDescription(itinerary.WalkFrom, board.Stop.Name, req.Country),
+				Distance:    convertDistance(itinerary.WalkFrom, req.Units),
+				Icon:        "Walk",
+				Summary:     walkSummary(itinerary.WalkFrom, board.Stop.Name, req.Units),
+			},
+			{
+				Number:      2,
+				Description: ride,
+				Distance:    convertDistance(rideDistance, req.Units),
+				Icon:        getStepIcon(0, "", trip.Route.modeName()),
+				Wheelchair:  wheelchairStatus(accessibility(trip.Wheelchair, board.Stop.Wheelchair, alight.Stop.Wheelchair)),
+				DepartTime:  itinerary.Board.Departs.Format(time.RFC3339),
+				ArriveTime:  alights.Format(time.RFC3339),
+				Summary:     rideSummary(trip.Route.modeName(), trip.Route.displayName(), alight.Stop.Name, itinerary.Alight-itinerary.Board.Index),
+			},
+			{
+				Number:      3,
+				Description: walkDescription(itinerary.WalkTo, req.ToDesc, req.Country),
+				Distance:    convertDistance(itinerary.WalkTo, req.Units),
+				Icon:        "Walk",
+				Summary:     walkSummary(itinerary.WalkTo, req.ToDesc, req.Units),
+			},
+		},
+	}
+
+	for i := itinerary.Board.Index + 1; i < itinerary.Alight; i++ {
+		result.Steps[1].Stops = append(result.Steps[1].Stops, trip.StopTimes[i].Stop.Name)
+	}
+
+	// Realtime alerts are best effort, so a feed outage doesn't block routing
+	if len(configFor(ctx).GTFSRealtime) > 0 {
+		alerts, err := alertsFor(ctx, trip.Route.ID, trip.ID, []string{board.Stop.ID, alight.Stop.ID})
+		if err != nil {
+			transitLog.WarnContext(ctx, "Error fetching service alerts", "error", err)
+		}
+		result.Steps[1].Alerts = alerts
+	}
+
+	setTransitTimes(result, leave.In(depart.Location()), itinerary.Arrives)
+
+	trackPoints := [][2]float64{{req.FromLat, req.FromLng}}
+	trackPoints = append(trackPoints, ridePoints...)
+	trackPoints = append(trackPoints, [2]float64{req.ToLat, req.ToLng})
+	last := len(trackPoints) - 1
+	trackSteps := []trackStep{
+		{Number: 1, Street: result.Steps[0].Description, Begin: 0, End: 1},
+		{Number: 2, Street: result.Steps[1].Description, Begin: 1, End: last - 1},
+		{Number: 3, Street: result.Steps[2].Description, Begin: last - 1, End: last},
+	}
+	storeRoute(result, newRouteTrack(trackPoints, trackSteps, req.Units))
+
+	points := normalizePath(trackPoints)
+	result.Path = Path{
+		Points: points,
+		Length: len(points),
+		Width:  NormalizedGridSize,
+		Height: NormalizedGridSize,
+	}
+
+	return result, nil
+}
@@ -1,20 +1,55 @@
 package nav
 
 import (
+	"bytes"
+	"context"
+	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
+	"time"
+	"unicode/utf8"
 )
 
-var navConfig NavConfig
-
 // SetConfig sets the navigation configuration
 func SetConfig(cfg NavConfig) {
-	navConfig = cfg
+	configMu.Lock()
+	defer configMu.Unlock()
+	setConfig(cfg)
+}
+
+// setConfig builds the state for a configuration and swaps it in; the caller
+// holds configMu
+func setConfig(cfg NavConfig) {
+	old := state.Load()
+	st := &navState{cfg: cfg}
+
+	// Reset the response caches so new TTLs and sizes take effect, sharing
+	// them through Redis when configured
+	st.redis = redisClientFor(cfg.Redis, old)
+	maxEntries := orDefault(cfg.CacheMaxEntries, DefaultCacheMaxEntries)
+	if cfg.GeocodeCacheTTL > 0 {
+		st.geocodeCache = newResponseCache[[]GeocodeResponse](st.redis, cfg.Redis, "geocode", time.Duration(cfg.GeocodeCacheTTL)*time.Second, maxEntries)
+	}
+	if cfg.RouteCacheTTL > 0 {
+		st.routeCache = newResponseCache[*cachedRoute](st.redis, cfg.Redis, "route", time.Duration(cfg.RouteCacheTTL)*time.Second, maxEntries)
+	}
+
+	setAbbreviations(cfg.Abbreviations)
+	st.upstream = setUpstreamClient(cfg.UpstreamTimeout, cfg.Upstream)
+
+	// Stored routes are kept across reloads, with a new TTL applying to
+	// routes stored from now on, and the oldest dropped if over a new limit
+	routeStore.resize(orDefaultSeconds(cfg.RouteStoreTTL, defaultRouteStoreTTL), maxEntries)
+
+	state.Store(st)
+	old.retire()
+	configLoaded.Store(true)
 }
 
 // Helper functions for formatting
@@ -31,6 +66,39 @@ func formatDuration(seconds float64) string {
 	return fmt.Sprintf("%dmin", minutes)
 }
 
+// formatDurationAs formats a duration in seconds in one of the timeFormat duration formats
+func formatDurationAs(seconds float64, format string) string {
+	switch format {
+	case DurationSeconds:
+		return fmt.Sprintf("%.0f", seconds)
+	case DurationClock:
+		minutes := int(seconds / 60)
+		return fmt.Sprintf("%d:%02d", minutes/60, minutes%60)
+	default:
+		return formatDuration(seconds)
+	}
+}
+
+// parseTimeFormat reads a timeFormat option, a comma-separated duration format
+// and clock format in either order, e.g. "clock,12h"
+func parseTimeFormat(v string) (duration string, twelveHour bool, err error) {
+	duration = DurationText
+	for _, part := range parseList(strings.ToLower(v)) {
+		switch part {
+		case DurationSeconds, DurationText, DurationClock:
+			duration = part
+		case Clock12Hour:
+			twelveHour = true
+		case Clock24Hour:
+			twelveHour = false
+		default:
+			return "", false, fmt.Errorf("timeFormat must be %s, %s, or %s, and %s or %s",
+				DurationSeconds, DurationText, DurationClock, Clock24Hour, Clock12Hour)
+		}
+	}
+	return duration, twelveHour, nil
+}
+
 func formatDistance(distance float64, units DistanceUnit) string {
 	if units == UnitMiles {
 		if distance < 0.1 {
@@ -46,32 +114,143 @@ func formatDistance(distance float64, units DistanceUnit) string {
 	return fmt.Sprintf("%.1fkm", distance)
 }
 
-func writePlainTextRoute(w http.ResponseWriter, result *RouteResponse) {
-	w.Header().Set("Content-Type", "text/plain")
+// compactLineWidth matches the departure board, one short of 40 columns
+const compactLineWidth = departureBoardWidth
+
+// Allowed column widths for wrapped plain-text routes
+const (
+	MinColumns = 16
+	MaxColumns = 255
+)
+
+// continuationMarker ends each wrapped line that continues on the next one
+const continuationMarker = "+"
+
+// wrapText word-wraps text to lines of at most width characters. Every line but
+// the last ends with the continuation marker, and words too long for a line are split.
+func wrapText(text string, width int) []string {
+	if utf8.RuneCountInString(text) <= width {
+		return []string{text}
+	}
+
+	// Leave room for the marker on every line
+	limit := width - len(continuationMarker)
+	var lines []string
+	var line []rune
+	for _, word := range strings.Fields(text) {
+		runes := []rune(word)
+		if len(line) > 0 && len(line)+1+len(runes) > limit {
+			lines = append(lines, string(line))
+			line = nil
+		}
+		if len(line) > 0 {
+			line = append(line, ' ')
+		}
+		for len(line)+len(runes) > limit {
+			n := limit - len(line)
+			lines = append(lines, string(append(line, runes[:n]...)))
+			line, runes = nil, runes[n:]
+		}
+		line = append(line, runes...)
+	}
+	lines = append(lines, string(line))
+
+	for i := range lines[:len(lines)-1] {
+		lines[i] += continuationMarker
+	}
+	return lines
+}
+
+// writePlainTextRoute writes a route as plain text. In compact mode each step is a
+// single line, using its summary where there is one, so itineraries fit 40x24 screens.
+// The inline format also writes one line per step, as "icon|meters|description".
+// With a column width set, single-line steps are cut to it and descriptions are wrapped.
+func writePlainTextRoute(w io.Writer, result *RouteResponse, output routeOutput) {
+	writePlainTextRouteSteps(w, result, output, len(result.Steps))
+}
 
+// writePlainTextRouteSteps writes a route in plain text with only its first
+// count steps, for fitting a size budget
+func writePlainTextRouteSteps(w io.Writer, result *RouteResponse, output routeOutput, count int) {
 	// Write duration and distance
-	fmt.Fprintf(w, "%s\n", formatDuration(result.Duration))
-	fmt.Fprintf(w, "%s\n", formatDistance(result.Distance, result.Units))
-	fmt.Fprintf(w, "%d\n", len(result.Steps))
+	fmt.Fprintf(w, "%s\n", localizeUnits(output.Lang, formatDurationAs(result.Duration, output.DurationFormat)))
+	fmt.Fprintf(w, "%s\n", localizeUnits(output.Lang, formatDistance(result.Distance, result.Units)))
+	fmt.Fprintf(w, "%d\n", count)
 
 	// Write steps
-	for i, step := range result.Steps {
-		// Write icon on its own line
-		fmt.Fprintf(w, "%s\n", step.Icon)
+	for i, step := range result.Steps[:count] {
+		if output.Compact {
+			line := step.Summary
+			if line == "" {
+				line = step.Description
+			}
+			width := compactLineWidth
+			if output.Cols > 0 {
+				width = output.Cols
+			}
+			fmt.Fprintf(w, "%.*s\n", width, line)
+			continue
+		}
+		if output.Format == "inline" {
+			line := fmt.Sprintf("%s|%.0f|%s", step.Icon, toMeters(step.Distance, result.Units), localizeDescription(output.Lang, step.Description))
+			if output.Cols > 0 {
+				line = fmt.Sprintf("%.*s", output.Cols, line)
+			}
+			fmt.Fprintf(w, "%s\n", line)
+			continue
+		}
+
+		// Write icon on its own line, except in brief detail
+		if output.Detail != DetailBrief {
+			fmt.Fprintf(w, "%s\n", step.Icon)
+		}
 
-		// For non-transit modes, append the distance in parentheses
-		if result.Mode != ModeTransit && i < len(result.Steps)-1 {
-			fmt.Fprintf(w, "%s (%s)\n", step.Description, formatDistance(step.Distance, result.Units))
+		// For non-transit modes, append the distance in parentheses to all but the arrival
+		description := localizeDescription(output.Lang, step.Description)
+		arrival := i == len(result.Steps)-1 && result.Page == result.Pages
+		if !result.Mode.usesTransit() && !arrival && output.Detail != DetailBrief {
+			description = fmt.Sprintf("%s (%s)", description, localizeUnits(output.Lang, formatDistance(step.Distance, result.Units)))
+		}
+		if output.Cols == 0 {
+			fmt.Fprintf(w, "%s\n", description)
 		} else {
-			fmt.Fprintf(w, "%s\n", step.Description)
+			for _, line := range wrapText(description, output.Cols) {
+				fmt.Fprintf(w, "%s\n", line)
+			}
+		}
+
+		// Full detail lists the stops passed, after their count
+		if output.Detail == DetailFull {
+			fmt.Fprintf(w, "%d\n", len(step.Stops))
+			for _, stop := range step.Stops {
+				fmt.Fprintf(w, "%s\n", stop)
+			}
 		}
 	}
+
+	// Route ID for progress lookups goes last so older clients can ignore it,
+	// followed by the page number and count for paginated routes
+	if result.Pages > 0 {
+		fmt.Fprintf(w, "%s\n%d/%d\n", result.ID, result.Page, result.Pages)
+	} else if result.ID != "" {
+		fmt.Fprintf(w, "%s\n", result.ID)
+	}
 }
 
 func writeError(w http.ResponseWriter, code int, message string) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(code)
-	json.NewEncoder(w).Encode(ErrorResponse{Error: message})
+	json.NewEncoder(w).Encode(ErrorResponse{Error: message, RequestID: w.Header().Get(RequestIDHeader)})
+}
+
+// readBodyError gives the status and message for a failed request body read,
+// 413 when the body is over the server's limit
+func readBodyError(err error) (int, string) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return http.StatusRequestEntityTooLarge, fmt.Sprintf("request body too large: limit is %d bytes", tooLarge.Limit)
+	}
+	return http.StatusBadRequest, "failed to read request body"
 }
 
 func writeJSON(w http.ResponseWriter, data interface{}) {
@@ -98,10 +277,103 @@ func parseLatLng(s string) (float64, float64, error) {
 	return lat, lng, nil
 }
 
+// parseLocation parses a location given as "lat,lng", a plus code, or a what3words address
+func parseLocation(ctx context.Context, s string) (float64, float64, error) {
+	if looksLikePlusCode(s) {
+		return resolvePlusCode(ctx, s)
+	}
+	if looksLikeWhat3Words(s) {
+		return resolveWhat3Words(ctx, s)
+	}
+	return parseLatLng(s)
+}
+
+func parseLayers(s string) ([]GeocodeLayer, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	var layers []GeocodeLayer
+	for _, part := range strings.Split(s, ",") {
+		layer := GeocodeLayer(strings.ToLower(strings.TrimSpace(part)))
+		if layer == "" {
+			continue
+		}
+		if !layer.IsValid() {
+			return nil, fmt.Errorf("invalid layer %q. Must be one of: %s, %s, %s, %s",
+				part, LayerAddress, LayerPOI, LayerLocality, LayerAdmin)
+		}
+		layers = append(layers, layer)
+	}
+
+	return layers, nil
+}
+
+func parseCountryCodes(s string) ([]CountryCode, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	var codes []CountryCode
+	for _, part := range strings.Split(s, ",") {
+		code := CountryCode(strings.ToLower(strings.TrimSpace(part)))
+		if code == "" {
+			continue
+		}
+		if !code.IsValid() {
+			return nil, fmt.Errorf("invalid country code %q", part)
+		}
+		codes = append(codes, code)
+	}
+
+	return codes, nil
+}
+
 // HandleGeocode handles the /nav/geocode endpoint
 func HandleGeocode(w http.ResponseWriter, r *http.Request) {
 	// Log request URL and method
-	log.Printf("Debug: Geocode %s request to %s", r.Method, r.URL.String())
+	httpLog.DebugContext(r.Context(), "Geocode request", "method", r.Method, "url", redactURL(r.URL.String()))
+
+	// Optional comma-separated list of countries to restrict results to
+	countryCodes, err := parseCountryCodes(r.URL.Query().Get("countrycodes"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid 'countrycodes' parameter: %v", err))
+		return
+	}
+
+	// Optional comma-separated list of result layers to include
+	layers, err := parseLayers(r.URL.Query().Get("layers"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid 'layers' parameter: %v", err))
+		return
+	}
+
+	// Optional full street types, directions, and states in addresses
+	unabbreviated, err := parseAbbrev(r.URL.Query().Get("abbrev"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Optional CSV output instead of JSON or plain text
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "csv" {
+		writeError(w, http.StatusBadRequest, "format must be csv")
+		return
+	}
+
+	// Optional size budget for plain-text responses
+	maxBytes, err := parseMaxBytes(r.URL.Query().Get("maxBytes"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Preferred language for names, falling back to the Accept-Language header
+	language := r.URL.Query().Get("lang")
+	if language == "" {
+		language = r.Header.Get("Accept-Language")
+	}
 
 	switch r.Method {
 	case http.MethodGet:
@@ -112,9 +384,9 @@ func HandleGeocode(w http.ResponseWriter, r *http.Request) {
 		}
 
 		// Log query parameter
-		log.Printf("Debug: Geocode query: %q", query)
+		geocodeLog.DebugContext(r.Context(), "Geocode query", "query", query, "countrycodes", countryCodes)
 
-		results, err := geocode(query)
+		results, err := geocode(r.Context(), GeocodeRequest{Query: query, CountryCodes: countryCodes, Language: language, Layers: layers, Unabbreviated: unabbreviated})
 		if err != nil {
 			if _, ok := err.(*ErrNoResults); ok {
 				writeError(w, http.StatusNotFound, err.Error())
@@ -125,26 +397,31 @@ func HandleGeocode(w http.ResponseWriter, r *http.Request) {
 		}
 
 		// Log number of results
-		log.Printf("Debug: Geocode found %d results", len(results))
+		geocodeLog.DebugContext(r.Context(), "Geocode found results", "count", len(results))
 
+		if format == "csv" {
+			writeGeocodeCSV(w, results)
+			return
+		}
 		writeJSON(w, results)
 
 	case http.MethodPost:
 		body, err := io.ReadAll(r.Body)
 		if err != nil {
-			writeError(w, http.StatusBadRequest, "failed to read request body")
+			status, message := readBodyError(err)
+			writeError(w, status, message)
 			return
 		}
 		defer r.Body.Close()
 
 		query := strings.TrimSpace(string(body))
-		log.Printf(query)
+		geocodeLog.DebugContext(r.Context(), "Geocode query", "query", query, "countrycodes", countryCodes)
 		if query == "" {
 			writeError(w, http.StatusBadRequest, "request body cannot be empty")
 			return
 		}
 
-		results, err := geocode(query)
+		results, err := geocode(r.Context(), GeocodeRequest{Query: query, CountryCodes: countryCodes, Language: language, Layers: layers, Unabbreviated: unabbreviated})
 		if err != nil {
 			if _, ok := err.(*ErrNoResults); ok {
 				http.Error(w, err.Error(), http.StatusNotFound)
@@ -155,217 +432,2286 @@ func HandleGeocode(w http.ResponseWriter, r *http.Request) {
 		}
 
 		// Log number of results
-		log.Printf("Debug: Geocode found %d results", len(results))
+		geocodeLog.DebugContext(r.Context(), "Geocode found results", "count", len(results))
 
-		// Return plain text format for POST requests
-		w.Header().Set("Content-Type", "text/plain")
-		// First line is the number of results
-		fmt.Fprintf(w, "%d\n", len(results))
-		// Output each result as 4 consecutive lines
-		for _, result := range results {
-			fmt.Fprintf(w, "%.4f,%.4f\n%s\n%s\n%s\n", result.Lat, result.Lng, result.Name, result.Address, result.Country)
+		if format == "csv" {
+			writeGeocodeCSV(w, results)
+			return
 		}
 
+		// Return plain text format for POST requests, dropping results to fit the
+		// size budget if one was given
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write(fitResults(r.Context(), len(results), maxBytes, func(n int) []byte {
+			var buf bytes.Buffer
+			// First line is the number of results
+			fmt.Fprintf(&buf, "%d\n", n)
+			// Output each result as 4 consecutive lines
+			for _, result := range results[:n] {
+				fmt.Fprintf(&buf, "%.4f,%.4f\n%s\n%s\n%s\n", result.Lat, result.Lng, result.Name, result.Address, result.Country)
+			}
+			return buf.Bytes()
+		}))
+
 	default:
 		writeError(w, http.StatusMethodNotAllowed, "only GET and POST methods are allowed")
 	}
 }
 
-// HandleRoute handles the /nav/route endpoint
-func HandleRoute(w http.ResponseWriter, r *http.Request) {
+// writeGeocodeCSV writes geocode results as CSV with a header row, one result per line
+func writeGeocodeCSV(w http.ResponseWriter, results []GeocodeResponse) {
+	w.Header().Set("Content-Type", "text/csv")
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"name", "address", "lat", "lng", "country", "plus_code", "layer", "category", "type", "importance"})
+	for _, result := range results {
+		cw.Write([]string{
+			result.Name,
+			result.Address,
+			fmt.Sprintf("%.6f", result.Lat),
+			fmt.Sprintf("%.6f", result.Lng),
+			result.Country,
+			result.PlusCode,
+			result.Layer,
+			result.Category,
+			result.Type,
+			fmt.Sprintf("%.3f", result.Importance),
+		})
+	}
+	cw.Flush()
+}
+
+// HandlePostalCode handles the /nav/zip endpoint
+func HandlePostalCode(w http.ResponseWriter, r *http.Request) {
 	// Log request URL and method
-	log.Printf("Debug: Route %s request to %s", r.Method, r.URL.String())
+	httpLog.DebugContext(r.Context(), "Postal code request", "method", r.Method, "url", redactURL(r.URL.String()))
 
 	switch r.Method {
 	case http.MethodGet:
 		// Parse parameters
-		from := r.URL.Query().Get("from")
-		to := r.URL.Query().Get("to")
-		mode := r.URL.Query().Get("mode")
-		units := r.URL.Query().Get("units")
+		code := strings.TrimSpace(r.URL.Query().Get("code"))
+		at := r.URL.Query().Get("at")
 		country := strings.ToLower(r.URL.Query().Get("country"))
-		fromDesc := r.URL.Query().Get("fromDesc")
-		toDesc := r.URL.Query().Get("toDesc")
-
-		// Log query parameters
-		log.Printf("Debug: Route parameters - from=%q, to=%q, mode=%q, units=%q, country=%q, fromDesc=%q, toDesc=%q",
-			from, to, mode, units, country, fromDesc, toDesc)
 
-		if from == "" || to == "" {
-			writeError(w, http.StatusBadRequest, "both 'from' and 'to' parameters are required")
+		if (code == "") == (at == "") {
+			writeError(w, http.StatusBadRequest, "exactly one of 'code' or 'at' parameters is required")
 			return
 		}
 
 		// Validate country code if provided
-		var countryCode CountryCode
-		if country != "" {
-			countryCode = CountryCode(country)
-			if !countryCode.IsValid() {
-				writeError(w, http.StatusBadRequest, "country must be a valid 2-letter ISO code in lowercase")
-				return
-			}
+		countryCode := CountryCode(country)
+		if country != "" && !countryCode.IsValid() {
+			writeError(w, http.StatusBadRequest, "country must be a valid 2-letter ISO code in lowercase")
+			return
 		}
 
-		// Validate mode
-		var transportMode TransportMode
-		if mode == "" {
-			transportMode = DefaultMode
+		var result *PostalCodeResponse
+		var err error
+		if code != "" {
+			result, err = lookupPostalCode(r.Context(), code, countryCode)
 		} else {
-			transportMode = TransportMode(strings.ToLower(mode))
-			if !transportMode.IsValid() {
-				writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid mode. Must be one of: %s, %s, %s, %s",
-					ModeWalking, ModeBiking, ModeAuto, ModeTransit))
+			lat, lng, parseErr := parseLatLng(at)
+			if parseErr != nil {
+				writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid 'at' parameter: %v", parseErr))
 				return
 			}
+			result, err = reversePostalCode(r.Context(), lat, lng)
 		}
-
-		// Validate units
-		var distanceUnit DistanceUnit
-		if units == "" {
-			distanceUnit = DefaultUnit
-		} else {
-			distanceUnit = DistanceUnit(strings.ToLower(units))
-			if !distanceUnit.IsValid() {
-				writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid units. Must be one of: %s, %s",
-					UnitKilometers, UnitMiles))
+		if err != nil {
+			if _, ok := err.(*ErrNoResults); ok {
+				writeError(w, http.StatusNotFound, err.Error())
 				return
 			}
-		}
-
-		// Parse coordinates
-		fromLat, fromLng, err := parseLatLng(from)
-		if err != nil {
-			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid 'from' parameter: %v", err))
-			return
-		}
-
-		toLat, toLng, err := parseLatLng(to)
-		if err != nil {
-			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid 'to' parameter: %v", err))
+			writeError(w, http.StatusInternalServerError, err.Error())
 			return
 		}
 
-		handleRouteRequest(w, r.Method, fromLat, fromLng, toLat, toLng, transportMode, distanceUnit, countryCode, fromDesc, toDesc)
+		writeJSON(w, result)
 
 	case http.MethodPost:
 		body, err := io.ReadAll(r.Body)
 		if err != nil {
-			w.Header().Set("Content-Type", "text/plain")
-			fmt.Fprintf(w, "\n\n0\nfailed to read request body\n")
+			status, message := readBodyError(err)
+			http.Error(w, message, status)
 			return
 		}
 		defer r.Body.Close()
 
-		// Log request body
-		log.Printf("Debug: Route POST body: %s", string(body))
-
-		// Split the body into lines
+		// First line is a postal code or coordinates, optional second line is the country
 		lines := strings.Split(strings.TrimSpace(string(body)), "\n")
-		if len(lines) < 5 {
-			w.Header().Set("Content-Type", "text/plain")
-			fmt.Fprintf(w, "\n\n0\nrequest must contain at least 5 lines\n")
+		query := strings.TrimSpace(strings.TrimRight(lines[0], "\r"))
+		if query == "" {
+			http.Error(w, "request body cannot be empty", http.StatusBadRequest)
 			return
 		}
 
-		// Clean up any \r from \r\n line endings
-		mode := strings.TrimSpace(strings.TrimRight(lines[0], "\r"))
-		country := strings.TrimSpace(strings.TrimRight(lines[1], "\r"))
-		units := strings.TrimSpace(strings.TrimRight(lines[2], "\r"))
-		from := strings.TrimSpace(strings.TrimRight(lines[3], "\r"))
-		to := strings.TrimSpace(strings.TrimRight(lines[4], "\r"))
-
-		// Validate and convert mode and units
-		transportMode := TransportMode(strings.ToLower(mode))
-		if !transportMode.IsValid() {
-			transportMode = DefaultMode
+		var countryCode CountryCode
+		if len(lines) > 1 {
+			countryCode = CountryCode(strings.ToLower(strings.TrimSpace(strings.TrimRight(lines[1], "\r"))))
+			if !countryCode.IsValid() {
+				countryCode = ""
+			}
 		}
-		distanceUnit := DistanceUnit(strings.ToLower(units))
-		if !distanceUnit.IsValid() {
-			distanceUnit = DefaultUnit
+
+		var result *PostalCodeResponse
+		if lat, lng, parseErr := parseLatLng(query); parseErr == nil {
+			result, err = reversePostalCode(r.Context(), lat, lng)
+		} else {
+			result, err = lookupPostalCode(r.Context(), query, countryCode)
 		}
-		countryCode := CountryCode(strings.ToLower(country))
-		if !countryCode.IsValid() {
-			countryCode = CountryCode("us")
+		if err != nil {
+			if _, ok := err.(*ErrNoResults); ok {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
 		}
 
-		// Get optional descriptions if provided
-		var fromDesc, toDesc string
-		if len(lines) > 5 {
-			fromDesc = strings.TrimSpace(strings.TrimRight(lines[5], "\r"))
-		}
-		if len(lines) > 6 {
-			toDesc = strings.TrimSpace(strings.TrimRight(lines[6], "\r"))
+		// Return plain text format for POST requests
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprintf(w, "%s\n%.4f,%.4f\n%s\n%s\n%s\n", result.PostalCode, result.Lat, result.Lng,
+			result.City, result.State, result.Country)
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "only GET and POST methods are allowed")
+	}
+}
+
+// HandleWhereAmI handles the /nav/whereami endpoint
+func HandleWhereAmI(w http.ResponseWriter, r *http.Request) {
+	// Log request URL and method
+	httpLog.DebugContext(r.Context(), "WhereAmI request", "method", r.Method, "url", redactURL(r.URL.String()))
+
+	switch r.Method {
+	case http.MethodGet:
+		// Use the provided IP or fall back to the caller's
+		ip := r.URL.Query().Get("ip")
+		if ip == "" {
+			ip = clientIP(r)
 		}
 
-		// Parse coordinates
-		fromLat, fromLng, err := parseLatLng(from)
+		result, err := whereAmI(ip)
 		if err != nil {
-			w.Header().Set("Content-Type", "text/plain")
-			fmt.Fprintf(w, "\n\n0\ninvalid 'from' coordinates\n")
+			switch err.(type) {
+			case *ErrInvalidIP:
+				writeError(w, http.StatusBadRequest, err.Error())
+			case *ErrNoResults:
+				writeError(w, http.StatusNotFound, err.Error())
+			default:
+				writeError(w, http.StatusInternalServerError, err.Error())
+			}
 			return
 		}
 
-		toLat, toLng, err := parseLatLng(to)
+		writeJSON(w, result)
+
+	case http.MethodPost:
+		body, err := io.ReadAll(r.Body)
 		if err != nil {
-			w.Header().Set("Content-Type", "text/plain")
-			fmt.Fprintf(w, "\n\n0\ninvalid 'to' coordinates\n")
+			status, message := readBodyError(err)
+			http.Error(w, message, status)
 			return
 		}
+		defer r.Body.Close()
+
+		// Optional body with an IP address to look up
+		ip := strings.TrimSpace(string(body))
+		if ip == "" {
+			ip = clientIP(r)
+		}
 
-		// Handle the route request
-		result, err := route(RouteRequest{
-			FromLat:  fromLat,
-			FromLng:  fromLng,
-			ToLat:    toLat,
-			ToLng:    toLng,
-			FromDesc: fromDesc,
-			ToDesc:   toDesc,
-			Mode:     transportMode,
-			Units:    distanceUnit,
-			Country:  countryCode,
-		})
+		result, err := whereAmI(ip)
 		if err != nil {
-			w.Header().Set("Content-Type", "text/plain")
-			fmt.Fprintf(w, "\n\n0\n%s\n", err.Error())
+			switch err.(type) {
+			case *ErrInvalidIP:
+				http.Error(w, err.Error(), http.StatusBadRequest)
+			case *ErrNoResults:
+				http.Error(w, err.Error(), http.StatusNotFound)
+			default:
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
 			return
 		}
 
-		// Write plain text response
-		writePlainTextRoute(w, result)
+		// Return plain text format for POST requests
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprintf(w, "%.4f,%.4f\n%s\n%s\n%s\n", result.Lat, result.Lng, result.City, result.State, result.Country)
 
 	default:
 		writeError(w, http.StatusMethodNotAllowed, "only GET and POST methods are allowed")
 	}
 }
 
-// handleRouteRequest handles the common routing logic for both GET and POST requests
-func handleRouteRequest(w http.ResponseWriter, method string, fromLat, fromLng, toLat, toLng float64, mode TransportMode, units DistanceUnit, country CountryCode, fromDesc, toDesc string) {
-	// Create route request
-	req := RouteRequest{
-		FromLat:  fromLat,
-		FromLng:  fromLng,
-		ToLat:    toLat,
-		ToLng:    toLng,
-		FromDesc: fromDesc,
-		ToDesc:   toDesc,
-		Mode:     mode,
-		Units:    units,
-		Country:  country,
-	}
+// HandleAdminArea handles the /nav/admin endpoint
+func HandleAdminArea(w http.ResponseWriter, r *http.Request) {
+	// Log request URL and method
+	httpLog.DebugContext(r.Context(), "Admin request", "method", r.Method, "url", redactURL(r.URL.String()))
 
-	// Get route
-	result, err := route(req)
-	if err != nil {
-		writeError(w, http.StatusInternalServerError, err.Error())
-		return
-	}
+	switch r.Method {
+	case http.MethodGet:
+		at := r.URL.Query().Get("at")
+		if at == "" {
+			writeError(w, http.StatusBadRequest, "query parameter 'at' is required")
+			return
+		}
 
-	// For POST requests, return plain text format
-	if method == http.MethodPost {
-		writePlainTextRoute(w, result)
+		lat, lng, err := parseLatLng(at)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid 'at' parameter: %v", err))
+			return
+		}
+
+		result, err := lookupAdminArea(r.Context(), lat, lng)
+		if err != nil {
+			if _, ok := err.(*ErrNoResults); ok {
+				writeError(w, http.StatusNotFound, err.Error())
+				return
+			}
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		writeJSON(w, result)
+
+	case http.MethodPost:
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			status, message := readBodyError(err)
+			http.Error(w, message, status)
+			return
+		}
+		defer r.Body.Close()
+
+		lat, lng, err := parseLatLng(strings.TrimSpace(string(body)))
+		if err != nil {
+			http.Error(w, "invalid coordinates", http.StatusBadRequest)
+			return
+		}
+
+		result, err := lookupAdminArea(r.Context(), lat, lng)
+		if err != nil {
+			if _, ok := err.(*ErrNoResults); ok {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// Return plain text format for POST requests
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprintf(w, "%s\n%s\n%s\n%s\n", result.City, result.County, result.StateCode, result.Country)
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "only GET and POST methods are allowed")
+	}
+}
+
+// HandleNearby handles the /nav/nearby endpoint
+func HandleNearby(w http.ResponseWriter, r *http.Request) {
+	// Log request URL and method
+	httpLog.DebugContext(r.Context(), "Nearby request", "method", r.Method, "url", redactURL(r.URL.String()))
+
+	switch r.Method {
+	case http.MethodGet:
+		// Parse parameters
+		at := r.URL.Query().Get("at")
+		category := r.URL.Query().Get("category")
+		radius := r.URL.Query().Get("radius")
+		units := r.URL.Query().Get("units")
+		limit := r.URL.Query().Get("limit")
+
+		if at == "" || category == "" {
+			writeError(w, http.StatusBadRequest, "both 'at' and 'category' parameters are required")
+			return
+		}
+
+		lat, lng, err := parseLatLng(at)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid 'at' parameter: %v", err))
+			return
+		}
+
+		if _, ok := lookupNearbyCategory(category); !ok {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid category. Must be one of: %s",
+				strings.Join(nearbyCategoryNames(), ", ")))
+			return
+		}
+
+		// Validate units
+		distanceUnit := DefaultUnit
+		if units != "" {
+			distanceUnit = DistanceUnit(strings.ToLower(units))
+			if !distanceUnit.IsValid() {
+				writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid units. Must be one of: %s, %s",
+					UnitKilometers, UnitMiles))
+				return
+			}
+		}
+
+		// Validate radius
+		radiusMeters := float64(DefaultNearbyRadius)
+		if radius != "" {
+			radiusMeters, err = strconv.ParseFloat(radius, 64)
+			if err != nil || radiusMeters <= 0 || radiusMeters > MaxNearbyRadius {
+				writeError(w, http.StatusBadRequest, fmt.Sprintf("radius must be between 1 and %d meters", MaxNearbyRadius))
+				return
+			}
+		}
+
+		// Validate limit
+		maxResults := 0
+		if limit != "" {
+			maxResults, err = strconv.Atoi(limit)
+			if err != nil || maxResults < 1 {
+				writeError(w, http.StatusBadRequest, "limit must be a positive integer")
+				return
+			}
+		}
+
+		results, err := nearby(r.Context(), NearbyRequest{
+			Lat:      lat,
+			Lng:      lng,
+			Category: category,
+			Radius:   radiusMeters,
+			Units:    distanceUnit,
+			Limit:    maxResults,
+		})
+		if err != nil {
+			if _, ok := err.(*ErrNoResults); ok {
+				writeError(w, http.StatusNotFound, err.Error())
+				return
+			}
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		// Log number of results
+		geocodeLog.DebugContext(r.Context(), "Nearby found results", "count", len(results))
+
+		writeJSON(w, results)
+
+	case http.MethodPost:
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			status, message := readBodyError(err)
+			http.Error(w, message, status)
+			return
+		}
+		defer r.Body.Close()
+
+		// Log request body
+		httpLog.DebugContext(r.Context(), "Nearby POST body", "body", string(body))
+
+		// Expect category, coordinates, and optional units on separate lines
+		lines := strings.Split(strings.TrimSpace(string(body)), "\n")
+		if len(lines) < 2 {
+			http.Error(w, "request must contain at least 2 lines", http.StatusBadRequest)
+			return
+		}
+
+		category := strings.TrimSpace(strings.TrimRight(lines[0], "\r"))
+		at := strings.TrimSpace(strings.TrimRight(lines[1], "\r"))
+
+		distanceUnit := DefaultUnit
+		if len(lines) > 2 {
+			distanceUnit = DistanceUnit(strings.ToLower(strings.TrimSpace(strings.TrimRight(lines[2], "\r"))))
+			if !distanceUnit.IsValid() {
+				distanceUnit = DefaultUnit
+			}
+		}
+
+		lat, lng, err := parseLatLng(at)
+		if err != nil {
+			http.Error(w, "invalid coordinates", http.StatusBadRequest)
+			return
+		}
+
+		if _, ok := lookupNearbyCategory(category); !ok {
+			http.Error(w, fmt.Sprintf("invalid category. Must be one of: %s",
+				strings.Join(nearbyCategoryNames(), ", ")), http.StatusBadRequest)
+			return
+		}
+
+		results, err := nearby(r.Context(), NearbyRequest{
+			Lat:      lat,
+			Lng:      lng,
+			Category: category,
+			Radius:   DefaultNearbyRadius,
+			Units:    distanceUnit,
+			Limit:    5,
+		})
+		if err != nil {
+			if _, ok := err.(*ErrNoResults); ok {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// Log number of results
+		geocodeLog.DebugContext(r.Context(), "Nearby found results", "count", len(results))
+
+		// Return plain text format for POST requests
+		w.Header().Set("Content-Type", "text/plain")
+		// First line is the number of results
+		fmt.Fprintf(w, "%d\n", len(results))
+		// Output each result as 3 consecutive lines
+		for _, result := range results {
+			fmt.Fprintf(w, "%s\n%s\n%s %s\n", result.Name, result.Address,
+				formatDistance(result.Distance, distanceUnit), result.Direction)
+		}
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "only GET and POST methods are allowed")
+	}
+}
+
+// HandleStops handles the /nav/stops endpoint
+func HandleStops(w http.ResponseWriter, r *http.Request) {
+	// Log request URL and method
+	httpLog.DebugContext(r.Context(), "Stops request", "method", r.Method, "url", redactURL(r.URL.String()))
+
+	switch r.Method {
+	case http.MethodGet:
+		// Parse parameters
+		at := r.URL.Query().Get("at")
+		radius := r.URL.Query().Get("radius")
+		units := r.URL.Query().Get("units")
+
+		if at == "" {
+			writeError(w, http.StatusBadRequest, "query parameter 'at' is required")
+			return
+		}
+
+		lat, lng, err := parseLatLng(at)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid 'at' parameter: %v", err))
+			return
+		}
+
+		// Validate units
+		distanceUnit := DefaultUnit
+		if units != "" {
+			distanceUnit = DistanceUnit(strings.ToLower(units))
+			if !distanceUnit.IsValid() {
+				writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid units. Must be one of: %s, %s",
+					UnitKilometers, UnitMiles))
+				return
+			}
+		}
+
+		// Validate radius
+		radiusMeters := float64(DefaultStopsRadius)
+		if radius != "" {
+			radiusMeters, err = strconv.ParseFloat(radius, 64)
+			if err != nil || radiusMeters <= 0 || radiusMeters > MaxStopsRadius {
+				writeError(w, http.StatusBadRequest, fmt.Sprintf("radius must be between 1 and %d meters", MaxStopsRadius))
+				return
+			}
+		}
+
+		stops, err := nearbyStops(r.Context(), lat, lng, radiusMeters, distanceUnit)
+		if err != nil {
+			if _, ok := err.(*ErrNoResults); ok {
+				writeError(w, http.StatusNotFound, err.Error())
+				return
+			}
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		writeJSON(w, stops)
+
+	case http.MethodPost:
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			status, message := readBodyError(err)
+			http.Error(w, message, status)
+			return
+		}
+		defer r.Body.Close()
+
+		// Expect coordinates and optional units on separate lines
+		lines := strings.Split(strings.TrimSpace(string(body)), "\n")
+		lat, lng, err := parseLatLng(strings.TrimSpace(strings.TrimRight(lines[0], "\r")))
+		if err != nil {
+			http.Error(w, "invalid coordinates", http.StatusBadRequest)
+			return
+		}
+
+		distanceUnit := DefaultUnit
+		if len(lines) > 1 {
+			distanceUnit = DistanceUnit(strings.ToLower(strings.TrimSpace(strings.TrimRight(lines[1], "\r"))))
+			if !distanceUnit.IsValid() {
+				distanceUnit = DefaultUnit
+			}
+		}
+
+		stops, err := nearbyStops(r.Context(), lat, lng, DefaultStopsRadius, distanceUnit)
+		if err != nil {
+			if _, ok := err.(*ErrNoResults); ok {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// Return plain text format for POST requests
+		w.Header().Set("Content-Type", "text/plain")
+		// First line is the number of stops
+		fmt.Fprintf(w, "%d\n", len(stops))
+		// Output each stop as 3 consecutive lines: numbered name, ID, and distance with routes
+		for i, stop := range stops {
+			fmt.Fprintf(w, "%d. %s\n%s\n%s %s\n", i+1, stop.Name, stop.ID,
+				formatDistance(stop.Distance, distanceUnit), strings.Join(stop.Routes, ","))
+		}
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "only GET and POST methods are allowed")
+	}
+}
+
+// HandleDepartures handles the /nav/departures endpoint
+func HandleDepartures(w http.ResponseWriter, r *http.Request) {
+	// Log request URL and method
+	httpLog.DebugContext(r.Context(), "Departures request", "method", r.Method, "url", redactURL(r.URL.String()))
+
+	switch r.Method {
+	case http.MethodGet:
+		// Parse parameters
+		stopID := r.URL.Query().Get("stop")
+		at := r.URL.Query().Get("at")
+		limit := r.URL.Query().Get("limit")
+		format := r.URL.Query().Get("format")
+
+		if (stopID == "") == (at == "") {
+			writeError(w, http.StatusBadRequest, "exactly one of 'stop' or 'at' parameters is required")
+			return
+		}
+		wheelchair, err := parseWheelchair(r.URL.Query().Get("wheelchair"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		// Validate limit
+		maxResults := DefaultDeparturesLimit
+		if limit != "" {
+			var err error
+			maxResults, err = strconv.Atoi(limit)
+			if err != nil || maxResults < 1 || maxResults > MaxDeparturesLimit {
+				writeError(w, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", MaxDeparturesLimit))
+				return
+			}
+		}
+
+		// Pick the nearest stop when given coordinates
+		if at != "" {
+			lat, lng, err := parseLatLng(at)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid 'at' parameter: %v", err))
+				return
+			}
+			stopID, err = nearestStopID(r.Context(), lat, lng)
+			if err != nil {
+				if _, ok := err.(*ErrNoResults); ok {
+					writeError(w, http.StatusNotFound, "no stops found nearby")
+					return
+				}
+				writeError(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+		}
+
+		board, err := departures(r.Context(), stopID, maxResults, wheelchair)
+		if err != nil {
+			if _, ok := err.(*ErrNoResults); ok {
+				writeError(w, http.StatusNotFound, err.Error())
+				return
+			}
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		// Fixed-width board for 40-column screens
+		if format == "text" {
+			w.Header().Set("Content-Type", "text/plain")
+			writeDepartureBoard(w, board)
+			return
+		}
+
+		writeJSON(w, board)
+
+	case http.MethodPost:
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			status, message := readBodyError(err)
+			http.Error(w, message, status)
+			return
+		}
+		defer r.Body.Close()
+
+		// First line is a stop code, stop ID, or coordinates; an optional second
+		// line is the number of departures, and any further lines are key=value
+		// options such as wheelchair=true, as in the GET query string
+		lines := strings.Split(strings.TrimSpace(string(body)), "\n")
+		stop := strings.TrimSpace(lines[0])
+		if stop == "" {
+			http.Error(w, "request body cannot be empty", http.StatusBadRequest)
+			return
+		}
+
+		maxResults := DefaultDeparturesLimit
+		optionLines := lines[1:]
+		if len(lines) > 1 && !strings.Contains(lines[1], "=") {
+			if n, err := strconv.Atoi(strings.TrimSpace(lines[1])); err == nil && n >= 1 && n <= MaxDeparturesLimit {
+				maxResults = n
+			}
+			optionLines = lines[2:]
+		}
+		options := parseOptionLines(optionLines)
+		if !options.Has("wheelchair") {
+			options.Set("wheelchair", r.URL.Query().Get("wheelchair"))
+		}
+		wheelchair, err := parseWheelchair(options.Get("wheelchair"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var stopID string
+		if lat, lng, err := parseLatLng(stop); err == nil {
+			stopID, err = nearestStopID(r.Context(), lat, lng)
+			if err != nil {
+				if _, ok := err.(*ErrNoResults); ok {
+					http.Error(w, "no stops found nearby", http.StatusNotFound)
+					return
+				}
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		} else {
+			stopID = resolveStopID(stop)
+		}
+
+		board, err := departures(r.Context(), stopID, maxResults, wheelchair)
+		if err != nil {
+			if _, ok := err.(*ErrNoResults); ok {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// Return the fixed-width board for POST requests
+		w.Header().Set("Content-Type", "text/plain")
+		writeDepartureBoard(w, board)
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "only GET and POST methods are allowed")
+	}
+}
+
+// HandleTransitRoute handles the /nav/transit/route endpoint
+func HandleTransitRoute(w http.ResponseWriter, r *http.Request) {
+	// Log request URL and method
+	httpLog.DebugContext(r.Context(), "Transit route request", "method", r.Method, "url", redactURL(r.URL.String()))
+
+	switch r.Method {
+	case http.MethodGet:
+		routeID := r.URL.Query().Get("id")
+		if routeID == "" {
+			writeError(w, http.StatusBadRequest, "query parameter 'id' is required")
+			return
+		}
+
+		result, err := routeDetails(r.Context(), routeID)
+		if err != nil {
+			if _, ok := err.(*ErrNoResults); ok {
+				writeError(w, http.StatusNotFound, err.Error())
+				return
+			}
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		writeJSON(w, result)
+
+	case http.MethodPost:
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			status, message := readBodyError(err)
+			http.Error(w, message, status)
+			return
+		}
+		defer r.Body.Close()
+
+		routeID := strings.TrimSpace(string(body))
+		if routeID == "" {
+			http.Error(w, "request body cannot be empty", http.StatusBadRequest)
+			return
+		}
+
+		result, err := routeDetails(r.Context(), routeID)
+		if err != nil {
+			if _, ok := err.(*ErrNoResults); ok {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// Return plain text format for POST requests
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprintf(w, "%s\n%s\n%s\n%s\n%s\n", result.ShortName, result.LongName, result.VehicleType,
+			result.Operator, result.Color)
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "only GET and POST methods are allowed")
+	}
+}
+
+// HandleTransitStop handles the /nav/transit/stop endpoint
+func HandleTransitStop(w http.ResponseWriter, r *http.Request) {
+	// Log request URL and method
+	httpLog.DebugContext(r.Context(), "Transit stop request", "method", r.Method, "url", redactURL(r.URL.String()))
+
+	switch r.Method {
+	case http.MethodGet:
+		stopID := r.URL.Query().Get("id")
+		if stopID == "" {
+			writeError(w, http.StatusBadRequest, "query parameter 'id' is required")
+			return
+		}
+
+		result, err := stopDetails(r.Context(), stopID)
+		if err != nil {
+			if _, ok := err.(*ErrNoResults); ok {
+				writeError(w, http.StatusNotFound, err.Error())
+				return
+			}
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		writeJSON(w, result)
+
+	case http.MethodPost:
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			status, message := readBodyError(err)
+			http.Error(w, message, status)
+			return
+		}
+		defer r.Body.Close()
+
+		stopID := strings.TrimSpace(string(body))
+		if stopID == "" {
+			http.Error(w, "request body cannot be empty", http.StatusBadRequest)
+			return
+		}
+
+		result, err := stopDetails(r.Context(), stopID)
+		if err != nil {
+			if _, ok := err.(*ErrNoResults); ok {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// Return plain text format for POST requests
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprintf(w, "%s\n%s\n%.4f,%.4f\n%s\n", result.Name, result.Code, result.Lat, result.Lng, result.Wheelchair)
+		// Then the number of routes and one route per line
+		fmt.Fprintf(w, "%d\n", len(result.Routes))
+		for _, route := range result.Routes {
+			fmt.Fprintf(w, "%s %s\n", route.ShortName, route.LongName)
+		}
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "only GET and POST methods are allowed")
+	}
+}
+
+// HandleTransitAgencies handles the /nav/transit/agencies endpoint
+func HandleTransitAgencies(w http.ResponseWriter, r *http.Request) {
+	// Log request URL and method
+	httpLog.DebugContext(r.Context(), "Transit agencies request", "method", r.Method, "url", redactURL(r.URL.String()))
+
+	switch r.Method {
+	case http.MethodGet:
+		near := r.URL.Query().Get("near")
+		if near == "" {
+			writeError(w, http.StatusBadRequest, "query parameter 'near' is required")
+			return
+		}
+
+		lat, lng, err := parseLatLng(near)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid 'near' parameter: %v", err))
+			return
+		}
+
+		agencies, err := nearbyAgencies(r.Context(), lat, lng)
+		if err != nil {
+			if _, ok := err.(*ErrNoResults); ok {
+				writeError(w, http.StatusNotFound, err.Error())
+				return
+			}
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		writeJSON(w, agencies)
+
+	case http.MethodPost:
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			status, message := readBodyError(err)
+			http.Error(w, message, status)
+			return
+		}
+		defer r.Body.Close()
+
+		lat, lng, err := parseLatLng(strings.TrimSpace(string(body)))
+		if err != nil {
+			http.Error(w, "invalid coordinates", http.StatusBadRequest)
+			return
+		}
+
+		agencies, err := nearbyAgencies(r.Context(), lat, lng)
+		if err != nil {
+			if _, ok := err.(*ErrNoResults); ok {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// Return plain text format for POST requests
+		w.Header().Set("Content-Type", "text/plain")
+		// First line is the number of agencies
+		fmt.Fprintf(w, "%d\n", len(agencies))
+		// Output each agency as 3 consecutive lines
+		for _, agency := range agencies {
+			fmt.Fprintf(w, "%s\n%s\n%s\n", agency.Name, agency.ID, agency.Website)
+		}
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "only GET and POST methods are allowed")
+	}
+}
+
+// HandleTransitVehicles handles the /nav/transit/vehicles endpoint
+func HandleTransitVehicles(w http.ResponseWriter, r *http.Request) {
+	// Log request URL and method
+	httpLog.DebugContext(r.Context(), "Transit vehicles request", "method", r.Method, "url", redactURL(r.URL.String()))
+
+	switch r.Method {
+	case http.MethodGet:
+		routeID := r.URL.Query().Get("route")
+		if routeID == "" {
+			writeError(w, http.StatusBadRequest, "query parameter 'route' is required")
+			return
+		}
+
+		result, err := vehiclePositions(r.Context(), routeID)
+		if err != nil {
+			if _, ok := err.(*ErrNoResults); ok {
+				writeError(w, http.StatusNotFound, err.Error())
+				return
+			}
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		writeJSON(w, result)
+
+	case http.MethodPost:
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			status, message := readBodyError(err)
+			http.Error(w, message, status)
+			return
+		}
+		defer r.Body.Close()
+
+		routeID := strings.TrimSpace(string(body))
+		if routeID == "" {
+			http.Error(w, "request body cannot be empty", http.StatusBadRequest)
+			return
+		}
+
+		result, err := vehiclePositions(r.Context(), routeID)
+		if err != nil {
+			if _, ok := err.(*ErrNoResults); ok {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// Return plain text format for POST requests
+		w.Header().Set("Content-Type", "text/plain")
+		// First line is the number of vehicles
+		fmt.Fprintf(w, "%d\n", len(result.Vehicles))
+		// Output each vehicle as 2 consecutive lines: label and headsign, then grid position
+		for _, v := range result.Vehicles {
+			label := v.Label
+			if label == "" {
+				label = v.ID
+			}
+			fmt.Fprintf(w, "%s %s\n%d,%d\n", label, v.Headsign, v.Point[0], v.Point[1])
+		}
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "only GET and POST methods are allowed")
+	}
+}
+
+// HandleTransitAlerts handles the /nav/transit/alerts endpoint
+func HandleTransitAlerts(w http.ResponseWriter, r *http.Request) {
+	// Log request URL and method
+	httpLog.DebugContext(r.Context(), "Transit alerts request", "method", r.Method, "url", redactURL(r.URL.String()))
+
+	switch r.Method {
+	case http.MethodGet:
+		alerts, err := transitAlerts(r.Context(), r.URL.Query().Get("route"), r.URL.Query().Get("stop"))
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		writeJSON(w, alerts)
+
+	case http.MethodPost:
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			status, message := readBodyError(err)
+			http.Error(w, message, status)
+			return
+		}
+		defer r.Body.Close()
+
+		// The body may name either a route or a stop
+		id := strings.TrimSpace(string(body))
+		if id == "" {
+			http.Error(w, "request body cannot be empty", http.StatusBadRequest)
+			return
+		}
+
+		alerts, err := transitAlerts(r.Context(), id, id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// Return plain text format for POST requests
+		w.Header().Set("Content-Type", "text/plain")
+		// First line is the number of alerts
+		fmt.Fprintf(w, "%d\n", len(alerts))
+		// Output each alert as 2 consecutive lines: header and effect
+		for _, alert := range alerts {
+			fmt.Fprintf(w, "%s\n%s\n", alert.Header, alert.Effect)
+		}
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "only GET and POST methods are allowed")
+	}
+}
+
+// HandleTransitCoverage handles the /nav/transit/coverage endpoint
+func HandleTransitCoverage(w http.ResponseWriter, r *http.Request) {
+	// Log request URL and method
+	httpLog.DebugContext(r.Context(), "Transit coverage request", "method", r.Method, "url", redactURL(r.URL.String()))
+
+	switch r.Method {
+	case http.MethodGet:
+		at := r.URL.Query().Get("at")
+		if at == "" {
+			writeError(w, http.StatusBadRequest, "query parameter 'at' is required")
+			return
+		}
+
+		lat, lng, err := parseLatLng(at)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid 'at' parameter: %v", err))
+			return
+		}
+
+		coverage, err := transitCoverage(r.Context(), lat, lng)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		writeJSON(w, coverage)
+
+	case http.MethodPost:
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			status, message := readBodyError(err)
+			http.Error(w, message, status)
+			return
+		}
+		defer r.Body.Close()
+
+		lat, lng, err := parseLatLng(strings.TrimSpace(string(body)))
+		if err != nil {
+			http.Error(w, "invalid coordinates", http.StatusBadRequest)
+			return
+		}
+
+		coverage, err := transitCoverage(r.Context(), lat, lng)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// Return plain text format for POST requests: 1 or 0, then the providers
+		w.Header().Set("Content-Type", "text/plain")
+		available := 0
+		if coverage.Available {
+			available = 1
+		}
+		fmt.Fprintf(w, "%d\n%s\n", available, strings.Join(coverage.Providers, ","))
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "only GET and POST methods are allowed")
+	}
+}
+
+// HandleRouteProgress handles the /nav/progress endpoint
+func HandleRouteProgress(w http.ResponseWriter, r *http.Request) {
+	// Log request URL and method
+	httpLog.DebugContext(r.Context(), "Progress request", "method", r.Method, "url", redactURL(r.URL.String()))
+
+	switch r.Method {
+	case http.MethodGet:
+		// Parse parameters
+		routeID := r.URL.Query().Get("route")
+		at := r.URL.Query().Get("at")
+
+		if routeID == "" || at == "" {
+			writeError(w, http.StatusBadRequest, "both 'route' and 'at' parameters are required")
+			return
+		}
+
+		lat, lng, err := parseLatLng(at)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid 'at' parameter: %v", err))
+			return
+		}
+
+		result, err := routeProgress(routeID, lat, lng)
+		if err != nil {
+			if _, ok := err.(*ErrNoResults); ok {
+				writeError(w, http.StatusNotFound, fmt.Sprintf("route %s not found or expired", routeID))
+				return
+			}
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		writeJSON(w, result)
+
+	case http.MethodPost:
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			status, message := readBodyError(err)
+			http.Error(w, message, status)
+			return
+		}
+		defer r.Body.Close()
+
+		// Expect the route ID and current position on separate lines
+		lines := strings.Split(strings.TrimSpace(string(body)), "\n")
+		if len(lines) < 2 {
+			http.Error(w, "request must contain at least 2 lines", http.StatusBadRequest)
+			return
+		}
+
+		routeID := strings.TrimSpace(strings.TrimRight(lines[0], "\r"))
+		lat, lng, err := parseLatLng(strings.TrimSpace(strings.TrimRight(lines[1], "\r")))
+		if err != nil {
+			http.Error(w, "invalid coordinates", http.StatusBadRequest)
+			return
+		}
+
+		result, err := routeProgress(routeID, lat, lng)
+		if err != nil {
+			if _, ok := err.(*ErrNoResults); ok {
+				http.Error(w, fmt.Sprintf("route %s not found or expired", routeID), http.StatusNotFound)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// Return plain text format for POST requests
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprintf(w, "%d\n%s\n%s\n%s\n", result.Step, result.Street,
+			formatDistance(result.StepRemaining, result.Units), formatDistance(result.Remaining, result.Units))
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "only GET and POST methods are allowed")
+	}
+}
+
+// parseBitmapSize reads a bitmap width and height, using the defaults for empty values
+func parseBitmapSize(width, height string) (int, int, error) {
+	return parseImageSize(width, height, DefaultBitmapWidth, DefaultBitmapHeight, MaxBitmapWidth, MaxBitmapHeight)
+}
+
+// parseImageSize reads an image width and height within limits, using the
+// defaults for empty values
+func parseImageSize(width, height string, defaultWidth, defaultHeight, maxWidth, maxHeight int) (int, int, error) {
+	w, h := defaultWidth, defaultHeight
+	if width != "" {
+		n, err := strconv.Atoi(width)
+		if err != nil || n < 1 || n > maxWidth {
+			return 0, 0, fmt.Errorf("width must be between 1 and %d", maxWidth)
+		}
+		w = n
+	}
+	if height != "" {
+		n, err := strconv.Atoi(height)
+		if err != nil || n < 1 || n > maxHeight {
+			return 0, 0, fmt.Errorf("height must be between 1 and %d", maxHeight)
+		}
+		h = n
+	}
+	return w, h, nil
+}
+
+// writeBitmap writes a packed bitmap as raw bytes
+func writeBitmap(w http.ResponseWriter, bitmap []byte) {
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.Itoa(len(bitmap)))
+	w.Write(bitmap)
+}
+
+// HandleRouteBitmap handles the /nav/route/bitmap endpoint
+func HandleRouteBitmap(w http.ResponseWriter, r *http.Request) {
+	// Log request URL and method
+	httpLog.DebugContext(r.Context(), "Route bitmap request", "method", r.Method, "url", redactURL(r.URL.String()))
+
+	switch r.Method {
+	case http.MethodGet:
+		// Parse parameters
+		routeID := r.URL.Query().Get("route")
+		if routeID == "" {
+			writeError(w, http.StatusBadRequest, "'route' parameter is required")
+			return
+		}
+
+		width, height, err := parseBitmapSize(r.URL.Query().Get("width"), r.URL.Query().Get("height"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		bitmap, err := routeBitmap(routeID, width, height)
+		if err != nil {
+			if _, ok := err.(*ErrNoResults); ok {
+				writeError(w, http.StatusNotFound, fmt.Sprintf("route %s not found or expired", routeID))
+				return
+			}
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		writeBitmap(w, bitmap)
+
+	case http.MethodPost:
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			status, message := readBodyError(err)
+			http.Error(w, message, status)
+			return
+		}
+		defer r.Body.Close()
+
+		// Expect the route ID, then optional width and height lines
+		lines := strings.Split(strings.TrimSpace(string(body)), "\n")
+		for i := range lines {
+			lines[i] = strings.TrimSpace(strings.TrimRight(lines[i], "\r"))
+		}
+		routeID := lines[0]
+		if routeID == "" {
+			http.Error(w, "request must contain a route ID", http.StatusBadRequest)
+			return
+		}
+
+		var widthLine, heightLine string
+		if len(lines) > 1 {
+			widthLine = lines[1]
+		}
+		if len(lines) > 2 {
+			heightLine = lines[2]
+		}
+		width, height, err := parseBitmapSize(widthLine, heightLine)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		bitmap, err := routeBitmap(routeID, width, height)
+		if err != nil {
+			if _, ok := err.(*ErrNoResults); ok {
+				http.Error(w, fmt.Sprintf("route %s not found or expired", routeID), http.StatusNotFound)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		writeBitmap(w, bitmap)
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "only GET and POST methods are allowed")
+	}
+}
+
+// HandleHealth reports that the server is up, for load balancer and container
+// health checks. With probe=1 it also checks each upstream dependency and
+// responds 503 when any is down.
+func HandleHealth(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeError(w, http.StatusMethodNotAllowed, "only GET method is allowed")
+		return
+	}
+
+	probe, _ := strconv.ParseBool(r.URL.Query().Get("probe"))
+	if !probe {
+		writeJSON(w, HealthResponse{Status: "ok"})
+		return
+	}
+
+	health := checkHealth(r.Context())
+	if health.Status != "ok" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(health)
+		return
+	}
+	writeJSON(w, health)
+}
+
+// HandleUsage reports the calling API key's request counts
+func HandleUsage(w http.ResponseWriter, r *http.Request) {
+	httpLog.DebugContext(r.Context(), "Usage request", "method", r.Method, "url", redactURL(r.URL.String()))
+
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "only GET method is allowed")
+		return
+	}
+	k := requestAPIKey(r.Context())
+	if k == nil {
+		writeError(w, http.StatusNotFound, "API keys are not enabled")
+		return
+	}
+	writeJSON(w, k.usage())
+}
+
+// HandleVersion reports the running build and its enabled modules, as JSON
+// for GET or for POST as lines: version, commit, build date, the number of
+// routers and one per line, then the number of features and one per line
+func HandleVersion(w http.ResponseWriter, r *http.Request) {
+	httpLog.DebugContext(r.Context(), "Version request", "method", r.Method, "url", redactURL(r.URL.String()))
+
+	version := versionInfo(r.Context())
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, version)
+
+	case http.MethodPost:
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprintf(w, "%s\n%s\n%s\n%d\n", version.Version, version.Commit, version.BuildDate, len(version.Routers))
+		for _, router := range version.Routers {
+			fmt.Fprintf(w, "%s\n", router)
+		}
+		fmt.Fprintf(w, "%d\n", len(version.Features))
+		for _, feature := range version.Features {
+			fmt.Fprintf(w, "%s\n", feature)
+		}
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "only GET and POST methods are allowed")
+	}
+}
+
+// HandleReady reports whether the server has finished loading its config and
+// data, responding 503 until then so traffic isn't sent to a starting instance
+func HandleReady(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeError(w, http.StatusMethodNotAllowed, "only GET method is allowed")
+		return
+	}
+
+	readiness := checkReadiness()
+	if readiness.Status != "ready" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(readiness)
+		return
+	}
+	writeJSON(w, readiness)
+}
+
+// HandleStaticMap handles the /nav/staticmap endpoint
+func HandleStaticMap(w http.ResponseWriter, r *http.Request) {
+	// Log request URL and method
+	httpLog.DebugContext(r.Context(), "Static map request", "method", r.Method, "url", redactURL(r.URL.String()))
+
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "only GET method is allowed")
+		return
+	}
+
+	// Parse parameters
+	routeID := r.URL.Query().Get("route")
+	if routeID == "" {
+		writeError(w, http.StatusBadRequest, "'route' parameter is required")
+		return
+	}
+
+	// Tiles are drawn by default when a tile server is configured
+	tiles := true
+	switch strings.ToLower(r.URL.Query().Get("tiles")) {
+	case "", "on":
+	case "off":
+		tiles = false
+	default:
+		writeError(w, http.StatusBadRequest, "tiles must be on or off")
+		return
+	}
+
+	switch format := r.URL.Query().Get("format"); format {
+	case "", "png":
+	case "raw":
+		writeStaticMapFramebuffer(w, r, routeID, tiles)
+		return
+	default:
+		writeError(w, http.StatusBadRequest, "format must be png or raw")
+		return
+	}
+
+	width, height, err := parseImageSize(r.URL.Query().Get("width"), r.URL.Query().Get("height"),
+		DefaultStaticMapWidth, DefaultStaticMapHeight, MaxStaticMapWidth, MaxStaticMapHeight)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	img, err := routeStaticMap(r.Context(), routeID, width, height, tiles)
+	if err != nil {
+		if _, ok := err.(*ErrNoResults); ok {
+			writeError(w, http.StatusNotFound, fmt.Sprintf("route %s not found or expired", routeID))
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := writePNG(&buf, img); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	w.Write(buf.Bytes())
+}
+
+// writeStaticMapFramebuffer writes a route map as a dithered raw framebuffer
+// for format=raw, reading its size, depth, palette, and pixel aspect
+func writeStaticMapFramebuffer(w http.ResponseWriter, r *http.Request, routeID string, tiles bool) {
+	query := r.URL.Query()
+	width, height, err := parseImageSize(query.Get("width"), query.Get("height"),
+		DefaultFramebufferWidth, DefaultFramebufferHeight, MaxFramebufferWidth, MaxFramebufferHeight)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	bits := DefaultFramebufferBits
+	if v := query.Get("bits"); v != "" {
+		bits, err = strconv.Atoi(v)
+		if err != nil || (bits != 2 && bits != 4) {
+			writeError(w, http.StatusBadRequest, "bits must be 2 or 4")
+			return
+		}
+	}
+
+	palette := PaletteGray
+	if v := query.Get("palette"); v != "" {
+		palette = Palette(strings.ToLower(v))
+		if !palette.IsValid() {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid palette. Must be one of: %s, %s, %s",
+				PaletteGray, PaletteCGA, PaletteC64))
+			return
+		}
+	}
+
+	aspect := 1
+	if v := query.Get("aspect"); v != "" {
+		aspect, err = strconv.Atoi(v)
+		if err != nil || aspect < 1 || aspect > MaxPixelAspect {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("aspect must be between 1 and %d", MaxPixelAspect))
+			return
+		}
+	}
+
+	framebuffer, err := routeFramebuffer(r.Context(), routeID, width, height, bits, aspect, palette, tiles)
+	if err != nil {
+		if _, ok := err.(*ErrNoResults); ok {
+			writeError(w, http.StatusNotFound, fmt.Sprintf("route %s not found or expired", routeID))
+			return
+		}
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	writeBitmap(w, framebuffer)
+}
+
+// publicBaseURL returns the base URL clients reach this server at, from the
+// configuration or else the request, for links that leave the client
+func publicBaseURL(r *http.Request) string {
+	if configFor(r.Context()).PublicURL != "" {
+		return strings.TrimRight(configFor(r.Context()).PublicURL, "/")
+	}
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+// HandleRouteQR handles the /nav/route/{id}/qr endpoint, encoding a link to a
+// stored route so it can be handed off to a phone
+func HandleRouteQR(w http.ResponseWriter, r *http.Request) {
+	// Log request URL and method
+	httpLog.DebugContext(r.Context(), "Route QR request", "method", r.Method, "url", redactURL(r.URL.String()))
+
+	routeID, rest, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/nav/route/"), "/")
+	if routeID == "" || rest != "qr" {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "only GET and POST methods are allowed")
+		return
+	}
+
+	if _, ok := routeStore.get(routeID); !ok {
+		message := fmt.Sprintf("route %s not found or expired", routeID)
+		if r.Method == http.MethodPost {
+			http.Error(w, message, http.StatusNotFound)
+		} else {
+			writeError(w, http.StatusNotFound, message)
+		}
+		return
+	}
+
+	link := publicBaseURL(r) + "/nav/route?route=" + url.QueryEscape(routeID)
+	code, err := encodeQR([]byte(link))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Return the code as text blocks for POST requests and format=text
+	if r.Method == http.MethodPost || r.URL.Query().Get("format") == "text" {
+		w.Header().Set("Content-Type", "text/plain")
+		code.writeText(w)
+		return
+	}
+
+	switch format := r.URL.Query().Get("format"); format {
+	case "", "png":
+	default:
+		writeError(w, http.StatusBadRequest, "format must be png or text")
+		return
+	}
+
+	scale := DefaultQRScale
+	if v := r.URL.Query().Get("scale"); v != "" {
+		scale, err = strconv.Atoi(v)
+		if err != nil || scale < 1 || scale > MaxQRScale {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("scale must be between 1 and %d", MaxQRScale))
+			return
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := writePNG(&buf, code.image(scale)); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	w.Write(buf.Bytes())
+}
+
+// HandleRoute handles the /nav/route endpoint
+func HandleRoute(w http.ResponseWriter, r *http.Request) {
+	// Log request URL and method
+	httpLog.DebugContext(r.Context(), "Route request", "method", r.Method, "url", redactURL(r.URL.String()))
+
+	switch r.Method {
+	case http.MethodGet:
+		// A stored route is fetched by ID, for more pages of steps without re-planning
+		if routeID := r.URL.Query().Get("route"); routeID != "" {
+			output, err := parseRouteOutput(r.URL.Query(), r.Header.Get("Accept-Language"))
+			if err != nil {
+				writeError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+
+			result, err := storedRoute(routeID)
+			if err != nil {
+				writeError(w, http.StatusNotFound, fmt.Sprintf("route %s not found or expired", routeID))
+				return
+			}
+			writeRouteResult(w, r, result, output)
+			return
+		}
+
+		// Parse parameters
+		from := r.URL.Query().Get("from")
+		to := r.URL.Query().Get("to")
+		mode := r.URL.Query().Get("mode")
+		units := r.URL.Query().Get("units")
+		country := strings.ToLower(r.URL.Query().Get("country"))
+		fromDesc := r.URL.Query().Get("fromDesc")
+		toDesc := r.URL.Query().Get("toDesc")
+
+		// Log query parameters
+		routeLog.DebugContext(r.Context(), "Route parameters", "from", from, "to", to, "mode", mode, "units", units,
+			"country", country, "fromDesc", fromDesc, "toDesc", toDesc)
+
+		if from == "" || to == "" {
+			writeError(w, http.StatusBadRequest, "both 'from' and 'to' parameters are required")
+			return
+		}
+
+		// Validate country code if provided
+		var countryCode CountryCode
+		if country != "" {
+			countryCode = CountryCode(country)
+			if !countryCode.IsValid() {
+				writeError(w, http.StatusBadRequest, "country must be a valid 2-letter ISO code in lowercase")
+				return
+			}
+		}
+
+		// Validate mode
+		var transportMode TransportMode
+		if mode == "" {
+			transportMode = DefaultMode
+		} else {
+			transportMode = TransportMode(strings.ToLower(mode))
+			if !transportMode.IsValid() {
+				writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid mode. Must be one of: %s, %s, %s, %s, %s",
+					ModeWalking, ModeBiking, ModeAuto, ModeTransit, ModeParkRide))
+				return
+			}
+		}
+
+		// Validate units
+		var distanceUnit DistanceUnit
+		if units == "" {
+			distanceUnit = DefaultUnit
+		} else {
+			distanceUnit = DistanceUnit(strings.ToLower(units))
+			if !distanceUnit.IsValid() {
+				writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid units. Must be one of: %s, %s",
+					UnitKilometers, UnitMiles))
+				return
+			}
+		}
+
+		// Parse coordinates
+		fromLat, fromLng, err := parseLocation(r.Context(), from)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid 'from' parameter: %v", err))
+			return
+		}
+
+		toLat, toLng, err := parseLocation(r.Context(), to)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid 'to' parameter: %v", err))
+			return
+		}
+
+		req := RouteRequest{
+			FromLat:  fromLat,
+			FromLng:  fromLng,
+			ToLat:    toLat,
+			ToLng:    toLng,
+			FromDesc: fromDesc,
+			ToDesc:   toDesc,
+			Mode:     transportMode,
+			Units:    distanceUnit,
+			Country:  countryCode,
+		}
+		if err := parseRouteOptions(r.URL.Query(), &req); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		output, err := parseRouteOutput(r.URL.Query(), r.Header.Get("Accept-Language"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		handleRouteRequest(w, r, req, output)
+
+	case http.MethodPost:
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			status, message := readBodyError(err)
+			w.Header().Set("Content-Type", "text/plain")
+			w.WriteHeader(status)
+			fmt.Fprintf(w, "\n\n0\n%s\n", message)
+			return
+		}
+		defer r.Body.Close()
+
+		// Log request body
+		httpLog.DebugContext(r.Context(), "Route POST body", "body", string(body))
+
+		// A GPX file is routed through its points, with options in the query string
+		if isGPX(r.Header.Get("Content-Type"), body) {
+			waypoints, err := parseGPX(body)
+			if err != nil {
+				w.Header().Set("Content-Type", "text/plain")
+				fmt.Fprintf(w, "\n\n0\n%s\n", err.Error())
+				return
+			}
+			handleWaypointRoute(w, r, waypoints, r.URL.Query())
+			return
+		}
+
+		// Split the body into lines
+		lines := strings.Split(strings.TrimSpace(string(body)), "\n")
+
+		// A stored route ID on its own line, followed by option lines, fetches
+		// more pages of steps without re-planning
+		if result, err := storedRoute(strings.TrimSpace(lines[0])); err == nil {
+			output, err := parseRouteOutput(parseOptionLines(lines[1:]), r.Header.Get("Accept-Language"))
+			if err != nil {
+				w.Header().Set("Content-Type", "text/plain")
+				fmt.Fprintf(w, "\n\n0\n%s\n", err.Error())
+				return
+			}
+			writeRouteResult(w, r, result, output)
+			return
+		}
+
+		// A list of locations instead of a mode on the first line is routed
+		// through in order, followed by option lines
+		if _, _, err := parseLatLng(strings.TrimSpace(lines[0])); err == nil {
+			waypoints, optionLines, err := parseWaypointLines(r.Context(), lines)
+			if err != nil {
+				w.Header().Set("Content-Type", "text/plain")
+				fmt.Fprintf(w, "\n\n0\n%s\n", err.Error())
+				return
+			}
+			handleWaypointRoute(w, r, waypoints, parseOptionLines(optionLines))
+			return
+		}
+
+		if len(lines) < 5 {
+			w.Header().Set("Content-Type", "text/plain")
+			fmt.Fprintf(w, "\n\n0\nrequest must contain at least 5 lines\n")
+			return
+		}
+
+		// Clean up any \r from \r\n line endings
+		mode := strings.TrimSpace(strings.TrimRight(lines[0], "\r"))
+		country := strings.TrimSpace(strings.TrimRight(lines[1], "\r"))
+		units := strings.TrimSpace(strings.TrimRight(lines[2], "\r"))
+		from := strings.TrimSpace(strings.TrimRight(lines[3], "\r"))
+		to := strings.TrimSpace(strings.TrimRight(lines[4], "\r"))
+
+		// Validate and convert mode and units
+		transportMode := TransportMode(strings.ToLower(mode))
+		if !transportMode.IsValid() {
+			transportMode = DefaultMode
+		}
+		distanceUnit := DistanceUnit(strings.ToLower(units))
+		if !distanceUnit.IsValid() {
+			distanceUnit = DefaultUnit
+		}
+		countryCode := CountryCode(strings.ToLower(country))
+		if !countryCode.IsValid() {
+			countryCode = CountryCode("us")
+		}
+
+		// Get optional descriptions if provided
+		var fromDesc, toDesc string
+		if len(lines) > 5 {
+			fromDesc = strings.TrimSpace(strings.TrimRight(lines[5], "\r"))
+		}
+		if len(lines) > 6 {
+			toDesc = strings.TrimSpace(strings.TrimRight(lines[6], "\r"))
+		}
+
+		// Parse coordinates
+		fromLat, fromLng, err := parseLocation(r.Context(), from)
+		if err != nil {
+			w.Header().Set("Content-Type", "text/plain")
+			fmt.Fprintf(w, "\n\n0\ninvalid 'from' coordinates\n")
+			return
+		}
+
+		toLat, toLng, err := parseLocation(r.Context(), to)
+		if err != nil {
+			w.Header().Set("Content-Type", "text/plain")
+			fmt.Fprintf(w, "\n\n0\ninvalid 'to' coordinates\n")
+			return
+		}
+
+		req := RouteRequest{
+			FromLat:  fromLat,
+			FromLng:  fromLng,
+			ToLat:    toLat,
+			ToLng:    toLng,
+			FromDesc: fromDesc,
+			ToDesc:   toDesc,
+			Mode:     transportMode,
+			Units:    distanceUnit,
+			Country:  countryCode,
+		}
+
+		// Any further lines are key=value options, as in the GET query string
+		options := url.Values{}
+		if len(lines) > 7 {
+			options = parseOptionLines(lines[7:])
+			if err := parseRouteOptions(options, &req); err != nil {
+				w.Header().Set("Content-Type", "text/plain")
+				fmt.Fprintf(w, "\n\n0\n%s\n", err.Error())
+				return
+			}
+		}
+		output, err := parseRouteOutput(options, r.Header.Get("Accept-Language"))
+		if err != nil {
+			w.Header().Set("Content-Type", "text/plain")
+			fmt.Fprintf(w, "\n\n0\n%s\n", err.Error())
+			return
+		}
+
+		// Handle the route request
+		result, err := route(r.Context(), req)
+		if err != nil {
+			w.Header().Set("Content-Type", "text/plain")
+			fmt.Fprintf(w, "\n\n0\n%s\n", err.Error())
+			return
+		}
+
+		// Write plain text response
+		writeRouteResult(w, r, result, output)
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "only GET and POST methods are allowed")
+	}
+}
+
+// routeOutput holds the parameters controlling how a route response is written
+type routeOutput struct {
+	Compact        bool   // One line per step in plain text
+	Format         string // "" for the default, ascii for a map of the path, or bin for the binary format
+	Width          int    // ASCII map size in characters
+	Height         int
+	Cols           int // Client screen width for wrapping, or 0 to leave lines as they are
+	Page           int // Page of steps to return, or 0 for all steps
+	PerPage        int
+	Path           string // Path encoding for JSON: "" for absolute points or delta
+	Icons          string // "" for icon names or numeric for icon codes
+	Aspect         string // "" to stretch the path to fill the grid or preserve
+	PathWidth      int    // Path grid size, or 0 for NormalizedGridSize
+	DurationFormat string // How plain-text durations are written, DurationText by default
+	Lang           string // Catalog language for fixed plain-text strings, or "" for English
+	PathHeight     int
+	MaxPoints      int // Most path points to return, or 0 for no limit
+	MaxBytes       int // Plain-text size budget, or 0 for no limit
+	Detail         Detail
+	Fields         []string // JSON fields to keep, e.g. steps.description, or none for all
+}
+
+// parseRouteOutput reads the output parameters shared by GET and POST route requests
+func parseRouteOutput(options url.Values, acceptLanguage string) (routeOutput, error) {
+	output := routeOutput{
+		Compact: options.Get("compact") == "1",
+		Format:  options.Get("format"),
+		Width:   DefaultMapWidth,
+		Height:  DefaultMapHeight,
+	}
+	switch output.Format {
+	case "", "ascii", "bin", "inline", "narrative":
+	default:
+		return output, fmt.Errorf("format must be ascii, bin, inline, or narrative")
+	}
+
+	for _, dim := range []struct {
+		name  string
+		value *int
+	}{{"width", &output.Width}, {"height", &output.Height}} {
+		v := options.Get(dim.name)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < MinMapSize || n > MaxMapSize {
+			return output, fmt.Errorf("%s must be between %d and %d", dim.name, MinMapSize, MaxMapSize)
+		}
+		*dim.value = n
+	}
+
+	if v := options.Get("cols"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < MinColumns || n > MaxColumns {
+			return output, fmt.Errorf("cols must be between %d and %d", MinColumns, MaxColumns)
+		}
+		output.Cols = n
+	}
+
+	output.Path = options.Get("path")
+	if output.Path != "" && output.Path != PathEncodingDelta {
+		return output, fmt.Errorf("path must be %s", PathEncodingDelta)
+	}
+
+	output.Aspect = options.Get("aspect")
+	if output.Aspect != "" && output.Aspect != "fill" && output.Aspect != PathAspectPreserve {
+		return output, fmt.Errorf("aspect must be fill or %s", PathAspectPreserve)
+	}
+	if output.Aspect == "fill" {
+		output.Aspect = ""
+	}
+
+	for _, dim := range []struct {
+		name  string
+		value *int
+	}{{"pathWidth", &output.PathWidth}, {"pathHeight", &output.PathHeight}} {
+		v := options.Get(dim.name)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < MinPathSize || n > MaxPathSize {
+			return output, fmt.Errorf("%s must be between %d and %d", dim.name, MinPathSize, MaxPathSize)
+		}
+		*dim.value = n
+	}
+	if output.Path == PathEncodingDelta && (output.PathWidth > MaxDeltaPathSize || output.PathHeight > MaxDeltaPathSize) {
+		return output, fmt.Errorf("pathWidth and pathHeight must be at most %d with path=%s", MaxDeltaPathSize, PathEncodingDelta)
+	}
+
+	durationFormat, _, err := parseTimeFormat(options.Get("timeFormat"))
+	if err != nil {
+		return output, err
+	}
+	output.DurationFormat = durationFormat
+
+	// Plain-text language from a lang option, falling back to the Accept-Language header
+	lang := options.Get("lang")
+	if lang == "" {
+		lang = acceptLanguage
+	}
+	output.Lang = catalogLanguage(lang)
+
+	output.Icons = options.Get("icons")
+	if output.Icons != "" && output.Icons != "numeric" {
+		return output, fmt.Errorf("icons must be numeric")
+	}
+
+	if v := options.Get("maxPoints"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 2 {
+			return output, fmt.Errorf("maxPoints must be at least 2")
+		}
+		output.MaxPoints = n
+	}
+
+	output.Fields = parseList(options.Get("fields"))
+
+	output.Detail = DefaultDetail
+	if v := options.Get("detail"); v != "" {
+		output.Detail = Detail(strings.ToLower(v))
+		if !output.Detail.IsValid() {
+			return output, fmt.Errorf("invalid detail. Must be one of: %s, %s, %s", DetailBrief, DetailNormal, DetailFull)
+		}
+	}
+
+	maxBytes, err := parseMaxBytes(options.Get("maxBytes"))
+	if err != nil {
+		return output, err
+	}
+	output.MaxBytes = maxBytes
+
+	page, perPage := options.Get("page"), options.Get("per_page")
+	if page != "" || perPage != "" {
+		output.Page, output.PerPage = 1, DefaultStepsPerPage
+	}
+	if page != "" {
+		n, err := strconv.Atoi(page)
+		if err != nil || n < 1 {
+			return output, fmt.Errorf("page must be a positive integer")
+		}
+		output.Page = n
+	}
+	if perPage != "" {
+		n, err := strconv.Atoi(perPage)
+		if err != nil || n < 1 || n > MaxStepsPerPage {
+			return output, fmt.Errorf("per_page must be between 1 and %d", MaxStepsPerPage)
+		}
+		output.PerPage = n
+	}
+	return output, nil
+}
+
+// DefaultStepsPerPage is the number of route steps per page when only page is given
+const DefaultStepsPerPage = 8
+
+// MaxStepsPerPage is the largest number of route steps per page
+const MaxStepsPerPage = 100
+
+// paginateRoute returns a copy of a route with only the requested page of steps,
+// leaving the path and totals for the whole route
+func paginateRoute(result *RouteResponse, output routeOutput) (*RouteResponse, error) {
+	if output.Page == 0 {
+		return result, nil
+	}
+
+	pages := max(1, (len(result.Steps)+output.PerPage-1)/output.PerPage)
+	if output.Page > pages {
+		return nil, fmt.Errorf("page must be between 1 and %d", pages)
+	}
+
+	paged := *result
+	start := (output.Page - 1) * output.PerPage
+	end := min(len(result.Steps), start+output.PerPage)
+	paged.Steps = result.Steps[start:end]
+	paged.Page, paged.PerPage, paged.Pages = output.Page, output.PerPage, pages
+	return &paged, nil
+}
+
+// writeRouteText writes a route in the plain-text or binary format selected by the output parameters
+func writeRouteText(ctx context.Context, w http.ResponseWriter, result *RouteResponse, output routeOutput) {
+	if output.Format == "bin" {
+		writeBinaryRoute(w, result)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	if output.Format == "narrative" {
+		w.Write(renderNarrativeRoute(ctx, result, output))
+		return
+	}
+	if output.MaxBytes > 0 {
+		w.Write(fitRouteText(ctx, result, output))
+		return
+	}
+	if output.Format == "ascii" {
+		writeASCIIMap(w, result, output.Width, output.Height)
+		return
+	}
+	writePlainTextRoute(w, result, output)
+}
+
+// parseRouteOptions applies optional routing parameters to a route request
+func parseRouteOptions(options url.Values, req *RouteRequest) error {
+	if v := options.Get("maxTransfers"); v != "" {
+		maxTransfers, err := strconv.Atoi(v)
+		if err != nil || maxTransfers < 0 {
+			return fmt.Errorf("maxTransfers must be a non-negative integer")
+		}
+		req.MaxTransfers = &maxTransfers
+	}
+	if v := options.Get("maxWalk"); v != "" {
+		maxWalk, err := strconv.ParseFloat(v, 64)
+		if err != nil || maxWalk <= 0 {
+			return fmt.Errorf("maxWalk must be a positive distance in meters")
+		}
+		req.MaxWalk = maxWalk
+	}
+	wheelchair, err := parseWheelchair(options.Get("wheelchair"))
+	if err != nil {
+		return err
+	}
+	req.Wheelchair = wheelchair
+	if v := options.Get("times"); v != "" {
+		times, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("times must be true or false")
+		}
+		req.StepTimes = times
+	}
+	if v := options.Get("depart"); v != "" {
+		if !validDepartTime(v) {
+			return fmt.Errorf("depart must be an RFC 3339 time, YYYY-MM-DDTHH:MM, or HH:MM")
+		}
+		req.Depart = v
+	}
+	req.BannedRoutes = parseList(options.Get("bannedRoutes"))
+	req.PreferredRoutes = parseList(options.Get("preferredRoutes"))
+	req.BannedAgencies = parseList(options.Get("bannedAgencies"))
+	req.PreferredAgencies = parseList(options.Get("preferredAgencies"))
+
+	unabbreviated, err := parseAbbrev(options.Get("abbrev"))
+	if err != nil {
+		return err
+	}
+	req.Unabbreviated = unabbreviated
+
+	_, twelveHour, err := parseTimeFormat(options.Get("timeFormat"))
+	if err != nil {
+		return err
+	}
+	req.TwelveHourClock = twelveHour
+	return nil
+}
+
+// parseAbbrev reads an abbrev parameter, returning true when abbreviations are turned off
+func parseAbbrev(v string) (bool, error) {
+	switch strings.ToLower(v) {
+	case "", "on":
+		return false, nil
+	case "off":
+		return true, nil
+	default:
+		return false, fmt.Errorf("abbrev must be on or off")
+	}
+}
+
+// parseList splits a comma-separated parameter, dropping empty entries
+func parseList(s string) []string {
+	var values []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// handleRouteRequest handles the common routing logic for both GET and POST requests
+func handleRouteRequest(w http.ResponseWriter, r *http.Request, req RouteRequest, output routeOutput) {
+	// Get route
+	result, err := route(r.Context(), req)
+	if err != nil {
+		if _, ok := err.(*ErrUpstreamUnavailable); ok {
+			writeError(w, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		if errors.Is(err, errTransitDisabled) {
+			writeError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeRouteResult(w, r, result, output)
+}
+
+// handleWaypointRoute plans a POST route through uploaded waypoints, taking
+// mode, units, and country from the options along with the usual route options
+func handleWaypointRoute(w http.ResponseWriter, r *http.Request, waypoints []waypoint, options url.Values) {
+	req := waypointRequest(waypoints)
+	req.Mode = TransportMode(strings.ToLower(options.Get("mode")))
+	if !req.Mode.IsValid() {
+		req.Mode = DefaultMode
+	}
+	req.Units = DistanceUnit(strings.ToLower(options.Get("units")))
+	if !req.Units.IsValid() {
+		req.Units = DefaultUnit
+	}
+	req.Country = CountryCode(strings.ToLower(options.Get("country")))
+	if !req.Country.IsValid() {
+		req.Country = CountryCode("us")
+	}
+
+	if err := parseRouteOptions(options, &req); err != nil {
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprintf(w, "\n\n0\n%s\n", err.Error())
+		return
+	}
+	output, err := parseRouteOutput(options, r.Header.Get("Accept-Language"))
+	if err != nil {
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprintf(w, "\n\n0\n%s\n", err.Error())
+		return
+	}
+
+	result, err := route(r.Context(), req)
+	if err != nil {
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprintf(w, "\n\n0\n%s\n", err.Error())
+		return
+	}
+	writeRouteResult(w, r, result, output)
+}
+
+// writeRouteResult writes the requested page of a route as plain text or JSON
+func writeRouteResult(w http.ResponseWriter, r *http.Request, result *RouteResponse, output routeOutput) {
+	_, span := startSpan(r.Context(), "format route")
+	defer span.End()
+	text := r.Method == http.MethodPost || output.Compact || output.Format != "" || output.Cols > 0
+
+	result, err := paginateRoute(result, output)
+	if err != nil {
+		if text {
+			w.Header().Set("Content-Type", "text/plain")
+			fmt.Fprintf(w, "\n\n0\n%s\n", err.Error())
+			return
+		}
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	result = withDetail(result, output.Detail)
+	if output.Icons == "numeric" || output.Format == "inline" {
+		result = numericIcons(result)
+	}
+	if output.Aspect == PathAspectPreserve || output.PathWidth > 0 || output.PathHeight > 0 {
+		result, err = reprojectPath(result, output)
+		if err != nil {
+			if text {
+				w.Header().Set("Content-Type", "text/plain")
+				fmt.Fprintf(w, "\n\n0\n%s\n", err.Error())
+				return
+			}
+			writeError(w, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+	}
+	if output.MaxPoints > 0 && len(result.Path.Points) > output.MaxPoints {
+		fitted := *result
+		fitted.Path.Points = fitPath(result.Path.Points, output.MaxPoints)
+		fitted.Path.Length = len(fitted.Path.Points)
+		result = &fitted
+	}
+
+	// For POST requests and text or binary formats, skip JSON
+	if text {
+		writeRouteText(r.Context(), w, result, output)
 		return
 	}
 
 	// For GET requests, return JSON format
+	if output.Path == PathEncodingDelta {
+		encoded := *result
+		encoded.Path = deltaEncodePath(result.Path)
+		result = &encoded
+	}
+	if len(output.Fields) > 0 {
+		selected, err := selectFields(result, output.Fields)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		writeJSON(w, selected)
+		return
+	}
 	writeJSON(w, result)
 }
+
+// withDetail returns a copy of a route with the step fields the detail level leaves out cleared
+func withDetail(result *RouteResponse, detail Detail) *RouteResponse {
+	if detail == DetailFull {
+		return result
+	}
+	trimmed := *result
+	trimmed.Steps = make([]RouteStep, len(result.Steps))
+	for i, step := range result.Steps {
+		step.Stops = nil
+		if detail == DetailBrief {
+			step.Distance = 0
+			step.Icon = ""
+		}
+		trimmed.Steps[i] = step
+	}
+	return &trimmed
+}
+
+// errNoRouteTrack is returned when a route's path can't be rescaled because
+// its full-resolution geometry is gone
+var errNoRouteTrack = errors.New("the route's geometry is no longer available to rescale its path, request the route again")
+
+// reprojectPath returns a copy of a route with its path normalized again from
+// its full-resolution track, for path options that change the projection
+func reprojectPath(result *RouteResponse, output routeOutput) (*RouteResponse, error) {
+	track := result.track
+	if track == nil {
+		if stored, ok := routeStore.get(result.ID); ok {
+			track = stored
+		}
+	}
+	if track == nil || len(track.Points) == 0 {
+		return nil, errNoRouteTrack
+	}
+	grid := newGridProjection(track.Points)
+	if output.PathWidth > 0 {
+		grid.width = output.PathWidth
+	}
+	if output.PathHeight > 0 {
+		grid.height = output.PathHeight
+	}
+	if output.Aspect == PathAspectPreserve {
+		grid = grid.preservingAspect()
+	}
+	reprojected := *result
+	reprojected.Path.Points = projectPath(track.Points, grid)
+	reprojected.Path.Length = len(reprojected.Path.Points)
+	reprojected.Path.Width, reprojected.Path.Height = grid.width, grid.height
+	return &reprojected, nil
+}
+
+// numericIcons returns a copy of a route with each step's icon replaced by its code
+func numericIcons(result *RouteResponse) *RouteResponse {
+	coded := *result
+	coded.Steps = make([]RouteStep, len(result.Steps))
+	for i, step := range result.Steps {
+		step.Icon = strconv.Itoa(IconCode(step.Icon))
+		coded.Steps[i] = step
+	}
+	return &coded
+}
+
+// parseWheelchair reads a wheelchair option, which is false when empty
+func parseWheelchair(v string) (bool, error) {
+	if v == "" {
+		return false, nil
+	}
+	wheelchair, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("wheelchair must be true or false")
+	}
+	return wheelchair, nil
+}
+
+// parseOptionLines reads key=value lines from a plain-text request body
+func parseOptionLines(lines []string) url.Values {
+	options := url.Values{}
+	for _, line := range lines {
+		key, value, _ := strings.Cut(strings.TrimSpace(line), "=")
+		if key != "" {
+			options.Add(key, value)
+		}
+	}
+	return options
+}
@@ -0,0 +1,150 @@
+package nav
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// healthProbeTimeout bounds each upstream probe, so health checks answer
+// quickly even when a dependency hangs
+const healthProbeTimeout = 2 * time.Second
+
+// Startup steps that must finish before the server is ready for traffic
+var (
+	configLoaded    atomic.Bool
+	gtfsLoaded      atomic.Bool
+	gazetteerLoaded atomic.Bool
+	parkRideLoaded  atomic.Bool
+)
+
+// Warm loads the configured GTFS feeds, gazetteer, and park and ride lots so
+// that /readyz reports ready only once requests won't wait on them. GTFS
+// errors are returned; the others are logged, since they're only fallbacks
+// and are retried on use.
+func Warm() error {
+	if err := LoadGTFSFeeds(); err != nil {
+		return err
+	}
+	gtfsLoaded.Store(true)
+
+	if currentConfig().GazetteerFile != "" {
+		if _, err := openGazetteer(); err != nil {
+			dataLog.Warn("Preloading failed", "error", err)
+		}
+	}
+	gazetteerLoaded.Store(true)
+
+	if currentConfig().ParkRideLots != "" {
+		if _, err := openParkRideLots(); err != nil {
+			dataLog.Warn("Preloading failed", "error", err)
+		}
+	}
+	parkRideLoaded.Store(true)
+	return nil
+}
+
+// checkReadiness lists the startup steps still pending
+func checkReadiness() ReadinessResponse {
+	readiness := ReadinessResponse{Status: "ready"}
+	for _, step := range []struct {
+		name string
+		done *atomic.Bool
+	}{
+		{"config", &configLoaded},
+		{"gtfs", &gtfsLoaded},
+		{"gazetteer", &gazetteerLoaded},
+		{"parkride", &parkRideLoaded},
+	} {
+		if !step.done.Load() {
+			readiness.Pending = append(readiness.Pending, step.name)
+		}
+	}
+	if len(readiness.Pending) > 0 {
+		readiness.Status = "starting"
+	}
+	return readiness
+}
+
+// healthProbe checks one upstream dependency with a lightweight request
+type healthProbe struct {
+	name     string
+	baseURL  string // Configured URL, empty when the dependency isn't set up
+	probeURL string
+}
+
+// healthProbes lists the upstream dependencies checked by /healthz
+func healthProbes(ctx context.Context) []healthProbe {
+	transitlandParams := url.Values{"limit": {"1"}, "api_key": {configFor(ctx).TransitlandAPIKey}}
+	return []healthProbe{
+		{"nominatim", configFor(ctx).NominatimURL, strings.TrimSuffix(configFor(ctx).NominatimURL, "/") + "/status?format=json"},
+		// Valhalla serves its status next to the route endpoint
+		{"valhalla", configFor(ctx).ValhallaURL, strings.TrimSuffix(strings.TrimSuffix(configFor(ctx).ValhallaURL, "/"), "/route") + "/status"},
+		{"transitland", configFor(ctx).TransitlandURL, strings.TrimSuffix(configFor(ctx).TransitlandURL, "/") + "/rest/agencies?" + transitlandParams.Encode()},
+	}
+}
+
+// probeDependency makes a single request to a dependency, skipping retries and
+// circuit breakers so the result reflects its current state
+func probeDependency(ctx context.Context, probe healthProbe) DependencyStatus {
+	status := DependencyStatus{Status: "unconfigured", Breaker: "closed"}
+	if probe.baseURL == "" {
+		return status
+	}
+	if u, err := url.Parse(probe.baseURL); err == nil && !breakerForHost(u.Host).closed() {
+		status.Breaker = "open"
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, healthProbeTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, probe.probeURL, nil)
+	if err != nil {
+		status.Status, status.Error = "down", err.Error()
+		return status
+	}
+	if configFor(ctx).UserAgent != "" {
+		req.Header.Set("User-Agent", configFor(ctx).UserAgent)
+	}
+
+	start := time.Now()
+	resp, err := stateFor(ctx).upstream.client.Do(req)
+	status.Latency = time.Since(start).Milliseconds()
+	if err != nil {
+		status.Status, status.Error = "down", redactError(err).Error()
+		return status
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		status.Status, status.Error = "down", fmt.Sprintf("status %d", resp.StatusCode)
+		return status
+	}
+	status.Status = "ok"
+	return status
+}
+
+// checkHealth probes every dependency at once
+func checkHealth(ctx context.Context) HealthResponse {
+	health := HealthResponse{Status: "ok", Dependencies: make(map[string]DependencyStatus)}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, probe := range healthProbes(ctx) {
+		wg.Add(1)
+		go func(probe healthProbe) {
+			defer wg.Done()
+			status := probeDependency(ctx, probe)
+			mu.Lock()
+			defer mu.Unlock()
+			health.Dependencies[probe.name] = status
+			if status.Status == "down" {
+				health.Status = "degraded"
+			}
+		}(probe)
+	}
+	wg.Wait()
+	return health
+}
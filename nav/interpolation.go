@@ -0,0 +1,132 @@
+package nav
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// houseNumberPattern matches a leading house number such as "123" or "123B"
+var houseNumberPattern = regexp.MustCompile(`^\s*(\d+)[A-Za-z]?\b`)
+
+// nominatimGeometry is the GeoJSON geometry returned with polygon_geojson=1
+type nominatimGeometry struct {
+	Type        string          `json:"type"`
+	Coordinates json.RawMessage `json:"coordinates"`
+}
+
+// queryHouseNumber returns the house number at the start of a query, if any
+func queryHouseNumber(query string) string {
+	match := houseNumberPattern.FindStringSubmatch(query)
+	if match == nil {
+		return ""
+	}
+	return match[1]
+}
+
+// needsInterpolation checks if a result is a road matched in place of a missing house number
+func needsInterpolation(result nominatimResponse) bool {
+	return result.Class == "highway" && result.Address.HouseNumber == "" && result.GeoJSON != nil
+}
+
+// line returns the geometry as [lat, lng] pairs, using the longest part of multi-line roads
+func (g *nominatimGeometry) line() [][2]float64 {
+	var lines [][][2]float64
+	switch g.Type {
+	case "LineString":
+		var coords [][2]float64
+		if err := json.Unmarshal(g.Coordinates, &coords); err != nil {
+			return nil
+		}
+		lines = append(lines, coords)
+	case "MultiLineString":
+		if err := json.Unmarshal(g.Coordinates, &lines); err != nil {
+			return nil
+		}
+	default:
+		return nil
+	}
+
+	var longest [][2]float64
+	for _, coords := range lines {
+		if len(coords) > len(longest) {
+			longest = coords
+		}
+	}
+
+	// GeoJSON coordinates are [lng, lat]
+	points := make([][2]float64, len(longest))
+	for i, c := range longest {
+		points[i] = [2]float64{c[1], c[0]}
+	}
+	return points
+}
+
+// houseNumberAt reverse geocodes a point and returns its house number if it lies on the given road
+func houseNumberAt(ctx context.Context, point [2]float64, road string) (int, bool) {
+	result, err := reverseNominatim(ctx, point[0], point[1], 0)
+	if err != nil || !strings.EqualFold(result.Address.Road, road) {
+		return 0, false
+	}
+	match := houseNumberPattern.FindStringSubmatch(result.Address.HouseNumber)
+	if match == nil {
+		return 0, false
+	}
+	number, err := strconv.Atoi(match[1])
+	return number, err == nil
+}
+
+// pointAlong returns the point at a fraction (0 to 1) of the way along a line
+func pointAlong(points [][2]float64, fraction float64) [2]float64 {
+	track := newRouteTrack(points, nil, DefaultUnit)
+	target := track.Cumulative[len(points)-1] * fraction
+	for i := 1; i < len(points); i++ {
+		if track.Cumulative[i] < target {
+			continue
+		}
+		segment := track.Cumulative[i] - track.Cumulative[i-1]
+		t := 0.0
+		if segment > 0 {
+			t = (target - track.Cumulative[i-1]) / segment
+		}
+		a, b := points[i-1], points[i]
+		return [2]float64{a[0] + (b[0]-a[0])*t, a[1] + (b[1]-a[1])*t}
+	}
+	return points[len(points)-1]
+}
+
+// interpolateHouseNumber estimates where a house number lies along a matched road.
+// The house numbers at either end of the road give its address range, and the
+// position is interpolated linearly between them.
+func interpolateHouseNumber(ctx context.Context, result nominatimResponse, houseNumber string) (float64, float64, bool) {
+	number, err := strconv.Atoi(houseNumber)
+	if err != nil {
+		return 0, 0, false
+	}
+
+	points := result.GeoJSON.line()
+	if len(points) < 2 {
+		return 0, 0, false
+	}
+
+	// Look up the address range from the numbers at each end of the road
+	first, ok := houseNumberAt(ctx, points[0], result.Address.Road)
+	if !ok {
+		return 0, 0, false
+	}
+	last, ok := houseNumberAt(ctx, points[len(points)-1], result.Address.Road)
+	if !ok || first == last {
+		return 0, 0, false
+	}
+
+	fraction := float64(number-first) / float64(last-first)
+	fraction = math.Max(0, math.Min(1, fraction))
+	point := pointAlong(points, fraction)
+
+	geocodeLog.DebugContext(ctx, "Interpolated house number", "house", houseNumber, "road", result.Address.Road, "first", first, "last", last)
+
+	return point[0], point[1], true
+}
@@ -0,0 +1,352 @@
+package nav
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxLineRequestBytes bounds a line protocol request, like MaxHeaderBytes does
+// for HTTP, so a client can't make the server buffer without limit
+const maxLineRequestBytes = 64 << 10
+
+// lineCommands maps line protocol command words to the endpoints they POST to.
+// Other endpoints can be named by path, e.g. /nav/route/1a2b3c4d/qr.
+var lineCommands = map[string]string{
+	"GEOCODE":      "/nav/geocode",
+	"ROUTE":        "/nav/route",
+	"BITMAP":       "/nav/route/bitmap",
+	"PROGRESS":     "/nav/progress",
+	"NEARBY":       "/nav/nearby",
+	"ZIP":          "/nav/zip",
+	"WHEREAMI":     "/nav/whereami",
+	"ADMIN":        "/nav/admin",
+	"STOPS":        "/nav/stops",
+	"DEPARTURES":   "/nav/departures",
+	"TRANSITROUTE": "/nav/transit/route",
+	"TRANSITSTOP":  "/nav/transit/stop",
+	"AGENCIES":     "/nav/transit/agencies",
+	"VEHICLES":     "/nav/transit/vehicles",
+	"ALERTS":       "/nav/transit/alerts",
+	"COVERAGE":     "/nav/transit/coverage",
+	"USAGE":        "/nav/usage",
+}
+
+// LineServer serves the plain-text POST protocols over raw TCP, for serial and
+// modem bridges without an HTTP stack. Each request is a command line, such as
+// "ROUTE" or "GEOCODE countrycodes=us" with query parameters after the word,
+// then the POST body's lines, ended by a line holding only ".". The reply is a
+// "status length" line, e.g. "200 57", followed by exactly that many bytes of
+// the HTTP response body. "QUIT" closes the connection.
+type LineServer struct {
+	Handler      http.Handler  // Serves each request as a POST, usually the HTTP server's handler
+	ReadTimeout  time.Duration // To read a whole request once its first line arrives
+	WriteTimeout time.Duration // To write a reply
+	IdleTimeout  time.Duration // To wait for the next request
+
+	mu        sync.Mutex
+	listeners []net.Listener
+	conns     map[net.Conn]*lineConn
+	closing   bool
+	wg        sync.WaitGroup
+}
+
+// lineConn tracks a connection's state for Shutdown
+type lineConn struct {
+	busy   bool               // Serving a request
+	cancel context.CancelFunc // Cancels the request being served
+}
+
+// Serve accepts connections on listener until Shutdown, returning
+// http.ErrServerClosed then. It can be called for several listeners at once.
+func (s *LineServer) Serve(listener net.Listener) error {
+	s.mu.Lock()
+	if s.closing {
+		s.mu.Unlock()
+		return http.ErrServerClosed
+	}
+	s.listeners = append(s.listeners, listener)
+	if s.conns == nil {
+		s.conns = make(map[net.Conn]*lineConn)
+	}
+	s.mu.Unlock()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closing := s.closing
+			s.mu.Unlock()
+			if closing {
+				return http.ErrServerClosed
+			}
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				continue
+			}
+			return err
+		}
+
+		s.mu.Lock()
+		if s.closing {
+			s.mu.Unlock()
+			conn.Close()
+			return http.ErrServerClosed
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		s.conns[conn] = &lineConn{cancel: cancel}
+		s.wg.Add(1)
+		s.mu.Unlock()
+		go s.serveConn(ctx, conn)
+	}
+}
+
+// Shutdown stops accepting connections, closes idle ones, and waits for
+// requests in progress to finish or ctx to end, then cancels and closes the
+// rest
+func (s *LineServer) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.closing = true
+	for _, listener := range s.listeners {
+		listener.Close()
+	}
+	for conn, c := range s.conns {
+		if !c.busy {
+			conn.Close()
+		}
+	}
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		for conn, c := range s.conns {
+			c.cancel()
+			conn.Close()
+		}
+		s.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// setBusy marks a connection busy with a request, or idle. It reports false
+// when the server is shutting down and an idle connection should close.
+func (s *LineServer) setBusy(conn net.Conn, busy bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.conns[conn].busy = busy
+	return !s.closing
+}
+
+// serveConn answers requests on a connection until the client quits or the
+// connection fails. Requests are served with ctx, which ends with the
+// connection.
+func (s *LineServer) serveConn(ctx context.Context, conn net.Conn) {
+	defer func() {
+		s.mu.Lock()
+		s.conns[conn].cancel()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.Close()
+		s.wg.Done()
+	}()
+
+	reader := bufio.NewReader(conn)
+	for {
+		if s.IdleTimeout > 0 {
+			conn.SetReadDeadline(time.Now().Add(s.IdleTimeout))
+		}
+		if _, err := reader.Peek(1); err != nil {
+			return
+		}
+		if !s.setBusy(conn, true) {
+			return
+		}
+		if s.ReadTimeout > 0 {
+			conn.SetReadDeadline(time.Now().Add(s.ReadTimeout))
+		}
+
+		command, body, err := readLineRequest(reader)
+		if err != nil {
+			if errors.Is(err, errLineQuit) {
+				return
+			}
+			var netErr net.Error
+			if errors.As(err, &netErr) {
+				return
+			}
+			s.writeReply(conn, http.StatusBadRequest, []byte(err.Error()+"\n"))
+			// The rest of an oversized request is still unread, so the
+			// connection can't be resynchronized
+			if errors.Is(err, errLineTooLarge) {
+				return
+			}
+		} else {
+			reqCtx, cancel := context.WithCancel(ctx)
+			stopWatching := watchHangup(conn, reader, cancel)
+			status, reply := s.serveLineRequest(reqCtx, conn, command, body)
+			stopWatching()
+			cancel()
+			s.writeReply(conn, status, reply)
+		}
+
+		if !s.setBusy(conn, false) {
+			return
+		}
+	}
+}
+
+var (
+	// errLineQuit ends a connection at the client's request
+	errLineQuit = errors.New("quit")
+
+	errLineTooLarge = fmt.Errorf("request too large, the limit is %d bytes", maxLineRequestBytes)
+)
+
+// readLineRequest reads a command line and the body lines up to the "." line,
+// never buffering more than maxLineRequestBytes
+func readLineRequest(reader *bufio.Reader) (string, []byte, error) {
+	var command string
+	var body bytes.Buffer
+	size := 0
+	for {
+		// Lines longer than the reader's buffer arrive in pieces
+		var raw []byte
+		for {
+			piece, err := reader.ReadSlice('\n')
+			size += len(piece)
+			if size > maxLineRequestBytes {
+				return "", nil, errLineTooLarge
+			}
+			raw = append(raw, piece...)
+			if err == nil {
+				break
+			}
+			if !errors.Is(err, bufio.ErrBufferFull) {
+				return "", nil, err
+			}
+		}
+		line := strings.TrimRight(string(raw), "\r\n")
+
+		// The first non-blank line is the command
+		if command == "" {
+			command = strings.TrimSpace(line)
+			if strings.EqualFold(command, "QUIT") {
+				return "", nil, errLineQuit
+			}
+			continue
+		}
+		if line == "." {
+			return command, body.Bytes(), nil
+		}
+		body.WriteString(line)
+		body.WriteByte('\n')
+	}
+}
+
+// watchHangup cancels a request when the client hangs up while it's being
+// served, so its upstream calls stop too. The returned function stops watching
+// before the connection is read again.
+func watchHangup(conn net.Conn, reader *bufio.Reader, cancel context.CancelFunc) func() {
+	conn.SetReadDeadline(time.Time{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		// Data from a client sending its next request early stays buffered
+		if _, err := reader.Peek(1); err != nil && !errors.Is(err, os.ErrDeadlineExceeded) {
+			cancel()
+		}
+	}()
+	return func() {
+		conn.SetReadDeadline(time.Now())
+		<-done
+		conn.SetReadDeadline(time.Time{})
+	}
+}
+
+// serveLineRequest serves a request as a POST to the command's endpoint,
+// returning the response status and body. A handler panic is logged and
+// answered with a 500, like the HTTP server does.
+func (s *LineServer) serveLineRequest(ctx context.Context, conn net.Conn, command string, body []byte) (status int, reply []byte) {
+	word, query, _ := strings.Cut(command, " ")
+	defer func() {
+		if err := recover(); err != nil {
+			httpLog.ErrorContext(ctx, "Panic serving line protocol request", "command", word, "error", err, "stack", string(debug.Stack()))
+			status, reply = http.StatusInternalServerError, []byte(http.StatusText(http.StatusInternalServerError)+"\n")
+		}
+	}()
+	path, ok := lineCommands[strings.ToUpper(word)]
+	if !ok {
+		if !strings.HasPrefix(word, "/") {
+			return http.StatusNotFound, []byte(fmt.Sprintf("unknown command %s\n", word))
+		}
+		path = word
+	}
+
+	target := path
+	if query = strings.TrimPrefix(strings.TrimSpace(query), "?"); query != "" {
+		target += "?" + query
+	}
+	r, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return http.StatusBadRequest, []byte(err.Error() + "\n")
+	}
+	r.Header.Set("Content-Type", "text/plain")
+	r.RemoteAddr = conn.RemoteAddr().String()
+
+	w := &lineResponseWriter{header: make(http.Header)}
+	s.Handler.ServeHTTP(w, r)
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.status, w.body.Bytes()
+}
+
+// writeReply writes a reply's status and length line, then its body
+func (s *LineServer) writeReply(conn net.Conn, status int, body []byte) {
+	if s.WriteTimeout > 0 {
+		conn.SetWriteDeadline(time.Now().Add(s.WriteTimeout))
+	}
+	fmt.Fprintf(conn, "%d %d\n", status, len(body))
+	conn.Write(body)
+}
+
+// lineResponseWriter collects a handler's response for a line protocol reply
+type lineResponseWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (w *lineResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *lineResponseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *lineResponseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.body.Write(b)
+}
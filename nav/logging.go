@@ -0,0 +1,67 @@
+package nav
+
+import (
+	"errors"
+	"log/slog"
+	"net/url"
+)
+
+// Per-module loggers, each tagging its records with the module name
+var (
+	httpLog     *slog.Logger // Incoming requests
+	geocodeLog  *slog.Logger // Geocoding, fuzzy retries, and interpolation
+	routeLog    *slog.Logger // Routing and park and ride
+	transitLog  *slog.Logger // Transit planning and realtime data
+	upstreamLog *slog.Logger // Calls to upstream services, retries, and circuit breakers
+	dataLog     *slog.Logger // Loading local data files
+)
+
+func init() {
+	SetLogger(slog.Default())
+}
+
+// SetLogger derives each module's logger from base, so they share its handler
+// and level, adding the request ID to records logged with a request's context
+func SetLogger(base *slog.Logger) {
+	base = slog.New(requestIDHandler{base.Handler()})
+	httpLog = base.With("module", "http")
+	geocodeLog = base.With("module", "geocode")
+	routeLog = base.With("module", "route")
+	transitLog = base.With("module", "transit")
+	upstreamLog = base.With("module", "upstream")
+	dataLog = base.With("module", "data")
+}
+
+// redactedParams are the query parameters upstream API keys are sent in
+var redactedParams = []string{"api_key", "apikey", "key", "token", "access_token"}
+
+// unparsableURL stands in for a URL that can't be parsed, since its keys
+// can't be found to hide them
+const unparsableURL = "(unparsable URL)"
+
+// redactURL hides API keys in a URL's query string, and any password in it,
+// before it's logged
+func redactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return unparsableURL
+	}
+	query := u.Query()
+	for _, key := range redactedParams {
+		if query.Has(key) {
+			query.Set(key, "REDACTED")
+		}
+	}
+	u.RawQuery = query.Encode()
+	return u.Redacted()
+}
+
+// redactError hides API keys in the URL net/http puts in the message of a
+// failed upstream call's error, before it's logged or returned to clients
+func redactError(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		urlErr.URL = redactURL(urlErr.URL)
+	}
+	return err
+}
@@ -0,0 +1,88 @@
+package nav
+
+import (
+	"regexp"
+	"strings"
+)
+
+// messageCatalog translates the fixed English strings of plain-text route
+// output, keyed by language and then the English text. Step descriptions are
+// matched whole, then by their first word; unit suffixes are matched after a
+// number. Anything missing stays in English.
+var messageCatalog = map[string]map[string]string{
+	"de": {
+		"Arrive at destination": "Ziel erreicht",
+		"Walk":                  "Gehen",
+		"Drive":                 "Fahren",
+		"Take":                  "Nehmen",
+		"hr":                    "Std",
+	},
+	"es": {
+		"Arrive at destination": "Llegada al destino",
+		"Walk":                  "Caminar",
+		"Drive":                 "Conducir",
+		"Take":                  "Tomar",
+		"hr":                    "h",
+	},
+	"fr": {
+		"Arrive at destination": "Arrivée à destination",
+		"Walk":                  "Marcher",
+		"Drive":                 "Conduire",
+		"Take":                  "Prendre",
+		"hr":                    "h",
+		"ft":                    "pi",
+	},
+}
+
+// unitSuffix matches the unit after a formatted number, e.g. the "hr" in "1hr"
+var unitSuffix = regexp.MustCompile(`(\d)(hr|min|mi|ft|km|m)\b`)
+
+// catalogLanguage picks the first language in an Accept-Language style list
+// that the catalog has, or "" for English
+func catalogLanguage(languages string) string {
+	for _, lang := range strings.Split(languages, ",") {
+		lang = primaryLanguage(lang)
+		if lang == "en" {
+			return ""
+		}
+		if messageCatalog[lang] != nil {
+			return lang
+		}
+	}
+	return ""
+}
+
+// localize translates a fixed message, returning it unchanged when the
+// language or message isn't in the catalog
+func localize(lang, message string) string {
+	if translated, ok := messageCatalog[lang][message]; ok {
+		return translated
+	}
+	return message
+}
+
+// localizeUnits translates the unit suffixes of formatted distances and durations
+func localizeUnits(lang, s string) string {
+	if messageCatalog[lang] == nil {
+		return s
+	}
+	return unitSuffix.ReplaceAllStringFunc(s, func(m string) string {
+		return m[:1] + localize(lang, m[1:])
+	})
+}
+
+// localizeDescription translates a whole step description when the catalog
+// has it, or else its leading verb
+func localizeDescription(lang, description string) string {
+	if messageCatalog[lang] == nil {
+		return description
+	}
+	if translated, ok := messageCatalog[lang][description]; ok {
+		return translated
+	}
+	verb, rest, found := strings.Cut(description, " ")
+	if !found {
+		return description
+	}
+	return localize(lang, verb) + " " + rest
+}
@@ -0,0 +1,155 @@
+package nav
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"strings"
+	"time"
+)
+
+// ProvidersMock is the providers setting that answers geocoding and routing
+// with canned data instead of calling Nominatim and Valhalla
+const ProvidersMock = "mock"
+
+// mockCenter is where mock places are put, around Springfield, IL
+var mockCenter = [2]float64{39.7817, -89.6501}
+
+// mockStreets name the legs of mock routes in turn
+var mockStreets = []string{"Main Street", "Oak Avenue", "North Elm Street", "Park Boulevard"}
+
+// mockSpeeds are the speeds mock routes are timed at, in meters per second
+var mockSpeeds = map[TransportMode]float64{
+	ModeWalking:  1.4,
+	ModeBiking:   4.5,
+	ModeAuto:     13.4,
+	ModeTransit:  8,
+	ModeParkRide: 10,
+}
+
+// mockProviders reports whether geocoding and routing are mocked
+func mockProviders(ctx context.Context) bool {
+	return configFor(ctx).Providers == ProvidersMock
+}
+
+// mockPlace returns a canned place at a point
+func mockPlace(name string, lat, lng float64, abbreviate bool) GeocodeResponse {
+	address := "123 Main Street, 62701 Springfield, IL"
+	if abbreviate {
+		address = "123 Main St, 62701 Springfield, IL"
+	}
+	return GeocodeResponse{
+		Name:       name,
+		Address:    address,
+		Lat:        lat,
+		Lng:        lng,
+		Importance: 0.5,
+		Country:    "us",
+		PlusCode:   encodePlusCode(lat, lng),
+		Layer:      string(LayerAddress),
+		Category:   "place",
+		Type:       "house",
+	}
+}
+
+// mockGeocode returns one canned result for a query, placed within about 5 km
+// of mockCenter by a hash of the query, so the same query always lands in the
+// same place and different queries can be routed between
+func mockGeocode(req GeocodeRequest) []GeocodeResponse {
+	query := strings.Join(strings.Fields(req.Query), " ")
+	h := fnv.New32a()
+	h.Write([]byte(strings.ToLower(query)))
+	sum := h.Sum32()
+	lat := mockCenter[0] + (float64(sum&0xffff)/0xffff-0.5)*0.09
+	lng := mockCenter[1] + (float64(sum>>16)/0xffff-0.5)*0.12
+	lat = math.Round(lat*1e6) / 1e6
+	lng = math.Round(lng*1e6) / 1e6
+	return []GeocodeResponse{mockPlace(query, lat, lng, !req.Unabbreviated)}
+}
+
+// mockRoute returns a canned route through the request's points, going north
+// or south and then east or west between each pair, with a step for each leg
+func mockRoute(req RouteRequest, depart time.Time) (*RouteResponse, error) {
+	if req.Units == "" {
+		req.Units = DefaultUnit
+	} else if !req.Units.IsValid() {
+		return nil, fmt.Errorf("invalid units: must be one of: %s, %s", UnitKilometers, UnitMiles)
+	}
+
+	stops := [][2]float64{{req.FromLat, req.FromLng}}
+	stops = append(stops, req.Via...)
+	stops = append(stops, [2]float64{req.ToLat, req.ToLng})
+	coords := [][2]float64{stops[0]}
+	for _, stop := range stops[1:] {
+		last := coords[len(coords)-1]
+		if corner := [2]float64{stop[0], last[1]}; corner != last && corner != stop {
+			coords = append(coords, corner)
+		}
+		if stop != coords[len(coords)-1] {
+			coords = append(coords, stop)
+		}
+	}
+
+	result := &RouteResponse{
+		Units:    req.Units,
+		Mode:     req.Mode,
+		Provider: ProvidersMock,
+		From:     Location{Desc: req.FromDesc, Lat: req.FromLat, Lng: req.FromLng},
+		To:       Location{Desc: req.ToDesc, Lat: req.ToLat, Lng: req.ToLng},
+	}
+
+	var meters float64
+	var trackSteps []trackStep
+	prevBearing := 0.0
+	for i := 1; i < len(coords); i++ {
+		a, b := coords[i-1], coords[i]
+		legMeters := haversineDistance(a[0], a[1], b[0], b[1])
+		meters += legMeters
+		bearing := initialBearing(a[0], a[1], b[0], b[1])
+		street := mockStreets[(i-1)%len(mockStreets)]
+
+		step := RouteStep{Number: i, Distance: convertDistance(legMeters, req.Units)}
+		if i == 1 {
+			heading := []string{"north", "east", "south", "west"}[int(math.Round(bearing/90))%4]
+			step.Description = fmt.Sprintf("Head %s on %s.", heading, street)
+			step.Icon = map[TransportMode]string{ModeWalking: "Walk", ModeBiking: "Cycle", ModeAuto: "Drive"}[req.Mode]
+		} else if turn := math.Mod(bearing-prevBearing+360, 360); turn < 180 {
+			step.Description = fmt.Sprintf("Turn right onto %s.", street)
+			step.Icon = "Right"
+		} else {
+			step.Description = fmt.Sprintf("Turn left onto %s.", street)
+			step.Icon = "Left"
+		}
+		step.Description = formatInstruction(step.Description, !req.Unabbreviated)
+		result.Steps = append(result.Steps, step)
+		trackSteps = append(trackSteps, trackStep{Number: i, Street: street, Begin: i - 1, End: i})
+		prevBearing = bearing
+	}
+	result.Steps = append(result.Steps, RouteStep{
+		Number:      len(result.Steps) + 1,
+		Description: "Arrive at destination",
+	})
+
+	result.Distance = convertDistance(meters, req.Units)
+	speed, ok := mockSpeeds[req.Mode]
+	if !ok {
+		speed = mockSpeeds[ModeAuto]
+	}
+	result.Duration = math.Round(meters / speed)
+	points := normalizePath(coords)
+	result.Path = Path{
+		Points: points,
+		Length: len(points),
+		Width:  NormalizedGridSize,
+		Height: NormalizedGridSize,
+	}
+	if len(coords) > 1 {
+		storeRoute(result, newRouteTrack(coords, trackSteps, req.Units))
+	}
+
+	if req.Mode.usesTransit() {
+		setTransitTimes(result, depart, depart.Add(time.Duration(result.Duration)*time.Second))
+	}
+	return result, nil
+}
@@ -0,0 +1,93 @@
+package nav
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Modules that can be switched off as a whole, for deployments without the
+// upstreams they need
+const (
+	ModuleGeocode  = "geocode"  // Geocoding, postal codes, admin areas, and nearby places, using Nominatim
+	ModuleRouting  = "routing"  // Routes and what's drawn from them, using Valhalla
+	ModuleTransit  = "transit"  // Stops, departures, transit details, and transit routing
+	ModuleWhereAmI = "whereami" // IP geolocation
+)
+
+// errTransitDisabled is returned for transit and park and ride routes while
+// the transit module is switched off
+var errTransitDisabled = errors.New("transit routing is disabled on this server")
+
+// moduleEndpoints maps each module to the endpoints it serves, as they're
+// listed in apiEndpoints
+var moduleEndpoints = map[string][]string{
+	ModuleGeocode:  {"/nav/geocode", "/nav/zip", "/nav/admin", "/nav/nearby"},
+	ModuleRouting:  {"/nav/route", "/nav/route/bitmap", "/nav/route/{id}/qr", "/nav/staticmap", "/nav/progress"},
+	ModuleTransit:  {"/nav/stops", "/nav/departures", "/nav/transit/route", "/nav/transit/stop", "/nav/transit/agencies", "/nav/transit/vehicles", "/nav/transit/alerts", "/nav/transit/coverage"},
+	ModuleWhereAmI: {"/nav/whereami"},
+}
+
+// enabled returns a module switch's value, on unless set to false
+func enabled(b *bool) bool {
+	return b == nil || *b
+}
+
+// ModuleEnabled reports whether a module is switched on in cfg
+func (cfg NavConfig) ModuleEnabled(module string) bool {
+	switch module {
+	case ModuleGeocode:
+		return enabled(cfg.GeocodeEnabled)
+	case ModuleRouting:
+		return enabled(cfg.RoutingEnabled)
+	case ModuleTransit:
+		return enabled(cfg.TransitEnabled)
+	case ModuleWhereAmI:
+		return enabled(cfg.WhereAmIEnabled)
+	}
+	return true
+}
+
+// CheckEndpoints reports an error for disabled_endpoints entries that don't
+// name an endpoint
+func (cfg NavConfig) CheckEndpoints() error {
+	for _, path := range cfg.DisabledEndpoints {
+		if statsEndpoint(path) == "other" {
+			return fmt.Errorf("nav.disabled_endpoints: unknown endpoint %q", path)
+		}
+	}
+	return nil
+}
+
+// endpointDisabled explains why the endpoint at path is switched off, or
+// returns "" when it's served
+func endpointDisabled(ctx context.Context, path string) string {
+	endpoint := statsEndpoint(path)
+	for module, paths := range moduleEndpoints {
+		for _, p := range paths {
+			if p == endpoint && !configFor(ctx).ModuleEnabled(module) {
+				return fmt.Sprintf("the %s module is disabled on this server", module)
+			}
+		}
+	}
+	for _, p := range configFor(ctx).DisabledEndpoints {
+		if statsEndpoint(p) == endpoint {
+			return fmt.Sprintf("%s is disabled on this server", endpoint)
+		}
+	}
+	return ""
+}
+
+// WithEnabledModules answers requests to switched-off modules and endpoints
+// with a 404 naming what's disabled, rather than passing them to handlers
+// whose upstreams may not exist
+func WithEnabledModules(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if reason := endpointDisabled(r.Context(), r.URL.Path); reason != "" {
+			writeError(w, http.StatusNotFound, reason)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
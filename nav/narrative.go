@@ -0,0 +1,98 @@
+package nav
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// spokenDistance formats a distance with its units spelled out, for narrative
+// routes read aloud by text-to-speech, e.g. "0.3 miles" or "500 feet"
+func spokenDistance(distance float64, units DistanceUnit) string {
+	if units == UnitMiles {
+		if distance < 0.1 {
+			return pluralize(fmt.Sprintf("%.0f", distance*5280), "foot", "feet")
+		}
+		return pluralize(strings.TrimSuffix(fmt.Sprintf("%.1f", distance), ".0"), "mile", "miles")
+	}
+	if distance < 1.0 {
+		return pluralize(fmt.Sprintf("%.0f", distance*1000), "meter", "meters")
+	}
+	return pluralize(strings.TrimSuffix(fmt.Sprintf("%.1f", distance), ".0"), "kilometer", "kilometers")
+}
+
+// spokenDuration formats a duration in seconds as words, e.g. "1 hour 5 minutes"
+func spokenDuration(seconds float64) string {
+	hours := int(seconds / 3600)
+	minutes := int((seconds - float64(hours*3600)) / 60)
+	if hours == 0 {
+		return pluralize(fmt.Sprint(minutes), "minute", "minutes")
+	}
+	spoken := pluralize(fmt.Sprint(hours), "hour", "hours")
+	if minutes > 0 {
+		spoken += " " + pluralize(fmt.Sprint(minutes), "minute", "minutes")
+	}
+	return spoken
+}
+
+// pluralize joins a formatted number to the singular or plural form of its unit
+func pluralize(n, singular, plural string) string {
+	if n == "1" {
+		return n + " " + singular
+	}
+	return n + " " + plural
+}
+
+// lowerFirst lowercases the first word of a clause that continues a sentence,
+// unless it's an acronym or number like "I-90"
+func lowerFirst(s string) string {
+	first, _, _ := strings.Cut(s, " ")
+	for _, r := range first[min(len(first), 1):] {
+		if !unicode.IsLower(r) {
+			return s
+		}
+	}
+	r, size := utf8.DecodeRuneInString(s)
+	return string(unicode.ToLower(r)) + s[size:]
+}
+
+// narrateRoute describes the first count steps of a route as one paragraph,
+// pairing steps into sentences and ending with the trip's length and duration
+func narrateRoute(result *RouteResponse, count int) string {
+	var clauses []string
+	for i, step := range result.Steps[:count] {
+		clause := strings.TrimSuffix(step.Description, ".")
+		arrival := i == len(result.Steps)-1 && result.Page == result.Pages
+		if !result.Mode.usesTransit() && !arrival && step.Distance > 0 {
+			clause += " for " + spokenDistance(step.Distance, result.Units)
+		}
+		clauses = append(clauses, clause)
+	}
+
+	var sentences []string
+	for i := 0; i < len(clauses); i += 2 {
+		sentence := clauses[i]
+		if i+1 < len(clauses) {
+			sentence += ", then " + lowerFirst(clauses[i+1])
+		}
+		sentences = append(sentences, sentence+".")
+	}
+	sentences = append(sentences, fmt.Sprintf("The trip is %s and takes about %s.",
+		spokenDistance(result.Distance, result.Units), spokenDuration(result.Duration)))
+	return strings.Join(sentences, " ")
+}
+
+// renderNarrativeRoute renders a route as a narrative paragraph, wrapped to
+// cols when set and cut to whole steps to fit maxBytes
+func renderNarrativeRoute(ctx context.Context, result *RouteResponse, output routeOutput) []byte {
+	render := func(n int) []byte {
+		paragraph := narrateRoute(result, n)
+		if output.Cols == 0 {
+			return []byte(paragraph + "\n")
+		}
+		return []byte(strings.Join(wrapText(paragraph, output.Cols), "\n") + "\n")
+	}
+	return fitResults(ctx, len(result.Steps), output.MaxBytes, render)
+}
@@ -0,0 +1,201 @@
+package nav
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// earthRadiusMeters is the mean radius of the Earth used for distance calculations
+const earthRadiusMeters = 6371000.0
+
+// DefaultNearbyRadius is the default search radius in meters for nearby searches
+const DefaultNearbyRadius = 1000
+
+// MaxNearbyRadius is the largest search radius in meters accepted for nearby searches
+const MaxNearbyRadius = 25000
+
+// Maps friendly category names to OSM tags understood by Nominatim special phrases
+var nearbyCategories = map[string]string{
+	"restaurant":  "amenity=restaurant",
+	"food":        "amenity=restaurant",
+	"cafe":        "amenity=cafe",
+	"coffee":      "amenity=cafe",
+	"fastfood":    "amenity=fast_food",
+	"bar":         "amenity=bar",
+	"pub":         "amenity=pub",
+	"gas":         "amenity=fuel",
+	"fuel":        "amenity=fuel",
+	"charging":    "amenity=charging_station",
+	"parking":     "amenity=parking",
+	"pharmacy":    "amenity=pharmacy",
+	"hospital":    "amenity=hospital",
+	"atm":         "amenity=atm",
+	"bank":        "amenity=bank",
+	"toilets":     "amenity=toilets",
+	"police":      "amenity=police",
+	"postoffice":  "amenity=post_office",
+	"library":     "amenity=library",
+	"hotel":       "tourism=hotel",
+	"grocery":     "shop=supermarket",
+	"supermarket": "shop=supermarket",
+}
+
+// compassPoints are the 8 compass directions, starting from north and going clockwise
+var compassPoints = []string{"N", "NE", "E", "SE", "S", "SW", "W", "NW"}
+
+// lookupNearbyCategory maps a category name to its OSM tag, accepting plurals
+func lookupNearbyCategory(category string) (string, bool) {
+	category = strings.ToLower(strings.TrimSpace(category))
+	if tag, ok := nearbyCategories[category]; ok {
+		return tag, true
+	}
+	if tag, ok := nearbyCategories[strings.TrimSuffix(category, "s")]; ok {
+		return tag, true
+	}
+	return "", false
+}
+
+// nearbyCategoryNames returns the sorted list of supported category names
+func nearbyCategoryNames() []string {
+	names := make([]string, 0, len(nearbyCategories))
+	for name := range nearbyCategories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// haversineDistance returns the great-circle distance between two points in meters
+func haversineDistance(lat1, lng1, lat2, lng2 float64) float64 {
+	phi1 := lat1 * math.Pi / 180
+	phi2 := lat2 * math.Pi / 180
+	dPhi := (lat2 - lat1) * math.Pi / 180
+	dLambda := (lng2 - lng1) * math.Pi / 180
+
+	a := math.Sin(dPhi/2)*math.Sin(dPhi/2) +
+		math.Cos(phi1)*math.Cos(phi2)*math.Sin(dLambda/2)*math.Sin(dLambda/2)
+	return earthRadiusMeters * 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+}
+
+// initialBearing returns the bearing in degrees (0-360) from the first point to the second
+func initialBearing(lat1, lng1, lat2, lng2 float64) float64 {
+	phi1 := lat1 * math.Pi / 180
+	phi2 := lat2 * math.Pi / 180
+	dLambda := (lng2 - lng1) * math.Pi / 180
+
+	y := math.Sin(dLambda) * math.Cos(phi2)
+	x := math.Cos(phi1)*math.Sin(phi2) - math.Sin(phi1)*math.Cos(phi2)*math.Cos(dLambda)
+	bearing := math.Atan2(y, x) * 180 / math.Pi
+	return math.Mod(bearing+360, 360)
+}
+
+// compassDirection converts a bearing in degrees to an 8-point compass direction
+func compassDirection(bearing float64) string {
+	index := int(math.Round(bearing/45)) % len(compassPoints)
+	return compassPoints[index]
+}
+
+// nearby searches for places of a given category around a point using Nominatim
+func nearby(ctx context.Context, req NearbyRequest) ([]NearbyResult, error) {
+	tag, ok := lookupNearbyCategory(req.Category)
+	if !ok {
+		return nil, fmt.Errorf("unknown category: %s", req.Category)
+	}
+
+	if req.Radius <= 0 {
+		req.Radius = DefaultNearbyRadius
+	}
+	if req.Units == "" {
+		req.Units = DefaultUnit
+	}
+
+	// Build a bounding box around the point covering the search radius
+	latDelta := req.Radius / earthRadiusMeters * 180 / math.Pi
+	lngDelta := latDelta / math.Max(math.Cos(req.Lat*math.Pi/180), 0.01)
+	viewbox := fmt.Sprintf("%.6f,%.6f,%.6f,%.6f",
+		req.Lng-lngDelta, req.Lat+latDelta, req.Lng+lngDelta, req.Lat-latDelta)
+
+	// Build query parameters using the [key=value] special phrase syntax
+	params := url.Values{
+		"q":              {fmt.Sprintf("[%s]", tag)},
+		"format":         {"json"},
+		"limit":          {"20"},
+		"addressdetails": {"1"},
+		"namedetails":    {"1"},
+		"viewbox":        {viewbox},
+		"bounded":        {"1"},
+	}
+
+	// Create request URL with query parameters
+	apiURL := fmt.Sprintf("%s/search?%s", configFor(ctx).NominatimURL, params.Encode())
+
+	// Make GET request
+	resp, err := nominatimGet(ctx, apiURL)
+	if err != nil {
+		return nil, fmt.Errorf("error making request to Nominatim: %v", err)
+	}
+	defer resp.Body.Close()
+
+	// Check response status
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("nominatim API returned status: %d", resp.StatusCode)
+	}
+
+	// Decode response
+	var nominatimResults []nominatimResponse
+	if err := json.NewDecoder(resp.Body).Decode(&nominatimResults); err != nil {
+		return nil, fmt.Errorf("error decoding response: %v", err)
+	}
+
+	// Convert nominatim results to our format, dropping anything outside the radius
+	var results []NearbyResult
+	for _, result := range nominatimResults {
+		lat, err := parseFloat(result.Lat)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing latitude: %v", err)
+		}
+		lng, err := parseFloat(result.Lon)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing longitude: %v", err)
+		}
+
+		meters := haversineDistance(req.Lat, req.Lng, lat, lng)
+		if meters > req.Radius {
+			continue
+		}
+
+		name, addr, _ := formatAddress(result.Address, result.NameDetails, "", true)
+		bearing := initialBearing(req.Lat, req.Lng, lat, lng)
+
+		results = append(results, NearbyResult{
+			Name:      name,
+			Address:   addr,
+			Lat:       lat,
+			Lng:       lng,
+			Distance:  convertDistance(meters, req.Units),
+			Bearing:   math.Round(bearing),
+			Direction: compassDirection(bearing),
+		})
+	}
+
+	if len(results) == 0 {
+		return nil, &ErrNoResults{Query: req.Category}
+	}
+
+	// Closest places first
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Distance < results[j].Distance
+	})
+
+	if req.Limit > 0 && len(results) > req.Limit {
+		results = results[:req.Limit]
+	}
+
+	return results, nil
+}
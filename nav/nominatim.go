@@ -0,0 +1,163 @@
+package nav
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// PublicNominatimHost is the OSMF instance covered by the Nominatim usage policy
+const PublicNominatimHost = "nominatim.openstreetmap.org"
+
+// nominatimMaxRetries is how many times a request is retried after a 429 response
+const nominatimMaxRetries = 3
+
+// nominatimInitialBackoff is the wait after the first 429 when no Retry-After is given
+const nominatimInitialBackoff = time.Second
+
+// nominatimMaxWait is how far ahead a request may book its turn; when the
+// queue is longer, or a Retry-After holds requests off for longer, the request
+// fails rather than waiting
+const nominatimMaxWait = 10 * time.Second
+
+// hostLimiter spaces out requests to a single host
+type hostLimiter struct {
+	host string
+	mu   sync.Mutex
+	next time.Time // Earliest time the next request may start
+}
+
+var (
+	hostLimitersMu sync.Mutex
+	hostLimiters   = make(map[string]*hostLimiter)
+)
+
+// limiterForHost returns the shared limiter for a host
+func limiterForHost(host string) *hostLimiter {
+	hostLimitersMu.Lock()
+	defer hostLimitersMu.Unlock()
+
+	limiter, ok := hostLimiters[host]
+	if !ok {
+		limiter = &hostLimiter{host: host}
+		hostLimiters[host] = limiter
+	}
+	return limiter
+}
+
+// wait blocks until this request's turn, reserving a slot interval after it.
+// It fails with ErrUpstreamUnavailable when the turn is more than
+// nominatimMaxWait away, or with ctx's error if it's cancelled first, giving
+// the slot back when no later request has booked one since.
+func (l *hostLimiter) wait(ctx context.Context, interval time.Duration) error {
+	l.mu.Lock()
+	now := time.Now()
+	slot := l.next
+	if slot.Before(now) {
+		slot = now
+	}
+	if slot.Sub(now) > nominatimMaxWait {
+		l.mu.Unlock()
+		upstreamStats(l.host).throttled.Add(1)
+		upstreamLog.WarnContext(ctx, "Nominatim rate limit queue full", "host", l.host, "wait", slot.Sub(now))
+		return &ErrUpstreamUnavailable{Service: upstreamService(ctx, l.host)}
+	}
+	reserved := slot.Add(interval)
+	l.next = reserved
+	l.mu.Unlock()
+
+	timer := time.NewTimer(time.Until(slot))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		l.mu.Lock()
+		if l.next.Equal(reserved) {
+			l.next = slot
+		}
+		l.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// backoff holds off all requests to the host for at least d
+func (l *hostLimiter) backoff(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if until := time.Now().Add(d); until.After(l.next) {
+		l.next = until
+	}
+}
+
+// nominatimInterval returns the minimum spacing between requests to Nominatim
+func nominatimInterval(ctx context.Context) time.Duration {
+	if configFor(ctx).NominatimMaxQPS <= 0 {
+		return 0
+	}
+	return time.Duration(float64(time.Second) / configFor(ctx).NominatimMaxQPS)
+}
+
+// retryAfter parses a Retry-After header given in seconds, returning 0 if absent
+func retryAfter(resp *http.Response) time.Duration {
+	seconds, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || seconds < 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// nominatimGet makes a GET request to Nominatim following its usage policy:
+// requests are rate limited per host, identify the application, and back off on 429s
+func nominatimGet(ctx context.Context, apiURL string) (*http.Response, error) {
+	parsed, err := url.Parse(apiURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Nominatim URL: %v", err)
+	}
+	limiter := limiterForHost(parsed.Host)
+	// Retries of 5xx responses take their turn too
+	ctx = withRetryPacing(ctx, func(ctx context.Context) error {
+		return limiter.wait(ctx, nominatimInterval(ctx))
+	})
+
+	backoff := nominatimInitialBackoff
+	for attempt := 0; ; attempt++ {
+		if err := limiter.wait(ctx, nominatimInterval(ctx)); err != nil {
+			return nil, err
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, apiURL, nil)
+		if err != nil {
+			return nil, err
+		}
+		if configFor(ctx).UserAgent != "" {
+			req.Header.Set("User-Agent", configFor(ctx).UserAgent)
+		}
+		if configFor(ctx).Referer != "" {
+			req.Header.Set("Referer", configFor(ctx).Referer)
+		}
+
+		resp, err := upstreamDo(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusTooManyRequests || attempt >= nominatimMaxRetries {
+			return resp, nil
+		}
+		resp.Body.Close()
+
+		// Honor the server's requested delay, otherwise back off exponentially
+		delay := retryAfter(resp)
+		if delay == 0 {
+			delay = backoff
+			backoff *= 2
+		}
+		upstreamLog.WarnContext(ctx, "Nominatim rate limited, backing off", "delay", delay)
+		limiter.backoff(delay)
+	}
+}
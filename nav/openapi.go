@@ -0,0 +1,484 @@
+package nav
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// apiParam is a query or path parameter of an endpoint
+type apiParam struct {
+	name        string
+	description string
+	required    bool
+	path        bool // Part of the URL path rather than the query string
+}
+
+// apiEndpoint describes an endpoint for the OpenAPI document. New endpoints
+// are added here alongside their route in main.
+type apiEndpoint struct {
+	path        string
+	summary     string
+	params      []apiParam
+	response    any    // A value of the GET response's JSON type, or nil when it isn't JSON
+	contentType string // Content type of a GET response that isn't JSON
+	post        string // How the POST body and response are laid out, empty when POST isn't accepted
+}
+
+// Parameters shared by several endpoints
+var (
+	atParam    = apiParam{name: "at", description: "Coordinates as lat,lng", required: true}
+	unitsParam = apiParam{name: "units", description: "km or mi (default: km)"}
+)
+
+var apiEndpoints = []apiEndpoint{
+	{
+		path:    "/nav/geocode",
+		summary: "Search for an address, landmark, or point of interest by name",
+		params: []apiParam{
+			{name: "q", description: "Search query, Plus Code, or what3words address", required: true},
+			{name: "countrycodes", description: "Comma-separated two-letter ISO country codes to restrict results to, e.g. us,ca"},
+			{name: "layers", description: "Comma-separated result layers to include: address, poi, locality, admin"},
+			{name: "lang", description: "Preferred languages for names and addresses, e.g. fr,en (default: the Accept-Language header)"},
+			{name: "format", description: "csv for text/csv output"},
+			{name: "maxBytes", description: "Size budget in bytes for the POST response, at least 32"},
+			{name: "abbrev", description: "off to spell out street types, directions, and states"},
+		},
+		response: []GeocodeResponse{},
+		post:     "The body is the search query. The response is the number of results, then the name, address, and coordinates of each.",
+	},
+	{
+		path:    "/nav/route",
+		summary: "Get directions between two points, or another page of a previously requested route",
+		params: []apiParam{
+			{name: "from", description: "Starting point as lat,lng, a Plus Code, or a what3words address"},
+			{name: "to", description: "Destination as lat,lng, a Plus Code, or a what3words address"},
+			{name: "route", description: "ID of a previously requested route, instead of from and to"},
+			{name: "mode", description: "walking, biking, driving, transit, or parkride (default: driving)"},
+			unitsParam,
+			{name: "country", description: "Two-letter ISO country code, for address abbreviations"},
+			{name: "fromDesc", description: "Description of the starting point"},
+			{name: "toDesc", description: "Description of the destination"},
+			{name: "maxTransfers", description: "For transit, the most transfers allowed"},
+			{name: "maxWalk", description: "For transit, the longest walk in meters"},
+			{name: "wheelchair", description: "For transit, true for wheelchair-accessible itineraries"},
+			{name: "depart", description: "For transit, when to leave, in RFC 3339 or the origin's local time as YYYY-MM-DDTHH:MM or HH:MM"},
+			{name: "times", description: "For transit, true to add board and alight times to ride descriptions"},
+			{name: "bannedRoutes", description: "For transit, comma-separated route IDs to avoid"},
+			{name: "preferredRoutes", description: "For transit, comma-separated route IDs to favor"},
+			{name: "bannedAgencies", description: "For transit, comma-separated agency IDs to avoid"},
+			{name: "preferredAgencies", description: "For transit, comma-separated agency IDs to favor"},
+			{name: "detail", description: "brief, normal, or full (default: normal)"},
+			{name: "fields", description: "Comma-separated JSON fields to keep, with dots for nested fields"},
+			{name: "format", description: "ascii, bin, inline, or narrative for other response formats"},
+			{name: "compact", description: "1 for one plain-text line per step"},
+			{name: "path", description: "delta to encode path points as offsets from the previous point"},
+			{name: "icons", description: "numeric for numeric step icon codes"},
+			{name: "aspect", description: "fill or preserve the path's proportions (default: fill)"},
+			{name: "pathWidth", description: "Width of the path grid, 8 to 255, or to 127 with path=delta (default: 100)"},
+			{name: "pathHeight", description: "Height of the path grid, 8 to 255, or to 127 with path=delta (default: 100)"},
+			{name: "maxPoints", description: "Simplify the path to at most this many points"},
+			{name: "maxBytes", description: "Size budget in bytes for plain-text responses, at least 32"},
+			{name: "width", description: "Width of the ASCII map in characters, 8 to 200 (default: 40)"},
+			{name: "height", description: "Height of the ASCII map in characters, 8 to 200 (default: 24)"},
+			{name: "cols", description: "Screen width to wrap plain-text steps to, 16 to 255"},
+			{name: "page", description: "Page of steps to return, starting at 1"},
+			{name: "per_page", description: "Steps per page, up to 100 (default: 8)"},
+			{name: "abbrev", description: "off to spell out turn instructions"},
+			{name: "lang", description: "Language for fixed strings in plain-text responses: de, es, or fr (default: the Accept-Language header)"},
+			{name: "timeFormat", description: "Duration and clock formats, e.g. clock,12h"},
+		},
+		response: RouteResponse{},
+		post: "The body is the start and destination on two lines, a list of 2 to 20 lat,lng waypoints, or a GPX file, " +
+			"followed by optional key=value option lines. The response is the duration, distance, " +
+			"the number of steps and each step's description, then the route ID.",
+	},
+	{
+		path:    "/nav/route/bitmap",
+		summary: "Draw a previously requested route as a packed 1-bit bitmap",
+		params: []apiParam{
+			{name: "route", description: "Route ID from /nav/route", required: true},
+			{name: "width", description: "Image width in pixels, up to 640 (default: 320)"},
+			{name: "height", description: "Image height in pixels, up to 480 (default: 192)"},
+		},
+		contentType: "application/octet-stream",
+		post:        "The body is the route ID, with optional width and height lines. The response is the bitmap.",
+	},
+	{
+		path:    "/nav/route/{id}/qr",
+		summary: "Encode a link to a previously requested route as a QR code",
+		params: []apiParam{
+			{name: "id", description: "Route ID from /nav/route", required: true, path: true},
+			{name: "format", description: "png or text (default: png)"},
+			{name: "scale", description: "For png, pixels per module, up to 20 (default: 8)"},
+		},
+		contentType: "image/png",
+		post:        "The response is the code as plain text.",
+	},
+	{
+		path:    "/nav/staticmap",
+		summary: "Draw a previously requested route as a map image",
+		params: []apiParam{
+			{name: "route", description: "Route ID from /nav/route", required: true},
+			{name: "width", description: "Image width in pixels, up to 1280 (default: 600)"},
+			{name: "height", description: "Image height in pixels, up to 1280 (default: 400)"},
+			{name: "tiles", description: "off for a plain background"},
+			{name: "format", description: "png or raw (default: png)"},
+			{name: "bits", description: "For raw, bits per pixel, 2 or 4 (default: 2)"},
+			{name: "palette", description: "For raw, gray, cga, or c64 (default: gray)"},
+			{name: "aspect", description: "For raw, how many times wider than tall each pixel is displayed, up to 4 (default: 1)"},
+		},
+		contentType: "image/png",
+	},
+	{
+		path:    "/nav/progress",
+		summary: "Find where a position lies along a previously requested route",
+		params: []apiParam{
+			{name: "route", description: "Route ID from /nav/route", required: true},
+			atParam,
+		},
+		response: RouteProgressResponse{},
+		post:     "The body is the route ID and the position on two lines. The response is the step number, street, distance to the end of the step, and distance remaining.",
+	},
+	{
+		path:    "/nav/nearby",
+		summary: "Find places of a category around a point, closest first",
+		params: []apiParam{
+			atParam,
+			{name: "category", description: "e.g. restaurant, gas, pharmacy, or atm", required: true},
+			{name: "radius", description: "Search radius in meters, up to 25000 (default: 1000)"},
+			unitsParam,
+			{name: "limit", description: "Maximum number of results"},
+		},
+		response: []NearbyResult{},
+		post:     "The body is the category and the point on two lines, with optional units. The response is the number of results, then the name, address, and distance and direction of each.",
+	},
+	{
+		path:    "/nav/zip",
+		summary: "Resolve a postal code, or find the postal code containing a point",
+		params: []apiParam{
+			{name: "code", description: "Postal code to look up"},
+			{name: "at", description: "Coordinates as lat,lng for a reverse lookup"},
+			{name: "country", description: "Two-letter ISO country code"},
+		},
+		response: PostalCodeResponse{},
+		post:     "The body is a postal code or lat,lng, with an optional country line. The response is the postal code, coordinates, city, state, and country.",
+	},
+	{
+		path:    "/nav/whereami",
+		summary: "Approximate a location from an IP address",
+		params: []apiParam{
+			{name: "ip", description: "IP address to look up (default: the caller's)"},
+		},
+		response: WhereAmIResponse{},
+		post:     "The body is an optional IP address. The response is the coordinates, city, state, and country.",
+	},
+	{
+		path:     "/nav/admin",
+		summary:  "Find the city, county, state, and country containing a point",
+		params:   []apiParam{atParam},
+		response: AdminAreaResponse{},
+		post:     "The body is lat,lng. The response is the city, county, state code, and country code.",
+	},
+	{
+		path:    "/nav/stops",
+		summary: "Find transit stops near a point, closest first",
+		params: []apiParam{
+			atParam,
+			{name: "radius", description: "Search radius in meters, up to 5000 (default: 500)"},
+			unitsParam,
+		},
+		response: []TransitStop{},
+		post:     "The body is lat,lng with optional units. The response is the number of stops, then the name, ID, and distance and routes of each.",
+	},
+	{
+		path:    "/nav/departures",
+		summary: "List the next departures from a transit stop",
+		params: []apiParam{
+			{name: "stop", description: "Stop ID from /nav/stops"},
+			{name: "at", description: "Coordinates as lat,lng to use the nearest stop"},
+			{name: "limit", description: "Number of departures, up to 20 (default: 5)"},
+			{name: "format", description: "text for a fixed-width board"},
+			{name: "wheelchair", description: "true for wheelchair-accessible trips only"},
+		},
+		response: DeparturesResponse{},
+		post:     "The body is a stop code, stop ID, or lat,lng, with an optional number of departures and wheelchair=true line. The response is a fixed-width board.",
+	},
+	{
+		path:     "/nav/transit/route",
+		summary:  "Look up display details for a transit route",
+		params:   []apiParam{{name: "id", description: "Route ID", required: true}},
+		response: TransitRouteDetails{},
+		post:     "The body is the route ID. The response is the short name, long name, vehicle type, operator, and color.",
+	},
+	{
+		path:     "/nav/transit/stop",
+		summary:  "Look up a transit stop and the routes serving it",
+		params:   []apiParam{{name: "id", description: "Stop ID", required: true}},
+		response: TransitStopDetails{},
+		post:     "The body is the stop ID. The response is the name, code, coordinates, and accessibility, then the number of routes and each route's names.",
+	},
+	{
+		path:     "/nav/transit/agencies",
+		summary:  "List the transit operators serving an area",
+		params:   []apiParam{{name: "near", description: "Coordinates as lat,lng", required: true}},
+		response: []TransitAgency{},
+		post:     "The body is lat,lng. The response is the number of agencies, then the name, ID, and website of each.",
+	},
+	{
+		path:     "/nav/transit/vehicles",
+		summary:  "Live vehicle positions for a route",
+		params:   []apiParam{{name: "route", description: "Route ID or short name", required: true}},
+		response: TransitVehiclesResponse{},
+		post:     "The body is the route. The response is the number of vehicles, then the label and headsign, and grid position of each.",
+	},
+	{
+		path:    "/nav/transit/alerts",
+		summary: "Active service alerts for a route, a stop, or everywhere",
+		params: []apiParam{
+			{name: "route", description: "Route ID or short name"},
+			{name: "stop", description: "Stop ID"},
+		},
+		response: []TransitAlert{},
+		post:     "The body is an optional route or stop. The response is the number of alerts, then the header and effect of each.",
+	},
+	{
+		path:     "/nav/transit/coverage",
+		summary:  "Check whether transit data is available around a point",
+		params:   []apiParam{atParam},
+		response: TransitCoverageResponse{},
+		post:     "The body is lat,lng. The response is 1 or 0, then the providers separated by commas.",
+	},
+	{
+		path:     "/nav/usage",
+		summary:  "Report the calling API key's usage",
+		response: APIKeyUsageResponse{},
+	},
+	{
+		path:     "/healthz",
+		summary:  "Report that the server is up",
+		params:   []apiParam{{name: "probe", description: "1 to also check upstream services"}},
+		response: HealthResponse{},
+	},
+	{
+		path:     "/readyz",
+		summary:  "Report whether the server has finished starting",
+		response: ReadinessResponse{},
+	},
+	{
+		path:     "/version",
+		summary:  "Report the running build and its enabled features",
+		response: VersionResponse{},
+		post:     "The response is the version, commit, and build date, then the number of routers and each router, then the number of features and each feature.",
+	},
+}
+
+// openAPIDocument builds an OpenAPI 3 document from apiEndpoints, leaving out
+// switched-off ones, with response schemas taken from the response types' JSON
+// encoding
+func openAPIDocument(ctx context.Context) map[string]any {
+	schemas := map[string]any{}
+	paths := map[string]any{}
+	errorSchema := schemaFor(reflect.TypeOf(ErrorResponse{}), schemas)
+
+	for _, endpoint := range apiEndpoints {
+		if endpointDisabled(ctx, endpoint.path) != "" {
+			continue
+		}
+		errorResponse := map[string]any{
+			"description": "Error",
+			"content":     map[string]any{"application/json": map[string]any{"schema": errorSchema}},
+		}
+
+		params := []any{}
+		for _, param := range endpoint.params {
+			in := "query"
+			if param.path {
+				in = "path"
+			}
+			params = append(params, map[string]any{
+				"name":        param.name,
+				"in":          in,
+				"description": param.description,
+				"required":    param.required,
+				"schema":      map[string]any{"type": "string"},
+			})
+		}
+
+		content := map[string]any{}
+		if endpoint.response != nil {
+			content["application/json"] = map[string]any{"schema": schemaFor(reflect.TypeOf(endpoint.response), schemas)}
+		} else {
+			content[endpoint.contentType] = map[string]any{"schema": map[string]any{"type": "string", "format": "binary"}}
+		}
+		operations := map[string]any{
+			"get": map[string]any{
+				"summary":    endpoint.summary,
+				"parameters": params,
+				"responses": map[string]any{
+					"200":     map[string]any{"description": "OK", "content": content},
+					"default": errorResponse,
+				},
+			},
+		}
+		if endpoint.post != "" {
+			text := map[string]any{"text/plain": map[string]any{"schema": map[string]any{"type": "string"}}}
+			operations["post"] = map[string]any{
+				"summary":     endpoint.summary,
+				"description": endpoint.post,
+				"parameters":  params,
+				"requestBody": map[string]any{"content": text},
+				"responses": map[string]any{
+					"200":     map[string]any{"description": "OK", "content": text},
+					"default": errorResponse,
+				},
+			}
+		}
+		if apiKeyExemptPaths[endpoint.path] {
+			for _, operation := range operations {
+				operation.(map[string]any)["security"] = []any{}
+			}
+		}
+		paths[endpoint.path] = operations
+	}
+
+	doc := map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":   "Fujisuite Server",
+			"version": buildInfo.Version,
+		},
+		"paths": paths,
+		"components": map[string]any{
+			"schemas": schemas,
+			"securitySchemes": map[string]any{
+				"apiKeyHeader": map[string]any{"type": "apiKey", "in": "header", "name": APIKeyHeader},
+				"apiKeyQuery":  map[string]any{"type": "apiKey", "in": "query", "name": "apikey"},
+			},
+		},
+	}
+	if configFor(ctx).PublicURL != "" {
+		doc["servers"] = []any{map[string]any{"url": strings.TrimSuffix(configFor(ctx).PublicURL, "/")}}
+	}
+	if authEnabled() {
+		doc["security"] = []any{
+			map[string]any{"apiKeyHeader": []any{}},
+			map[string]any{"apiKeyQuery": []any{}},
+		}
+	}
+	return doc
+}
+
+// schemaFor returns the JSON schema for values of type t as encoding/json
+// writes them, adding named structs to schemas and referring to them there
+func schemaFor(t reflect.Type, schemas map[string]any) map[string]any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Slice:
+		return map[string]any{"type": "array", "items": schemaFor(t.Elem(), schemas)}
+	case reflect.Array:
+		return map[string]any{
+			"type":     "array",
+			"items":    schemaFor(t.Elem(), schemas),
+			"minItems": t.Len(),
+			"maxItems": t.Len(),
+		}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": schemaFor(t.Elem(), schemas)}
+	case reflect.Struct:
+		ref := map[string]any{"$ref": "#/components/schemas/" + t.Name()}
+		if _, ok := schemas[t.Name()]; ok {
+			return ref
+		}
+		// Placeholder so recursive types refer to themselves
+		schemas[t.Name()] = nil
+
+		properties := map[string]any{}
+		required := []string{}
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if name == "-" {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+			properties[name] = schemaFor(field.Type, schemas)
+			if !strings.Contains(options, "omitempty") {
+				required = append(required, name)
+			}
+		}
+		schema := map[string]any{"type": "object", "properties": properties}
+		if len(required) > 0 {
+			schema["required"] = required
+		}
+		schemas[t.Name()] = schema
+		return ref
+	default:
+		return map[string]any{}
+	}
+}
+
+// HandleOpenAPI serves the OpenAPI document describing the endpoints
+func HandleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	httpLog.DebugContext(r.Context(), "OpenAPI request", "method", r.Method, "url", redactURL(r.URL.String()))
+
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "only GET method is allowed")
+		return
+	}
+	writeJSON(w, openAPIDocument(r.Context()))
+}
+
+// swaggerUIPage loads Swagger UI from a CDN and points it at /openapi.json
+const swaggerUIPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Fujisuite Server API</title>
+<link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+<div id="swagger-ui"></div>
+<script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+<script>
+SwaggerUIBundle({url: "/openapi.json", dom_id: "#swagger-ui"});
+</script>
+</body>
+</html>
+`
+
+// HandleAPIDocs serves Swagger UI for browsing the OpenAPI document, when
+// api_docs is enabled
+func HandleAPIDocs(w http.ResponseWriter, r *http.Request) {
+	httpLog.DebugContext(r.Context(), "API docs request", "method", r.Method, "url", redactURL(r.URL.String()))
+
+	if !configFor(r.Context()).APIDocs {
+		writeError(w, http.StatusNotFound, "API docs are not enabled")
+		return
+	}
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "only GET method is allowed")
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprint(w, swaggerUIPage)
+}
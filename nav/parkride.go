@@ -0,0 +1,261 @@
+package nav
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// parkRideCandidates is how many of the most direct lots are fully routed
+	parkRideCandidates = 3
+	// parkRideBuffer is time allowed to park and walk to the platform
+	parkRideBuffer = 5 * time.Minute
+)
+
+// parkRideLot is a park-and-ride lot loaded from the configured dataset
+type parkRideLot struct {
+	Name string
+	Lat  float64
+	Lng  float64
+}
+
+var (
+	parkRideMu   sync.Mutex
+	parkRideData []parkRideLot
+	parkRidePath string
+)
+
+// loadParkRideLots reads a CSV of lots with name, lat, and lng columns
+func loadParkRideLots(filename string) ([]parkRideLot, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("error opening park and ride lots: %v", err)
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("error reading park and ride lots header: %v", err)
+	}
+	columns := make(map[string]int)
+	for i, column := range header {
+		columns[strings.ToLower(strings.TrimSpace(column))] = i
+	}
+	for _, column := range []string{"name", "lat", "lng"} {
+		if _, ok := columns[column]; !ok {
+			return nil, fmt.Errorf("park and ride lots missing %q column", column)
+		}
+	}
+
+	var lots []parkRideLot
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading park and ride lots: %v", err)
+		}
+		if len(row) <= columns["lat"] || len(row) <= columns["lng"] || len(row) <= columns["name"] {
+			continue
+		}
+		lat, errLat := strconv.ParseFloat(strings.TrimSpace(row[columns["lat"]]), 64)
+		lng, errLng := strconv.ParseFloat(strings.TrimSpace(row[columns["lng"]]), 64)
+		if errLat != nil || errLng != nil {
+			continue
+		}
+		lots = append(lots, parkRideLot{Name: strings.TrimSpace(row[columns["name"]]), Lat: lat, Lng: lng})
+	}
+
+	return lots, nil
+}
+
+// openParkRideLots returns the configured lots, loading them on first use
+func openParkRideLots() ([]parkRideLot, error) {
+	parkRideMu.Lock()
+	defer parkRideMu.Unlock()
+
+	if currentConfig().ParkRideLots == "" {
+		return nil, fmt.Errorf("park and ride lots not configured")
+	}
+
+	// Reuse the loaded lots unless the configured path has changed
+	if parkRideData != nil && parkRidePath == currentConfig().ParkRideLots {
+		return parkRideData, nil
+	}
+
+	lots, err := loadParkRideLots(currentConfig().ParkRideLots)
+	if err != nil {
+		return nil, err
+	}
+	parkRideData = lots
+	parkRidePath = currentConfig().ParkRideLots
+
+	dataLog.Info("Loaded park and ride lots", "lots", len(lots), "file", currentConfig().ParkRideLots)
+
+	return parkRideData, nil
+}
+
+// candidateLots returns the lots with the smallest detour between two points,
+// skipping any that are farther from the origin than the destination is
+func candidateLots(lots []parkRideLot, req RouteRequest) []parkRideLot {
+	direct := haversineDistance(req.FromLat, req.FromLng, req.ToLat, req.ToLng)
+	detour := func(lot parkRideLot) float64 {
+		return haversineDistance(req.FromLat, req.FromLng, lot.Lat, lot.Lng) +
+			haversineDistance(lot.Lat, lot.Lng, req.ToLat, req.ToLng)
+	}
+
+	var candidates []parkRideLot
+	for _, lot := range lots {
+		if haversineDistance(req.FromLat, req.FromLng, lot.Lat, lot.Lng) < direct {
+			candidates = append(candidates, lot)
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return detour(candidates[i]) < detour(candidates[j])
+	})
+	if len(candidates) > parkRideCandidates {
+		candidates = candidates[:parkRideCandidates]
+	}
+	return candidates
+}
+
+// parkRideRoute is a combined route along with its track, stored once chosen
+type parkRideRoute struct {
+	*RouteResponse
+	track *routeTrack
+}
+
+// routeParkRide drives to the park-and-ride lot giving the earliest arrival, then
+// takes transit to the destination. Without a lot dataset, US trips are left to
+// the OTP planner's own park-and-ride support.
+func routeParkRide(ctx context.Context, req RouteRequest, depart time.Time) (*RouteResponse, error) {
+	lots, err := openParkRideLots()
+	if err != nil {
+		if req.Country == CountryCode("us") && configFor(ctx).TransitlandURL != "" {
+			return routeTransitUS(ctx, req, depart)
+		}
+		return nil, err
+	}
+
+	candidates := candidateLots(lots, req)
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("no park and ride lots between origin and destination")
+	}
+
+	var best *parkRideRoute
+	var bestArrive time.Time
+	for _, lot := range candidates {
+		result, arrive, err := parkRideVia(ctx, req, lot, depart)
+		if err != nil {
+			routeLog.DebugContext(ctx, "Park and ride via lot failed", "lot", lot.Name, "error", err)
+			continue
+		}
+		if best == nil || arrive.Before(bestArrive) {
+			best, bestArrive = result, arrive
+		}
+	}
+	if best == nil {
+		return nil, fmt.Errorf("no route found")
+	}
+
+	storeRoute(best.RouteResponse, best.track)
+	return best.RouteResponse, nil
+}
+
+// parkRideVia routes from the origin to a lot by car, then on by transit
+func parkRideVia(ctx context.Context, req RouteRequest, lot parkRideLot, depart time.Time) (*parkRideRoute, time.Time, error) {
+	driveReq := req
+	driveReq.Mode = ModeAuto
+	driveReq.ToLat, driveReq.ToLng, driveReq.ToDesc = lot.Lat, lot.Lng, lot.Name
+	drive, err := route(ctx, driveReq)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	transitReq := req
+	transitReq.Mode = ModeTransit
+	transitReq.FromLat, transitReq.FromLng, transitReq.FromDesc = lot.Lat, lot.Lng, lot.Name
+	transitReq.Depart = depart.Add(time.Duration(drive.Duration)*time.Second + parkRideBuffer).Format(time.RFC3339)
+	transit, err := route(ctx, transitReq)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	arrive, err := time.Parse(time.RFC3339, transit.ArriveTime)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("transit route has no arrival time")
+	}
+
+	result := &RouteResponse{
+		Duration: arrive.Sub(depart).Seconds(),
+		Distance: drive.Distance + transit.Distance,
+		Units:    drive.Units,
+		Mode:     ModeParkRide,
+		Provider: drive.Provider + "," + transit.Provider,
+		From:     drive.From,
+		To:       transit.To,
+	}
+
+	// Drive steps, then a step for the mode switch, then transit steps. The drive's
+	// arrival step is replaced by the park step.
+	driveSteps := drive.Steps
+	if len(driveSteps) > 1 {
+		driveSteps = driveSteps[:len(driveSteps)-1]
+	}
+	result.Steps = append(result.Steps, driveSteps...)
+	result.Steps = append(result.Steps, RouteStep{
+		Description: fmt.Sprintf("Park at %s", lot.Name),
+		Icon:        "Park",
+		Summary:     "PARK -> " + lot.Name,
+	})
+	result.Steps = append(result.Steps, transit.Steps...)
+	for i := range result.Steps {
+		result.Steps[i].Number = i + 1
+	}
+
+	// Join the two tracks, with the park step at the end of the drive
+	var points [][2]float64
+	var trackSteps []trackStep
+	if t, ok := routeStore.get(drive.ID); ok {
+		points = append(points, t.Points...)
+		for _, step := range t.Steps {
+			if step.Number <= len(driveSteps) {
+				trackSteps = append(trackSteps, step)
+			}
+		}
+	}
+	parkAt := max(0, len(points)-1)
+	trackSteps = append(trackSteps, trackStep{Number: len(driveSteps) + 1, Street: lot.Name, Begin: parkAt, End: parkAt})
+	if t, ok := routeStore.get(transit.ID); ok {
+		offset := len(points)
+		points = append(points, t.Points...)
+		for _, step := range t.Steps {
+			step.Number += len(driveSteps) + 1
+			step.Begin += offset
+			step.End += offset
+			trackSteps = append(trackSteps, step)
+		}
+	}
+
+	pathPoints := normalizePath(points)
+	result.Path = Path{
+		Points: pathPoints,
+		Length: len(pathPoints),
+		Width:  NormalizedGridSize,
+		Height: NormalizedGridSize,
+	}
+	setTransitTimes(result, depart, arrive)
+
+	return &parkRideRoute{RouteResponse: result, track: newRouteTrack(points, trackSteps, result.Units)}, arrive, nil
+}
@@ -0,0 +1,236 @@
+package nav
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Open Location Code (Plus Code) constants, see https://github.com/google/open-location-code
+const (
+	plusCodeAlphabet       = "23456789CFGHJMPQRVWX"
+	plusCodeSeparator      = '+'
+	plusCodeSeparatorPos   = 8
+	plusCodePadding        = '0'
+	plusCodePairLength     = 10
+	plusCodeGridRows       = 5
+	plusCodeGridColumns    = 4
+	plusCodeMaxLength      = 15
+	plusCodePairPrecision  = 8000 // 20^3, inverse of the 10-digit resolution in degrees
+	plusCodeMaxLatitude    = 90
+	plusCodeMaxLongitude   = 180
+	plusCodeEncodingBase   = 20
+	plusCodeFirstPairWidth = 20 // degrees covered by each value of the first pair
+)
+
+// plusCodeArea is the area covered by a decoded plus code
+type plusCodeArea struct {
+	LatLo, LngLo float64
+	LatHi, LngHi float64
+}
+
+// center returns the center point of the area
+func (a plusCodeArea) center() (float64, float64) {
+	return (a.LatLo + a.LatHi) / 2, (a.LngLo + a.LngHi) / 2
+}
+
+// plusCodeDigit returns the value of a plus code character, or -1 if it isn't valid
+func plusCodeDigit(c byte) int {
+	return strings.IndexByte(plusCodeAlphabet, c)
+}
+
+// isValidPlusCode checks if the string is a syntactically valid full or short plus code
+func isValidPlusCode(code string) bool {
+	code = strings.ToUpper(code)
+	sep := strings.IndexByte(code, plusCodeSeparator)
+	if sep < 0 || sep != strings.LastIndexByte(code, plusCodeSeparator) {
+		return false
+	}
+	if sep > plusCodeSeparatorPos || sep%2 != 0 || len(code) > plusCodeMaxLength+1 {
+		return false
+	}
+
+	// Padding is only allowed in full codes, in pairs, immediately before the separator
+	if pad := strings.IndexByte(code, plusCodePadding); pad >= 0 {
+		if sep < plusCodeSeparatorPos || pad == 0 || pad%2 != 0 {
+			return false
+		}
+		if strings.Trim(code[pad:sep], string(plusCodePadding)) != "" || sep != len(code)-1 {
+			return false
+		}
+		code = code[:pad] + code[sep:]
+		sep = pad
+	}
+
+	// A single character after the separator isn't allowed
+	if len(code)-sep-1 == 1 {
+		return false
+	}
+
+	for i := 0; i < len(code); i++ {
+		if i != sep && plusCodeDigit(code[i]) < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// isFullPlusCode checks if the string is a valid plus code that can be decoded on its own
+func isFullPlusCode(code string) bool {
+	if !isValidPlusCode(code) {
+		return false
+	}
+	code = strings.ToUpper(code)
+	if strings.IndexByte(code, plusCodeSeparator) != plusCodeSeparatorPos {
+		return false
+	}
+
+	// The first pair must be within the latitude and longitude ranges
+	if plusCodeDigit(code[0])*plusCodeFirstPairWidth >= 2*plusCodeMaxLatitude {
+		return false
+	}
+	if plusCodeDigit(code[1])*plusCodeFirstPairWidth >= 2*plusCodeMaxLongitude {
+		return false
+	}
+	return true
+}
+
+// encodePlusCode returns the 10-digit plus code for a point
+func encodePlusCode(lat, lng float64) string {
+	lat = math.Max(-plusCodeMaxLatitude, math.Min(plusCodeMaxLatitude, lat))
+	lng = math.Mod(lng+plusCodeMaxLongitude, 2*plusCodeMaxLongitude)
+	if lng < 0 {
+		lng += 2 * plusCodeMaxLongitude
+	}
+
+	latVal := int(math.Floor((lat + plusCodeMaxLatitude) * plusCodePairPrecision))
+	lngVal := int(math.Floor(lng * plusCodePairPrecision))
+
+	// The north pole belongs to the cell just below it
+	if latVal >= 2*plusCodeMaxLatitude*plusCodePairPrecision {
+		latVal = 2*plusCodeMaxLatitude*plusCodePairPrecision - 1
+	}
+
+	// Build digits from least to most significant
+	digits := make([]byte, plusCodePairLength)
+	for i := plusCodePairLength/2 - 1; i >= 0; i-- {
+		digits[i*2] = plusCodeAlphabet[latVal%plusCodeEncodingBase]
+		digits[i*2+1] = plusCodeAlphabet[lngVal%plusCodeEncodingBase]
+		latVal /= plusCodeEncodingBase
+		lngVal /= plusCodeEncodingBase
+	}
+
+	return string(digits[:plusCodeSeparatorPos]) + string(plusCodeSeparator) + string(digits[plusCodeSeparatorPos:])
+}
+
+// decodePlusCode returns the area covered by a full plus code
+func decodePlusCode(code string) (plusCodeArea, error) {
+	if !isFullPlusCode(code) {
+		return plusCodeArea{}, fmt.Errorf("invalid plus code: %s", code)
+	}
+
+	// Strip the separator and any padding
+	code = strings.ToUpper(code)
+	code = strings.ReplaceAll(code, string(plusCodeSeparator), "")
+	code = strings.TrimRight(code, string(plusCodePadding))
+
+	lat, lng := -float64(plusCodeMaxLatitude), -float64(plusCodeMaxLongitude)
+	latRes, lngRes := float64(plusCodeEncodingBase*plusCodeEncodingBase), float64(plusCodeEncodingBase*plusCodeEncodingBase)
+
+	// Decode the pairs section
+	for i := 0; i < len(code) && i < plusCodePairLength; i += 2 {
+		latRes /= plusCodeEncodingBase
+		lngRes /= plusCodeEncodingBase
+		lat += float64(plusCodeDigit(code[i])) * latRes
+		lng += float64(plusCodeDigit(code[i+1])) * lngRes
+	}
+
+	// Decode the grid section, one character per refinement
+	for i := plusCodePairLength; i < len(code); i++ {
+		latRes /= plusCodeGridRows
+		lngRes /= plusCodeGridColumns
+		value := plusCodeDigit(code[i])
+		lat += float64(value/plusCodeGridColumns) * latRes
+		lng += float64(value%plusCodeGridColumns) * lngRes
+	}
+
+	return plusCodeArea{LatLo: lat, LngLo: lng, LatHi: lat + latRes, LngHi: lng + lngRes}, nil
+}
+
+// recoverPlusCode expands a short plus code to the nearest matching location to a reference point
+func recoverPlusCode(code string, refLat, refLng float64) (float64, float64, error) {
+	if isFullPlusCode(code) {
+		area, err := decodePlusCode(code)
+		if err != nil {
+			return 0, 0, err
+		}
+		lat, lng := area.center()
+		return lat, lng, nil
+	}
+	if !isValidPlusCode(code) {
+		return 0, 0, fmt.Errorf("invalid plus code: %s", code)
+	}
+
+	// Borrow the missing leading digits from the reference point
+	code = strings.ToUpper(code)
+	paddingLength := plusCodeSeparatorPos - strings.IndexByte(code, plusCodeSeparator)
+	resolution := math.Pow(plusCodeEncodingBase, float64(2-paddingLength/2))
+	halfResolution := resolution / 2
+
+	area, err := decodePlusCode(encodePlusCode(refLat, refLng)[:paddingLength] + code)
+	if err != nil {
+		return 0, 0, err
+	}
+	lat, lng := area.center()
+
+	// The borrowed prefix may point at the neighbouring cell, so move towards the reference
+	if refLat+halfResolution < lat && lat-resolution >= -plusCodeMaxLatitude {
+		lat -= resolution
+	} else if refLat-halfResolution > lat && lat+resolution <= plusCodeMaxLatitude {
+		lat += resolution
+	}
+	if refLng+halfResolution < lng {
+		lng -= resolution
+	} else if refLng-halfResolution > lng {
+		lng += resolution
+	}
+
+	return lat, lng, nil
+}
+
+// looksLikePlusCode reports whether the first word of s is a plus code
+func looksLikePlusCode(s string) bool {
+	fields := strings.Fields(s)
+	return len(fields) > 0 && isValidPlusCode(strings.TrimSuffix(fields[0], ","))
+}
+
+// resolvePlusCode converts a full plus code, or a short code followed by a locality
+// (e.g. "Q2+2M Mountain View"), to coordinates
+func resolvePlusCode(ctx context.Context, s string) (float64, float64, error) {
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		return 0, 0, fmt.Errorf("empty plus code")
+	}
+	code := strings.TrimSuffix(fields[0], ",")
+	locality := strings.TrimSpace(strings.Join(fields[1:], " "))
+
+	if isFullPlusCode(code) {
+		area, err := decodePlusCode(code)
+		if err != nil {
+			return 0, 0, err
+		}
+		lat, lng := area.center()
+		return lat, lng, nil
+	}
+
+	// Short codes need a locality to recover the full code against
+	if locality == "" {
+		return 0, 0, fmt.Errorf("short plus code %s requires a locality, e.g. %s Springfield", code, code)
+	}
+	results, err := geocode(ctx, GeocodeRequest{Query: locality})
+	if err != nil {
+		return 0, 0, fmt.Errorf("error resolving plus code locality: %v", err)
+	}
+	return recoverPlusCode(code, results[0].Lat, results[0].Lng)
+}
@@ -0,0 +1,131 @@
+package nav
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// lookupPostalCode resolves a postal code to its centroid, city, and state using Nominatim
+func lookupPostalCode(ctx context.Context, code string, country CountryCode) (*PostalCodeResponse, error) {
+	// Build query parameters for a structured postal code search
+	params := url.Values{
+		"postalcode":     {code},
+		"format":         {"json"},
+		"limit":          {"1"},
+		"addressdetails": {"1"},
+	}
+	if country != "" {
+		params.Set("countrycodes", string(country))
+	}
+
+	// Create request URL with query parameters
+	apiURL := fmt.Sprintf("%s/search?%s", configFor(ctx).NominatimURL, params.Encode())
+
+	// Make GET request
+	resp, err := nominatimGet(ctx, apiURL)
+	if err != nil {
+		return nil, fmt.Errorf("error making request to Nominatim: %v", err)
+	}
+	defer resp.Body.Close()
+
+	// Check response status
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("nominatim API returned status: %d", resp.StatusCode)
+	}
+
+	// Decode response
+	var nominatimResults []nominatimResponse
+	if err := json.NewDecoder(resp.Body).Decode(&nominatimResults); err != nil {
+		return nil, fmt.Errorf("error decoding response: %v", err)
+	}
+
+	if len(nominatimResults) == 0 {
+		return nil, &ErrNoResults{Query: code}
+	}
+
+	result, err := postalCodeResponse(nominatimResults[0])
+	if err != nil {
+		return nil, err
+	}
+
+	// Nominatim sometimes omits the postcode on the matched area itself
+	if result.PostalCode == "" {
+		result.PostalCode = code
+	}
+
+	return result, nil
+}
+
+// reversePostalCode resolves coordinates to the postal code containing them using Nominatim
+func reversePostalCode(ctx context.Context, lat, lng float64) (*PostalCodeResponse, error) {
+	// Build query parameters
+	params := url.Values{
+		"lat":            {fmt.Sprintf("%.6f", lat)},
+		"lon":            {fmt.Sprintf("%.6f", lng)},
+		"format":         {"json"},
+		"addressdetails": {"1"},
+	}
+
+	// Create request URL with query parameters
+	apiURL := fmt.Sprintf("%s/reverse?%s", configFor(ctx).NominatimURL, params.Encode())
+
+	// Make GET request
+	resp, err := nominatimGet(ctx, apiURL)
+	if err != nil {
+		return nil, fmt.Errorf("error making request to Nominatim: %v", err)
+	}
+	defer resp.Body.Close()
+
+	// Check response status
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("nominatim API returned status: %d", resp.StatusCode)
+	}
+
+	// Decode response
+	var result nominatimResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("error decoding response: %v", err)
+	}
+
+	query := fmt.Sprintf("%.6f,%.6f", lat, lng)
+	if result.Address.PostCode == "" {
+		return nil, &ErrNoResults{Query: query}
+	}
+
+	postal, err := postalCodeResponse(result)
+	if err != nil {
+		return nil, err
+	}
+
+	// Report the requested point rather than the matched feature
+	postal.Lat = lat
+	postal.Lng = lng
+
+	return postal, nil
+}
+
+// postalCodeResponse converts a Nominatim result to our postal code format
+func postalCodeResponse(result nominatimResponse) (*PostalCodeResponse, error) {
+	// Parse lat/lon strings to float64
+	lat, err := parseFloat(result.Lat)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing latitude: %v", err)
+	}
+	lng, err := parseFloat(result.Lon)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing longitude: %v", err)
+	}
+
+	return &PostalCodeResponse{
+		PostalCode: result.Address.PostCode,
+		Lat:        lat,
+		Lng:        lng,
+		City:       cityName(result.Address),
+		State:      abbreviateState(result.Address.State),
+		Country:    strings.ToLower(result.Address.Country),
+	}, nil
+}
@@ -0,0 +1,480 @@
+package nav
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"strings"
+)
+
+// Default and allowed QR code image scales, in pixels per module
+const (
+	DefaultQRScale = 8
+	MaxQRScale     = 20
+	qrQuietZone    = 4 // Light modules around the code, as scanners expect
+	maxQRVersion   = 10
+)
+
+// qrBlocks describes the error correction blocks of a QR code version at
+// level M, which survives smudged or glaring screens better than level L
+type qrBlocks struct {
+	ecPerBlock int
+	groups     [][2]int // Block count and data codewords per block, for each group
+}
+
+// qrVersionBlocks lists the level M block layout of versions 1 to 10
+var qrVersionBlocks = [maxQRVersion + 1]qrBlocks{
+	1:  {10, [][2]int{{1, 16}}},
+	2:  {16, [][2]int{{1, 28}}},
+	3:  {26, [][2]int{{1, 44}}},
+	4:  {18, [][2]int{{2, 32}}},
+	5:  {24, [][2]int{{2, 43}}},
+	6:  {16, [][2]int{{4, 27}}},
+	7:  {18, [][2]int{{4, 31}}},
+	8:  {22, [][2]int{{2, 38}, {2, 39}}},
+	9:  {22, [][2]int{{3, 36}, {2, 37}}},
+	10: {26, [][2]int{{4, 43}, {1, 44}}},
+}
+
+// qrAlignment lists the alignment pattern centers of versions 1 to 10
+var qrAlignment = [maxQRVersion + 1][]int{
+	2: {6, 18}, 3: {6, 22}, 4: {6, 26}, 5: {6, 30}, 6: {6, 34},
+	7: {6, 22, 38}, 8: {6, 24, 42}, 9: {6, 26, 46}, 10: {6, 28, 50},
+}
+
+// dataCodewords returns the number of data codewords the layout holds
+func (b qrBlocks) dataCodewords() int {
+	n := 0
+	for _, g := range b.groups {
+		n += g[0] * g[1]
+	}
+	return n
+}
+
+// qrCode is an encoded QR code, with modules indexed by row then column and
+// true for dark
+type qrCode struct {
+	size     int
+	modules  [][]bool
+	function [][]bool // Finder, timing, alignment, and format modules, which masks skip
+}
+
+// gfMul multiplies in GF(256) with the QR code polynomial x^8 + x^4 + x^3 + x^2 + 1
+func gfMul(a, b byte) byte {
+	var p byte
+	for b != 0 {
+		if b&1 != 0 {
+			p ^= a
+		}
+		carry := a & 0x80
+		a <<= 1
+		if carry != 0 {
+			a ^= 0x1D
+		}
+		b >>= 1
+	}
+	return p
+}
+
+// reedSolomon computes the error correction codewords for a block of data
+func reedSolomon(data []byte, ecLen int) []byte {
+	// Generator polynomial (x - 2^0)(x - 2^1)...(x - 2^(ecLen-1)), highest term implied
+	generator := make([]byte, ecLen)
+	generator[ecLen-1] = 1
+	root := byte(1)
+	for i := 0; i < ecLen; i++ {
+		for j := 0; j < ecLen; j++ {
+			generator[j] = gfMul(generator[j], root)
+			if j+1 < ecLen {
+				generator[j] ^= generator[j+1]
+			}
+		}
+		root = gfMul(root, 2)
+	}
+
+	remainder := make([]byte, ecLen)
+	for _, b := range data {
+		factor := b ^ remainder[0]
+		copy(remainder, remainder[1:])
+		remainder[ecLen-1] = 0
+		for j := range remainder {
+			remainder[j] ^= gfMul(generator[j], factor)
+		}
+	}
+	return remainder
+}
+
+// qrCodewords lays out data in byte mode, pads it to the version's capacity,
+// and interleaves the blocks with their error correction
+func qrCodewords(data []byte, version int) []byte {
+	blocks := qrVersionBlocks[version]
+	capacity := blocks.dataCodewords()
+
+	var bits []bool
+	appendBits := func(v, n int) {
+		for i := n - 1; i >= 0; i-- {
+			bits = append(bits, v>>i&1 != 0)
+		}
+	}
+	appendBits(0b0100, 4) // Byte mode
+	if version < 10 {
+		appendBits(len(data), 8)
+	} else {
+		appendBits(len(data), 16)
+	}
+	for _, b := range data {
+		appendBits(int(b), 8)
+	}
+	appendBits(0, min(4, capacity*8-len(bits))) // Terminator
+	for len(bits)%8 != 0 {
+		bits = append(bits, false)
+	}
+
+	codewords := make([]byte, 0, capacity)
+	for i := 0; i < len(bits); i += 8 {
+		var b byte
+		for _, bit := range bits[i : i+8] {
+			b <<= 1
+			if bit {
+				b |= 1
+			}
+		}
+		codewords = append(codewords, b)
+	}
+	for pad := 0; len(codewords) < capacity; pad++ {
+		codewords = append(codewords, []byte{0xEC, 0x11}[pad%2])
+	}
+
+	// Split into blocks, then interleave data and error correction codewords
+	var dataBlocks, ecBlocks [][]byte
+	offset := 0
+	for _, g := range blocks.groups {
+		for i := 0; i < g[0]; i++ {
+			block := codewords[offset : offset+g[1]]
+			offset += g[1]
+			dataBlocks = append(dataBlocks, block)
+			ecBlocks = append(ecBlocks, reedSolomon(block, blocks.ecPerBlock))
+		}
+	}
+	var out []byte
+	for i := 0; ; i++ {
+		added := false
+		for _, block := range dataBlocks {
+			if i < len(block) {
+				out = append(out, block[i])
+				added = true
+			}
+		}
+		if !added {
+			break
+		}
+	}
+	for i := 0; i < blocks.ecPerBlock; i++ {
+		for _, block := range ecBlocks {
+			out = append(out, block[i])
+		}
+	}
+	return out
+}
+
+// setFunction sets a function module, which data and masks skip
+func (q *qrCode) setFunction(x, y int, dark bool) {
+	q.modules[y][x] = dark
+	q.function[y][x] = true
+}
+
+// drawFunctionPatterns draws the finder, timing, and alignment patterns and
+// reserves the format and version areas
+func (q *qrCode) drawFunctionPatterns(version int) {
+	for i := 0; i < q.size; i++ {
+		q.setFunction(6, i, i%2 == 0)
+		q.setFunction(i, 6, i%2 == 0)
+	}
+
+	for _, c := range [][2]int{{3, 3}, {q.size - 4, 3}, {3, q.size - 4}} {
+		for dy := -4; dy <= 4; dy++ {
+			for dx := -4; dx <= 4; dx++ {
+				x, y := c[0]+dx, c[1]+dy
+				if x < 0 || x >= q.size || y < 0 || y >= q.size {
+					continue
+				}
+				dist := max(abs(dx), abs(dy))
+				q.setFunction(x, y, dist != 2 && dist != 4)
+			}
+		}
+	}
+
+	positions := qrAlignment[version]
+	last := len(positions) - 1
+	for i, cy := range positions {
+		for j, cx := range positions {
+			// Skip the corners taken by finder patterns
+			if (i == 0 && j == 0) || (i == 0 && j == last) || (i == last && j == 0) {
+				continue
+			}
+			for dy := -2; dy <= 2; dy++ {
+				for dx := -2; dx <= 2; dx++ {
+					q.setFunction(cx+dx, cy+dy, max(abs(dx), abs(dy)) != 1)
+				}
+			}
+		}
+	}
+
+	q.drawFormatBits(0)
+	q.drawVersionBits(version)
+}
+
+// drawFormatBits draws both copies of the level M format information for a mask
+func (q *qrCode) drawFormatBits(mask int) {
+	data := mask // Level M is 00
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = rem<<1 ^ (rem>>9)*0x537
+	}
+	bits := (data<<10 | rem) ^ 0x5412
+	bit := func(i int) bool { return bits>>i&1 != 0 }
+
+	for i := 0; i <= 5; i++ {
+		q.setFunction(8, i, bit(i))
+	}
+	q.setFunction(8, 7, bit(6))
+	q.setFunction(8, 8, bit(7))
+	q.setFunction(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		q.setFunction(14-i, 8, bit(i))
+	}
+
+	for i := 0; i < 8; i++ {
+		q.setFunction(q.size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		q.setFunction(8, q.size-15+i, bit(i))
+	}
+	q.setFunction(8, q.size-8, true) // Always dark
+}
+
+// drawVersionBits draws both copies of the version information, from version 7
+func (q *qrCode) drawVersionBits(version int) {
+	if version < 7 {
+		return
+	}
+	rem := version
+	for i := 0; i < 12; i++ {
+		rem = rem<<1 ^ (rem>>11)*0x1F25
+	}
+	bits := version<<12 | rem
+	for i := 0; i < 18; i++ {
+		dark := bits>>i&1 != 0
+		a, b := q.size-11+i%3, i/3
+		q.setFunction(a, b, dark)
+		q.setFunction(b, a, dark)
+	}
+}
+
+// drawCodewords places the codewords in the zigzag column pairs from the
+// bottom right, skipping function modules
+func (q *qrCode) drawCodewords(codewords []byte) {
+	i := 0
+	for right := q.size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5 // Skip the vertical timing pattern
+		}
+		upward := (right+1)&2 == 0
+		for vert := 0; vert < q.size; vert++ {
+			y := vert
+			if upward {
+				y = q.size - 1 - vert
+			}
+			for j := 0; j < 2; j++ {
+				x := right - j
+				if q.function[y][x] {
+					continue
+				}
+				// Modules past the last codeword are remainder bits, left light
+				if i < len(codewords)*8 {
+					q.modules[y][x] = codewords[i/8]>>(7-i%8)&1 != 0
+					i++
+				}
+			}
+		}
+	}
+}
+
+// applyMask inverts the data modules selected by one of the eight mask
+// patterns. Applying the same mask twice undoes it.
+func (q *qrCode) applyMask(mask int) {
+	for y := 0; y < q.size; y++ {
+		for x := 0; x < q.size; x++ {
+			var invert bool
+			switch mask {
+			case 0:
+				invert = (x+y)%2 == 0
+			case 1:
+				invert = y%2 == 0
+			case 2:
+				invert = x%3 == 0
+			case 3:
+				invert = (x+y)%3 == 0
+			case 4:
+				invert = (x/3+y/2)%2 == 0
+			case 5:
+				invert = x*y%2+x*y%3 == 0
+			case 6:
+				invert = (x*y%2+x*y%3)%2 == 0
+			case 7:
+				invert = ((x+y)%2+x*y%3)%2 == 0
+			}
+			if invert && !q.function[y][x] {
+				q.modules[y][x] = !q.modules[y][x]
+			}
+		}
+	}
+}
+
+// penalty scores how hard a masked code is to scan, lower being better, by
+// the long runs, 2x2 blocks, finder-like patterns, and dark balance rules
+func (q *qrCode) penalty() int {
+	score := 0
+	at := func(x, y int, transpose bool) bool {
+		if transpose {
+			return q.modules[x][y]
+		}
+		return q.modules[y][x]
+	}
+	finderLike := []bool{true, false, true, true, true, false, true}
+
+	for _, transpose := range []bool{false, true} {
+		for y := 0; y < q.size; y++ {
+			run := 1
+			for x := 1; x <= q.size; x++ {
+				if x < q.size && at(x, y, transpose) == at(x-1, y, transpose) {
+					run++
+					continue
+				}
+				if run >= 5 {
+					score += 3 + run - 5
+				}
+				run = 1
+			}
+
+			// A 1:1:3:1:1 finder pattern with four light modules on either side
+			for x := 0; x+7 <= q.size; x++ {
+				match := true
+				for k, dark := range finderLike {
+					if at(x+k, y, transpose) != dark {
+						match = false
+						break
+					}
+				}
+				if !match {
+					continue
+				}
+				light := func(from, to int) bool {
+					for k := from; k < to; k++ {
+						if k >= 0 && k < q.size && at(k, y, transpose) {
+							return false
+						}
+					}
+					return true
+				}
+				if light(x-4, x) || light(x+7, x+11) {
+					score += 40
+				}
+			}
+		}
+	}
+
+	dark := 0
+	for y := 0; y < q.size; y++ {
+		for x := 0; x < q.size; x++ {
+			if q.modules[y][x] {
+				dark++
+			}
+			if x+1 < q.size && y+1 < q.size {
+				c := q.modules[y][x]
+				if q.modules[y][x+1] == c && q.modules[y+1][x] == c && q.modules[y+1][x+1] == c {
+					score += 3
+				}
+			}
+		}
+	}
+	total := q.size * q.size
+	score += abs(dark*20-total*10) / total * 10
+	return score
+}
+
+// encodeQR encodes data as a level M QR code in byte mode, using the smallest
+// version it fits in and the mask with the lowest penalty
+func encodeQR(data []byte) (*qrCode, error) {
+	version := 1
+	for ; version <= maxQRVersion; version++ {
+		countBits := 8
+		if version >= 10 {
+			countBits = 16
+		}
+		if 4+countBits+len(data)*8 <= qrVersionBlocks[version].dataCodewords()*8 {
+			break
+		}
+	}
+	if version > maxQRVersion {
+		return nil, fmt.Errorf("too much data for a QR code: %d bytes", len(data))
+	}
+
+	size := 17 + 4*version
+	q := &qrCode{size: size, modules: make([][]bool, size), function: make([][]bool, size)}
+	for i := range q.modules {
+		q.modules[i] = make([]bool, size)
+		q.function[i] = make([]bool, size)
+	}
+	q.drawFunctionPatterns(version)
+	q.drawCodewords(qrCodewords(data, version))
+
+	bestMask, bestPenalty := 0, -1
+	for mask := 0; mask < 8; mask++ {
+		q.applyMask(mask)
+		q.drawFormatBits(mask)
+		if p := q.penalty(); bestPenalty < 0 || p < bestPenalty {
+			bestMask, bestPenalty = mask, p
+		}
+		q.applyMask(mask)
+	}
+	q.applyMask(bestMask)
+	q.drawFormatBits(bestMask)
+	return q, nil
+}
+
+// dark reports whether a module is dark, treating the quiet zone as light
+func (q *qrCode) dark(x, y int) bool {
+	return x >= 0 && x < q.size && y >= 0 && y < q.size && q.modules[y][x]
+}
+
+// image draws the code with its quiet zone, scale pixels per module
+func (q *qrCode) image(scale int) *image.Paletted {
+	side := (q.size + 2*qrQuietZone) * scale
+	img := image.NewPaletted(image.Rect(0, 0, side, side), color.Palette{color.White, color.Black})
+	for py := 0; py < side; py++ {
+		for px := 0; px < side; px++ {
+			if q.dark(px/scale-qrQuietZone, py/scale-qrQuietZone) {
+				img.SetColorIndex(px, py, 1)
+			}
+		}
+	}
+	return img
+}
+
+// writeText draws the code as text, two characters per module so it comes
+// out roughly square on 80-column screens, with a quiet zone of spaces
+func (q *qrCode) writeText(w io.Writer) {
+	for y := -qrQuietZone; y < q.size+qrQuietZone; y++ {
+		var line strings.Builder
+		for x := -qrQuietZone; x < q.size+qrQuietZone; x++ {
+			if q.dark(x, y) {
+				line.WriteString("##")
+			} else {
+				line.WriteString("  ")
+			}
+		}
+		fmt.Fprintln(w, strings.TrimRight(line.String(), " "))
+	}
+}
@@ -0,0 +1,165 @@
+package nav
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/MobilityData/gtfs-realtime-bindings/golang/gtfs"
+	"google.golang.org/protobuf/proto"
+)
+
+// realtimeCacheTTL is how long GTFS-Realtime feeds are reused. Most agencies
+// refresh vehicle positions every 15 to 30 seconds.
+const realtimeCacheTTL = 15 * time.Second
+
+var realtimeCache = newTTLCache[*gtfs.FeedMessage]("realtime", realtimeCacheTTL, 0)
+
+// fetchRealtime downloads and decodes a GTFS-Realtime protobuf feed
+func fetchRealtime(ctx context.Context, feedURL string) (*gtfs.FeedMessage, error) {
+	if msg, ok := realtimeCache.get(feedURL); ok {
+		return msg, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, feedURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %v", err)
+	}
+	if configFor(ctx).UserAgent != "" {
+		req.Header.Set("User-Agent", configFor(ctx).UserAgent)
+	}
+
+	resp, err := upstreamDo(req)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching realtime feed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading realtime feed: %v", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("realtime feed returned status %d", resp.StatusCode)
+	}
+
+	msg := &gtfs.FeedMessage{}
+	if err := proto.Unmarshal(body, msg); err != nil {
+		return nil, fmt.Errorf("error decoding realtime feed: %v", err)
+	}
+
+	realtimeCache.set(feedURL, msg)
+	return msg, nil
+}
+
+// roundCoord trims float32 noise from a realtime coordinate to 6 decimal places
+func roundCoord(v float32) float64 {
+	return math.Round(float64(v)*1e6) / 1e6
+}
+
+// findRoute looks up a route by its feed-qualified ID, or failing that by short name
+func (feed *gtfsFeed) findRoute(id string) *gtfsRoute {
+	if route, ok := feed.Routes[id]; ok {
+		return route
+	}
+
+	var match *gtfsRoute
+	for _, route := range feed.Routes {
+		if route.ShortName == id && (match == nil || route.ID < match.ID) {
+			match = route
+		}
+	}
+	return match
+}
+
+// vehiclePositions returns the live positions of vehicles on a route, projected
+// onto the normalized grid of the route's shape
+func vehiclePositions(ctx context.Context, routeID string) (*TransitVehiclesResponse, error) {
+	feed := currentGTFS()
+	if feed == nil || len(configFor(ctx).GTFSRealtime) == 0 {
+		return nil, fmt.Errorf("gtfs realtime not configured")
+	}
+
+	route := feed.findRoute(routeID)
+	if route == nil {
+		return nil, &ErrNoResults{Query: routeID}
+	}
+
+	shape := feed.routeShape(route.ID)
+	points := normalizePath(shape)
+	result := &TransitVehiclesResponse{
+		RouteID: route.ID,
+		Route:   route.displayName(),
+		Path: Path{
+			Points: points,
+			Length: len(points),
+			Width:  NormalizedGridSize,
+			Height: NormalizedGridSize,
+		},
+		Vehicles: []TransitVehicle{},
+	}
+	if len(shape) == 0 {
+		return result, nil
+	}
+	grid := newGridProjection(shape)
+
+	for _, rt := range configFor(ctx).GTFSRealtime {
+		if rt.VehiclePositionsURL == "" {
+			continue
+		}
+		msg, err := fetchRealtime(ctx, rt.VehiclePositionsURL)
+		if err != nil {
+			return nil, err
+		}
+
+		prefix := rt.Feed + ":"
+		for _, entity := range msg.GetEntity() {
+			vp := entity.GetVehicle()
+			if vp == nil || vp.GetPosition() == nil {
+				continue
+			}
+
+			// Some feeds only identify the trip, so resolve its route from the schedule
+			tripID := prefix + vp.GetTrip().GetTripId()
+			trip := feed.Trips[tripID]
+			vehicleRoute := prefix + vp.GetTrip().GetRouteId()
+			if vp.GetTrip().GetRouteId() == "" && trip != nil {
+				vehicleRoute = trip.Route.ID
+			}
+			if vehicleRoute != route.ID {
+				continue
+			}
+
+			vehicle := TransitVehicle{
+				ID:      vp.GetVehicle().GetId(),
+				Label:   vp.GetVehicle().GetLabel(),
+				Lat:     roundCoord(vp.GetPosition().GetLatitude()),
+				Lng:     roundCoord(vp.GetPosition().GetLongitude()),
+				Bearing: float64(vp.GetPosition().GetBearing()),
+			}
+			if vehicle.ID == "" {
+				vehicle.ID = entity.GetId()
+			}
+			if trip != nil {
+				vehicle.TripID = trip.ID
+				vehicle.Headsign = trip.Headsign
+			}
+			if ts := vp.GetTimestamp(); ts > 0 {
+				vehicle.Timestamp = time.Unix(int64(ts), 0).Format(time.RFC3339)
+			}
+			vehicle.Point = grid.project(vehicle.Lat, vehicle.Lng)
+			result.Vehicles = append(result.Vehicles, vehicle)
+		}
+	}
+
+	sort.Slice(result.Vehicles, func(i, j int) bool {
+		return result.Vehicles[i].ID < result.Vehicles[j].ID
+	})
+
+	return result, nil
+}
@@ -0,0 +1,131 @@
+package nav
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisTimeout bounds each cache call to Redis, so a slow Redis costs a cache
+// miss rather than a slow response
+const redisTimeout = 500 * time.Millisecond
+
+const defaultRedisPrefix = "fujisuite:"
+
+// sharedRedisClient is a Redis client shared by the states configured with it,
+// closed once the last of them is done with it
+type sharedRedisClient struct {
+	*redis.Client
+	refs atomic.Int64
+}
+
+// release drops a state's reference, closing the client after the last one
+func (c *sharedRedisClient) release() {
+	if c.refs.Add(-1) == 0 {
+		c.Close()
+	}
+}
+
+// redisClientFor returns the Redis client for a configuration, sharing the
+// current state's when its settings haven't changed, or nil to cache in memory
+func redisClientFor(cfg RedisConfig, current *navState) *sharedRedisClient {
+	if current.redis != nil && cfg == current.cfg.Redis {
+		current.redis.refs.Add(1)
+		return current.redis
+	}
+	if cfg.Address == "" {
+		return nil
+	}
+	client := &sharedRedisClient{Client: redis.NewClient(&redis.Options{
+		Addr:         cfg.Address,
+		Password:     cfg.Password,
+		DB:           cfg.DB,
+		DialTimeout:  redisTimeout,
+		ReadTimeout:  redisTimeout,
+		WriteTimeout: redisTimeout,
+	})}
+	client.refs.Add(1)
+	return client
+}
+
+// newResponseCache returns a cache of one kind of response, shared through
+// Redis when there's a client or held in memory otherwise
+func newResponseCache[V any](client *sharedRedisClient, cfg RedisConfig, kind string, ttl time.Duration, maxEntries int) responseCache[V] {
+	if client == nil {
+		return newTTLCache[V](kind, ttl, maxEntries)
+	}
+	prefix := cfg.Prefix
+	if prefix == "" {
+		prefix = defaultRedisPrefix
+	}
+	return &redisCache[V]{client: client.Client, addr: cfg.Address, prefix: prefix + kind + ":", ttl: ttl, stats: cacheStats(kind, nil)}
+}
+
+// redisCache stores responses in Redis as JSON, expiring them after a fixed
+// TTL. Errors are logged and treated as misses, and a circuit breaker skips
+// Redis while it's down.
+type redisCache[V any] struct {
+	client *redis.Client
+	addr   string
+	prefix string
+	ttl    time.Duration
+	stats  *cacheCounter
+}
+
+// do makes a call to Redis through its circuit breaker
+func (c *redisCache[V]) do(call func(ctx context.Context) error) error {
+	breaker := breakerForHost(c.addr)
+	if !breaker.allow() {
+		upstreamStats(c.addr).rejected.Add(1)
+		return &ErrUpstreamUnavailable{Service: "redis"}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	err := call(ctx)
+	breaker.record(c.addr, err == nil || errors.Is(err, redis.Nil))
+	return err
+}
+
+// get returns the cached value for key if present and not expired
+func (c *redisCache[V]) get(key string) (V, bool) {
+	var value V
+	var data []byte
+	err := c.do(func(ctx context.Context) error {
+		var err error
+		data, err = c.client.Get(ctx, c.prefix+key).Bytes()
+		return err
+	})
+	if err != nil {
+		if _, open := err.(*ErrUpstreamUnavailable); !open && !errors.Is(err, redis.Nil) {
+			upstreamLog.Warn("Redis cache lookup failed", "error", err)
+		}
+		c.stats.misses.Add(1)
+		return value, false
+	}
+	if err := json.Unmarshal(data, &value); err != nil {
+		upstreamLog.Warn("Invalid Redis cache entry", "key", c.prefix+key, "error", err)
+		c.stats.misses.Add(1)
+		return value, false
+	}
+	c.stats.hits.Add(1)
+	return value, true
+}
+
+// set stores value under key
+func (c *redisCache[V]) set(key string, value V) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		upstreamLog.Warn("Error encoding Redis cache entry", "error", err)
+		return
+	}
+	err = c.do(func(ctx context.Context) error {
+		return c.client.Set(ctx, c.prefix+key, data, c.ttl).Err()
+	})
+	if _, open := err.(*ErrUpstreamUnavailable); err != nil && !open {
+		upstreamLog.Warn("Redis cache update failed", "error", err)
+	}
+}
@@ -0,0 +1,143 @@
+package nav
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"sync"
+	"sync/atomic"
+)
+
+// navState is a configuration and the state built from it, replaced as a
+// whole on reload. Each request keeps the one it arrived with to the end. State
+// shared across reloads, such as API keys, abbreviations, circuit breakers,
+// stored routes, and GTFS feeds, is updated alongside it, so a request arriving
+// mid-reload may see those change before its configuration does.
+type navState struct {
+	cfg          NavConfig
+	geocodeCache responseCache[[]GeocodeResponse] // Recent geocoding results, nil when disabled
+	routeCache   responseCache[*cachedRoute]      // Recent walking, biking, and driving routes, nil when disabled. Transit routes depend on the time and aren't cached.
+	upstream     *upstreamClients
+	redis        *sharedRedisClient // Used by the caches, nil when caching in memory
+
+	refs      atomic.Int64 // Requests using the state
+	retired   atomic.Bool  // Replaced by a reload
+	closeOnce sync.Once
+}
+
+// acquireState returns the current state, counted as in use until released
+// so nothing it owns is closed under a request
+func acquireState() *navState {
+	for {
+		st := state.Load()
+		st.refs.Add(1)
+		if !st.retired.Load() {
+			return st
+		}
+		// Replaced in the meantime, so take the new one
+		st.release()
+	}
+}
+
+// release ends a request's use of a state
+func (st *navState) release() {
+	if st.refs.Add(-1) == 0 && st.retired.Load() {
+		st.closeOnce.Do(st.close)
+	}
+}
+
+// retire marks a replaced state, closing what it holds once the last request
+// using it finishes
+func (st *navState) retire() {
+	st.retired.Store(true)
+	if st.refs.Load() == 0 {
+		st.closeOnce.Do(st.close)
+	}
+}
+
+func (st *navState) close() {
+	if st.redis != nil {
+		st.redis.release()
+	}
+}
+
+var (
+	// configMu serializes replacing the configuration; requests never take it
+	configMu sync.Mutex
+	state    atomic.Pointer[navState]
+)
+
+func init() {
+	state.Store(&navState{upstream: newUpstreamClients(0, UpstreamConfig{}, upstreamTransport)})
+}
+
+type stateContextKey struct{}
+
+// WithConfig gives each request the configuration in effect when it arrived,
+// so a reload never changes settings partway through one and never waits for
+// requests to finish
+func WithConfig(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		st := acquireState()
+		defer st.release()
+		ctx := context.WithValue(r.Context(), stateContextKey{}, st)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// stateFor returns the state the request ctx belongs to is served with, or
+// the current state outside of requests
+func stateFor(ctx context.Context) *navState {
+	if st, ok := ctx.Value(stateContextKey{}).(*navState); ok {
+		return st
+	}
+	return state.Load()
+}
+
+// configFor returns the configuration the request ctx belongs to is served with
+func configFor(ctx context.Context) *NavConfig {
+	return &stateFor(ctx).cfg
+}
+
+// currentConfig returns the configuration in effect, for work outside of
+// requests such as loading data files
+func currentConfig() *NavConfig {
+	return &state.Load().cfg
+}
+
+// CheckConfig checks the parts of a configuration that are only read when it's
+// applied, such as the API key file
+func CheckConfig(cfg NavConfig) error {
+	_, err := buildAPIKeys(cfg)
+	return err
+}
+
+// ReloadConfig replaces the navigation configuration while the server is
+// running. API keys and any changed GTFS feeds are loaded first, so an error
+// leaves the current configuration in place. Requests already in flight finish
+// with the configuration they started with.
+func ReloadConfig(cfg NavConfig) error {
+	keys, err := buildAPIKeys(cfg)
+	if err != nil {
+		return err
+	}
+
+	feedsChanged := !slices.Equal(cfg.GTFSFeeds, currentConfig().GTFSFeeds)
+	var feed *gtfsFeed
+	if feedsChanged {
+		if feed, err = loadGTFSFeeds(cfg.GTFSFeeds); err != nil {
+			return err
+		}
+	}
+
+	configMu.Lock()
+	defer configMu.Unlock()
+	setConfig(cfg)
+	setAPIKeys(keys)
+	if feedsChanged {
+		gtfsMu.Lock()
+		gtfsData = feed
+		gtfsMu.Unlock()
+	}
+	return nil
+}
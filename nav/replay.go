@@ -0,0 +1,179 @@
+package nav
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"unicode/utf8"
+)
+
+// errNotRecorded is returned in replay mode for upstream calls with no
+// recording, and isn't retried
+var errNotRecorded = errors.New("no recorded response")
+
+// recordedExchange is an upstream request and its response as saved on disk.
+// Bodies that aren't UTF-8 text, such as map tiles and GTFS-Realtime feeds,
+// are kept base64 encoded.
+type recordedExchange struct {
+	Method      string      `json:"method"`
+	URL         string      `json:"url"` // With API keys redacted
+	RequestBody string      `json:"requestBody,omitempty"`
+	Status      int         `json:"status"`
+	Header      http.Header `json:"header"`
+	Body        string      `json:"body,omitempty"`
+	BodyBase64  []byte      `json:"bodyBase64,omitempty"`
+}
+
+// upstreamRoundTripper returns the transport upstream calls go through:
+// the network, the network with each exchange recorded to cfg.Record, or
+// recordings replayed from cfg.Replay
+func upstreamRoundTripper(cfg UpstreamConfig, network http.RoundTripper) http.RoundTripper {
+	switch {
+	case cfg.Replay != "":
+		return &replayTransport{dir: cfg.Replay}
+	case cfg.Record != "":
+		return &recordingTransport{next: network, dir: cfg.Record}
+	}
+	return network
+}
+
+// exchangeFile names the file an exchange is recorded in, from a hash of the
+// method, URL without API keys, and request body, so recordings made with one
+// key replay with another
+func exchangeFile(dir, method, redactedURL string, body []byte) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%s\n", method, redactedURL)
+	h.Write(body)
+	return filepath.Join(dir, hex.EncodeToString(h.Sum(nil))[:16]+".json")
+}
+
+// requestBody reads a request's body without consuming it, returning the
+// request to send on in its place
+func requestBody(req *http.Request) ([]byte, *http.Request, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, req, nil
+	}
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, nil, err
+		}
+		defer body.Close()
+		data, err := io.ReadAll(body)
+		return data, req, err
+	}
+	data, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, nil, err
+	}
+	req = req.Clone(req.Context())
+	req.Body = io.NopCloser(bytes.NewReader(data))
+	return data, req, nil
+}
+
+// recordingTransport saves each upstream exchange to a directory as it
+// passes it through to the network
+type recordingTransport struct {
+	next http.RoundTripper
+	dir  string
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	reqBody, req, err := requestBody(req)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	exchange := recordedExchange{
+		Method:      req.Method,
+		URL:         redactURL(req.URL.String()),
+		RequestBody: string(reqBody),
+		Status:      resp.StatusCode,
+		Header:      resp.Header,
+	}
+	if utf8.Valid(body) {
+		exchange.Body = string(body)
+	} else {
+		exchange.BodyBase64 = body
+	}
+	if err := t.save(exchange, reqBody); err != nil {
+		upstreamLog.WarnContext(req.Context(), "Failed to record upstream response", "url", exchange.URL, "error", err)
+	}
+	return resp, nil
+}
+
+// save writes an exchange to its file, replacing any earlier recording
+func (t *recordingTransport) save(exchange recordedExchange, reqBody []byte) error {
+	if err := os.MkdirAll(t.dir, 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(exchange, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(exchangeFile(t.dir, exchange.Method, exchange.URL, reqBody), data, 0o644)
+}
+
+// replayTransport answers upstream calls from recordings, without touching
+// the network
+type replayTransport struct {
+	dir string
+}
+
+func (t *replayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	reqBody, _, err := requestBody(req)
+	if err != nil {
+		return nil, err
+	}
+	if req.Body != nil {
+		req.Body.Close()
+	}
+
+	redacted := redactURL(req.URL.String())
+	data, err := os.ReadFile(exchangeFile(t.dir, req.Method, redacted, reqBody))
+	if errors.Is(err, os.ErrNotExist) {
+		upstreamLog.WarnContext(req.Context(), "No recorded upstream response", "method", req.Method, "url", redacted)
+		return nil, fmt.Errorf("%w for %s %s", errNotRecorded, req.Method, redacted)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var exchange recordedExchange
+	if err := json.Unmarshal(data, &exchange); err != nil {
+		return nil, fmt.Errorf("invalid recording for %s %s: %v", req.Method, redacted, err)
+	}
+
+	body := []byte(exchange.Body)
+	if exchange.BodyBase64 != nil {
+		body = exchange.BodyBase64
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", exchange.Status, http.StatusText(exchange.Status)),
+		StatusCode:    exchange.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        exchange.Header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
@@ -0,0 +1,148 @@
+package nav
+
+import (
+	"strings"
+	"unicode"
+)
+
+// greekLetters romanizes lowercase Greek letters, following ELOT 743 loosely
+var greekLetters = map[rune]string{
+	'α': "a", 'β': "v", 'γ': "g", 'δ': "d", 'ε': "e", 'ζ': "z", 'η': "i", 'θ': "th",
+	'ι': "i", 'κ': "k", 'λ': "l", 'μ': "m", 'ν': "n", 'ξ': "x", 'ο': "o", 'π': "p",
+	'ρ': "r", 'σ': "s", 'ς': "s", 'τ': "t", 'υ': "y", 'φ': "f", 'χ': "ch", 'ψ': "ps",
+	'ω': "o", 'ά': "a", 'έ': "e", 'ή': "i", 'ί': "i", 'ό': "o", 'ύ': "y", 'ώ': "o",
+	'ϊ': "i", 'ϋ': "y", 'ΐ': "i", 'ΰ': "y",
+}
+
+// cyrillicLetters romanizes lowercase Russian, Ukrainian, and Belarusian letters,
+// following BGN/PCGN loosely
+var cyrillicLetters = map[rune]string{
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "yo", 'ж': "zh",
+	'з': "z", 'и': "i", 'й': "y", 'к': "k", 'л': "l", 'м': "m", 'н': "n", 'о': "o",
+	'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u", 'ф': "f", 'х': "kh", 'ц': "ts",
+	'ч': "ch", 'ш': "sh", 'щ': "shch", 'ъ': "", 'ы': "y", 'ь': "", 'э': "e", 'ю': "yu",
+	'я': "ya", 'і': "i", 'ї': "yi", 'є': "ye", 'ґ': "g", 'ў': "w",
+}
+
+// kana romanizes hiragana from U+3041 in Hepburn. Katakana are the same letters
+// 0x60 later. The small tsu is empty because it doubles the next consonant.
+var kana = []string{
+	"a", "a", "i", "i", "u", "u", "e", "e", "o", "o",
+	"ka", "ga", "ki", "gi", "ku", "gu", "ke", "ge", "ko", "go",
+	"sa", "za", "shi", "ji", "su", "zu", "se", "ze", "so", "zo",
+	"ta", "da", "chi", "ji", "", "tsu", "zu", "te", "de", "to", "do",
+	"na", "ni", "nu", "ne", "no",
+	"ha", "ba", "pa", "hi", "bi", "pi", "fu", "bu", "pu", "he", "be", "pe", "ho", "bo", "po",
+	"ma", "mi", "mu", "me", "mo",
+	"ya", "ya", "yu", "yu", "yo", "yo",
+	"ra", "ri", "ru", "re", "ro",
+	"wa", "wa", "i", "e", "o", "n", "vu", "ka", "ke",
+}
+
+// Kana with special roles when romanizing
+const (
+	smallTsu = 0x3063
+	smallYa  = 0x3083
+	smallYu  = 0x3085
+	smallYo  = 0x3087
+	longMark = 0x30FC // Katakana vowel lengthening
+)
+
+// Hangul syllables are built from an initial consonant, a vowel, and an optional
+// final consonant, romanized here in the Revised Romanization without the
+// sound changes between syllables
+var (
+	hangulInitials = []string{"g", "kk", "n", "d", "tt", "r", "m", "b", "pp", "s", "ss", "", "j", "jj", "ch", "k", "t", "p", "h"}
+	hangulVowels   = []string{"a", "ae", "ya", "yae", "eo", "e", "yeo", "ye", "o", "wa", "wae", "oe", "yo", "u", "wo", "we", "wi", "yu", "eu", "ui", "i"}
+	hangulFinals   = []string{"", "k", "k", "k", "n", "n", "n", "t", "l", "k", "m", "l", "l", "l", "p", "l", "m", "p", "p", "t", "t", "ng", "t", "t", "k", "t", "p", "t"}
+)
+
+// kanaIndex returns a kana's position in the kana table, or -1 for anything else
+func kanaIndex(r rune) int {
+	if r >= 0x30A1 && r <= 0x30F6 {
+		r -= 0x60 // Katakana to hiragana
+	}
+	if r >= 0x3041 && int(r-0x3041) < len(kana) {
+		return int(r - 0x3041)
+	}
+	return -1
+}
+
+// romanize spells out the letter at runes[i] in ASCII for scripts that can be
+// romanized letter by letter: Greek, Cyrillic, Japanese kana, and Hangul. It
+// returns the romanization and the number of runes used, which is 0 for
+// letters it can't romanize, like Chinese characters.
+func romanize(runes []rune, i int) (string, int) {
+	r := runes[i]
+	lower := unicode.ToLower(r)
+
+	if roman, ok := greekLetters[lower]; ok {
+		return matchCase(roman, r), 1
+	}
+	if roman, ok := cyrillicLetters[lower]; ok {
+		return matchCase(roman, r), 1
+	}
+
+	if r >= 0xAC00 && r <= 0xD7A3 {
+		s := int(r - 0xAC00)
+		return hangulInitials[s/588] + hangulVowels[s%588/28] + hangulFinals[s%28], 1
+	}
+
+	if r == longMark {
+		return "", 1
+	}
+	if kanaIndex(r) >= 0 {
+		return romanizeKana(runes, i)
+	}
+	return "", 0
+}
+
+// romanizeKana romanizes the kana at runes[i], taking in a following small ya,
+// yu, or yo, and doubling the next consonant after a small tsu
+func romanizeKana(runes []rune, i int) (string, int) {
+	if kanaIndex(runes[i]) == smallTsu-0x3041 {
+		if i+1 < len(runes) && kanaIndex(runes[i+1]) >= 0 {
+			next, n := romanizeKana(runes, i+1)
+			if strings.HasPrefix(next, "ch") {
+				return "t" + next, n + 1
+			}
+			if next != "" && !strings.ContainsRune("aeiou", rune(next[0])) {
+				return next[:1] + next, n + 1
+			}
+			return next, n + 1
+		}
+		return "", 1
+	}
+
+	roman := kana[kanaIndex(runes[i])]
+	if i+1 >= len(runes) || !strings.HasSuffix(roman, "i") || len(roman) < 2 {
+		return roman, 1
+	}
+
+	var vowel string
+	switch kanaIndex(runes[i+1]) {
+	case smallYa - 0x3041:
+		vowel = "a"
+	case smallYu - 0x3041:
+		vowel = "u"
+	case smallYo - 0x3041:
+		vowel = "o"
+	default:
+		return roman, 1
+	}
+
+	// きゃ is kya, but しゃ is sha and じゃ is ja
+	base := roman[:len(roman)-1]
+	if base == "sh" || base == "ch" || base == "j" {
+		return base + vowel, 2
+	}
+	return base + "y" + vowel, 2
+}
+
+// matchCase capitalizes a romanization when the letter it came from is uppercase
+func matchCase(roman string, r rune) string {
+	if roman == "" || !unicode.IsUpper(r) {
+		return roman
+	}
+	return strings.ToUpper(roman[:1]) + roman[1:]
+}
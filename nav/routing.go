@@ -2,14 +2,21 @@ package nav
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"math"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // Valhalla URL is configured in config.json
@@ -29,9 +36,12 @@ type valhallaRequest struct {
 }
 
 type valhallaManeuver struct {
-	Type        int     `json:"type"`
-	Instruction string  `json:"instruction"`
-	Distance    float64 `json:"length"`
+	Type            int      `json:"type"`
+	Instruction     string   `json:"instruction"`
+	Distance        float64  `json:"length"`
+	StreetNames     []string `json:"street_names"`
+	BeginShapeIndex int      `json:"begin_shape_index"`
+	EndShapeIndex   int      `json:"end_shape_index"`
 }
 
 type valhallaLeg struct {
@@ -66,7 +76,19 @@ type transitlandResponse struct {
 			WalkTime     float64 `json:"walkTime"`     // seconds
 			TransitTime  float64 `json:"transitTime"`  // seconds
 			WalkDistance float64 `json:"walkDistance"` // meters
-			Legs         []struct {
+			StartTime    int64   `json:"startTime"`    // milliseconds since epoch
+			EndTime      int64   `json:"endTime"`      // milliseconds since epoch
+			Fare         struct {
+				Fare struct {
+					Regular struct {
+						Currency struct {
+							CurrencyCode string `json:"currencyCode"`
+						} `json:"currency"`
+						Cents int `json:"cents"`
+					} `json:"regular"`
+				} `json:"fare"`
+			} `json:"fare"`
+			Legs []struct {
 				Mode     string  `json:"mode"`
 				Distance float64 `json:"distance"` // meters
 				Duration float64 `json:"duration"` // seconds
@@ -74,12 +96,16 @@ type transitlandResponse struct {
 					Name     string `json:"name"`     // station/stop name
 					StopId   string `json:"stopId"`   // stop ID
 					StopCode string `json:"stopCode"` // stop code
+					ZoneId   string `json:"zoneId"`   // fare zone
 				} `json:"from"`
 				To struct {
 					Name     string `json:"name"`     // station/stop name
 					StopId   string `json:"stopId"`   // stop ID
 					StopCode string `json:"stopCode"` // stop code
+					ZoneId   string `json:"zoneId"`   // fare zone
 				} `json:"to"`
+				StartTime      int64  `json:"startTime"`      // milliseconds since epoch
+				EndTime        int64  `json:"endTime"`        // milliseconds since epoch
 				RouteId        string `json:"routeId"`        // route ID
 				RouteShortName string `json:"routeShortName"` // route number
 				RouteLongName  string `json:"routeLongName"`  // route name
@@ -100,6 +126,13 @@ type transitlandResponse struct {
 					RelativeDirection string  `json:"relativeDirection"`
 					StreetName        string  `json:"streetName"`
 				} `json:"steps"`
+				Alerts []struct {
+					AlertHeaderText      string `json:"alertHeaderText"`
+					AlertDescriptionText string `json:"alertDescriptionText"`
+					AlertURL             string `json:"alertUrl"`
+					EffectiveStartDate   int64  `json:"effectiveStartDate"` // milliseconds since epoch
+					EffectiveEndDate     int64  `json:"effectiveEndDate"`   // milliseconds since epoch
+				} `json:"alerts"`
 			} `json:"legs"`
 		} `json:"itineraries"`
 	} `json:"plan"`
@@ -149,20 +182,39 @@ func convertDistance(meters float64, units DistanceUnit) float64 {
 	return meters / 1000 // convert to kilometers
 }
 
+// toMeters converts a distance in the given units back to meters
+func toMeters(distance float64, units DistanceUnit) float64 {
+	if units == UnitMiles {
+		return distance * metersPerMile
+	}
+	return distance * 1000
+}
+
+// Polyline precisions used by upstream services
+const (
+	polylinePrecision5 = 5 // Google-style polylines, as returned by OpenTripPlanner
+	polylinePrecision6 = 6 // Valhalla route shapes
+)
+
 func decodePolyline(encoded string) []PathPoint {
 	if encoded == "" {
 		return []PathPoint{}
 	}
 
-	// Use precision of 5 for Valhalla coordinates
-	precision := 5
+	// Use precision of 5 for Valhalla coordinates; the path is normalized,
+	// so the scale doesn't matter here
+	return normalizePath(decodePolylineCoords(encoded, polylinePrecision5))
+}
+
+// decodePolylineCoords decodes an encoded polyline into [lat, lng] pairs
+func decodePolylineCoords(encoded string, precision int) [][2]float64 {
 	factor := math.Pow10(precision)
 
 	lat, lng := 0, 0
 	var rawPoints [][2]float64
 	index := 0
 
-	// First pass: decode all points
+	// Decode all points
 	for index < len(encoded) {
 		// Consume varint bits for lat until we run out
 		var byte int = 0x20
@@ -204,10 +256,18 @@ func decodePolyline(encoded string) []PathPoint {
 		rawPoints = append(rawPoints, [2]float64{actualLat, actualLng})
 	}
 
-	if len(rawPoints) == 0 {
-		return []PathPoint{}
-	}
+	return rawPoints
+}
+
+// gridProjection maps [lat, lng] pairs onto the normalized grid
+type gridProjection struct {
+	minLat, minLng     float64
+	latRange, lngRange float64
+	width, height      int // Grid size, NormalizedGridSize unless a client asked for another
+}
 
+// newGridProjection fits the normalized grid to the bounds of a set of points
+func newGridProjection(rawPoints [][2]float64) gridProjection {
 	// Find bounds
 	minLat := rawPoints[0][0]
 	maxLat := rawPoints[0][0]
@@ -231,23 +291,128 @@ func decodePolyline(encoded string) []PathPoint {
 		lngRange = 1 // Avoid division by zero
 	}
 
-	// Second pass: normalize points and remove duplicates and near-duplicates
+	return gridProjection{minLat: minLat, minLng: minLng, latRange: latRange, lngRange: lngRange,
+		width: NormalizedGridSize, height: NormalizedGridSize}
+}
+
+// preservingAspect returns a copy of the projection with one axis widened so
+// ground distances match the grid's proportions, centering the points, so the
+// path keeps its real shape
+func (g gridProjection) preservingAspect() gridProjection {
+	// Degrees of longitude shrink toward the poles
+	lngScale := math.Cos((g.minLat + g.latRange/2) * math.Pi / 180)
+	if lngScale <= 0 {
+		return g
+	}
+	width, height := g.lngRange*lngScale, g.latRange
+	gridAspect := float64(g.width) / float64(g.height)
+	if width < height*gridAspect {
+		lngRange := height * gridAspect / lngScale
+		g.minLng -= (lngRange - g.lngRange) / 2
+		g.lngRange = lngRange
+	} else {
+		latRange := width / gridAspect
+		g.minLat -= (latRange - g.latRange) / 2
+		g.latRange = latRange
+	}
+	return g
+}
+
+// project normalizes a point to the grid, clamping points outside the bounds to its edges
+func (g gridProjection) project(lat, lng float64) PathPoint {
+	x := int(math.Round((lng - g.minLng) / g.lngRange * float64(g.width)))
+	y := int(math.Round((lat - g.minLat) / g.latRange * float64(g.height)))
+
+	// Ensure points are within bounds
+	x = max(0, min(g.width, x))
+	y = max(0, min(g.height, y))
+	return PathPoint{x, y}
+}
+
+// deltaEncodePath returns a copy of a path with each point after the first replaced
+// by its offset from the previous point. On grids up to 127 across, including the
+// default normalized grid, the offsets fit in a signed byte.
+func deltaEncodePath(path Path) Path {
+	points := make([]PathPoint, len(path.Points))
+	for i, p := range path.Points {
+		if i == 0 {
+			points[i] = p
+			continue
+		}
+		prev := path.Points[i-1]
+		points[i] = PathPoint{p[0] - prev[0], p[1] - prev[1]}
+	}
+	path.Points = points
+	path.Encoding = PathEncodingDelta
+	return path
+}
+
+// simplifyPath drops points that lie within tolerance grid units of the line
+// through their neighbors, using the Douglas-Peucker algorithm. The first and
+// last points are always kept.
+func simplifyPath(points []PathPoint, tolerance float64) []PathPoint {
+	if len(points) < 3 {
+		return points
+	}
+
+	// Find the point farthest from the line between the endpoints
+	first, last := points[0], points[len(points)-1]
+	farthest, maxDist := 0, 0.0
+	for i := 1; i < len(points)-1; i++ {
+		if d := lineDistance(points[i], first, last); d > maxDist {
+			farthest, maxDist = i, d
+		}
+	}
+	if maxDist <= tolerance {
+		return []PathPoint{first, last}
+	}
+
+	left := simplifyPath(points[:farthest+1], tolerance)
+	right := simplifyPath(points[farthest:], tolerance)
+	return append(left[:len(left):len(left)], right[1:]...)
+}
+
+// lineDistance returns the distance from p to the segment a-b in grid units
+func lineDistance(p, a, b PathPoint) float64 {
+	dx, dy := float64(b[0]-a[0]), float64(b[1]-a[1])
+	px, py := float64(p[0]-a[0]), float64(p[1]-a[1])
+	lengthSquared := dx*dx + dy*dy
+	if lengthSquared == 0 {
+		return math.Hypot(px, py)
+	}
+	t := math.Max(0, math.Min(1, (px*dx+py*dy)/lengthSquared))
+	return math.Hypot(px-t*dx, py-t*dy)
+}
+
+// fitPath simplifies a path with increasing tolerance until it has at most maxPoints points
+func fitPath(points []PathPoint, maxPoints int) []PathPoint {
+	for tolerance := 1.0; len(points) > maxPoints; tolerance++ {
+		points = simplifyPath(points, tolerance)
+	}
+	return points
+}
+
+// normalizePath scales [lat, lng] pairs onto the normalized grid, dropping near-duplicates
+func normalizePath(rawPoints [][2]float64) []PathPoint {
+	if len(rawPoints) == 0 {
+		return []PathPoint{}
+	}
+	return projectPath(rawPoints, newGridProjection(rawPoints))
+}
+
+// projectPath maps [lat, lng] pairs onto the grid with a projection, dropping near-duplicates
+func projectPath(rawPoints [][2]float64, grid gridProjection) []PathPoint {
+	// Normalize points and remove duplicates and near-duplicates
 	var normalizedPoints []PathPoint
 
 	for _, p := range rawPoints {
-		// Normalize to 100x100 grid
-		x := int(math.Round((p[1] - minLng) / lngRange * float64(NormalizedGridSize)))
-		y := int(math.Round((p[0] - minLat) / latRange * float64(NormalizedGridSize)))
-
-		// Ensure points are within bounds
-		x = max(0, min(NormalizedGridSize, x))
-		y = max(0, min(NormalizedGridSize, y))
+		point := grid.project(p[0], p[1])
 
 		// Check if this point is too close to any existing point
 		isDuplicate := false
 		for _, existing := range normalizedPoints {
 			// Calculate Manhattan distance
-			dist := abs(x-existing[0]) + abs(y-existing[1])
+			dist := abs(point[0]-existing[0]) + abs(point[1]-existing[1])
 			if dist <= 2 { // Points within 2 units of each other
 				isDuplicate = true
 				break
@@ -255,7 +420,7 @@ func decodePolyline(encoded string) []PathPoint {
 		}
 
 		if !isDuplicate {
-			normalizedPoints = append(normalizedPoints, PathPoint{x, y})
+			normalizedPoints = append(normalizedPoints, point)
 		}
 	}
 
@@ -297,28 +462,82 @@ func formatUSDistance(meters float64) string {
 	return fmt.Sprintf("%.1f miles", miles)
 }
 
-func routeTransitUS(req RouteRequest) (*RouteResponse, error) {
-	if navConfig.TransitlandURL == "" || navConfig.TransitlandAPIKey == "" {
+// walkSummary is the compact form of a walking leg, e.g. "WALK 400m -> Clark/Lake"
+func walkSummary(meters float64, to string, units DistanceUnit) string {
+	summary := "WALK " + formatDistance(convertDistance(meters, units), units)
+	if to != "" {
+		summary += " -> " + to
+	}
+	return summary
+}
+
+// rideSummary is the compact form of a transit leg, e.g. "BUS 38 -> Clark/Lake (12 stops)".
+// Arrows are ASCII since 8-bit character sets don't have one.
+func rideSummary(mode, route, to string, stops int) string {
+	summary := strings.ToUpper(mode)
+	if route != "" {
+		summary += " " + route
+	}
+	if to != "" {
+		summary += " -> " + to
+	}
+	switch {
+	case stops == 1:
+		summary += " (1 stop)"
+	case stops > 1:
+		summary += fmt.Sprintf(" (%d stops)", stops)
+	}
+	return summary
+}
+
+func routeTransitUS(ctx context.Context, req RouteRequest, depart time.Time) (*RouteResponse, error) {
+	if configFor(ctx).TransitlandURL == "" || configFor(ctx).TransitlandAPIKey == "" {
 		return nil, fmt.Errorf("transitland configuration not complete")
 	}
 
-	// Build query parameters
-	now := time.Now()
+	// Build query parameters, with the date and time local to the origin
 	params := url.Values{
-		"api_key":   {navConfig.TransitlandAPIKey},
+		"api_key":   {configFor(ctx).TransitlandAPIKey},
 		"fromPlace": {fmt.Sprintf("%.6f,%.6f", req.FromLat, req.FromLng)},
 		"toPlace":   {fmt.Sprintf("%.6f,%.6f", req.ToLat, req.ToLng)},
-		"date":      {now.Format("2006-01-02")},
-		"time":      {now.Format("15:04")},
+		"date":      {depart.Format("2006-01-02")},
+		"time":      {depart.Format("15:04")},
+	}
+	if req.MaxTransfers != nil {
+		params.Set("maxTransfers", strconv.Itoa(*req.MaxTransfers))
+	}
+	if req.MaxWalk > 0 {
+		params.Set("maxWalkDistance", strconv.FormatFloat(req.MaxWalk, 'f', 0, 64))
+	}
+	if req.Wheelchair {
+		params.Set("wheelchair", "true")
+	}
+	if req.Mode == ModeParkRide {
+		params.Set("mode", "CAR_PARK,WALK,TRANSIT")
+	}
+	if len(req.BannedRoutes) > 0 {
+		params.Set("bannedRoutes", strings.Join(req.BannedRoutes, ","))
+	}
+	if len(req.PreferredRoutes) > 0 {
+		params.Set("preferredRoutes", strings.Join(req.PreferredRoutes, ","))
+	}
+	if len(req.BannedAgencies) > 0 {
+		params.Set("bannedAgencies", strings.Join(req.BannedAgencies, ","))
+	}
+	if len(req.PreferredAgencies) > 0 {
+		params.Set("preferredAgencies", strings.Join(req.PreferredAgencies, ","))
 	}
 
 	// Create request URL with query parameters
-	apiURL := fmt.Sprintf("%s/routing/otp/plan?%s", navConfig.TransitlandURL, params.Encode())
-	fmt.Printf("Debug: Making request to %s\n", apiURL)
+	apiURL := fmt.Sprintf("%s/routing/otp/plan?%s", configFor(ctx).TransitlandURL, params.Encode())
+	transitLog.DebugContext(ctx, "Planning transit route", "url", redactURL(apiURL))
 
 	// Make GET request
-	resp, err := http.Get(apiURL)
+	resp, err := upstreamGet(ctx, apiURL)
 	if err != nil {
+		if _, ok := err.(*ErrUpstreamUnavailable); ok {
+			return nil, err
+		}
 		return nil, fmt.Errorf("error making request to transitland: %v", err)
 	}
 	defer resp.Body.Close()
@@ -350,6 +569,7 @@ func routeTransitUS(req RouteRequest) (*RouteResponse, error) {
 		Distance: convertDistance(itinerary.WalkDistance, req.Units), // Convert walk distance to requested units
 		Units:    req.Units,
 		Mode:     req.Mode,
+		Provider: "transitland",
 		From: Location{
 			Desc: req.FromDesc,
 			Lat:  req.FromLat,
@@ -362,12 +582,25 @@ func routeTransitUS(req RouteRequest) (*RouteResponse, error) {
 		},
 	}
 
+	start, end := depart, depart.Add(time.Duration(itinerary.Duration)*time.Second)
+	if itinerary.StartTime > 0 && itinerary.EndTime > 0 {
+		start = time.UnixMilli(itinerary.StartTime).In(depart.Location())
+		end = time.UnixMilli(itinerary.EndTime).In(depart.Location())
+	}
+	setTransitTimes(result, start, end)
+
 	// Process legs and build path
 	var allPoints []PathPoint
+	var trackPoints [][2]float64
+	var trackSteps []trackStep
+	farePending := itinerary.Fare.Fare.Regular.Cents > 0
 	for i, leg := range itinerary.Legs {
 		// Create step description based on mode
 		var description string
+		var summary string
 		var icon string
+		var wheelchair string
+		var boards, alights time.Time
 		switch leg.Mode {
 		case "WALK":
 			if req.Country == "us" {
@@ -378,7 +611,22 @@ func routeTransitUS(req RouteRequest) (*RouteResponse, error) {
 			if leg.To.Name != "" {
 				description += fmt.Sprintf(" to %s", leg.To.Name)
 			}
+			summary = walkSummary(leg.Distance, leg.To.Name, req.Units)
 			icon = "Walk"
+		case "CAR":
+			if req.Country == "us" {
+				description = fmt.Sprintf("Drive %s", formatUSDistance(leg.Distance))
+			} else {
+				description = fmt.Sprintf("Drive %.0f meters", leg.Distance)
+			}
+			if leg.To.Name != "" {
+				description += fmt.Sprintf(" and park at %s", leg.To.Name)
+			}
+			summary = "DRIVE " + formatDistance(convertDistance(leg.Distance, req.Units), req.Units)
+			if leg.To.Name != "" {
+				summary += " -> " + leg.To.Name
+			}
+			icon = "Drive"
 		case "BUS", "RAIL", "SUBWAY", "TRAM", "FERRY":
 			description = fmt.Sprintf("Take")
 			if leg.RouteShortName != "" {
@@ -390,13 +638,40 @@ func routeTransitUS(req RouteRequest) (*RouteResponse, error) {
 			if leg.AgencyName != "" {
 				description += fmt.Sprintf(" operated by %s", leg.AgencyName)
 			}
+			if leg.StartTime > 0 && leg.EndTime > 0 {
+				boards = time.UnixMilli(leg.StartTime).In(depart.Location())
+				alights = time.UnixMilli(leg.EndTime).In(depart.Location())
+			}
+			if req.StepTimes && !boards.IsZero() {
+				description += " at " + clockTime(boards, req.TwelveHourClock)
+			}
 			if leg.From.Name != "" && leg.To.Name != "" {
 				description += fmt.Sprintf(" from %s to %s", leg.From.Name, leg.To.Name)
 			}
+			if req.StepTimes && !alights.IsZero() {
+				description += ", arriving " + clockTime(alights, req.TwelveHourClock)
+			}
 			if len(leg.IntermediateStops) > 0 {
 				description += fmt.Sprintf(" (%d stops)", len(leg.IntermediateStops))
 			}
+			// OTP prices the whole itinerary, so the fare goes on the first ride
+			var price string
+			if farePending {
+				regular := itinerary.Fare.Fare.Regular
+				price = formatFare(float64(regular.Cents)/100, regular.Currency.CurrencyCode)
+				farePending = false
+			}
+			if fares := fareDescription(leg.From.ZoneId, leg.To.ZoneId, price, ""); fares != "" {
+				description += "; " + fares
+			}
+			// Stops ridden, counting the one to get off at
+			summary = rideSummary(leg.Mode, leg.RouteShortName, leg.To.Name, len(leg.IntermediateStops)+1)
 			icon = getStepIcon(0, "", leg.Mode)
+			// OTP only returns accessible itineraries when asked, but doesn't say otherwise
+			wheelchair = "unknown"
+			if req.Wheelchair {
+				wheelchair = "yes"
+			}
 		default:
 			if req.Country == "us" {
 				description = fmt.Sprintf("%s for %s", leg.Mode, formatUSDistance(leg.Distance))
@@ -411,6 +686,28 @@ func routeTransitUS(req RouteRequest) (*RouteResponse, error) {
 			Description: description,
 			Distance:    convertDistance(leg.Distance, req.Units),
 			Icon:        icon,
+			Wheelchair:  wheelchair,
+			Summary:     summary,
+		}
+		if !boards.IsZero() {
+			step.DepartTime = boards.Format(time.RFC3339)
+			step.ArriveTime = alights.Format(time.RFC3339)
+		}
+		for _, stop := range leg.IntermediateStops {
+			step.Stops = append(step.Stops, stop.Name)
+		}
+		for _, a := range leg.Alerts {
+			alert := TransitAlert{
+				Header:      a.AlertHeaderText,
+				Description: a.AlertDescriptionText,
+				URL:         a.AlertURL,
+				Start:       alertTime(a.EffectiveStartDate / 1000),
+				End:         alertTime(a.EffectiveEndDate / 1000),
+			}
+			if leg.RouteId != "" {
+				alert.Routes = []string{leg.RouteId}
+			}
+			step.Alerts = append(step.Alerts, alert)
 		}
 		result.Steps = append(result.Steps, step)
 
@@ -418,8 +715,20 @@ func routeTransitUS(req RouteRequest) (*RouteResponse, error) {
 		if leg.LegGeometry.Points != "" {
 			points := decodePolyline(leg.LegGeometry.Points)
 			allPoints = append(allPoints, points...)
+
+			// Keep the full-resolution geometry for progress lookups
+			coords := decodePolylineCoords(leg.LegGeometry.Points, polylinePrecision5)
+			begin := len(trackPoints)
+			trackPoints = append(trackPoints, coords...)
+			trackSteps = append(trackSteps, trackStep{
+				Number: step.Number,
+				Street: description,
+				Begin:  begin,
+				End:    len(trackPoints) - 1,
+			})
 		}
 	}
+	storeRoute(result, newRouteTrack(trackPoints, trackSteps, req.Units))
 
 	// Set complete path
 	result.Path = Path{
@@ -432,20 +741,20 @@ func routeTransitUS(req RouteRequest) (*RouteResponse, error) {
 	return result, nil
 }
 
-func getRouteDetails(routeID string) (*transitlandRouteResponse, error) {
+func getRouteDetails(ctx context.Context, routeID string) (*transitlandRouteResponse, error) {
 	if routeID == "" {
 		return nil, fmt.Errorf("route ID is required")
 	}
 
 	params := url.Values{
-		"api_key": {navConfig.TransitlandAPIKey},
+		"api_key": {configFor(ctx).TransitlandAPIKey},
 		"ids":     {routeID},
 	}
 
-	apiURL := fmt.Sprintf("%s/routes?%s", navConfig.TransitlandURL, params.Encode())
-	fmt.Printf("Debug: Fetching route details from %s\n", apiURL)
+	apiURL := fmt.Sprintf("%s/routes?%s", configFor(ctx).TransitlandURL, params.Encode())
+	transitLog.DebugContext(ctx, "Fetching route details", "url", redactURL(apiURL))
 
-	resp, err := http.Get(apiURL)
+	resp, err := upstreamGet(ctx, apiURL)
 	if err != nil {
 		return nil, fmt.Errorf("error fetching route details: %v", err)
 	}
@@ -468,6 +777,37 @@ func getRouteDetails(routeID string) (*transitlandRouteResponse, error) {
 	return &routeResp, nil
 }
 
+// routeDetails looks up a transit route's display metadata
+func routeDetails(ctx context.Context, routeID string) (*TransitRouteDetails, error) {
+	routeResp, err := getRouteDetails(ctx, routeID)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(routeResp.Routes) == 0 {
+		return nil, &ErrNoResults{Query: routeID}
+	}
+
+	r := routeResp.Routes[0]
+	id := r.OnestopID
+	if id == "" {
+		id = r.ID
+	}
+	shortName := r.ShortName
+	if shortName == "" {
+		shortName = r.Name
+	}
+
+	return &TransitRouteDetails{
+		ID:          id,
+		ShortName:   shortName,
+		LongName:    r.LongName,
+		Color:       strings.TrimPrefix(r.Color, "#"),
+		VehicleType: getTransportModeName(r.VehicleType),
+		Operator:    r.Operator.Name,
+	}, nil
+}
+
 func getTransportModeName(vehicleType string) string {
 	switch strings.ToLower(vehicleType) {
 	case "bus":
@@ -497,33 +837,36 @@ func abbreviateInstruction(instruction string) string {
 
 	// Abbreviate common words
 	instruction = strings.ReplaceAll(instruction, " onto ", " on ")
-	instruction = strings.ReplaceAll(instruction, " Avenue", " Ave")
-	instruction = strings.ReplaceAll(instruction, " Street", " St")
-	instruction = strings.ReplaceAll(instruction, " Road", " Rd")
-	instruction = strings.ReplaceAll(instruction, " Boulevard", " Blvd")
-	instruction = strings.ReplaceAll(instruction, " Drive", " Dr")
-	instruction = strings.ReplaceAll(instruction, " Court", " Ct")
-	instruction = strings.ReplaceAll(instruction, " Circle", " Cir")
-	instruction = strings.ReplaceAll(instruction, " Highway", " Hwy")
-	instruction = strings.ReplaceAll(instruction, " Parkway", " Pkwy")
-	instruction = strings.ReplaceAll(instruction, " Place", " Pl")
-	instruction = strings.ReplaceAll(instruction, " Square", " Sq")
-	instruction = strings.ReplaceAll(instruction, " Terrace", " Ter")
-	instruction = strings.ReplaceAll(instruction, " Trail", " Trl")
-	instruction = strings.ReplaceAll(instruction, " Turnpike", " Tpke")
-	instruction = strings.ReplaceAll(instruction, " Lane", " Ln")
-	instruction = strings.ReplaceAll(instruction, " North ", " N ")
-	instruction = strings.ReplaceAll(instruction, " South ", " S ")
-	instruction = strings.ReplaceAll(instruction, " East ", " E ")
-	instruction = strings.ReplaceAll(instruction, " West ", " W ")
-	instruction = strings.ReplaceAll(instruction, " Northeast ", " NE ")
-	instruction = strings.ReplaceAll(instruction, " Northwest ", " NW ")
-	instruction = strings.ReplaceAll(instruction, " Southeast ", " SE ")
-	instruction = strings.ReplaceAll(instruction, " Southwest ", " SW ")
+
+	// Abbreviate capitalized street types anywhere and directions that aren't
+	// the last word, e.g. "Turn left on North Main Street" to "Turn left on N Main St"
+	words := strings.Split(instruction, " ")
+	for i := 1; i < len(words); i++ {
+		word := strings.TrimRight(words[i], ",;:")
+		punctuation := words[i][len(word):]
+		if r, _ := utf8.DecodeRuneInString(word); !unicode.IsUpper(r) {
+			continue
+		}
+		if short := abbreviateStreetType(word); short != word {
+			words[i] = short + punctuation
+		} else if i < len(words)-1 {
+			words[i] = abbreviateDirection(word) + punctuation
+		}
+	}
+	instruction = strings.Join(words, " ")
 
 	return instruction
 }
 
+// formatInstruction tidies a turn instruction for display, abbreviating it
+// unless the client asked for full text
+func formatInstruction(instruction string, abbreviate bool) string {
+	if abbreviate {
+		return abbreviateInstruction(instruction)
+	}
+	return strings.TrimSuffix(instruction, ".")
+}
+
 // getStepIcon determines the appropriate icon based on the maneuver type and mode
 func getStepIcon(maneuverType int, instruction string, mode string) string {
 	// For transit modes
@@ -564,10 +907,122 @@ func getStepIcon(maneuverType int, instruction string, mode string) string {
 
 }
 
-func route(req RouteRequest) (*RouteResponse, error) {
+// cachedRoute is a cached route with its track, so a route cached by another
+// instance can still be followed with progress lookups
+type cachedRoute struct {
+	Route *RouteResponse
+	Track *routeTrack // nil for routes without geometry
+}
+
+// routeCacheKey builds a cache key from a route's parameters, with coordinates
+// rounded to 5 decimal places (about a meter) so nearby fixes share routes
+func routeCacheKey(req RouteRequest) string {
+	coord := func(v float64) string {
+		return strconv.FormatFloat(v, 'f', 5, 64)
+	}
+	points := []string{coord(req.FromLat) + "," + coord(req.FromLng)}
+	for _, v := range req.Via {
+		points = append(points, coord(v[0])+","+coord(v[1]))
+	}
+	points = append(points, coord(req.ToLat)+","+coord(req.ToLng))
+
+	units := req.Units
+	if units == "" {
+		units = DefaultUnit
+	}
+	return strings.Join(points, ";") + "|" + string(req.Mode) + "|" + string(units) + "|" + string(req.Country) +
+		"|" + req.FromDesc + "|" + req.ToDesc + "|" + strconv.FormatBool(req.Unabbreviated)
+}
+
+// route plans a route, serving repeated walking, biking, and driving requests
+// from the cache when enabled
+func route(ctx context.Context, req RouteRequest) (result *RouteResponse, err error) {
+	ctx, span := startSpan(ctx, "plan route", attribute.String("mode", string(req.Mode)))
+	defer func() {
+		spanError(span, err)
+		span.End()
+	}()
+	routeCache := stateFor(ctx).routeCache
+	if routeCache == nil || req.Mode.usesTransit() {
+		return planRoute(ctx, req)
+	}
+
+	key := routeCacheKey(req)
+	if cached, ok := routeCache.get(key); ok {
+		routeLog.DebugContext(ctx, "Route cache hit", "key", key)
+		span.SetAttributes(attribute.Bool("cache_hit", true))
+		// Store the track again if it has expired here or was cached elsewhere
+		if cached.Track != nil {
+			if _, stored := routeStore.get(cached.Route.ID); !stored {
+				// In memory, the cached track may also be held by the route
+				// store and read by progress lookups, so store a copy
+				track := *cached.Track
+				track.Response = cached.Route
+				routeStore.set(cached.Route.ID, &track)
+			}
+		}
+		// Routes cached elsewhere come back without their track attached
+		if cached.Route.track == nil && cached.Track != nil {
+			withTrack := *cached.Route
+			withTrack.track = cached.Track
+			return &withTrack, nil
+		}
+		return cached.Route, nil
+	}
+
+	result, err = planRoute(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	cached := &cachedRoute{Route: result}
+	if track, ok := routeStore.get(result.ID); ok {
+		cached.Track = track
+	}
+	routeCache.set(key, cached)
+
+	return result, nil
+}
+
+// planRoute plans a route with local GTFS feeds, Transitland, or Valhalla, or
+// returns a canned one when providers are mocked
+func planRoute(ctx context.Context, req RouteRequest) (*RouteResponse, error) {
+	if req.Mode.usesTransit() && !configFor(ctx).ModuleEnabled(ModuleTransit) {
+		return nil, errTransitDisabled
+	}
+	if len(req.Via) > 0 && req.Mode.usesTransit() {
+		return nil, fmt.Errorf("waypoints are only supported for walking, biking, and driving")
+	}
+
+	// Transit times are planned in the origin's local time, whatever the server's timezone
+	var depart time.Time
+	if req.Mode.usesTransit() {
+		var err error
+		depart, err = departTime(req.Depart, timezoneAt(req.FromLat, req.FromLng), time.Now())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if mockProviders(ctx) {
+		return mockRoute(req, depart)
+	}
+	if req.Mode == ModeParkRide {
+		return routeParkRide(ctx, req, depart)
+	}
+
+	// Prefer local GTFS feeds for transit, falling back to online services when
+	// they have no direct trip
+	if req.Mode == ModeTransit {
+		if feed := currentGTFS(); feed != nil {
+			if result, err := routeTransitGTFS(ctx, feed, req, depart); err == nil {
+				return result, nil
+			}
+		}
+	}
+
 	// Check if this is a US transit request
-	if req.Mode == ModeTransit && req.Country == CountryCode("us") && navConfig.TransitlandURL != "" {
-		return routeTransitUS(req)
+	if req.Mode == ModeTransit && req.Country == CountryCode("us") && configFor(ctx).TransitlandURL != "" {
+		return routeTransitUS(ctx, req, depart)
 	}
 
 	// Validate units
@@ -577,22 +1032,17 @@ func route(req RouteRequest) (*RouteResponse, error) {
 		return nil, fmt.Errorf("invalid units: must be one of: %s, %s", UnitKilometers, UnitMiles)
 	}
 
-	// Create Valhalla request
+	// Create Valhalla request. Waypoints are via locations, which keep the
+	// route in one leg and allow turning around at them.
+	locations := []valhallaLocation{{Lat: req.FromLat, Lon: req.FromLng, Type: "break"}}
+	for _, v := range req.Via {
+		locations = append(locations, valhallaLocation{Lat: v[0], Lon: v[1], Type: "via"})
+	}
+	locations = append(locations, valhallaLocation{Lat: req.ToLat, Lon: req.ToLng, Type: "break"})
 	vReq := valhallaRequest{
-		Locations: []valhallaLocation{
-			{
-				Lat:  req.FromLat,
-				Lon:  req.FromLng,
-				Type: "break",
-			},
-			{
-				Lat:  req.ToLat,
-				Lon:  req.ToLng,
-				Type: "break",
-			},
-		},
-		Costing: getTransportMode(req.Mode),
-		Units:   getValhallaUnits(req.Units),
+		Locations: locations,
+		Costing:   getTransportMode(req.Mode),
+		Units:     getValhallaUnits(req.Units),
 		CostingOptions: map[string]interface{}{
 			"auto": map[string]interface{}{
 				"use_display_name": false,
@@ -610,8 +1060,8 @@ func route(req RouteRequest) (*RouteResponse, error) {
 	if req.Mode == ModeTransit {
 		// Add current date/time for transit routing
 		vReq.DateTime = map[string]interface{}{
-			"type":  1,                                     // Meaning depart at specified time
-			"value": time.Now().Format("2006-01-02T15:04"), // Current time in ISO format
+			"type":  1,                                 // Meaning depart at specified time
+			"value": depart.Format("2006-01-02T15:04"), // Local time at the origin in ISO format
 		}
 
 		// Add transit costing options
@@ -635,9 +1085,12 @@ func route(req RouteRequest) (*RouteResponse, error) {
 		return nil, fmt.Errorf("error marshaling request: %v", err)
 	}
 
-	// Make request to Valhalla
-	resp, err := http.Post(navConfig.ValhallaURL, "application/json", bytes.NewBuffer(reqBody))
+	// Make request to Valhalla, failing over to any fallback routers
+	resp, provider, err := postValhalla(ctx, reqBody)
 	if err != nil {
+		if _, ok := err.(*ErrUpstreamUnavailable); ok {
+			return nil, err
+		}
 		return nil, fmt.Errorf("error making request to Valhalla: %v", err)
 	}
 	defer resp.Body.Close()
@@ -665,7 +1118,7 @@ func route(req RouteRequest) (*RouteResponse, error) {
 				if req.Mode == ModeTransit {
 					// Switch to auto routing
 					req.Mode = ModeAuto
-					return route(req)
+					return route(ctx, req)
 				}
 				return nil, fmt.Errorf("no route found: locations are not connected in the transportation network")
 			default:
@@ -689,6 +1142,7 @@ func route(req RouteRequest) (*RouteResponse, error) {
 		Distance: convertDistance(vResp.Trip.Summary.Distance*1000, req.Units), // convert to specified units
 		Units:    req.Units,
 		Mode:     req.Mode,
+		Provider: provider,
 		From: Location{
 			Desc: req.FromDesc,
 			Lat:  req.FromLat,
@@ -706,7 +1160,7 @@ func route(req RouteRequest) (*RouteResponse, error) {
 		for i, maneuver := range vResp.Trip.Legs[0].Maneuvers {
 			step := RouteStep{
 				Number:      i + 1,
-				Description: abbreviateInstruction(maneuver.Instruction),
+				Description: formatInstruction(maneuver.Instruction, !req.Unabbreviated),
 				Distance:    convertDistance(maneuver.Distance*1000, req.Units),
 				Icon:        getStepIcon(maneuver.Type, maneuver.Instruction, ""),
 			}
@@ -736,5 +1190,96 @@ func route(req RouteRequest) (*RouteResponse, error) {
 		}
 	}
 
+	// Keep the full-resolution geometry for progress lookups
+	if len(vResp.Trip.Legs) > 0 {
+		leg := vResp.Trip.Legs[0]
+		coords := decodePolylineCoords(leg.Shape, polylinePrecision6)
+		var trackSteps []trackStep
+		for i, maneuver := range leg.Maneuvers {
+			street := strings.Join(maneuver.StreetNames, "/")
+			if street == "" {
+				street = formatInstruction(maneuver.Instruction, !req.Unabbreviated)
+			}
+			end := maneuver.EndShapeIndex
+			if end >= len(coords) {
+				end = len(coords) - 1
+			}
+			trackSteps = append(trackSteps, trackStep{
+				Number: i + 1,
+				Street: street,
+				Begin:  maneuver.BeginShapeIndex,
+				End:    end,
+			})
+		}
+		storeRoute(result, newRouteTrack(coords, trackSteps, req.Units))
+	}
+
+	if result.Mode == ModeTransit {
+		setTransitTimes(result, depart, depart.Add(time.Duration(result.Duration)*time.Second))
+	}
+
 	return result, nil
 }
+
+// valhallaRouters lists the Valhalla-compatible routers to try in order,
+// valhalla_url first and then the configured fallbacks
+func valhallaRouters(ctx context.Context) []RouterConfig {
+	return append([]RouterConfig{{URL: configFor(ctx).ValhallaURL}}, configFor(ctx).FallbackRouters...)
+}
+
+// routerName names a router as a route's provider, defaulting to its URL's host
+func routerName(router RouterConfig) string {
+	if router.Name != "" {
+		return router.Name
+	}
+	if u, err := url.Parse(router.URL); err == nil {
+		return u.Host
+	}
+	return router.URL
+}
+
+// postValhalla sends a route request to each router in turn until one answers,
+// moving on after connection errors, 5xx responses, and open circuit breakers.
+// It returns the response along with the name of the router that sent it.
+func postValhalla(ctx context.Context, reqBody []byte) (*http.Response, string, error) {
+	routers := valhallaRouters(ctx)
+	var lastErr error
+	for i, router := range routers {
+		routerURL, err := url.Parse(router.URL)
+		if err != nil {
+			lastErr = fmt.Errorf("invalid router URL %q: %v", router.URL, err)
+			continue
+		}
+		if router.APIKey != "" {
+			query := routerURL.Query()
+			query.Set("api_key", router.APIKey)
+			routerURL.RawQuery = query.Encode()
+		}
+		name := routerName(router)
+
+		last := i == len(routers)-1
+		resp, err := upstreamPost(ctx, routerURL.String(), "application/json", bytes.NewReader(reqBody))
+		if err == nil && (resp.StatusCode < 500 || last) {
+			return resp, name, nil
+		}
+		if err == nil {
+			resp.Body.Close()
+			err = fmt.Errorf("status %d", resp.StatusCode)
+		}
+		if errors.Is(err, context.Canceled) {
+			return nil, "", err
+		}
+		if !last {
+			routeLog.WarnContext(ctx, "Router failed, trying the next one", "router", name, "error", err)
+		}
+		lastErr = err
+	}
+	return nil, "", lastErr
+}
+
+// setTransitTimes records when a transit route leaves and arrives, in the origin's timezone
+func setTransitTimes(result *RouteResponse, depart, arrive time.Time) {
+	result.Timezone = depart.Location().String()
+	result.DepartTime = depart.Format(time.RFC3339)
+	result.ArriveTime = arrive.In(depart.Location()).Format(time.RFC3339)
+}
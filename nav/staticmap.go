@@ -0,0 +1,247 @@
+package nav
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/jpeg" // Some tile servers send JPEG tiles
+	"image/png"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Default and allowed sizes for static map images, in pixels
+const (
+	DefaultStaticMapWidth  = 600
+	DefaultStaticMapHeight = 400
+	MaxStaticMapWidth      = 1280
+	MaxStaticMapHeight     = 1280
+)
+
+const (
+	tileSize         = 256
+	maxTileZoom      = 18
+	maxTilesPerMap   = 64
+	tileCacheTTL     = 24 * time.Hour
+	tileFetchTimeout = 5 * time.Second
+)
+
+// mapStyle sets how routes are drawn on a map image
+type mapStyle struct {
+	background   color.Color // Shown where there are no tiles
+	padding      int         // Pixels kept clear around the route
+	lineRadius   int
+	line         color.Color
+	markerRadius int
+	outline      color.Color // Ring around the markers
+	start, end   color.Color
+}
+
+// pngMapStyle draws routes in full color for web pages and modern clients
+var pngMapStyle = mapStyle{
+	background:   color.RGBA{0xF2, 0xEF, 0xE9, 0xFF},
+	padding:      24,
+	lineRadius:   2,
+	line:         color.RGBA{0x1A, 0x73, 0xE8, 0xFF},
+	markerRadius: 7,
+	outline:      color.White,
+	start:        color.RGBA{0x1E, 0x8E, 0x3E, 0xFF},
+	end:          color.RGBA{0xD9, 0x30, 0x25, 0xFF},
+}
+
+var tileCache = newTTLCache[image.Image]("tiles", tileCacheTTL, 0)
+
+// mercatorView maps [lat, lng] pairs to image pixels at a Web Mercator zoom
+// level, centered on a point, matching the layout of slippy map tiles
+type mercatorView struct {
+	zoom          int
+	centerX       float64 // World pixel coordinates of the image center
+	centerY       float64
+	width, height int
+}
+
+// worldPixel returns the Web Mercator pixel coordinates of a point at a zoom level
+func worldPixel(lat, lng float64, zoom int) (float64, float64) {
+	scale := tileSize * math.Exp2(float64(zoom))
+	lat = math.Max(-85.05112878, math.Min(85.05112878, lat))
+	sin := math.Sin(lat * math.Pi / 180)
+	x := (lng + 180) / 360 * scale
+	y := (0.5 - math.Log((1+sin)/(1-sin))/(4*math.Pi)) * scale
+	return x, y
+}
+
+// fitMercatorView picks the closest zoom level that shows every point with
+// padding to spare, centered on their bounds
+func fitMercatorView(points [][2]float64, width, height, padding int) mercatorView {
+	minLat, maxLat := points[0][0], points[0][0]
+	minLng, maxLng := points[0][1], points[0][1]
+	for _, p := range points[1:] {
+		minLat, maxLat = math.Min(minLat, p[0]), math.Max(maxLat, p[0])
+		minLng, maxLng = math.Min(minLng, p[1]), math.Max(maxLng, p[1])
+	}
+
+	view := mercatorView{width: width, height: height}
+	availableW := float64(max(1, width-2*padding))
+	availableH := float64(max(1, height-2*padding))
+	for zoom := maxTileZoom; zoom >= 0; zoom-- {
+		x0, y0 := worldPixel(maxLat, minLng, zoom)
+		x1, y1 := worldPixel(minLat, maxLng, zoom)
+		view.zoom = zoom
+		view.centerX, view.centerY = (x0+x1)/2, (y0+y1)/2
+		if x1-x0 <= availableW && y1-y0 <= availableH {
+			break
+		}
+	}
+	return view
+}
+
+// toPixel converts a [lat, lng] pair to image pixel coordinates
+func (v mercatorView) toPixel(p [2]float64) (float64, float64) {
+	x, y := worldPixel(p[0], p[1], v.zoom)
+	return x - v.centerX + float64(v.width)/2, y - v.centerY + float64(v.height)/2
+}
+
+// tileURL fills in a tile server URL template with {z}, {x}, and {y}
+func tileURL(template string, zoom, x, y int) string {
+	return strings.NewReplacer(
+		"{z}", strconv.Itoa(zoom),
+		"{x}", strconv.Itoa(x),
+		"{y}", strconv.Itoa(y),
+	).Replace(template)
+}
+
+// fetchTile downloads and decodes one map tile from the configured tile server
+func fetchTile(ctx context.Context, zoom, x, y int) (image.Image, error) {
+	tileAddr := tileURL(configFor(ctx).TileURL, zoom, x, y)
+	if tile, ok := tileCache.get(tileAddr); ok {
+		return tile, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, tileAddr, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %v", err)
+	}
+	if configFor(ctx).UserAgent != "" {
+		req.Header.Set("User-Agent", configFor(ctx).UserAgent)
+	}
+	if configFor(ctx).Referer != "" {
+		req.Header.Set("Referer", configFor(ctx).Referer)
+	}
+
+	resp, err := stateFor(ctx).upstream.tileClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching tile: %v", redactError(err))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("tile server returned status %d", resp.StatusCode)
+	}
+
+	tile, _, err := image.Decode(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding tile: %v", err)
+	}
+
+	tileCache.set(tileAddr, tile)
+	return tile, nil
+}
+
+// drawTiles paints the map tiles under a view. Tiles that can't be fetched
+// are left as the plain background so the route is still shown.
+func drawTiles(ctx context.Context, img *image.RGBA, view mercatorView) {
+	left := view.centerX - float64(view.width)/2
+	top := view.centerY - float64(view.height)/2
+	firstX, firstY := int(math.Floor(left/tileSize)), int(math.Floor(top/tileSize))
+	lastX := int(math.Floor((left + float64(view.width) - 1) / tileSize))
+	lastY := int(math.Floor((top + float64(view.height) - 1) / tileSize))
+	if (lastX-firstX+1)*(lastY-firstY+1) > maxTilesPerMap {
+		return
+	}
+
+	tiles := 1 << view.zoom
+	for ty := firstY; ty <= lastY; ty++ {
+		if ty < 0 || ty >= tiles {
+			continue
+		}
+		for tx := firstX; tx <= lastX; tx++ {
+			// Wrap around the antimeridian
+			tile, err := fetchTile(ctx, view.zoom, ((tx%tiles)+tiles)%tiles, ty)
+			if err != nil {
+				upstreamLog.Debug("Static map tile unavailable", "z", view.zoom, "x", tx, "y", ty, "error", err)
+				continue
+			}
+			at := image.Pt(int(math.Round(float64(tx*tileSize)-left)), int(math.Round(float64(ty*tileSize)-top)))
+			draw.Draw(img, image.Rectangle{Min: at, Max: at.Add(image.Pt(tileSize, tileSize))}, tile, tile.Bounds().Min, draw.Src)
+		}
+	}
+}
+
+// fillCircle paints a filled circle centered on a pixel
+func fillCircle(img *image.RGBA, cx, cy, radius int, c color.Color) {
+	for y := -radius; y <= radius; y++ {
+		for x := -radius; x <= radius; x++ {
+			if x*x+y*y <= radius*radius {
+				img.Set(cx+x, cy+y, c)
+			}
+		}
+	}
+}
+
+// drawMarker paints a route endpoint as a colored dot with an outline
+func drawMarker(img *image.RGBA, x, y float64, c color.Color, style mapStyle) {
+	cx, cy := int(math.Round(x)), int(math.Round(y))
+	fillCircle(img, cx, cy, style.markerRadius+max(1, style.markerRadius/3), style.outline)
+	fillCircle(img, cx, cy, style.markerRadius, c)
+}
+
+// renderStaticMap draws [lat, lng] pairs as a route line with start and end
+// markers, over map tiles when a tile server is configured and tiles is set
+func renderStaticMap(ctx context.Context, points [][2]float64, width, height int, tiles bool, style mapStyle) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), image.NewUniform(style.background), image.Point{}, draw.Src)
+	if len(points) == 0 {
+		return img
+	}
+
+	view := fitMercatorView(points, width, height, style.padding)
+	if tiles && configFor(ctx).TileURL != "" {
+		drawTiles(ctx, img, view)
+	}
+
+	plot := func(x, y int) {
+		fillCircle(img, x, y, style.lineRadius, style.line)
+	}
+	x0, y0 := view.toPixel(points[0])
+	for _, p := range points[1:] {
+		x1, y1 := view.toPixel(p)
+		bresenham(int(math.Round(x0)), int(math.Round(y0)), int(math.Round(x1)), int(math.Round(y1)), plot)
+		x0, y0 = x1, y1
+	}
+
+	drawMarker(img, x0, y0, style.end, style)
+	startX, startY := view.toPixel(points[0])
+	drawMarker(img, startX, startY, style.start, style)
+	return img
+}
+
+// routeStaticMap renders a stored route's full-resolution path as a map image
+func routeStaticMap(ctx context.Context, routeID string, width, height int, tiles bool) (*image.RGBA, error) {
+	track, ok := routeStore.get(routeID)
+	if !ok {
+		return nil, &ErrNoResults{Query: routeID}
+	}
+	return renderStaticMap(ctx, track.Points, width, height, tiles, pngMapStyle), nil
+}
+
+// writePNG encodes an image as a PNG response
+func writePNG(w io.Writer, img image.Image) error {
+	encoder := png.Encoder{CompressionLevel: png.BestSpeed}
+	return encoder.Encode(w, img)
+}
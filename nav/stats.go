@@ -0,0 +1,226 @@
+package nav
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// latencySamples is how many recent requests to each endpoint the latency
+// percentiles are taken over
+const latencySamples = 1000
+
+var statsStart = time.Now()
+
+// endpointCounter tracks requests to one endpoint since start
+type endpointCounter struct {
+	requests     int64
+	errors       int64           // 4xx and 5xx responses
+	serverErrors int64           // 5xx responses
+	latencies    []time.Duration // Ring buffer of the most recent requests
+	next         int
+}
+
+// upstreamCounter tracks calls to one upstream host since start
+type upstreamCounter struct {
+	calls     atomic.Int64
+	errors    atomic.Int64
+	rejected  atomic.Int64 // Failed fast while the circuit breaker was open
+	throttled atomic.Int64 // Failed after waiting too long for a slot under the concurrency or rate limit
+}
+
+// cacheCounter tracks lookups in one kind of cache since start
+type cacheCounter struct {
+	hits   atomic.Int64
+	misses atomic.Int64
+	size   func() int // Entries held, nil for caches in Redis
+}
+
+var (
+	statsMu          sync.Mutex
+	endpointCounters = make(map[string]*endpointCounter)
+	upstreamCounters = make(map[string]*upstreamCounter)
+	cacheCounters    = make(map[string]*cacheCounter)
+)
+
+// WithStats counts requests, errors, and latencies for each endpoint
+func WithStats(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w}
+		next.ServeHTTP(sw, r)
+		if sw.status == 0 {
+			sw.status = http.StatusOK
+		}
+		recordRequest(statsEndpoint(r.URL.Path), sw.status, time.Since(start))
+	})
+}
+
+// statusWriter remembers the status a handler responded with
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (sw *statusWriter) WriteHeader(code int) {
+	if sw.status == 0 {
+		sw.status = code
+	}
+	sw.ResponseWriter.WriteHeader(code)
+}
+
+func (sw *statusWriter) Write(p []byte) (int, error) {
+	if sw.status == 0 {
+		sw.status = http.StatusOK
+	}
+	return sw.ResponseWriter.Write(p)
+}
+
+// statsEndpoint names the endpoint a path is counted under, as it's listed in
+// apiEndpoints, so route IDs in paths and unknown paths don't each get a counter
+func statsEndpoint(path string) string {
+	for _, endpoint := range apiEndpoints {
+		if endpoint.path == path {
+			return path
+		}
+	}
+	if strings.HasPrefix(path, "/nav/route/") && strings.HasSuffix(path, "/qr") {
+		return "/nav/route/{id}/qr"
+	}
+	if path == "/openapi.json" || path == "/docs" {
+		return path
+	}
+	return "other"
+}
+
+// recordRequest adds a finished request to its endpoint's counters
+func recordRequest(endpoint string, status int, latency time.Duration) {
+	statsMu.Lock()
+	defer statsMu.Unlock()
+
+	c, ok := endpointCounters[endpoint]
+	if !ok {
+		c = &endpointCounter{latencies: make([]time.Duration, 0, latencySamples)}
+		endpointCounters[endpoint] = c
+	}
+	c.requests++
+	if status >= 400 {
+		c.errors++
+	}
+	if status >= 500 {
+		c.serverErrors++
+	}
+	if len(c.latencies) < latencySamples {
+		c.latencies = append(c.latencies, latency)
+	} else {
+		c.latencies[c.next] = latency
+		c.next = (c.next + 1) % latencySamples
+	}
+}
+
+// upstreamStats returns the counters for calls to a host
+func upstreamStats(host string) *upstreamCounter {
+	statsMu.Lock()
+	defer statsMu.Unlock()
+
+	c, ok := upstreamCounters[host]
+	if !ok {
+		c = &upstreamCounter{}
+		upstreamCounters[host] = c
+	}
+	return c
+}
+
+// cacheStats returns the counters for a kind of cache, carried over when the
+// cache is replaced on a config reload
+func cacheStats(name string, size func() int) *cacheCounter {
+	statsMu.Lock()
+	defer statsMu.Unlock()
+
+	c, ok := cacheCounters[name]
+	if !ok {
+		c = &cacheCounter{}
+		cacheCounters[name] = c
+	}
+	c.size = size
+	return c
+}
+
+// percentile returns the p-th percentile of sorted latencies in milliseconds
+func percentile(sorted []time.Duration, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(p * float64(len(sorted)-1))
+	return float64(sorted[i].Microseconds()) / 1000
+}
+
+// ratio returns n/total, or 0 when there's nothing to divide
+func ratio(n, total int64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(n) / float64(total)
+}
+
+// HandleStats reports request, upstream, and cache statistics since the
+// server started, for lightweight monitoring
+func HandleStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "only GET method is allowed")
+		return
+	}
+
+	stats := StatsResponse{
+		Uptime:    int64(time.Since(statsStart).Seconds()),
+		Endpoints: make(map[string]EndpointStats),
+		Upstreams: make(map[string]UpstreamStats),
+		Caches:    make(map[string]CacheStats),
+	}
+
+	statsMu.Lock()
+	for name, c := range endpointCounters {
+		sorted := append([]time.Duration(nil), c.latencies...)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		stats.Endpoints[name] = EndpointStats{
+			Requests:     c.requests,
+			Errors:       c.errors,
+			ServerErrors: c.serverErrors,
+			ErrorRate:    ratio(c.errors, c.requests),
+			P50:          percentile(sorted, 0.50),
+			P95:          percentile(sorted, 0.95),
+		}
+	}
+	for host, c := range upstreamCounters {
+		calls, errors := c.calls.Load(), c.errors.Load()
+		stats.Upstreams[host] = UpstreamStats{
+			Calls:     calls,
+			Errors:    errors,
+			Rejected:  c.rejected.Load(),
+			Throttled: c.throttled.Load(),
+			ErrorRate: ratio(errors, calls),
+		}
+	}
+	sizes := make(map[string]func() int, len(cacheCounters))
+	for name, c := range cacheCounters {
+		hits, misses := c.hits.Load(), c.misses.Load()
+		stats.Caches[name] = CacheStats{Hits: hits, Misses: misses, HitRate: ratio(hits, hits+misses)}
+		sizes[name] = c.size
+	}
+	statsMu.Unlock()
+
+	// Cache sizes take each cache's own lock, so they're read after releasing statsMu
+	for name, size := range sizes {
+		if size != nil {
+			cache := stats.Caches[name]
+			entries := size()
+			cache.Entries = &entries
+			stats.Caches[name] = cache
+		}
+	}
+
+	writeJSON(w, stats)
+}
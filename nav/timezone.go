@@ -0,0 +1,66 @@
+package nav
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/bradfitz/latlong"
+)
+
+// Formats accepted for departure times given in the origin's local time
+const (
+	localDateTimeFormat = "2006-01-02T15:04"
+	localTimeFormat     = "15:04"
+)
+
+// clockTime formats a time of day for step descriptions, in 12- or 24-hour form
+func clockTime(t time.Time, twelveHour bool) string {
+	if twelveHour {
+		return t.Format("3:04pm")
+	}
+	return t.Format(localTimeFormat)
+}
+
+// timezoneAt returns the timezone at a point, falling back to the server's
+// timezone at sea or where the lookup fails
+func timezoneAt(lat, lng float64) *time.Location {
+	name := latlong.LookupZoneName(lat, lng)
+	if name == "" {
+		return time.Local
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return time.Local
+	}
+	return loc
+}
+
+// validDepartTime checks the format of a departure time without resolving it
+func validDepartTime(s string) bool {
+	for _, layout := range []string{time.RFC3339, localDateTimeFormat, localTimeFormat} {
+		if _, err := time.Parse(layout, s); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// departTime resolves a requested departure time in the given timezone. RFC 3339
+// times are absolute; YYYY-MM-DDTHH:MM and HH:MM are local times, the latter on
+// today's local date. An empty string means now.
+func departTime(s string, loc *time.Location, now time.Time) (time.Time, error) {
+	if s == "" {
+		return now.In(loc), nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t.In(loc), nil
+	}
+	if t, err := time.ParseInLocation(localDateTimeFormat, s, loc); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation(localTimeFormat, s, loc); err == nil {
+		today := now.In(loc)
+		return time.Date(today.Year(), today.Month(), today.Day(), t.Hour(), t.Minute(), 0, 0, loc), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid departure time %q", s)
+}
@@ -0,0 +1,76 @@
+package nav
+
+import (
+	"context"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer starts the spans requests are traced with. Until the server sets up
+// an exporter, they're no-ops.
+var tracer = otel.Tracer("github.com/nwah/fujisuite-server/nav")
+
+// startSpan starts an internal span for a step of handling a request
+func startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return tracer.Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// spanError marks a span failed when err is set
+func spanError(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
+
+// WithTracing traces each request in a span named after its endpoint,
+// continuing a trace started by the caller when it sends a traceparent header
+func WithTracing(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		endpoint := statsEndpoint(r.URL.Path)
+		ctx, span := tracer.Start(ctx, r.Method+" "+endpoint,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.method", r.Method),
+				attribute.String("http.route", endpoint),
+				attribute.String("http.target", redactURL(r.URL.String())),
+			),
+		)
+		defer span.End()
+		if id := requestID(ctx); id != "" {
+			span.SetAttributes(attribute.String("request_id", id))
+		}
+
+		sw := &statusWriter{ResponseWriter: w}
+		next.ServeHTTP(sw, r.WithContext(ctx))
+		if sw.status == 0 {
+			sw.status = http.StatusOK
+		}
+		span.SetAttributes(attribute.Int("http.status_code", sw.status))
+		if sw.status >= 500 {
+			span.SetStatus(codes.Error, http.StatusText(sw.status))
+		}
+	})
+}
+
+// startUpstreamSpan starts a client span for a call to an upstream service,
+// named after the service, and passes the trace on in the request's headers
+func startUpstreamSpan(req *http.Request) (*http.Request, trace.Span) {
+	ctx, span := tracer.Start(req.Context(), "upstream "+upstreamService(req.Context(), req.URL.Host),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("http.method", req.Method),
+			attribute.String("http.url", redactURL(req.URL.String())),
+			attribute.String("net.peer.name", req.URL.Host),
+		),
+	)
+	req = req.WithContext(ctx)
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+	return req, span
+}
@@ -0,0 +1,136 @@
+package nav
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"time"
+)
+
+// defaultRouteStoreTTL is how long routes are kept for progress lookups when not configured
+const defaultRouteStoreTTL = 4 * time.Hour
+
+// routeStore holds recently computed routes by ID for progress lookups
+var routeStore = newTTLCache[*routeTrack]("routeStore", defaultRouteStoreTTL, DefaultCacheMaxEntries)
+
+// routeTrack is the full-resolution geometry of a stored route
+type routeTrack struct {
+	Points     [][2]float64 // [lat, lng] pairs along the route
+	Cumulative []float64    // Distance in meters from the start to each point
+	Steps      []trackStep
+	Units      DistanceUnit
+	Response   *RouteResponse `json:"-"` // The route as returned, for fetching pages of steps later
+}
+
+// trackStep maps a route step onto the range of points it covers
+type trackStep struct {
+	Number int
+	Street string
+	Begin  int // Index of the first point of the step
+	End    int // Index of the last point of the step
+}
+
+// newRouteID returns a short random identifier that's easy to store on small clients
+func newRouteID() string {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%08x", time.Now().UnixNano()&0xffffffff)
+	}
+	return hex.EncodeToString(b)
+}
+
+// newRouteTrack builds a track from raw points, computing cumulative distances
+func newRouteTrack(points [][2]float64, steps []trackStep, units DistanceUnit) *routeTrack {
+	cumulative := make([]float64, len(points))
+	for i := 1; i < len(points); i++ {
+		cumulative[i] = cumulative[i-1] + haversineDistance(points[i-1][0], points[i-1][1], points[i][0], points[i][1])
+	}
+	return &routeTrack{Points: points, Cumulative: cumulative, Steps: steps, Units: units}
+}
+
+// storeRoute saves the track under a new ID and records the ID on the response
+func storeRoute(result *RouteResponse, track *routeTrack) {
+	if track == nil || len(track.Points) == 0 {
+		return
+	}
+	result.ID = newRouteID()
+	result.track = track
+	track.Response = result
+	routeStore.set(result.ID, track)
+}
+
+// storedRoute returns a previously computed route by ID
+func storedRoute(routeID string) (*RouteResponse, error) {
+	track, ok := routeStore.get(routeID)
+	if !ok || track.Response == nil {
+		return nil, &ErrNoResults{Query: routeID}
+	}
+	return track.Response, nil
+}
+
+// projectOntoSegment returns the fraction along segment a-b closest to p, using
+// an equirectangular projection which is accurate over short distances
+func projectOntoSegment(p, a, b [2]float64) float64 {
+	scale := math.Cos(p[0] * math.Pi / 180)
+	ax, ay := (a[1]-p[1])*scale, a[0]-p[0]
+	bx, by := (b[1]-p[1])*scale, b[0]-p[0]
+
+	dx, dy := bx-ax, by-ay
+	lengthSquared := dx*dx + dy*dy
+	if lengthSquared == 0 {
+		return 0
+	}
+	t := -(ax*dx + ay*dy) / lengthSquared
+	return math.Max(0, math.Min(1, t))
+}
+
+// routeProgress finds where a position lies along a stored route
+func routeProgress(routeID string, lat, lng float64) (*RouteProgressResponse, error) {
+	track, ok := routeStore.get(routeID)
+	if !ok {
+		return nil, &ErrNoResults{Query: routeID}
+	}
+
+	// Find the closest point on any segment of the route
+	p := [2]float64{lat, lng}
+	bestSegment, bestFraction := 0, 0.0
+	bestPoint := track.Points[0]
+	bestDistance := haversineDistance(lat, lng, bestPoint[0], bestPoint[1])
+	for i := 0; i+1 < len(track.Points); i++ {
+		a, b := track.Points[i], track.Points[i+1]
+		t := projectOntoSegment(p, a, b)
+		candidate := [2]float64{a[0] + (b[0]-a[0])*t, a[1] + (b[1]-a[1])*t}
+		if d := haversineDistance(lat, lng, candidate[0], candidate[1]); d < bestDistance {
+			bestSegment, bestFraction, bestPoint, bestDistance = i, t, candidate, d
+		}
+	}
+
+	// Distance travelled along the route up to the closest point
+	travelled := track.Cumulative[bestSegment]
+	if bestSegment+1 < len(track.Points) {
+		travelled += (track.Cumulative[bestSegment+1] - track.Cumulative[bestSegment]) * bestFraction
+	}
+	total := track.Cumulative[len(track.Cumulative)-1]
+
+	result := &RouteProgressResponse{
+		RouteID:   routeID,
+		Lat:       bestPoint[0],
+		Lng:       bestPoint[1],
+		OffRoute:  convertDistance(bestDistance, track.Units),
+		Remaining: convertDistance(math.Max(0, total-travelled), track.Units),
+		Units:     track.Units,
+	}
+
+	// Find the step covering the closest segment
+	for _, step := range track.Steps {
+		if bestSegment >= step.Begin && bestSegment < step.End {
+			result.Step = step.Number
+			result.Street = step.Street
+			result.StepRemaining = convertDistance(math.Max(0, track.Cumulative[step.End]-travelled), track.Units)
+			break
+		}
+	}
+
+	return result, nil
+}
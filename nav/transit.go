@@ -0,0 +1,240 @@
+package nav
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+)
+
+// DefaultStopsRadius is the default search radius in meters for nearby stops
+const DefaultStopsRadius = 500
+
+// MaxStopsRadius is the largest search radius in meters accepted for nearby stops
+const MaxStopsRadius = 5000
+
+// agenciesRadius is the search radius in meters for agencies serving an area
+const agenciesRadius = 10000
+
+type transitlandRoute struct {
+	OnestopID      string `json:"onestop_id"`
+	RouteID        string `json:"route_id"`
+	RouteShortName string `json:"route_short_name"`
+	RouteLongName  string `json:"route_long_name"`
+	RouteType      int    `json:"route_type"`
+	RouteColor     string `json:"route_color"`
+	Agency         struct {
+		AgencyName string `json:"agency_name"`
+		OnestopID  string `json:"onestop_id"`
+	} `json:"agency"`
+}
+
+type transitlandStop struct {
+	OnestopID          string `json:"onestop_id"`
+	StopID             string `json:"stop_id"`
+	StopName           string `json:"stop_name"`
+	StopCode           string `json:"stop_code"`
+	WheelchairBoarding int    `json:"wheelchair_boarding"` // 0 unknown, 1 accessible, 2 not accessible
+	Geometry           struct {
+		Coordinates [2]float64 `json:"coordinates"` // [lng, lat]
+	} `json:"geometry"`
+	RouteStops []struct {
+		Route transitlandRoute `json:"route"`
+	} `json:"route_stops"`
+}
+
+type transitlandStopsResponse struct {
+	Stops []transitlandStop `json:"stops"`
+}
+
+type transitlandAgenciesResponse struct {
+	Agencies []struct {
+		OnestopID  string `json:"onestop_id"`
+		AgencyName string `json:"agency_name"`
+		AgencyURL  string `json:"agency_url"`
+	} `json:"agencies"`
+}
+
+// transitlandGet makes a GET request to the Transitland REST API and decodes the JSON response
+func transitlandGet(ctx context.Context, path string, params url.Values, v interface{}) error {
+	if configFor(ctx).TransitlandURL == "" || configFor(ctx).TransitlandAPIKey == "" {
+		return fmt.Errorf("transitland configuration not complete")
+	}
+
+	params.Set("api_key", configFor(ctx).TransitlandAPIKey)
+	apiURL := fmt.Sprintf("%s%s?%s", configFor(ctx).TransitlandURL, path, params.Encode())
+
+	resp, err := upstreamGet(ctx, apiURL)
+	if err != nil {
+		return fmt.Errorf("error making request to transitland: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("error reading response body: %v", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("transitland API returned status %d: %s", resp.StatusCode, string(body))
+	}
+
+	if err := json.NewDecoder(bytes.NewReader(body)).Decode(v); err != nil {
+		return fmt.Errorf("error decoding response: %v", err)
+	}
+	return nil
+}
+
+// routeNames returns the distinct short names of the routes serving a stop
+func (s transitlandStop) routeNames() []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, rs := range s.RouteStops {
+		name := rs.Route.RouteShortName
+		if name == "" {
+			name = rs.Route.RouteLongName
+		}
+		if name != "" && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// nearbyStops finds transit stops within a radius of a point, preferring the
+// local GTFS feeds and falling back to Transitland
+func nearbyStops(ctx context.Context, lat, lng, radius float64, units DistanceUnit) ([]TransitStop, error) {
+	if feed := currentGTFS(); feed != nil {
+		stops, err := gtfsNearbyStops(feed, lat, lng, radius, units)
+		if err == nil || configFor(ctx).TransitlandAPIKey == "" {
+			return stops, err
+		}
+	}
+
+	params := url.Values{
+		"lat":    {fmt.Sprintf("%.6f", lat)},
+		"lon":    {fmt.Sprintf("%.6f", lng)},
+		"radius": {fmt.Sprintf("%.0f", radius)},
+		"limit":  {"20"},
+	}
+
+	var tResp transitlandStopsResponse
+	if err := transitlandGet(ctx, "/rest/stops", params, &tResp); err != nil {
+		return nil, err
+	}
+
+	if len(tResp.Stops) == 0 {
+		return nil, &ErrNoResults{Query: fmt.Sprintf("%.6f,%.6f", lat, lng)}
+	}
+
+	stops := make([]TransitStop, 0, len(tResp.Stops))
+	for _, s := range tResp.Stops {
+		stopLat, stopLng := s.Geometry.Coordinates[1], s.Geometry.Coordinates[0]
+		stops = append(stops, TransitStop{
+			ID:       s.OnestopID,
+			Name:     s.StopName,
+			Code:     s.StopCode,
+			Lat:      stopLat,
+			Lng:      stopLng,
+			Routes:   s.routeNames(),
+			Distance: convertDistance(haversineDistance(lat, lng, stopLat, stopLng), units),
+		})
+	}
+
+	// Closest stops first
+	sort.Slice(stops, func(i, j int) bool {
+		return stops[i].Distance < stops[j].Distance
+	})
+
+	return stops, nil
+}
+
+// wheelchairStatus converts a GTFS wheelchair value to a readable status
+func wheelchairStatus(value int) string {
+	switch value {
+	case 1:
+		return "yes"
+	case 2:
+		return "no"
+	default:
+		return "unknown"
+	}
+}
+
+// stopDetails looks up a transit stop and the routes serving it using Transitland
+func stopDetails(ctx context.Context, stopID string) (*TransitStopDetails, error) {
+	var tResp transitlandStopsResponse
+	if err := transitlandGet(ctx, "/rest/stops/"+url.PathEscape(stopID), url.Values{}, &tResp); err != nil {
+		return nil, err
+	}
+
+	if len(tResp.Stops) == 0 {
+		return nil, &ErrNoResults{Query: stopID}
+	}
+
+	s := tResp.Stops[0]
+	result := &TransitStopDetails{
+		ID:         s.OnestopID,
+		Name:       s.StopName,
+		Code:       s.StopCode,
+		Lat:        s.Geometry.Coordinates[1],
+		Lng:        s.Geometry.Coordinates[0],
+		Wheelchair: wheelchairStatus(s.WheelchairBoarding),
+		Routes:     []TransitRouteSummary{},
+	}
+
+	seen := make(map[string]bool)
+	for _, rs := range s.RouteStops {
+		if seen[rs.Route.OnestopID] {
+			continue
+		}
+		seen[rs.Route.OnestopID] = true
+		result.Routes = append(result.Routes, TransitRouteSummary{
+			ID:        rs.Route.OnestopID,
+			ShortName: rs.Route.RouteShortName,
+			LongName:  rs.Route.RouteLongName,
+			Operator:  rs.Route.Agency.AgencyName,
+		})
+	}
+
+	return result, nil
+}
+
+// nearbyAgencies lists the transit operators serving the area around a point using Transitland
+func nearbyAgencies(ctx context.Context, lat, lng float64) ([]TransitAgency, error) {
+	params := url.Values{
+		"lat":    {fmt.Sprintf("%.6f", lat)},
+		"lon":    {fmt.Sprintf("%.6f", lng)},
+		"radius": {fmt.Sprintf("%d", agenciesRadius)},
+	}
+
+	var tResp transitlandAgenciesResponse
+	if err := transitlandGet(ctx, "/rest/agencies", params, &tResp); err != nil {
+		return nil, err
+	}
+
+	if len(tResp.Agencies) == 0 {
+		return nil, &ErrNoResults{Query: fmt.Sprintf("%.6f,%.6f", lat, lng)}
+	}
+
+	agencies := make([]TransitAgency, 0, len(tResp.Agencies))
+	for _, a := range tResp.Agencies {
+		agencies = append(agencies, TransitAgency{
+			ID:      a.OnestopID,
+			Name:    a.AgencyName,
+			Website: a.AgencyURL,
+		})
+	}
+
+	// Alphabetical for a stable listing
+	sort.Slice(agencies, func(i, j int) bool {
+		return agencies[i].Name < agencies[j].Name
+	})
+
+	return agencies, nil
+}
@@ -2,20 +2,301 @@ package nav
 
 // NavConfig holds navigation-specific configuration
 type NavConfig struct {
-	NominatimURL      string `toml:"nominatim_url"`
-	ValhallaURL       string `toml:"valhalla_url"`
-	TransitlandURL    string `toml:"transitland_url"`
-	TransitlandAPIKey string `toml:"transitland_api_key"`
+	NominatimURL      string             `toml:"nominatim_url"`
+	ValhallaURL       string             `toml:"valhalla_url"`
+	TransitlandURL    string             `toml:"transitland_url"`
+	TransitlandAPIKey string             `toml:"transitland_api_key"`
+	What3WordsURL     string             `toml:"what3words_url"`
+	What3WordsAPIKey  string             `toml:"what3words_api_key"`
+	GeocodeCacheTTL   int                `toml:"geocode_cache_ttl"` // in seconds, 0 disables caching
+	RouteCacheTTL     int                `toml:"route_cache_ttl"`   // in seconds, for walking, biking, and driving routes; 0 disables caching
+	CacheMaxEntries   int                `toml:"cache_max_entries"` // Most responses each cache, and routes the route store, holds before dropping the least recently used
+	Redis             RedisConfig        `toml:"redis"`             // Shared cache for geocode and route responses across instances
+	MinImportance     float64            `toml:"min_importance"`    // Drop geocode results below this relevance score
+	GeoIPDatabase     string             `toml:"geoip_database"`    // Path to a MaxMind GeoLite2/GeoIP2 City database
+	GazetteerFile     string             `toml:"gazetteer_file"`    // Path to a GeoNames extract used when Nominatim is down
+	UserAgent         string             `toml:"user_agent"`        // Identifies this deployment to upstream services
+	Referer           string             `toml:"referer"`           // Optional Referer sent to Nominatim
+	NominatimMaxQPS   float64            `toml:"nominatim_max_qps"` // Max requests per second to Nominatim, 0 for unlimited
+	RouteStoreTTL     int                `toml:"route_store_ttl"`   // in seconds, how long routes are kept for progress lookups
+	GTFSFeeds         []string           `toml:"gtfs_feeds"`        // Paths to GTFS zip feeds for offline transit
+	ParkRideLots      string             `toml:"park_ride_lots"`    // Path to a CSV of park-and-ride lots with name, lat, and lng columns
+	GTFSRealtime      []GTFSRealtimeFeed `toml:"gtfs_realtime"`
+	Abbreviations     AbbreviationConfig `toml:"abbreviations"`      // Changes to the built-in address and instruction abbreviations
+	TileURL           string             `toml:"tile_url"`           // Map tile URL template with {z}, {x}, and {y} for static map backgrounds
+	PublicURL         string             `toml:"public_url"`         // Base URL clients reach this server at, for links in QR codes
+	UpstreamTimeout   int                `toml:"upstream_timeout"`   // in seconds, for each call to an upstream service
+	Upstream          UpstreamConfig     `toml:"upstream"`           // Connection pool and TLS settings for upstream calls
+	FallbackRouters   []RouterConfig     `toml:"fallback_routers"`   // Valhalla-compatible routers tried in order when valhalla_url fails
+	APIKeys           []APIKeyConfig     `toml:"api_keys"`           // Keys clients must send when any are configured
+	APIKeyFile        string             `toml:"api_key_file"`       // Path to a CSV of keys with key, name, and rate_limit columns
+	APIKeyRateLimit   float64            `toml:"api_key_rate_limit"` // Requests per minute for keys without their own limit, 0 for unlimited
+	CORS              CORSConfig         `toml:"cors"`               // Cross-origin access for browser clients
+	APIDocs           bool               `toml:"api_docs"`           // Serve Swagger UI at /docs for browsing /openapi.json
+	Providers         string             `toml:"providers"`          // "mock" for canned geocoding and routing without Nominatim or Valhalla
+
+	// Module switches, on unless set to false, for deployments without the
+	// upstreams a module needs
+	GeocodeEnabled    *bool    `toml:"geocode_enabled"`    // /nav/geocode, /nav/zip, /nav/admin, and /nav/nearby
+	RoutingEnabled    *bool    `toml:"routing_enabled"`    // /nav/route and the endpoints drawing stored routes
+	TransitEnabled    *bool    `toml:"transit_enabled"`    // Transit endpoints and the transit and parkride route modes
+	WhereAmIEnabled   *bool    `toml:"whereami_enabled"`   // /nav/whereami
+	DisabledEndpoints []string `toml:"disabled_endpoints"` // Individual endpoints to switch off, e.g. ["/nav/staticmap"]
+}
+
+// RedisConfig points the geocode and route caches at a Redis server, so
+// instances behind a load balancer share them
+type RedisConfig struct {
+	Address  string `toml:"address"` // host:port, empty to cache in each instance's memory
+	Password string `toml:"password"`
+	DB       int    `toml:"db"`
+	Prefix   string `toml:"prefix"` // Prepended to cache keys, defaulting to "fujisuite:"
+}
+
+// CORSConfig lets browser clients on other origins call the API. With no
+// allowed origins, cross-origin requests get no CORS headers.
+type CORSConfig struct {
+	AllowedOrigins []string `toml:"allowed_origins"` // e.g. ["https://map.example.com"], or ["*"] for any origin
+	AllowedMethods []string `toml:"allowed_methods"` // Defaults to GET, POST, and OPTIONS
+	AllowedHeaders []string `toml:"allowed_headers"` // Request headers allowed in preflight, defaulting to Content-Type, X-API-Key, and X-Request-ID
+	MaxAge         int      `toml:"max_age"`         // in seconds, how long browsers may cache a preflight response
+}
+
+// AbbreviationConfig adds to or replaces the built-in abbreviations, keyed by
+// long form. An empty abbreviation removes a built-in one.
+type AbbreviationConfig struct {
+	Directions  map[string]string `toml:"directions"`   // e.g. nord = "N"
+	StreetTypes map[string]string `toml:"street_types"` // e.g. calle = "C.", or "-straße" = "str." to match word endings
+	States      map[string]string `toml:"states"`       // e.g. bavaria = "BY"
+	Countries   []string          `toml:"countries"`    // Country codes whose addresses are also abbreviated, e.g. ["de", "es"]
+}
+
+// APIKeyConfig is a key clients send to use the API
+type APIKeyConfig struct {
+	Key       string  `toml:"key"`
+	Name      string  `toml:"name"`       // Who the key belongs to, for usage reports and logs
+	RateLimit float64 `toml:"rate_limit"` // Requests per minute, or 0 for api_key_rate_limit
+}
+
+// RouterConfig is a Valhalla-compatible routing endpoint, such as a hosted API
+type RouterConfig struct {
+	Name   string `toml:"name"`    // Reported as the route's provider, defaulting to the URL's host
+	URL    string `toml:"url"`     // Route endpoint, like valhalla_url
+	APIKey string `toml:"api_key"` // Sent as the api_key query parameter when set
+}
+
+// UpstreamConfig tunes the HTTP client shared by calls to upstream services.
+// Zero values keep the defaults.
+type UpstreamConfig struct {
+	MaxIdleConns        int            `toml:"max_idle_conns"`          // Idle keep-alive connections kept across all hosts
+	MaxIdleConnsPerHost int            `toml:"max_idle_conns_per_host"` // Idle keep-alive connections kept per host
+	MaxConnsPerHost     int            `toml:"max_conns_per_host"`      // Connections open to one host at once, 0 for unlimited
+	IdleConnTimeout     int            `toml:"idle_conn_timeout"`       // in seconds, before an idle connection is closed
+	TLSHandshakeTimeout int            `toml:"tls_handshake_timeout"`   // in seconds
+	TLSMinVersion       string         `toml:"tls_min_version"`         // "1.2" or "1.3"
+	InsecureSkipVerify  bool           `toml:"insecure_skip_verify"`    // Accept any certificate, e.g. for a self-hosted Valhalla with a self-signed one
+	RetryAttempts       int            `toml:"retry_attempts"`          // Tries per call, counting the first, for connection errors and 5xx responses
+	RetryBackoff        float64        `toml:"retry_backoff"`           // in seconds, before the first retry, doubling after each
+	BreakerThreshold    int            `toml:"breaker_threshold"`       // Failed calls in a row before calls to a host fail fast
+	BreakerCooldown     int            `toml:"breaker_cooldown"`        // in seconds, before a failing host is tried again
+	Record              string         `toml:"record"`                  // Directory to save each upstream request and response in, for replaying later
+	Replay              string         `toml:"replay"`                  // Directory of recordings to answer upstream calls from instead of the network
+	Concurrency         map[string]int `toml:"concurrency"`             // Calls in flight at once to a service, e.g. {geocoding = 4}, or to a host
+}
+
+// GTFSRealtimeFeed configures the GTFS-Realtime endpoints for a local GTFS feed
+type GTFSRealtimeFeed struct {
+	Feed                string `toml:"feed"` // Name of the GTFS zip the IDs refer to, without .zip
+	VehiclePositionsURL string `toml:"vehicle_positions_url"`
+	AlertsURL           string `toml:"alerts_url"`
 }
 
 // GeocodeResponse represents the response from the geocoding endpoint
 type GeocodeResponse struct {
-	Name       string  `json:"name"`    // Place name or street address
-	Address    string  `json:"address"` // Simplified address (street, postal code, city)
-	Lat        float64 `json:"lat"`
+	Name         string       `json:"name"`    // Place name or street address
+	Address      string       `json:"address"` // Simplified address (street, postal code, city)
+	Lat          float64      `json:"lat"`
+	Lng          float64      `json:"lng"`
+	Importance   float64      `json:"importance"`             // Relevance score from 0 to 1
+	Country      string       `json:"country"`                // Two-letter ISO country code
+	PlusCode     string       `json:"plusCode"`               // Open Location Code for the result
+	Layer        string       `json:"layer"`                  // address, poi, locality, or admin
+	Category     string       `json:"category"`               // OSM class, e.g. amenity, place, highway
+	Type         string       `json:"type"`                   // OSM type, e.g. restaurant, city, house
+	BBox         *BoundingBox `json:"boundingBox,omitempty"`  // Extent of the place, for zooming
+	Interpolated bool         `json:"interpolated,omitempty"` // Position estimated along the road from its address range
+}
+
+// BoundingBox represents a rectangular area in degrees
+type BoundingBox struct {
+	South float64 `json:"south"`
+	North float64 `json:"north"`
+	West  float64 `json:"west"`
+	East  float64 `json:"east"`
+}
+
+// GeocodeRequest represents the parameters for a geocoding request
+type GeocodeRequest struct {
+	Query         string         `json:"query"`
+	CountryCodes  []CountryCode  `json:"countryCodes,omitempty"`  // Restrict results to these countries
+	Language      string         `json:"language,omitempty"`      // Preferred languages, in Accept-Language format
+	Layers        []GeocodeLayer `json:"layers,omitempty"`        // Only return results in these layers
+	Unabbreviated bool           `json:"unabbreviated,omitempty"` // Keep street types, directions, and states spelled out
+}
+
+// PostalCodeResponse represents the response from the postal code endpoint
+type PostalCodeResponse struct {
+	PostalCode string  `json:"postalCode"`
+	Lat        float64 `json:"lat"` // Centroid of the postal code, or the requested point for reverse lookups
 	Lng        float64 `json:"lng"`
-	Importance float64 `json:"importance"` // Relevance score from 0 to 1
-	Country    string  `json:"country"`    // Two-letter ISO country code
+	City       string  `json:"city"`
+	State      string  `json:"state"`   // Abbreviated where known, e.g. IL
+	Country    string  `json:"country"` // Two-letter ISO country code
+}
+
+// WhereAmIResponse represents the response from the IP geolocation endpoint
+type WhereAmIResponse struct {
+	IP       string  `json:"ip"`
+	Lat      float64 `json:"lat"`
+	Lng      float64 `json:"lng"`
+	Accuracy float64 `json:"accuracy"` // Accuracy radius in kilometers
+	City     string  `json:"city"`
+	State    string  `json:"state"`   // Subdivision ISO code, e.g. IL
+	Country  string  `json:"country"` // Two-letter ISO country code
+}
+
+// AdminAreaResponse represents the administrative areas containing a point
+type AdminAreaResponse struct {
+	City        string `json:"city"`
+	County      string `json:"county"`
+	State       string `json:"state"`
+	StateCode   string `json:"stateCode"`   // Subdivision code where known, e.g. IL
+	Country     string `json:"country"`     // Two-letter ISO country code
+	CountryName string `json:"countryName"` // Localized country name
+}
+
+// NearbyRequest represents the parameters for a nearby places search
+type NearbyRequest struct {
+	Lat      float64      `json:"lat"`
+	Lng      float64      `json:"lng"`
+	Category string       `json:"category"` // e.g. restaurant, gas, pharmacy, atm
+	Radius   float64      `json:"radius"`   // in meters
+	Units    DistanceUnit `json:"units"`
+	Limit    int          `json:"limit"`
+}
+
+// NearbyResult represents a single place returned by the nearby endpoint
+type NearbyResult struct {
+	Name      string  `json:"name"`
+	Address   string  `json:"address"`
+	Lat       float64 `json:"lat"`
+	Lng       float64 `json:"lng"`
+	Distance  float64 `json:"distance"`  // in specified units
+	Bearing   float64 `json:"bearing"`   // degrees clockwise from north
+	Direction string  `json:"direction"` // 8-point compass direction, e.g. NE
+}
+
+// TransitStop represents a transit stop near a point
+type TransitStop struct {
+	ID       string   `json:"id"` // Transitland Onestop ID
+	Name     string   `json:"name"`
+	Code     string   `json:"code"` // Rider-facing stop code, if any
+	Lat      float64  `json:"lat"`
+	Lng      float64  `json:"lng"`
+	Routes   []string `json:"routes"`   // Short names of routes serving the stop
+	Distance float64  `json:"distance"` // in specified units
+}
+
+// TransitRouteSummary represents a route serving a stop
+type TransitRouteSummary struct {
+	ID        string `json:"id"`
+	ShortName string `json:"shortName"`
+	LongName  string `json:"longName"`
+	Operator  string `json:"operator"`
+}
+
+// TransitStopDetails represents the response from the stop details endpoint
+type TransitStopDetails struct {
+	ID         string                `json:"id"`
+	Name       string                `json:"name"`
+	Code       string                `json:"code"`
+	Lat        float64               `json:"lat"`
+	Lng        float64               `json:"lng"`
+	Wheelchair string                `json:"wheelchair"` // yes, no, or unknown
+	Routes     []TransitRouteSummary `json:"routes"`
+}
+
+// TransitAgency represents a transit operator serving an area
+type TransitAgency struct {
+	ID      string `json:"id"` // Transitland Onestop ID
+	Name    string `json:"name"`
+	Website string `json:"website"`
+}
+
+// Departure represents a single upcoming departure from a stop
+type Departure struct {
+	Route    string `json:"route"`    // Route short name
+	Headsign string `json:"headsign"` // Destination shown on the vehicle
+	Minutes  int    `json:"minutes"`  // Minutes until departure
+	Time     string `json:"time"`     // Departure time in RFC 3339 format
+	Realtime bool   `json:"realtime"` // Whether the time is a real-time estimate
+}
+
+// DeparturesResponse represents the response from the departures endpoint
+type DeparturesResponse struct {
+	StopID     string      `json:"stopId"`
+	StopName   string      `json:"stopName"`
+	Departures []Departure `json:"departures"`
+}
+
+// TransitRouteDetails represents display metadata for a transit route
+type TransitRouteDetails struct {
+	ID          string `json:"id"`
+	ShortName   string `json:"shortName"`   // Route number, e.g. 38
+	LongName    string `json:"longName"`    // Full route name
+	Color       string `json:"color"`       // Hex color without the leading #
+	VehicleType string `json:"vehicleType"` // Bus, Train, Subway, Tram, Ferry, etc.
+	Operator    string `json:"operator"`
+}
+
+// TransitCoverageResponse represents whether transit data is available around a point
+type TransitCoverageResponse struct {
+	Available bool     `json:"available"`
+	Providers []string `json:"providers"` // gtfs for local feeds, transitland for the Transitland API
+}
+
+// TransitAlert represents a service alert such as a detour or elevator outage
+type TransitAlert struct {
+	Header      string   `json:"header"`
+	Description string   `json:"description"`
+	Effect      string   `json:"effect"` // e.g. detour, reduced_service, accessibility_issue
+	Cause       string   `json:"cause"`  // e.g. construction, maintenance
+	URL         string   `json:"url"`
+	Routes      []string `json:"routes"` // IDs of affected routes
+	Stops       []string `json:"stops"`  // IDs of affected stops
+	Start       string   `json:"start"`  // Start of the alert in RFC 3339 format, if known
+	End         string   `json:"end"`    // End of the alert in RFC 3339 format, if known
+}
+
+// TransitVehicle represents the live position of a vehicle on a route
+type TransitVehicle struct {
+	ID        string    `json:"id"`
+	Label     string    `json:"label"` // Rider-facing vehicle number, if any
+	TripID    string    `json:"tripId"`
+	Headsign  string    `json:"headsign"`
+	Lat       float64   `json:"lat"`
+	Lng       float64   `json:"lng"`
+	Bearing   float64   `json:"bearing"`   // degrees clockwise from north
+	Point     PathPoint `json:"point"`     // Position on the route's normalized grid
+	Timestamp string    `json:"timestamp"` // Time of the position in RFC 3339 format
+}
+
+// TransitVehiclesResponse represents the response from the vehicle positions endpoint
+type TransitVehiclesResponse struct {
+	RouteID  string           `json:"routeId"`
+	Route    string           `json:"route"` // Route short name
+	Path     Path             `json:"path"`  // Shape of the route
+	Vehicles []TransitVehicle `json:"vehicles"`
 }
 
 // RouteRequest represents the parameters for a routing request
@@ -29,14 +310,37 @@ type RouteRequest struct {
 	Mode     TransportMode `json:"mode"`
 	Units    DistanceUnit  `json:"units"`
 	Country  CountryCode   `json:"country,omitempty"`
+	Via      [][2]float64  `json:"via,omitempty"` // [lat, lng] waypoints to pass through in order, for walking, biking, and driving
+
+	Unabbreviated   bool `json:"unabbreviated,omitempty"`   // Keep turn instructions spelled out
+	TwelveHourClock bool `json:"twelveHourClock,omitempty"` // Show clock times in steps as 3:04pm rather than 15:04
+	StepTimes       bool `json:"stepTimes,omitempty"`       // Add board and alight times to transit step descriptions
+
+	// Transit options
+	MaxTransfers *int    `json:"maxTransfers,omitempty"` // nil for no limit, 0 for single-seat rides
+	MaxWalk      float64 `json:"maxWalk,omitempty"`      // Longest walk to, from, or between stops in meters, 0 for the default
+	Wheelchair   bool    `json:"wheelchair,omitempty"`   // Only use wheelchair-accessible trips and stops
+	Depart       string  `json:"depart,omitempty"`       // RFC 3339, or local time at the origin as YYYY-MM-DDTHH:MM or HH:MM; empty for now
+
+	// Route and agency IDs, or route short names for local GTFS feeds
+	BannedRoutes      []string `json:"bannedRoutes,omitempty"`
+	PreferredRoutes   []string `json:"preferredRoutes,omitempty"`
+	BannedAgencies    []string `json:"bannedAgencies,omitempty"`
+	PreferredAgencies []string `json:"preferredAgencies,omitempty"`
 }
 
 // RouteStep represents a single navigation step
 type RouteStep struct {
-	Number      int     `json:"number"`
-	Description string  `json:"description"`
-	Distance    float64 `json:"distance"` // in specified units
-	Icon        string  `json:"icon"`     // Icon representing the step type
+	Number      int            `json:"number"`
+	Description string         `json:"description"`
+	Distance    float64        `json:"distance"`             // in specified units
+	Icon        string         `json:"icon"`                 // Icon representing the step type
+	Alerts      []TransitAlert `json:"alerts,omitempty"`     // Service alerts affecting a transit step
+	Wheelchair  string         `json:"wheelchair,omitempty"` // For transit steps: yes, no, or unknown
+	Summary     string         `json:"summary,omitempty"`    // One-line form for compact output, e.g. "BUS 38 -> Clark/Lake (12 stops)"
+	Stops       []string       `json:"stops,omitempty"`      // For transit steps with detail=full: stops passed between boarding and getting off
+	DepartTime  string         `json:"departTime,omitempty"` // For transit steps: scheduled boarding time, in RFC 3339 format with the local offset
+	ArriveTime  string         `json:"arriveTime,omitempty"` // For transit steps: scheduled time getting off
 }
 
 // PathPoint represents a normalized point on the route path
@@ -46,8 +350,12 @@ type PathPoint [2]int // [x, y] normalized to 0-NormalizedGridSize
 type Path struct {
 	Points []PathPoint `json:"points"` // Array of [x, y] points
 	Length int         `json:"length"` // Number of points in the path
-	Width  int         `json:"width"`  // Width of the normalized grid (NormalizedGridSize)
-	Height int         `json:"height"` // Height of the normalized grid (NormalizedGridSize)
+	Width  int         `json:"width"`  // Width of the normalized grid, NormalizedGridSize unless pathWidth was given
+	Height int         `json:"height"` // Height of the normalized grid, NormalizedGridSize unless pathHeight was given
+
+	// "delta" when each point after the first is the signed offset from the previous
+	// point, which always fits in a byte; empty for absolute points
+	Encoding string `json:"encoding,omitempty"`
 }
 
 // Location represents a point with description and coordinates
@@ -59,17 +367,119 @@ type Location struct {
 
 // RouteResponse represents the response from the routing endpoint
 type RouteResponse struct {
-	Duration float64       `json:"duration"` // in seconds
-	Distance float64       `json:"distance"` // in specified units
-	Units    DistanceUnit  `json:"units"`    // km or mi
+	ID       string        `json:"id,omitempty"` // Identifies the stored route for progress lookups
+	Duration float64       `json:"duration"`     // in seconds
+	Distance float64       `json:"distance"`     // in specified units
+	Units    DistanceUnit  `json:"units"`        // km or mi
 	Steps    []RouteStep   `json:"steps"`
-	Path     Path          `json:"path"` // Complete path with metadata
-	Mode     TransportMode `json:"mode"` // The mode used for routing
-	From     Location      `json:"from"` // Starting location
-	To       Location      `json:"to"`   // Destination location
+	Path     Path          `json:"path"`               // Complete path with metadata
+	Mode     TransportMode `json:"mode"`               // The mode used for routing
+	Provider string        `json:"provider,omitempty"` // Router that planned the route, e.g. a fallback router's name
+	From     Location      `json:"from"`               // Starting location
+	To       Location      `json:"to"`                 // Destination location
+
+	// Transit routes only
+	Timezone   string `json:"timezone,omitempty"`   // IANA timezone at the origin, e.g. America/Chicago
+	DepartTime string `json:"departTime,omitempty"` // When to leave the origin, in RFC 3339 format with the local offset
+	ArriveTime string `json:"arriveTime,omitempty"` // When to expect to arrive, in RFC 3339 format with the local offset
+
+	// Paginated responses only
+	Page    int `json:"page,omitempty"`    // Page number, starting at 1
+	PerPage int `json:"perPage,omitempty"` // Steps per page
+	Pages   int `json:"pages,omitempty"`   // Total number of pages
+
+	track *routeTrack // Full-resolution geometry for rescaling the path, nil for routes without one
+}
+
+// RouteProgressResponse represents a position matched against a stored route
+type RouteProgressResponse struct {
+	RouteID       string       `json:"routeId"`
+	Lat           float64      `json:"lat"`           // Nearest point on the route
+	Lng           float64      `json:"lng"`           // Nearest point on the route
+	OffRoute      float64      `json:"offRoute"`      // Distance from the position to the route, in specified units
+	Step          int          `json:"step"`          // Number of the current step
+	Street        string       `json:"street"`        // Current street name
+	StepRemaining float64      `json:"stepRemaining"` // Distance to the end of the current step, in specified units
+	Remaining     float64      `json:"remaining"`     // Distance to the destination, in specified units
+	Units         DistanceUnit `json:"units"`
+}
+
+// HealthResponse reports whether the server is up and, when probed, the status
+// of each upstream dependency
+type HealthResponse struct {
+	Status       string                      `json:"status"` // ok, or degraded when a probed dependency is down
+	Dependencies map[string]DependencyStatus `json:"dependencies,omitempty"`
+}
+
+// ReadinessResponse reports whether the server has finished starting up
+type ReadinessResponse struct {
+	Status  string   `json:"status"`            // ready, or starting
+	Pending []string `json:"pending,omitempty"` // What's still loading: config, gtfs, gazetteer, or parkride
+}
+
+// VersionResponse identifies the running build and what its configuration enables
+type VersionResponse struct {
+	Version   string   `json:"version"`   // Release version, or "dev" for local builds
+	Commit    string   `json:"commit"`    // Git commit the server was built from
+	BuildDate string   `json:"buildDate"` // When the server was built, in RFC 3339 format
+	GoVersion string   `json:"goVersion"`
+	Routers   []string `json:"routers"`  // Routing providers in the order they're tried
+	Features  []string `json:"features"` // Optional modules enabled by the config, e.g. gtfs or what3words
+}
+
+// DependencyStatus is the result of probing one upstream dependency
+type DependencyStatus struct {
+	Status  string `json:"status"`          // ok, down, or unconfigured
+	Latency int64  `json:"latency"`         // in milliseconds
+	Breaker string `json:"breaker"`         // closed, or open while calls fail fast
+	Error   string `json:"error,omitempty"` // Why the probe failed
+}
+
+// APIKeyUsageResponse reports the calling API key's usage since the server started
+type APIKeyUsageResponse struct {
+	Name      string  `json:"name"`
+	Requests  int64   `json:"requests"`  // Requests allowed
+	Limited   int64   `json:"limited"`   // Requests rejected by the rate limit
+	RateLimit float64 `json:"rateLimit"` // Requests per minute, 0 for unlimited
+}
+
+// StatsResponse reports request, upstream, and cache statistics since the server started
+type StatsResponse struct {
+	Uptime    int64                    `json:"uptime"`    // in seconds
+	Endpoints map[string]EndpointStats `json:"endpoints"` // By path, with "other" for unknown paths
+	Upstreams map[string]UpstreamStats `json:"upstreams"` // By host
+	Caches    map[string]CacheStats    `json:"caches"`    // By kind, e.g. geocode or route
+}
+
+// EndpointStats counts the requests to one endpoint
+type EndpointStats struct {
+	Requests     int64   `json:"requests"`
+	Errors       int64   `json:"errors"`       // 4xx and 5xx responses
+	ServerErrors int64   `json:"serverErrors"` // 5xx responses
+	ErrorRate    float64 `json:"errorRate"`    // Errors as a fraction of requests
+	P50          float64 `json:"p50"`          // Median latency in milliseconds, over the last 1000 requests
+	P95          float64 `json:"p95"`          // 95th percentile latency in milliseconds, over the last 1000 requests
+}
+
+// UpstreamStats counts the calls to one upstream host
+type UpstreamStats struct {
+	Calls     int64   `json:"calls"`
+	Errors    int64   `json:"errors"`    // Connection errors and 5xx responses, after retries
+	Rejected  int64   `json:"rejected"`  // Calls failed fast while the circuit breaker was open
+	Throttled int64   `json:"throttled"` // Calls failed after waiting too long under the concurrency or rate limit
+	ErrorRate float64 `json:"errorRate"` // Errors as a fraction of calls
+}
+
+// CacheStats counts the lookups in one kind of cache
+type CacheStats struct {
+	Hits    int64   `json:"hits"`
+	Misses  int64   `json:"misses"`
+	HitRate float64 `json:"hitRate"`           // Hits as a fraction of lookups
+	Entries *int    `json:"entries,omitempty"` // Responses held, omitted for caches in Redis
 }
 
 // ErrorResponse represents an error response
 type ErrorResponse struct {
-	Error string `json:"error"`
+	Error     string `json:"error"`
+	RequestID string `json:"requestId,omitempty"` // Matches the X-Request-ID response header and log lines
 }
@@ -0,0 +1,289 @@
+package nav
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+// DefaultUpstreamTimeout bounds each call to Nominatim, Valhalla, Transitland,
+// what3words, and realtime feeds when upstream_timeout isn't configured
+const DefaultUpstreamTimeout = 10 * time.Second
+
+// Defaults for the shared upstream connection pool
+const (
+	defaultMaxIdleConns        = 100
+	defaultMaxIdleConnsPerHost = 16
+	defaultIdleConnTimeout     = 90 * time.Second
+	defaultTLSHandshakeTimeout = 5 * time.Second
+)
+
+// Defaults for retrying failed upstream calls
+const (
+	DefaultRetryAttempts = 3
+	DefaultRetryBackoff  = 250 * time.Millisecond
+)
+
+// upstreamTransport pools keep-alive connections for all upstream calls,
+// including map tiles. It's only replaced while configMu is held.
+var upstreamTransport = newUpstreamTransport(UpstreamConfig{})
+
+// upstreamClients make calls to upstream services, with the retry settings
+// for one configuration
+type upstreamClients struct {
+	client        *http.Client // Bounded by the upstream timeout, so a hung service fails the request instead of stalling its handler
+	tileClient    *http.Client
+	retryAttempts int           // Tries per call, for connection errors and 5xx responses
+	retryBackoff  time.Duration // Before the first retry, doubling after each
+}
+
+// newUpstreamClients builds the clients for a configuration, with the per-call
+// timeout in seconds or the default for 0
+func newUpstreamClients(timeoutSeconds int, cfg UpstreamConfig, network *http.Transport) *upstreamClients {
+	transport := upstreamRoundTripper(cfg, network)
+	clients := &upstreamClients{
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   orDefaultSeconds(timeoutSeconds, DefaultUpstreamTimeout),
+		},
+		tileClient:    &http.Client{Transport: transport, Timeout: tileFetchTimeout},
+		retryAttempts: orDefault(cfg.RetryAttempts, DefaultRetryAttempts),
+		retryBackoff:  DefaultRetryBackoff,
+	}
+	if cfg.RetryBackoff > 0 {
+		clients.retryBackoff = time.Duration(cfg.RetryBackoff * float64(time.Second))
+	}
+	return clients
+}
+
+// newUpstreamTransport builds the transport for upstream calls from its config
+func newUpstreamTransport(cfg UpstreamConfig) *http.Transport {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12, InsecureSkipVerify: cfg.InsecureSkipVerify}
+	switch cfg.TLSMinVersion {
+	case "", "1.2":
+	case "1.3":
+		tlsConfig.MinVersion = tls.VersionTLS13
+	default:
+		upstreamLog.Warn("Unsupported upstream tls_min_version, using 1.2", "version", cfg.TLSMinVersion)
+	}
+
+	return &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		ForceAttemptHTTP2:   true,
+		TLSClientConfig:     tlsConfig,
+		MaxIdleConns:        orDefault(cfg.MaxIdleConns, defaultMaxIdleConns),
+		MaxIdleConnsPerHost: orDefault(cfg.MaxIdleConnsPerHost, defaultMaxIdleConnsPerHost),
+		MaxConnsPerHost:     cfg.MaxConnsPerHost,
+		IdleConnTimeout:     orDefaultSeconds(cfg.IdleConnTimeout, defaultIdleConnTimeout),
+		TLSHandshakeTimeout: orDefaultSeconds(cfg.TLSHandshakeTimeout, defaultTLSHandshakeTimeout),
+	}
+}
+
+// setUpstreamClient replaces the shared connection pool, returning clients
+// that use it, and resets the circuit breakers and concurrency limits. Calls
+// in flight finish on the old pool. The caller holds configMu.
+func setUpstreamClient(timeoutSeconds int, cfg UpstreamConfig) *upstreamClients {
+	upstreamTransport.CloseIdleConnections()
+	upstreamTransport = newUpstreamTransport(cfg)
+	clients := newUpstreamClients(timeoutSeconds, cfg, upstreamTransport)
+	setBreakers(cfg.BreakerThreshold, cfg.BreakerCooldown)
+	setConcurrencyLimits(cfg.Concurrency, clients.client.Timeout)
+	return clients
+}
+
+// orDefault returns n, or def when n isn't positive
+func orDefault(n, def int) int {
+	if n > 0 {
+		return n
+	}
+	return def
+}
+
+// orDefaultSeconds returns a number of seconds as a duration, or def when it isn't positive
+func orDefaultSeconds(seconds int, def time.Duration) time.Duration {
+	if seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return def
+}
+
+// upstreamDo sends a request to an upstream service through the host's circuit
+// breaker, failing fast with ErrUpstreamUnavailable while it's open, after
+// waiting for a slot under the service's concurrency limit if it has one. The
+// request ID, if any, is passed on in X-Request-ID.
+func upstreamDo(req *http.Request) (*http.Response, error) {
+	if id := requestID(req.Context()); id != "" {
+		req.Header.Set(RequestIDHeader, id)
+	}
+	req, span := startUpstreamSpan(req)
+	defer span.End()
+	host := req.URL.Host
+
+	// The slot is held until the response body is closed, since the upstream
+	// is still working until then
+	limiter := concurrencyLimiterFor(req.Context(), host)
+	if limiter != nil {
+		start := time.Now()
+		ok := limiter.acquire(req.Context())
+		span.SetAttributes(attribute.Int64("queue_wait_ms", time.Since(start).Milliseconds()))
+		if !ok {
+			err := req.Context().Err()
+			if err == nil {
+				upstreamStats(host).throttled.Add(1)
+				upstreamLog.WarnContext(req.Context(), "Upstream concurrency limit full", "host", host)
+				err = &ErrUpstreamUnavailable{Service: upstreamService(req.Context(), host)}
+			}
+			spanError(span, err)
+			return nil, err
+		}
+	}
+
+	breaker := breakerForHost(host)
+	if !breaker.allow() {
+		if limiter != nil {
+			limiter.release()
+		}
+		upstreamStats(host).rejected.Add(1)
+		err := &ErrUpstreamUnavailable{Service: upstreamService(req.Context(), host)}
+		spanError(span, err)
+		return nil, err
+	}
+
+	resp, err := upstreamDoRetry(req)
+	if limiter != nil {
+		if err != nil {
+			limiter.release()
+		} else {
+			resp.Body = &releasingBody{ReadCloser: resp.Body, release: limiter.release}
+		}
+	}
+	if err != nil {
+		spanError(span, err)
+	} else {
+		span.SetAttributes(attribute.Int("http.status_code", resp.StatusCode))
+		if resp.StatusCode >= 500 {
+			span.SetStatus(codes.Error, resp.Status)
+		}
+	}
+	switch {
+	case errors.Is(err, context.Canceled), errors.Is(err, errNotRecorded):
+		breaker.release()
+	case err != nil || resp.StatusCode >= 500:
+		breaker.record(host, false)
+	default:
+		breaker.record(host, true)
+	}
+	return resp, err
+}
+
+// releasingBody is a response body that frees its call's concurrency slot
+// when closed
+type releasingBody struct {
+	io.ReadCloser
+	release func()
+	once    sync.Once
+}
+
+func (b *releasingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
+
+// upstreamDoRetry sends a request to an upstream service, retrying connection
+// errors and 5xx responses with exponential backoff. 4xx responses, timeouts,
+// and canceled requests are returned as they are. Retries of rate-limited
+// calls also wait their turn with the host.
+func upstreamDoRetry(req *http.Request) (*http.Response, error) {
+	clients := stateFor(req.Context()).upstream
+	backoff := clients.retryBackoff
+	for attempt := 1; ; attempt++ {
+		resp, err := clients.client.Do(req)
+		err = redactError(err)
+		if attempt >= clients.retryAttempts || !retryable(resp, err) {
+			return resp, err
+		}
+		if err != nil {
+			upstreamLog.DebugContext(req.Context(), "Upstream request failed, retrying", "host", req.URL.Host, "error", err)
+		} else {
+			upstreamLog.DebugContext(req.Context(), "Upstream request failed, retrying", "host", req.URL.Host, "status", resp.StatusCode)
+			resp.Body.Close()
+		}
+
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if pace, ok := req.Context().Value(retryPacingContextKey{}).(func(context.Context) error); ok {
+			if err := pace(req.Context()); err != nil {
+				return nil, err
+			}
+		}
+
+		// Requests with a body need a fresh copy of it for each try
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+	}
+}
+
+type retryPacingContextKey struct{}
+
+// withRetryPacing returns a context whose upstream calls wait on pace before
+// each retry, so retries keep to a host's rate limit like first tries do
+func withRetryPacing(ctx context.Context, pace func(context.Context) error) context.Context {
+	return context.WithValue(ctx, retryPacingContextKey{}, pace)
+}
+
+// retryable reports whether an upstream call failed in a way worth retrying:
+// a connection error other than a timeout, cancellation, or missing recording,
+// or a 5xx response
+func retryable(resp *http.Response, err error) bool {
+	if err != nil {
+		var netErr net.Error
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, errNotRecorded) ||
+			(errors.As(err, &netErr) && netErr.Timeout()) {
+			return false
+		}
+		return true
+	}
+	return resp.StatusCode >= 500
+}
+
+// upstreamGet makes a GET request to an upstream service, canceled along with ctx
+func upstreamGet(ctx context.Context, apiURL string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, apiURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	return upstreamDo(req)
+}
+
+// upstreamPost makes a POST request to an upstream service, canceled along with ctx
+func upstreamPost(ctx context.Context, apiURL, contentType string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, apiURL, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	return upstreamDo(req)
+}
@@ -0,0 +1,76 @@
+package nav
+
+import (
+	"context"
+	"runtime"
+	"runtime/debug"
+)
+
+// BuildInfo identifies the running build, from values injected at build time
+type BuildInfo struct {
+	Version   string
+	Commit    string
+	BuildDate string
+}
+
+var buildInfo = BuildInfo{Version: "dev"}
+
+// SetBuildInfo records the build's version, filling in the commit and build
+// date from the Go toolchain's VCS stamp when they weren't injected
+func SetBuildInfo(info BuildInfo) {
+	if info.Version == "" {
+		info.Version = "dev"
+	}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range bi.Settings {
+			switch {
+			case setting.Key == "vcs.revision" && info.Commit == "":
+				info.Commit = setting.Value
+			case setting.Key == "vcs.time" && info.BuildDate == "":
+				info.BuildDate = setting.Value
+			}
+		}
+	}
+	buildInfo = info
+}
+
+// versionInfo describes the build and the optional modules the current
+// configuration enables, leaving out those whose endpoints are switched off
+func versionInfo(ctx context.Context) VersionResponse {
+	version := VersionResponse{
+		Version:   buildInfo.Version,
+		Commit:    buildInfo.Commit,
+		BuildDate: buildInfo.BuildDate,
+		GoVersion: runtime.Version(),
+		Routers:   []string{},
+		Features:  []string{},
+	}
+	if mockProviders(ctx) {
+		version.Routers = append(version.Routers, ProvidersMock)
+	} else {
+		for _, router := range valhallaRouters(ctx) {
+			version.Routers = append(version.Routers, routerName(router))
+		}
+	}
+
+	transit := configFor(ctx).ModuleEnabled(ModuleTransit)
+	for _, feature := range []struct {
+		name    string
+		enabled bool
+	}{
+		{"transitland", transit && configFor(ctx).TransitlandURL != ""},
+		{"gtfs", transit && len(configFor(ctx).GTFSFeeds) > 0},
+		{"gtfs-realtime", transit && len(configFor(ctx).GTFSRealtime) > 0},
+		{"what3words", configFor(ctx).What3WordsAPIKey != ""},
+		{"gazetteer", configFor(ctx).ModuleEnabled(ModuleGeocode) && configFor(ctx).GazetteerFile != ""},
+		{"geoip", configFor(ctx).ModuleEnabled(ModuleWhereAmI) && configFor(ctx).GeoIPDatabase != ""},
+		{"parkride", transit && configFor(ctx).ParkRideLots != ""},
+		{"tiles", configFor(ctx).TileURL != "" && endpointDisabled(ctx, "/nav/staticmap") == ""},
+		{"api-keys", authEnabled()},
+	} {
+		if feature.enabled {
+			version.Features = append(version.Features, feature.name)
+		}
+	}
+	return version
+}
@@ -0,0 +1,141 @@
+package nav
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"strings"
+)
+
+// MaxWaypoints is the most points a route is planned through, including the
+// start and end. Longer GPX tracks are sampled down to this many.
+const MaxWaypoints = 20
+
+// waypoint is a point to route through, with an optional name
+type waypoint struct {
+	Lat, Lng float64
+	Name     string
+}
+
+// gpxPoint is a waypoint, route point, or track point in a GPX file
+type gpxPoint struct {
+	Lat  float64 `xml:"lat,attr"`
+	Lon  float64 `xml:"lon,attr"`
+	Name string  `xml:"name"`
+}
+
+// gpxFile holds the parts of a GPX 1.0 or 1.1 file used for routing
+type gpxFile struct {
+	Waypoints []gpxPoint `xml:"wpt"`
+	Routes    []struct {
+		Points []gpxPoint `xml:"rtept"`
+	} `xml:"rte"`
+	Tracks []struct {
+		Segments []struct {
+			Points []gpxPoint `xml:"trkpt"`
+		} `xml:"trkseg"`
+	} `xml:"trk"`
+}
+
+// isGPX sniffs whether a request body is a GPX file rather than plain-text lines
+func isGPX(contentType string, body []byte) bool {
+	if strings.Contains(contentType, "gpx") {
+		return true
+	}
+	return bytes.HasPrefix(bytes.TrimSpace(body), []byte("<"))
+}
+
+// parseGPX reads the points to route through from a GPX file, preferring a
+// planned route, then waypoints, then a recorded track sampled down to
+// MaxWaypoints
+func parseGPX(body []byte) ([]waypoint, error) {
+	var gpx gpxFile
+	if err := xml.Unmarshal(body, &gpx); err != nil {
+		return nil, fmt.Errorf("invalid GPX file: %v", err)
+	}
+
+	var points []gpxPoint
+	for _, rte := range gpx.Routes {
+		points = append(points, rte.Points...)
+	}
+	if len(points) == 0 {
+		points = gpx.Waypoints
+	}
+	if len(points) == 0 {
+		for _, trk := range gpx.Tracks {
+			for _, seg := range trk.Segments {
+				points = append(points, seg.Points...)
+			}
+		}
+		points = sampleWaypoints(points, MaxWaypoints)
+	}
+
+	waypoints := make([]waypoint, len(points))
+	for i, p := range points {
+		waypoints[i] = waypoint{Lat: p.Lat, Lng: p.Lon, Name: strings.TrimSpace(p.Name)}
+	}
+	return waypoints, checkWaypoints(waypoints)
+}
+
+// sampleWaypoints picks at most n evenly spaced points, keeping the first and last
+func sampleWaypoints[T any](points []T, n int) []T {
+	if len(points) <= n {
+		return points
+	}
+	sampled := make([]T, n)
+	for i := range sampled {
+		sampled[i] = points[i*(len(points)-1)/(n-1)]
+	}
+	return sampled
+}
+
+// parseWaypointLines reads a plain-text waypoint list, one location per line in
+// any form parseLocation accepts, followed by key=value option lines
+func parseWaypointLines(ctx context.Context, lines []string) ([]waypoint, []string, error) {
+	var waypoints []waypoint
+	for i, line := range lines {
+		line = strings.TrimSpace(strings.TrimRight(line, "\r"))
+		if strings.Contains(line, "=") {
+			return waypoints, lines[i:], checkWaypoints(waypoints)
+		}
+		if line == "" {
+			continue
+		}
+		lat, lng, err := parseLocation(ctx, line)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid waypoint %q", line)
+		}
+		waypoints = append(waypoints, waypoint{Lat: lat, Lng: lng})
+	}
+	return waypoints, nil, checkWaypoints(waypoints)
+}
+
+// checkWaypoints checks there are enough waypoints for a route and not too many
+func checkWaypoints(waypoints []waypoint) error {
+	if len(waypoints) < 2 {
+		return fmt.Errorf("at least 2 waypoints are required")
+	}
+	if len(waypoints) > MaxWaypoints {
+		return fmt.Errorf("at most %d waypoints are allowed", MaxWaypoints)
+	}
+	return nil
+}
+
+// waypointRequest builds a route request from the first waypoint to the last,
+// through the others in order
+func waypointRequest(waypoints []waypoint) RouteRequest {
+	first, last := waypoints[0], waypoints[len(waypoints)-1]
+	req := RouteRequest{
+		FromLat:  first.Lat,
+		FromLng:  first.Lng,
+		ToLat:    last.Lat,
+		ToLng:    last.Lng,
+		FromDesc: first.Name,
+		ToDesc:   last.Name,
+	}
+	for _, w := range waypoints[1 : len(waypoints)-1] {
+		req.Via = append(req.Via, [2]float64{w.Lat, w.Lng})
+	}
+	return req
+}
@@ -0,0 +1,101 @@
+package nav
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// what3wordsPattern matches a three word address with its /// prefix. Bare
+// words.like.this are left to Nominatim, since they're as likely to be a
+// place name or a typo.
+var what3wordsPattern = regexp.MustCompile(`^///([^\s./\d]+)\.([^\s./\d]+)\.([^\s./\d]+)$`)
+
+type what3wordsResponse struct {
+	Country      string `json:"country"`
+	NearestPlace string `json:"nearestPlace"`
+	Words        string `json:"words"`
+	Coordinates  struct {
+		Lat float64 `json:"lat"`
+		Lng float64 `json:"lng"`
+	} `json:"coordinates"`
+	Error *struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// looksLikeWhat3Words reports whether s is a what3words address such as ///filled.count.soap
+func looksLikeWhat3Words(s string) bool {
+	return what3wordsPattern.MatchString(strings.TrimSpace(s))
+}
+
+// convertWhat3Words resolves a three word address to coordinates using the what3words API
+func convertWhat3Words(ctx context.Context, s string) (*what3wordsResponse, error) {
+	if configFor(ctx).What3WordsURL == "" || configFor(ctx).What3WordsAPIKey == "" {
+		return nil, fmt.Errorf("what3words configuration not complete")
+	}
+
+	words := strings.TrimPrefix(strings.TrimSpace(s), "///")
+	params := url.Values{
+		"words": {strings.ToLower(words)},
+		"key":   {configFor(ctx).What3WordsAPIKey},
+	}
+
+	apiURL := fmt.Sprintf("%s/convert-to-coordinates?%s", configFor(ctx).What3WordsURL, params.Encode())
+
+	resp, err := upstreamGet(ctx, apiURL)
+	if err != nil {
+		return nil, fmt.Errorf("error making request to what3words: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var wResp what3wordsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&wResp); err != nil {
+		return nil, fmt.Errorf("error decoding response: %v", err)
+	}
+
+	if wResp.Error != nil {
+		if wResp.Error.Code == "BadWords" {
+			return nil, &ErrNoResults{Query: s}
+		}
+		return nil, fmt.Errorf("what3words error: %s", wResp.Error.Message)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("what3words API returned status: %d", resp.StatusCode)
+	}
+
+	return &wResp, nil
+}
+
+// resolveWhat3Words converts a three word address to coordinates
+func resolveWhat3Words(ctx context.Context, s string) (float64, float64, error) {
+	wResp, err := convertWhat3Words(ctx, s)
+	if err != nil {
+		return 0, 0, err
+	}
+	return wResp.Coordinates.Lat, wResp.Coordinates.Lng, nil
+}
+
+// geocodeWhat3Words resolves a three word address to a single geocoding result
+func geocodeWhat3Words(ctx context.Context, query string) ([]GeocodeResponse, error) {
+	wResp, err := convertWhat3Words(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	lat, lng := wResp.Coordinates.Lat, wResp.Coordinates.Lng
+	return []GeocodeResponse{{
+		Name:       "///" + wResp.Words,
+		Address:    wResp.NearestPlace,
+		Lat:        lat,
+		Lng:        lng,
+		Importance: 1,
+		Country:    strings.ToLower(wResp.Country),
+		PlusCode:   encodePlusCode(lat, lng),
+	}}, nil
+}
@@ -0,0 +1,106 @@
+package nav
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/oschwald/geoip2-golang"
+)
+
+var (
+	geoipMu   sync.Mutex
+	geoipDB   *geoip2.Reader
+	geoipPath string
+)
+
+// openGeoIPDatabase returns the configured GeoIP database, opening it on first use
+func openGeoIPDatabase() (*geoip2.Reader, error) {
+	geoipMu.Lock()
+	defer geoipMu.Unlock()
+
+	if currentConfig().GeoIPDatabase == "" {
+		return nil, fmt.Errorf("geoip database not configured")
+	}
+
+	// Reuse the open database unless the configured path has changed
+	if geoipDB != nil && geoipPath == currentConfig().GeoIPDatabase {
+		return geoipDB, nil
+	}
+	if geoipDB != nil {
+		geoipDB.Close()
+		geoipDB = nil
+	}
+
+	db, err := geoip2.Open(currentConfig().GeoIPDatabase)
+	if err != nil {
+		return nil, fmt.Errorf("error opening geoip database: %v", err)
+	}
+	geoipDB = db
+	geoipPath = currentConfig().GeoIPDatabase
+
+	return geoipDB, nil
+}
+
+// clientIP returns the caller's IP, preferring the first X-Forwarded-For entry
+// when the server sits behind a proxy
+func clientIP(r *http.Request) string {
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		return strings.TrimSpace(strings.Split(forwarded, ",")[0])
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// ErrInvalidIP is returned when the address to look up isn't an IP address,
+// such as a junk X-Forwarded-For header or a caller on a Unix socket
+type ErrInvalidIP struct {
+	Address string
+}
+
+func (e *ErrInvalidIP) Error() string {
+	return fmt.Sprintf("invalid IP address %q", e.Address)
+}
+
+// whereAmI resolves an IP address to an approximate location using the GeoIP database
+func whereAmI(ipString string) (*WhereAmIResponse, error) {
+	ip := net.ParseIP(ipString)
+	if ip == nil {
+		return nil, &ErrInvalidIP{Address: ipString}
+	}
+
+	db, err := openGeoIPDatabase()
+	if err != nil {
+		return nil, err
+	}
+
+	record, err := db.City(ip)
+	if err != nil {
+		return nil, fmt.Errorf("error looking up IP address: %v", err)
+	}
+
+	// Private and unknown addresses come back as an empty record
+	if record.Location.Latitude == 0 && record.Location.Longitude == 0 {
+		return nil, &ErrNoResults{Query: ipString}
+	}
+
+	var state string
+	if len(record.Subdivisions) > 0 {
+		state = record.Subdivisions[0].IsoCode
+	}
+
+	return &WhereAmIResponse{
+		IP:       ipString,
+		Lat:      record.Location.Latitude,
+		Lng:      record.Location.Longitude,
+		Accuracy: float64(record.Location.AccuracyRadius),
+		City:     record.City.Names["en"],
+		State:    state,
+		Country:  strings.ToLower(record.Country.IsoCode),
+	}, nil
+}
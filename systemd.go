@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// systemdFirstFD is the first file descriptor systemd passes sockets on
+const systemdFirstFD = 3
+
+// lineSocketName is the FileDescriptorName= of activated sockets to serve the
+// line protocol on; other activated sockets serve HTTP
+const lineSocketName = "line"
+
+// systemdListeners returns the sockets systemd passed by socket activation,
+// split into those for HTTP and the line protocol, or none when the server
+// wasn't socket activated. The environment variables are cleared so child
+// processes don't take the sockets too.
+func systemdListeners() (httpListeners, lineListeners []net.Listener, err error) {
+	pid, _ := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	count, _ := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+	if pid != os.Getpid() || count <= 0 {
+		return nil, nil, nil
+	}
+
+	for i := 0; i < count; i++ {
+		fd := systemdFirstFD + i
+		syscall.CloseOnExec(fd)
+		name := fmt.Sprintf("LISTEN_FD_%d", fd)
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+		file := os.NewFile(uintptr(fd), name)
+		listener, err := net.FileListener(file)
+		file.Close()
+		if err != nil {
+			return nil, nil, fmt.Errorf("socket %s from systemd: %v", name, err)
+		}
+		if name == lineSocketName {
+			lineListeners = append(lineListeners, listener)
+		} else {
+			httpListeners = append(httpListeners, listener)
+		}
+	}
+	return httpListeners, lineListeners, nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// TracingConfig sends OpenTelemetry traces of requests and their upstream
+// calls to an OTLP collector
+type TracingConfig struct {
+	Endpoint    string            `toml:"endpoint"`     // OTLP/HTTP collector URL, e.g. "http://localhost:4318"; empty to disable tracing
+	Headers     map[string]string `toml:"headers"`      // Sent with each export, e.g. for a hosted collector's API key
+	ServiceName string            `toml:"service_name"` // Reported as service.name
+	SampleRatio float64           `toml:"sample_ratio"` // Fraction of requests traced, up to 1 for all; a caller's sampling decision is followed
+}
+
+// setupTracing starts exporting traces when an endpoint is configured,
+// returning a function that flushes them on shutdown. Without one, spans are
+// no-ops.
+func setupTracing(cfg TracingConfig) (func(context.Context) error, error) {
+	// Follow traces started by callers, and pass them on to upstream services
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	if cfg.Endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := otlptracehttp.New(context.Background(),
+		otlptracehttp.WithEndpointURL(cfg.Endpoint),
+		otlptracehttp.WithHeaders(cfg.Headers),
+	)
+	if err != nil {
+		return nil, err
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+		sdktrace.WithResource(resource.NewSchemaless(
+			attribute.String("service.name", cfg.ServiceName),
+			attribute.String("service.version", version),
+		)),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+		slog.Warn("Tracing error", "error", err)
+	}))
+	return provider.Shutdown, nil
+}